@@ -1,13 +1,22 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/kubernetes-helm/chartmuseum/pkg/cache"
 	"github.com/kubernetes-helm/chartmuseum/pkg/chartmuseum"
+	"github.com/kubernetes-helm/chartmuseum/pkg/leader"
+	"github.com/kubernetes-helm/chartmuseum/pkg/lock"
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
 	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+	"github.com/kubernetes-helm/chartmuseum/pkg/winsvc"
 
 	"github.com/urfave/cli"
 )
@@ -19,40 +28,129 @@ var (
 
 	newServer = chartmuseum.NewServer
 
+	// uploadLockTTL is how long a shared upload lock is held at most, in case an instance dies mid-upload
+	uploadLockTTL = 5 * time.Minute
+
 	// Version is the semantic version (added at compile time)
 	Version string
 
 	// Revision is the git commit id (added at compile time)
 	Revision string
+
+	// BuildDate is when the binary was built (added at compile time)
+	BuildDate string
 )
 
 func main() {
 	app := cli.NewApp()
 	app.Name = "ChartMuseum"
-	app.Version = fmt.Sprintf("%s (build %s)", Version, Revision)
+	app.Version = fmt.Sprintf("%s (build %s, %s)", Version, Revision, BuildDate)
 	app.Usage = "Helm Chart Repository with support for Amazon S3 and Google Cloud Storage"
 	app.Action = cliHandler
 	app.Flags = cliFlags
+	app.Commands = cliCommands
 	app.Run(os.Args)
 }
 
 func cliHandler(c *cli.Context) {
 	backend := backendFromContext(c)
 
+	routes := chartmuseum.RouteConfig{
+		Index:     true,
+		ChartGet:  true,
+		APIRead:   !c.Bool("disable-api") && !c.Bool("disable-api-get"),
+		APIWrite:  !c.Bool("disable-api"),
+		APIDelete: !c.Bool("disable-api") && !c.Bool("disable-delete"),
+		Admin:     c.Bool("enable-admin"),
+	}
+
 	options := chartmuseum.ServerOptions{
+		BuildInfo:              buildInfo(),
 		Debug:                  c.Bool("debug"),
 		LogJSON:                c.Bool("log-json"),
-		EnableAPI:              !c.Bool("disable-api"),
+		EventLogSource:         eventLogSourceFromContext(c),
+		Routes:                 routes,
 		EnableMetrics:          !c.Bool("disable-metrics"),
+		MetricsBearerToken:     c.String("metrics-bearer-token"),
+		MetricsClientCA:        c.String("metrics-client-ca"),
 		AllowOverwrite:         c.Bool("allow-overwrite"),
+		ReadOnly:               c.Bool("read-only"),
+		EnableGraphQL:          c.Bool("enable-graphql"),
+		EnableWebUI:            c.Bool("web-ui"),
+		GRPCPort:               c.Int("grpc-port"),
+		AdminPort:              c.Int("admin-port"),
+		AdminUsername:          c.String("admin-username"),
+		AdminPassword:          c.String("admin-password"),
+		AdminIdentities:        c.StringSlice("admin-identity"),
+		AuthFailureDelay:       c.Duration("auth-failure-delay"),
+		AuthLockoutFailures:    c.Int("auth-lockout-failures"),
+		AuthLockoutDuration:    c.Duration("auth-lockout-duration"),
+		MaxConcurrentUploads:   c.Int("max-concurrent-uploads"),
+		SpoolThreshold:         c.Int64("spool-threshold"),
+		CompressResponses:      c.Bool("compress-responses"),
+		CompressionLevel:       c.Int("compression-level"),
+		CompressionMinSize:     c.Int("compression-min-size"),
+		ResponseCacheSize:      c.Int("response-cache-size"),
+		AsyncUploads:           c.Bool("async-uploads"),
+		ResumableUploadTTL:     c.Duration("resumable-upload-ttl"),
+		ResumableUploadMaxSize: c.Int64("resumable-upload-max-size"),
+		ResumableUploadDir:     c.String("resumable-upload-dir"),
+		MaintenanceMode:        c.Bool("maintenance-mode"),
+		MaintenanceRetryAfter:  c.Int("maintenance-retry-after"),
 		ChartURL:               c.String("chart-url"),
 		TlsCert:                c.String("tls-cert"),
 		TlsKey:                 c.String("tls-key"),
+		TlsPort:                c.Int("tls-port"),
+		DisableHTTP:            c.Bool("disable-http"),
 		Username:               c.String("basic-auth-user"),
 		Password:               c.String("basic-auth-pass"),
+		BearerToken:            c.String("bearer-token"),
+		HelmPush:               c.Bool("helm-push"),
+		DependencyValidation:   c.String("validate-dependencies"),
+		DependencyRepos:        c.StringSlice("dependency-repo"),
+		RecordUploads:          c.Bool("record-uploads"),
+		GenerateSBOM:           c.Bool("generate-sbom"),
+		CosignKey:              c.String("cosign-key"),
+		CosignRoots:            c.String("cosign-roots"),
+		CosignIdentity:         c.String("cosign-identity"),
+		CosignIssuer:           c.String("cosign-issuer"),
+		RequireCosignSignature: c.Bool("require-cosign-signature"),
+		VerifyWrites:           c.Bool("verify-writes"),
+		MaxUnpackedSize:        c.Int64("max-unpacked-size"),
+		MaxChartFiles:          c.Int("max-chart-files"),
+		SecretScan:             c.String("scan-secrets"),
+		PolicyURL:              c.String("policy-url"),
+		ClamdAddress:           c.String("clamd-address"),
+		NotificationsConfig:    c.String("notifications-config"),
+		ChartOwnersConfig:      c.String("chart-owners"),
+		AccessPolicy:           c.String("access-policy"),
+		TrustedProxies:         c.StringSlice("trusted-proxies"),
+		ClientIPHeaders:        c.StringSlice("client-ip-header"),
+		ForwardedForDepth:      c.Int("forwarded-for-depth"),
+		ProxyProtocol:          c.Bool("proxy-protocol"),
+		EnableH2C:              c.Bool("h2c"),
 		StorageBackend:         backend,
+		CacheStore:             cacheStoreFromContext(c),
+		Locker:                 lockerFromContext(c),
+		LeaderElector:          leaderElectorFromContext(c),
+		ResyncInterval:         c.Duration("resync-interval"),
+		DisableRequestSync:     c.Bool("disable-request-sync"),
+		IndexSharding:          c.Bool("index-sharding"),
+		LibraryCharts:          c.String("library-charts"),
+		IndexMaxAge:            c.Duration("index-max-age"),
+		IndexHidePrereleases:   c.Bool("index-hide-prereleases"),
+		StoreIndex:             c.Bool("store-index"),
+		HealthCheckInterval:    c.Duration("storage-health-check-interval"),
+		MetadataCacheTTL:       c.Duration("storage-metadata-cache-ttl"),
+		BackupBackend:          backupBackendFromContext(c),
+		BackupInterval:         c.Duration("backup-interval"),
+		BackupRetention:        c.Int("backup-retention"),
+		PublishBackend:         publishBackendFromContext(c),
+		PublishCharts:          c.Bool("publish-charts"),
+		PublishInterval:        c.Duration("publish-interval"),
 		ChartPostFormFieldName: c.String("chart-post-form-field-name"),
 		ProvPostFormFieldName:  c.String("prov-post-form-field-name"),
+		DeferIndexBuild:        !c.Bool("gen-index"),
 	}
 
 	server, err := newServer(options)
@@ -65,9 +163,276 @@ func cliHandler(c *cli.Context) {
 		exit(0)
 	}
 
+	isService, err := winsvc.IsWindowsService()
+	if err != nil {
+		crash(err)
+	}
+	if isService {
+		err = winsvc.Run(c.String("windows-service-name"), func() {
+			server.Listen(c.Int("port"))
+		})
+		if err != nil {
+			crash(err)
+		}
+		return
+	}
+
 	server.Listen(c.Int("port"))
 }
 
+// buildInfo returns the version, git commit and build date set at compile time
+func buildInfo() chartmuseum.BuildInfo {
+	return chartmuseum.BuildInfo{
+		Version:   Version,
+		Revision:  Revision,
+		BuildDate: BuildDate,
+	}
+}
+
+func versionCommandHandler(c *cli.Context) {
+	info := buildInfo()
+	echo(fmt.Sprintf("Version: %s\nRevision: %s\nBuild date: %s\n", info.Version, info.Revision, info.BuildDate))
+	exit(0)
+}
+
+func genIndexCommandHandler(c *cli.Context) {
+	backend := backendFromContext(c)
+
+	options := chartmuseum.ServerOptions{
+		Debug:          c.Bool("debug"),
+		LogJSON:        c.Bool("log-json"),
+		ChartURL:       c.String("chart-url"),
+		StorageBackend: backend,
+	}
+
+	server, err := newServer(options)
+	if err != nil {
+		crash(err)
+	}
+
+	raw := server.RepositoryIndex.Raw
+	output := c.String("output")
+	if output == "" || output == "-" {
+		echo(string(raw[:]))
+	} else {
+		err = ioutil.WriteFile(output, raw, 0644)
+		if err != nil {
+			crash(err)
+		}
+	}
+
+	if c.Bool("upload") {
+		err = backend.PutObject(repo.IndexFileName, raw)
+		if err != nil {
+			crash(err)
+		}
+		err = backend.PutObject(repo.IndexGzipFileName, server.RepositoryIndex.RawGzip)
+		if err != nil {
+			crash(err)
+		}
+	}
+}
+
+func checkCommandHandler(c *cli.Context) {
+	backend := backendFromContext(c)
+
+	checks := []struct {
+		name string
+		fn   func() error
+	}{
+		{"storage", func() error {
+			_, err := backend.ListObjects()
+			return err
+		}},
+		{"tls", func() error {
+			return checkTLSFiles(c.String("tls-cert"), c.String("tls-key"))
+		}},
+		{"basic auth", func() error {
+			return checkBothOrNeither(c, "basic-auth-user", "basic-auth-pass")
+		}},
+		{"chart url", func() error {
+			return checkChartURL(c.String("chart-url"))
+		}},
+	}
+
+	failed := false
+	report := []string{}
+	for _, check := range checks {
+		if err := check.fn(); err != nil {
+			failed = true
+			report = append(report, fmt.Sprintf("[FAIL] %s: %s", check.name, err))
+		} else {
+			report = append(report, fmt.Sprintf("[ OK ] %s", check.name))
+		}
+	}
+	echo(strings.Join(report, "\n") + "\n")
+
+	if failed {
+		exit(1)
+	}
+}
+
+func migrateCommandHandler(c *cli.Context) {
+	crashIfContextMissingFlags(c, []string{"to"})
+	backend := backendFromContext(c)
+	to := c.String("to")
+
+	copied, err := storage.MigrateObjects(backend, backendFromURL(to))
+	if err != nil {
+		crash(err)
+	}
+	echo(fmt.Sprintf("Copied %d files to %s\n", copied, to))
+}
+
+func backupCommandHandler(c *cli.Context) {
+	crashIfContextMissingFlags(c, []string{"backup-url"})
+	backend := backendFromContext(c)
+
+	options := chartmuseum.ServerOptions{
+		Debug:           c.Bool("debug"),
+		LogJSON:         c.Bool("log-json"),
+		ChartURL:        c.String("chart-url"),
+		StorageBackend:  backend,
+		BackupBackend:   backupBackendFromContext(c),
+		BackupRetention: c.Int("backup-retention"),
+	}
+
+	server, err := newServer(options)
+	if err != nil {
+		crash(err)
+	}
+
+	manifest, err := server.BackupRepository()
+	if err != nil {
+		crash(err)
+	}
+	echo(fmt.Sprintf("Created backup snapshot %s (%d files) in %s\n", manifest.ID, len(manifest.Objects), c.String("backup-url")))
+}
+
+func restoreCommandHandler(c *cli.Context) {
+	crashIfContextMissingFlags(c, []string{"from"})
+	backend := backendFromContext(c)
+	from := c.String("from")
+
+	var manifest storage.BackupManifest
+	var err error
+	if strings.Contains(from, "://") {
+		backup := backendFromURL(from)
+		snapshot := c.String("snapshot")
+		if snapshot == "" {
+			ids, err := storage.ListBackupSnapshots(backup)
+			if err != nil {
+				crash(err)
+			}
+			if len(ids) == 0 {
+				crash("No backup snapshots found in ", from)
+			}
+			snapshot = ids[len(ids)-1]
+		}
+		manifest, err = storage.RestoreBackupSnapshot(backup, snapshot, backend)
+	} else {
+		var f *os.File
+		f, err = os.Open(from)
+		if err != nil {
+			crash(err)
+		}
+		defer f.Close()
+		manifest, err = storage.RestoreBackupArchive(f, backend)
+	}
+	if err != nil {
+		crash(err)
+	}
+	echo(fmt.Sprintf("Restored %d files from %s\n", len(manifest.Objects), from))
+}
+
+func publishCommandHandler(c *cli.Context) {
+	crashIfContextMissingFlags(c, []string{"publish-url"})
+	backend := backendFromContext(c)
+
+	options := chartmuseum.ServerOptions{
+		Debug:          c.Bool("debug"),
+		LogJSON:        c.Bool("log-json"),
+		ChartURL:       c.String("chart-url"),
+		StorageBackend: backend,
+	}
+
+	server, err := newServer(options)
+	if err != nil {
+		crash(err)
+	}
+	server.PublishBackend = publishBackendFromContext(c)
+	server.PublishCharts = c.Bool("publish-charts")
+
+	result, err := server.PublishRepository()
+	if err != nil {
+		crash(err)
+	}
+	echo(fmt.Sprintf("Published index.yaml to %s (%d charts copied, %d deleted, %d unchanged)\n",
+		c.String("publish-url"), result.Copied, result.Deleted, result.Unchanged))
+}
+
+func checkTLSFiles(certFile string, keyFile string) error {
+	if certFile == "" && keyFile == "" {
+		return nil
+	}
+	if err := checkBothOrNeitherValues("tls-cert", certFile, "tls-key", keyFile); err != nil {
+		return err
+	}
+	_, err := tls.LoadX509KeyPair(certFile, keyFile)
+	return err
+}
+
+func checkChartURL(chartURL string) error {
+	if chartURL == "" {
+		return nil
+	}
+	u, err := url.Parse(chartURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%s is not an absolute url", chartURL)
+	}
+	return nil
+}
+
+func checkBothOrNeither(c *cli.Context, flag1 string, flag2 string) error {
+	return checkBothOrNeitherValues(flag1, c.String(flag1), flag2, c.String(flag2))
+}
+
+func checkBothOrNeitherValues(flag1 string, value1 string, flag2 string, value2 string) error {
+	if (value1 == "") != (value2 == "") {
+		return fmt.Errorf("--%s and --%s must be provided together", flag1, flag2)
+	}
+	return nil
+}
+
+func serviceInstallCommandHandler(c *cli.Context) {
+	name := c.String("windows-service-name")
+	args := append([]string{"serve", "--windows-service-name", name}, c.Args()...)
+	err := winsvc.Install(name, args)
+	if err != nil {
+		crash(err)
+	}
+	echo(fmt.Sprintf("Installed windows service %s\n", name))
+}
+
+func serviceUninstallCommandHandler(c *cli.Context) {
+	name := c.String("windows-service-name")
+	err := winsvc.Uninstall(name)
+	if err != nil {
+		crash(err)
+	}
+	echo(fmt.Sprintf("Uninstalled windows service %s\n", name))
+}
+
+func eventLogSourceFromContext(c *cli.Context) string {
+	if !c.Bool("windows-event-log") {
+		return ""
+	}
+	return c.String("windows-service-name")
+}
+
 func backendFromContext(c *cli.Context) storage.Backend {
 	crashIfContextMissingFlags(c, []string{"storage"})
 
@@ -85,9 +450,97 @@ func backendFromContext(c *cli.Context) storage.Backend {
 		crash("Unsupported storage backend: ", storageFlag)
 	}
 
+	layoutBackend, err := storage.NewLayoutBackend(backend, strings.ToLower(c.String("storage-layout")))
+	if err != nil {
+		crash(err)
+	}
+	layoutBackend.ParallelListing = c.Bool("storage-parallel-listing")
+	backend = storage.Backend(layoutBackend)
+
+	federated := c.StringSlice("storage-federated")
+	if len(federated) > 0 {
+		var secondaries []storage.Backend
+		for _, rawurl := range federated {
+			secondary, err := storage.NewLayoutBackend(backendFromURL(rawurl), storage.LayoutFlat)
+			if err != nil {
+				crash(err)
+			}
+			secondaries = append(secondaries, storage.Backend(secondary))
+		}
+		backend = storage.Backend(storage.NewFederatedBackend(backend, secondaries...))
+	}
+
+	if dualWrite := c.String("storage-dual-write"); dualWrite != "" {
+		secondary, err := storage.NewLayoutBackend(backendFromURL(dualWrite), strings.ToLower(c.String("storage-layout")))
+		if err != nil {
+			crash(err)
+		}
+		backend = storage.Backend(storage.NewDualWriteBackend(backend, secondary))
+	}
+
+	if spec := c.String("storage-faults"); spec != "" {
+		faults, err := storage.ParseFaults(spec)
+		if err != nil {
+			crash(err)
+		}
+		backend = storage.Backend(storage.NewFaultInjectionBackend(backend, faults))
+	}
+
 	return backend
 }
 
+// backendFromURL creates a backend from a url such as local:///charts, s3://bucket/prefix?region=us-east-1
+// or gs://bucket/prefix
+func backendFromURL(rawurl string) storage.Backend {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		crash(err)
+	}
+
+	var backend storage.Backend
+
+	switch u.Scheme {
+	case "local":
+		backend = storage.Backend(storage.NewLocalFilesystemBackend(u.Host + u.Path))
+	case "s3":
+		region := u.Query().Get("region")
+		endpoint := u.Query().Get("endpoint")
+		if endpoint != "" && region == "" {
+			region = "us-east-1"
+		}
+		if roleARN := u.Query().Get("role-arn"); roleARN != "" {
+			backend = storage.Backend(storage.NewAmazonS3BackendWithAssumeRole(u.Host, u.Path, region, endpoint, storage.AmazonS3AssumeRole{
+				RoleARN:    roleARN,
+				ExternalID: u.Query().Get("external-id"),
+			}))
+		} else {
+			backend = storage.Backend(storage.NewAmazonS3Backend(u.Host, u.Path, region, endpoint))
+		}
+	case "gs":
+		backend = storage.Backend(storage.NewGoogleCSBackend(u.Host, u.Path))
+	default:
+		crash("Unsupported storage url: ", rawurl)
+	}
+
+	return backend
+}
+
+func backupBackendFromContext(c *cli.Context) storage.Backend {
+	backupURL := c.String("backup-url")
+	if backupURL == "" {
+		return nil
+	}
+	return backendFromURL(backupURL)
+}
+
+func publishBackendFromContext(c *cli.Context) storage.Backend {
+	publishURL := c.String("publish-url")
+	if publishURL == "" {
+		return nil
+	}
+	return backendFromURL(publishURL)
+}
+
 func localBackendFromContext(c *cli.Context) storage.Backend {
 	crashIfContextMissingFlags(c, []string{"storage-local-rootdir"})
 	return storage.Backend(storage.NewLocalFilesystemBackend(
@@ -101,12 +554,33 @@ func amazonBackendFromContext(c *cli.Context) storage.Backend {
 		c.Set("storage-amazon-region", "us-east-1")
 	}
 	crashIfContextMissingFlags(c, []string{"storage-amazon-bucket", "storage-amazon-region"})
-	return storage.Backend(storage.NewAmazonS3Backend(
+	if c.String("storage-amazon-role-arn") == "" {
+		if c.String("storage-amazon-external-id") != "" || c.String("storage-amazon-web-identity-token-file") != "" {
+			crashIfContextMissingFlags(c, []string{"storage-amazon-role-arn"})
+		}
+		backend := storage.NewAmazonS3Backend(
+			c.String("storage-amazon-bucket"),
+			c.String("storage-amazon-prefix"),
+			c.String("storage-amazon-region"),
+			c.String("storage-amazon-endpoint"),
+		)
+		backend.ChangeQueueURL = c.String("storage-amazon-change-queue")
+		return storage.Backend(backend)
+	}
+	backend := storage.NewAmazonS3BackendWithAssumeRole(
 		c.String("storage-amazon-bucket"),
 		c.String("storage-amazon-prefix"),
 		c.String("storage-amazon-region"),
 		c.String("storage-amazon-endpoint"),
-	))
+		storage.AmazonS3AssumeRole{
+			RoleARN:              c.String("storage-amazon-role-arn"),
+			ExternalID:           c.String("storage-amazon-external-id"),
+			SessionName:          c.String("storage-amazon-role-session-name"),
+			WebIdentityTokenFile: c.String("storage-amazon-web-identity-token-file"),
+		},
+	)
+	backend.ChangeQueueURL = c.String("storage-amazon-change-queue")
+	return storage.Backend(backend)
 }
 
 func googleBackendFromContext(c *cli.Context) storage.Backend {
@@ -117,6 +591,66 @@ func googleBackendFromContext(c *cli.Context) storage.Backend {
 	))
 }
 
+func cacheStoreFromContext(c *cli.Context) cache.Store {
+	var store cache.Store
+
+	cacheFlag := strings.ToLower(c.String("cache"))
+	switch cacheFlag {
+	case "":
+		// no shared cache store
+	case "redis":
+		store = redisCacheStoreFromContext(c)
+	default:
+		crash("Unsupported cache store: ", cacheFlag)
+	}
+
+	return store
+}
+
+func redisCacheStoreFromContext(c *cli.Context) cache.Store {
+	crashIfContextMissingFlags(c, []string{"cache-redis-addr"})
+	return cache.Store(cache.NewRedisStore(
+		c.String("cache-redis-addr"),
+		c.String("cache-redis-password"),
+		c.Int("cache-redis-db"),
+	))
+}
+
+func lockerFromContext(c *cli.Context) lock.Locker {
+	var locker lock.Locker
+
+	// upload locks are shared through the cache store if possible, otherwise the server uses local locks
+	if strings.ToLower(c.String("cache")) == "redis" {
+		locker = lock.Locker(lock.NewRedisLocker(
+			c.String("cache-redis-addr"),
+			c.String("cache-redis-password"),
+			c.Int("cache-redis-db"),
+			uploadLockTTL,
+		))
+	}
+
+	return locker
+}
+
+func leaderElectorFromContext(c *cli.Context) leader.Elector {
+	var elector leader.Elector
+
+	if c.Bool("leader-election") {
+		kubernetesElector, err := leader.NewKubernetesLeaseElector(
+			c.String("leader-election-namespace"),
+			c.String("leader-election-lease-name"),
+			"",
+			c.Duration("leader-election-lease-duration"),
+		)
+		if err != nil {
+			crash(err)
+		}
+		elector = leader.Elector(kubernetesElector)
+	}
+
+	return elector
+}
+
 func crashIfContextMissingFlags(c *cli.Context, flags []string) {
 	missing := []string{}
 	for _, flag := range flags {
@@ -129,57 +663,360 @@ func crashIfContextMissingFlags(c *cli.Context, flags []string) {
 	}
 }
 
-var cliFlags = []cli.Flag{
-	cli.BoolFlag{
+// flagSets concatenates sets of flags, for flags shared between commands
+func flagSets(sets ...[]cli.Flag) []cli.Flag {
+	flags := []cli.Flag{}
+	for _, set := range sets {
+		flags = append(flags, set...)
+	}
+	return flags
+}
+
+var cliCommands = []cli.Command{
+	{
+		Name:   "serve",
+		Usage:  "start the server (the default without a subcommand)",
+		Action: cliHandler,
+		Flags:  cliFlags,
+	},
+	{
+		Name:   "version",
+		Usage:  "print the version, git commit and build date, then exit",
+		Action: versionCommandHandler,
+	},
+	{
 		Name:   "gen-index",
-		Usage:  "generate index.yaml, print to stdout and exit",
-		EnvVar: "GEN_INDEX",
+		Usage:  "generate index.yaml from storage without starting the server",
+		Action: genIndexCommandHandler,
+		Flags:  genIndexFlags,
 	},
-	cli.BoolFlag{
-		Name:   "debug",
-		Usage:  "show debug messages",
-		EnvVar: "DEBUG",
+	{
+		Name:   "check",
+		Usage:  "validate configuration and storage connectivity, then exit",
+		Action: checkCommandHandler,
+		Flags:  cliFlags,
 	},
+	{
+		Name:   "migrate",
+		Usage:  "copy all files missing from another backend to it, then exit",
+		Action: migrateCommandHandler,
+		Flags:  migrateFlags,
+	},
+	{
+		Name:   "backup",
+		Usage:  "take a backup snapshot of all charts and the index, then exit",
+		Action: backupCommandHandler,
+		Flags:  backupCommandFlags,
+	},
+	{
+		Name:  "service",
+		Usage: "install or uninstall chartmuseum as a windows service",
+		Subcommands: []cli.Command{
+			{
+				Name:      "install",
+				Usage:     "install a windows service running the server with the options given after --",
+				ArgsUsage: "-- [server options]",
+				Action:    serviceInstallCommandHandler,
+				Flags:     []cli.Flag{windowsServiceNameFlag},
+			},
+			{
+				Name:   "uninstall",
+				Usage:  "uninstall the windows service",
+				Action: serviceUninstallCommandHandler,
+				Flags:  []cli.Flag{windowsServiceNameFlag},
+			},
+		},
+	},
+	{
+		Name:   "restore",
+		Usage:  "repopulate storage from a backup snapshot or tarball, then exit",
+		Action: restoreCommandHandler,
+		Flags:  restoreFlags,
+	},
+	{
+		Name:   "publish",
+		Usage:  "publish index.yaml (and optionally all charts) for static hosting, then exit",
+		Action: publishCommandHandler,
+		Flags:  publishCommandFlags,
+	},
+}
+
+var cliFlags = flagSets([]cli.Flag{
 	cli.BoolFlag{
-		Name:   "log-json",
-		Usage:  "output structured logs as json",
-		EnvVar: "LOG_JSON",
+		Name:   "gen-index",
+		Usage:  "generate index.yaml, print to stdout and exit",
+		EnvVar: "GEN_INDEX",
 	},
 	cli.BoolFlag{
 		Name:   "disable-metrics",
 		Usage:  "disable Prometheus metrics",
 		EnvVar: "DISABLE_METRICS",
 	},
+	cli.StringFlag{
+		Name:   "metrics-bearer-token",
+		Usage:  "token required in \"Authorization: Bearer\" headers to get /metrics, instead of the main credentials",
+		EnvVar: "METRICS_BEARER_TOKEN",
+	},
+	cli.StringFlag{
+		Name:   "metrics-client-ca",
+		Usage:  "path to PEM CA certificates issuing the client certificates accepted to get /metrics over TLS, instead of the main credentials",
+		EnvVar: "METRICS_CLIENT_CA",
+	},
 	cli.BoolFlag{
 		Name:   "disable-api",
 		Usage:  "disable all routes prefixed with /api",
 		EnvVar: "DISABLE_API",
 	},
+	cli.BoolFlag{
+		Name:   "disable-api-get",
+		Usage:  "disable GET routes prefixed with /api",
+		EnvVar: "DISABLE_API_GET",
+	},
+	cli.BoolFlag{
+		Name:   "disable-delete",
+		Usage:  "disable DELETE route",
+		EnvVar: "DISABLE_DELETE",
+	},
 	cli.BoolFlag{
 		Name:   "allow-overwrite",
 		Usage:  "allow chart versions to be re-uploaded",
 		EnvVar: "ALLOW_OVERWRITE",
 	},
+	cli.StringFlag{
+		Name:   "validate-dependencies",
+		Usage:  "check that dependencies of uploaded charts can be resolved, and \"warn\" or \"reject\" if not",
+		EnvVar: "VALIDATE_DEPENDENCIES",
+	},
+	cli.StringSliceFlag{
+		Name:   "dependency-repo",
+		Usage:  "url of an upstream repository trusted to provide dependencies of uploaded charts (can be repeated)",
+		EnvVar: "DEPENDENCY_REPOS",
+	},
+	cli.StringFlag{
+		Name:   "scan-secrets",
+		Usage:  "scan values and templates of uploaded charts for likely secrets, and \"warn\" or \"reject\" if found",
+		EnvVar: "SCAN_SECRETS",
+	},
+	cli.StringFlag{
+		Name:   "policy-url",
+		Usage:  "url of an OPA policy (data API) deciding whether uploaded charts are accepted",
+		EnvVar: "POLICY_URL",
+	},
+	cli.StringFlag{
+		Name:   "clamd-address",
+		Usage:  "address of clamd to scan uploads for malware (unix:///path/to/clamd.sock or tcp://host:port)",
+		EnvVar: "CLAMD_ADDRESS",
+	},
+	cli.StringFlag{
+		Name:   "chart-owners",
+		Usage:  "yaml file mapping chart name patterns to the only identities allowed to push or delete them",
+		EnvVar: "CHART_OWNERS",
+	},
+	cli.StringFlag{
+		Name:   "access-policy",
+		Usage:  "yaml file granting identities get, push and/or delete on chart name patterns, anything else is denied",
+		EnvVar: "ACCESS_POLICY",
+	},
+	cli.StringFlag{
+		Name:   "notifications-config",
+		Usage:  "yaml file mapping chart name patterns to Slack webhooks or email recipients notified of new versions",
+		EnvVar: "NOTIFICATIONS_CONFIG",
+	},
+	cli.BoolFlag{
+		Name:   "record-uploads",
+		Usage:  "record who uploaded each chart package, from where and when, next to it in storage",
+		EnvVar: "RECORD_UPLOADS",
+	},
+	cli.BoolFlag{
+		Name:   "generate-sbom",
+		Usage:  "generate an SBOM (images, dependencies and files) of each chart package uploaded, and store it next to it",
+		EnvVar: "GENERATE_SBOM",
+	},
+	cli.StringFlag{
+		Name:   "cosign-key",
+		Usage:  "path to a PEM public key to verify cosign signatures of chart packages against",
+		EnvVar: "COSIGN_KEY",
+	},
+	cli.StringFlag{
+		Name:   "cosign-roots",
+		Usage:  "path to PEM root certificates (e.g. Fulcio's) to verify keyless cosign signatures of chart packages against",
+		EnvVar: "COSIGN_ROOTS",
+	},
+	cli.StringFlag{
+		Name:   "cosign-identity",
+		Usage:  "email or URI keyless cosign signatures must be issued to, with --cosign-roots",
+		EnvVar: "COSIGN_IDENTITY",
+	},
+	cli.StringFlag{
+		Name:   "cosign-issuer",
+		Usage:  "OIDC issuer of the identity keyless cosign signatures must be issued to, with --cosign-roots",
+		EnvVar: "COSIGN_ISSUER",
+	},
+	cli.BoolFlag{
+		Name:   "require-cosign-signature",
+		Usage:  "reject chart packages uploaded without a cosign signature which verifies",
+		EnvVar: "REQUIRE_COSIGN_SIGNATURE",
+	},
+	cli.BoolFlag{
+		Name:   "verify-writes",
+		Usage:  "read back each uploaded chart package and provenance file from storage before reporting it as saved",
+		EnvVar: "VERIFY_WRITES",
+	},
+	cli.Int64Flag{
+		Name:   "max-unpacked-size",
+		Usage:  "maximum size in bytes an uploaded chart package may unpack to (0 for no limit)",
+		EnvVar: "MAX_UNPACKED_SIZE",
+	},
+	cli.IntFlag{
+		Name:   "max-chart-files",
+		Usage:  "maximum number of files in an uploaded chart package (0 for no limit)",
+		EnvVar: "MAX_CHART_FILES",
+	},
+	cli.BoolFlag{
+		Name:   "read-only",
+		Usage:  "serve index and charts only, forbidding uploads and deletes",
+		EnvVar: "READ_ONLY",
+	},
+	cli.BoolFlag{
+		Name:   "enable-admin",
+		Usage:  "enable administrative routes prefixed with /admin",
+		EnvVar: "ENABLE_ADMIN",
+	},
+	cli.BoolFlag{
+		Name:   "enable-graphql",
+		Usage:  "enable GraphQL endpoint for querying charts at /graphql",
+		EnvVar: "ENABLE_GRAPHQL",
+	},
+	cli.BoolFlag{
+		Name:   "web-ui",
+		Usage:  "enable web UI for browsing charts at /ui",
+		EnvVar: "WEB_UI",
+	},
+	cli.BoolFlag{
+		Name:   "maintenance-mode",
+		Usage:  "start in maintenance mode (respond 503 on all non-admin routes)",
+		EnvVar: "MAINTENANCE_MODE",
+	},
+	cli.IntFlag{
+		Name:   "maintenance-retry-after",
+		Value:  300,
+		Usage:  "seconds sent in the Retry-After header while in maintenance mode",
+		EnvVar: "MAINTENANCE_RETRY_AFTER",
+	},
 	cli.IntFlag{
 		Name:   "port",
 		Value:  8080,
 		Usage:  "port to listen on",
 		EnvVar: "PORT",
 	},
+	cli.IntFlag{
+		Name:   "grpc-port",
+		Usage:  "port to serve the gRPC API on (disabled if not set)",
+		EnvVar: "GRPC_PORT",
+	},
+	cli.IntFlag{
+		Name:   "admin-port",
+		Usage:  "port to serve administrative routes on, instead of on the main port (requires --admin-username and --admin-password)",
+		EnvVar: "ADMIN_PORT",
+	},
 	cli.StringFlag{
-		Name:   "chart-url",
-		Usage:  "absolute url for .tgzs in index.yaml",
-		EnvVar: "CHART_URL",
+		Name:   "admin-username",
+		Usage:  "username for basic http authentication on the admin port",
+		EnvVar: "ADMIN_USERNAME",
 	},
 	cli.StringFlag{
-		Name:   "basic-auth-user",
-		Usage:  "username for basic http authentication",
-		EnvVar: "BASIC_AUTH_USER",
+		Name:   "admin-password",
+		Usage:  "password for basic http authentication on the admin port (may be a bcrypt hash)",
+		EnvVar: "ADMIN_PASSWORD",
+	},
+	cli.StringSliceFlag{
+		Name:   "admin-identity",
+		Usage:  "identity allowed to use administrative routes on the main port, the basic auth username by default (can be repeated)",
+		EnvVar: "ADMIN_IDENTITIES",
+	},
+	cli.IntFlag{
+		Name:   "max-concurrent-uploads",
+		Usage:  "maximum number of uploads handled at the same time, excess uploads get a 429 (0 for no limit)",
+		EnvVar: "MAX_CONCURRENT_UPLOADS",
+	},
+	cli.Int64Flag{
+		Name:   "spool-threshold",
+		Usage:  "size in bytes above which upload bodies are written to temporary files while received, and checked before being loaded (0 to keep them in memory)",
+		EnvVar: "SPOOL_THRESHOLD",
+	},
+	cli.DurationFlag{
+		Name:   "resumable-upload-ttl",
+		Usage:  "how long a resumable upload is kept without receiving any chunk before it is aborted and its data removed",
+		Value:  time.Hour,
+		EnvVar: "RESUMABLE_UPLOAD_TTL",
+	},
+	cli.Int64Flag{
+		Name:   "resumable-upload-max-size",
+		Usage:  "maximum size in bytes of a resumable upload, larger chunks get a 413",
+		Value:  104857600,
+		EnvVar: "RESUMABLE_UPLOAD_MAX_SIZE",
 	},
 	cli.StringFlag{
-		Name:   "basic-auth-pass",
-		Usage:  "password for basic http authentication",
-		EnvVar: "BASIC_AUTH_PASS",
+		Name:   "resumable-upload-dir",
+		Usage:  "directory of this server's resumable uploads, where files left behind by a previous process are removed as well (defaults to a new temporary directory)",
+		EnvVar: "RESUMABLE_UPLOAD_DIR",
+	},
+	cli.BoolFlag{
+		Name:   "compress-responses",
+		Usage:  "gzip JSON responses for clients accepting it",
+		EnvVar: "COMPRESS_RESPONSES",
+	},
+	cli.IntFlag{
+		Name:   "compression-level",
+		Value:  6,
+		Usage:  "gzip level of compressed responses, from 1 (fastest) to 9 (smallest)",
+		EnvVar: "COMPRESSION_LEVEL",
+	},
+	cli.IntFlag{
+		Name:   "compression-min-size",
+		Value:  1024,
+		Usage:  "size in bytes below which JSON responses are not compressed",
+		EnvVar: "COMPRESSION_MIN_SIZE",
+	},
+	cli.IntFlag{
+		Name:   "response-cache-size",
+		Usage:  "number of computed API responses (listings, search results, metadata read from packages) to keep cached (0 to disable)",
+		EnvVar: "RESPONSE_CACHE_SIZE",
+	},
+	cli.BoolFlag{
+		Name:   "async-uploads",
+		Usage:  "accept chart package uploads with 202 and process them in the background",
+		EnvVar: "ASYNC_UPLOADS",
+	},
+	cli.BoolFlag{
+		Name:   "helm-push",
+		Usage:  "enable compatibility with the helm-push plugin (version endpoint, ?force overwrites, chart/prov form fields)",
+		EnvVar: "HELM_PUSH",
+	},
+	cli.StringSliceFlag{
+		Name:   "trusted-proxies",
+		Usage:  "cidr or ip of a proxy allowed to set X-Forwarded-For and X-Real-Ip, e.g. 10.0.0.0/8 (can be repeated)",
+		EnvVar: "TRUSTED_PROXIES",
+	},
+	cli.StringSliceFlag{
+		Name:   "client-ip-header",
+		Usage:  "header to take the client address from, e.g. CF-Connecting-IP (can be repeated, tried in order, default X-Forwarded-For then X-Real-Ip, requires --trusted-proxies)",
+		EnvVar: "CLIENT_IP_HEADER",
+	},
+	cli.IntFlag{
+		Name:   "forwarded-for-depth",
+		Usage:  "number of proxies appending to X-Forwarded-For in front of chartmuseum, the client address is the one added by the outermost (requires --trusted-proxies)",
+		EnvVar: "FORWARDED_FOR_DEPTH",
+	},
+	cli.BoolFlag{
+		Name:   "proxy-protocol",
+		Usage:  "expect a PROXY protocol (v1 or v2) header on every connection, as sent by tcp load balancers",
+		EnvVar: "PROXY_PROTOCOL",
+	},
+	cli.BoolFlag{
+		Name:   "h2c",
+		Usage:  "also accept HTTP/2 without TLS (h2c), e.g. from a proxy terminating TLS",
+		EnvVar: "H2C",
 	},
 	cli.StringFlag{
 		Name:   "tls-cert",
@@ -191,11 +1028,252 @@ var cliFlags = []cli.Flag{
 		Usage:  "path to tls key file",
 		EnvVar: "TLS_KEY",
 	},
+	cli.IntFlag{
+		Name:   "tls-port",
+		Usage:  "port to serve HTTPS on, alongside plain HTTP on --port (requires --tls-cert and --tls-key)",
+		EnvVar: "TLS_PORT",
+	},
+	cli.BoolFlag{
+		Name:   "disable-http",
+		Usage:  "do not serve plain HTTP on --port, only HTTPS on --tls-port",
+		EnvVar: "DISABLE_HTTP",
+	},
+	cli.StringFlag{
+		Name:   "cache",
+		Usage:  "shared cache store for multiple instances, can be one of: redis",
+		EnvVar: "CACHE",
+	},
+	cli.StringFlag{
+		Name:   "cache-redis-addr",
+		Usage:  "address of redis server (host:port) for redis cache store",
+		EnvVar: "CACHE_REDIS_ADDR",
+	},
+	cli.StringFlag{
+		Name:   "cache-redis-password",
+		Usage:  "password for --cache-redis-addr",
+		EnvVar: "CACHE_REDIS_PASSWORD",
+	},
+	cli.IntFlag{
+		Name:   "cache-redis-db",
+		Value:  0,
+		Usage:  "redis database to use for --cache-redis-addr",
+		EnvVar: "CACHE_REDIS_DB",
+	},
+	cli.DurationFlag{
+		Name:   "resync-interval",
+		Usage:  "how often to resync the index with storage in the background (e.g. 5m), disabled if 0",
+		EnvVar: "RESYNC_INTERVAL",
+	},
+	cli.BoolFlag{
+		Name:   "disable-request-sync",
+		Usage:  "do not list storage to sync the index on each request, rely on uploads, deletes and --resync-interval",
+		EnvVar: "DISABLE_REQUEST_SYNC",
+	},
+	cli.BoolFlag{
+		Name:   "index-sharding",
+		Usage:  "generate index.yaml in shards by chart name prefix, only regenerating changed shards",
+		EnvVar: "INDEX_SHARDING",
+	},
+	cli.StringFlag{
+		Name:   "library-charts",
+		Value:  "include",
+		Usage:  "how library charts are listed: include (in index.yaml), exclude (API only) or separate (in /library/index.yaml)",
+		EnvVar: "LIBRARY_CHARTS",
+	},
+	cli.DurationFlag{
+		Name:   "index-max-age",
+		Usage:  "leave chart versions created longer ago than this out of index.yaml, except the newest version of each chart (e.g. 2160h)",
+		EnvVar: "INDEX_MAX_AGE",
+	},
+	cli.BoolFlag{
+		Name:   "index-hide-prereleases",
+		Usage:  "leave prerelease chart versions out of index.yaml",
+		EnvVar: "INDEX_HIDE_PRERELEASES",
+	},
+	cli.BoolFlag{
+		Name:   "store-index",
+		Usage:  "write index.yaml and index.yaml.gz to the root of the storage backend whenever the index changes",
+		EnvVar: "STORE_INDEX",
+	},
+	cli.DurationFlag{
+		Name:   "storage-health-check-interval",
+		Value:  30 * time.Second,
+		Usage:  "how often to check that storage is reachable, for /ready (e.g. 30s), disabled if 0",
+		EnvVar: "STORAGE_HEALTH_CHECK_INTERVAL",
+	},
+	cli.DurationFlag{
+		Name:   "storage-metadata-cache-ttl",
+		Usage:  "list storage at most this often when syncing the index (e.g. 30s), uploads and deletes through the API are always picked up",
+		EnvVar: "STORAGE_METADATA_CACHE_TTL",
+	},
+	cli.DurationFlag{
+		Name:   "backup-interval",
+		Usage:  "how often to snapshot all charts to the backup backend (e.g. 24h), disabled if 0",
+		EnvVar: "BACKUP_INTERVAL",
+	},
+	cli.StringFlag{
+		Name:   "publish-url",
+		Usage:  "url of a backend to publish index.yaml to for static hosting, e.g. s3://bucket/prefix?region=us-east-1",
+		EnvVar: "PUBLISH_URL",
+	},
+	cli.BoolFlag{
+		Name:   "publish-charts",
+		Usage:  "also publish all chart packages and provenance files to --publish-url",
+		EnvVar: "PUBLISH_CHARTS",
+	},
+	cli.DurationFlag{
+		Name:   "publish-interval",
+		Usage:  "how often to publish to --publish-url (e.g. 10m), on every index change if 0",
+		EnvVar: "PUBLISH_INTERVAL",
+	},
+	cli.BoolFlag{
+		Name:   "leader-election",
+		Usage:  "only run background jobs on the instance holding a kubernetes lease",
+		EnvVar: "LEADER_ELECTION",
+	},
+	cli.StringFlag{
+		Name:   "leader-election-namespace",
+		Usage:  "namespace of the lease for --leader-election (defaults to the pod's namespace)",
+		EnvVar: "LEADER_ELECTION_NAMESPACE",
+	},
+	cli.StringFlag{
+		Name:   "leader-election-lease-name",
+		Value:  "chartmuseum",
+		Usage:  "name of the lease for --leader-election",
+		EnvVar: "LEADER_ELECTION_LEASE_NAME",
+	},
+	cli.DurationFlag{
+		Name:   "leader-election-lease-duration",
+		Value:  15 * time.Second,
+		Usage:  "duration of the lease for --leader-election",
+		EnvVar: "LEADER_ELECTION_LEASE_DURATION",
+	},
+	cli.StringFlag{
+		Name:   "chart-post-form-field-name",
+		Value:  "chart",
+		Usage:  "form field which will be queried for the chart file content",
+		EnvVar: "CHART_POST_FORM_FIELD_NAME",
+	},
+	cli.StringFlag{
+		Name:   "prov-post-form-field-name",
+		Value:  "prov",
+		Usage:  "form field which will be queried for the provenance file content",
+		EnvVar: "PROV_POST_FORM_FIELD_NAME",
+	},
+	cli.BoolFlag{
+		Name:   "windows-event-log",
+		Usage:  "also write logs to the windows event log, as the source named by --windows-service-name",
+		EnvVar: "WINDOWS_EVENT_LOG",
+	},
+	windowsServiceNameFlag,
+}, logFlags, []cli.Flag{chartURLFlag}, authFlags, backupFlags, storageFlags)
+
+var logFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:   "debug",
+		Usage:  "show debug messages",
+		EnvVar: "DEBUG",
+	},
+	cli.BoolFlag{
+		Name:   "log-json",
+		Usage:  "output structured logs as json",
+		EnvVar: "LOG_JSON",
+	},
+}
+
+var chartURLFlag = cli.StringFlag{
+	Name:   "chart-url",
+	Usage:  "absolute url for .tgzs in index.yaml",
+	EnvVar: "CHART_URL",
+}
+
+var windowsServiceNameFlag = cli.StringFlag{
+	Name:   "windows-service-name",
+	Value:  winsvc.DefaultName,
+	Usage:  "name of the windows service, and event log source of its logs",
+	EnvVar: "WINDOWS_SERVICE_NAME",
+}
+
+var authFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "basic-auth-user",
+		Usage:  "username for basic http authentication",
+		EnvVar: "BASIC_AUTH_USER",
+	},
+	cli.StringFlag{
+		Name:   "basic-auth-pass",
+		Usage:  "password for basic http authentication, or its bcrypt hash",
+		EnvVar: "BASIC_AUTH_PASS",
+	},
+	cli.StringFlag{
+		Name:   "bearer-token",
+		Usage:  "token accepted in \"Authorization: Bearer\" headers, e.g. from helm push --access-token",
+		EnvVar: "BEARER_TOKEN",
+	},
+	cli.DurationFlag{
+		Name:   "auth-failure-delay",
+		Usage:  "delay requests from a client by this long (e.g. 1s), doubling with each further authentication failure",
+		EnvVar: "AUTH_FAILURE_DELAY",
+	},
+	cli.IntFlag{
+		Name:   "auth-lockout-failures",
+		Usage:  "lock out a client after this many consecutive authentication failures (disabled if 0)",
+		EnvVar: "AUTH_LOCKOUT_FAILURES",
+	},
+	cli.DurationFlag{
+		Name:   "auth-lockout-duration",
+		Value:  15 * time.Minute,
+		Usage:  "how long clients are locked out for, and how long authentication failures are remembered",
+		EnvVar: "AUTH_LOCKOUT_DURATION",
+	},
+}
+
+var backupFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "backup-url",
+		Usage:  "url of a backend to store backup snapshots in, e.g. s3://bucket/prefix?region=us-east-1",
+		EnvVar: "BACKUP_URL",
+	},
+	cli.IntFlag{
+		Name:   "backup-retention",
+		Value:  7,
+		Usage:  "number of backup snapshots to keep, all if 0",
+		EnvVar: "BACKUP_RETENTION",
+	},
+}
+
+var storageFlags = []cli.Flag{
 	cli.StringFlag{
 		Name:   "storage",
 		Usage:  "storage backend, can be one of: local, amazon, google",
 		EnvVar: "STORAGE",
 	},
+	cli.StringSliceFlag{
+		Name:   "storage-federated",
+		Usage:  "url of an additional read-only backend to serve charts from, e.g. s3://bucket/prefix?region=us-east-1 (can be repeated)",
+		EnvVar: "STORAGE_FEDERATED",
+	},
+	cli.StringFlag{
+		Name:   "storage-dual-write",
+		Usage:  "url of a backend to also write uploads and deletes to, e.g. gs://bucket/prefix (for migrating storage)",
+		EnvVar: "STORAGE_DUAL_WRITE",
+	},
+	cli.StringFlag{
+		Name:   "storage-faults",
+		Usage:  "for testing only: inject latencies and errors into storage operations, e.g. get=200ms,put=100ms:0.1",
+		EnvVar: "STORAGE_FAULTS",
+	},
+	cli.StringFlag{
+		Name:   "storage-layout",
+		Value:  storage.LayoutFlat,
+		Usage:  "key layout for new uploads, can be one of: flat, name-version, hashed",
+		EnvVar: "STORAGE_LAYOUT",
+	},
+	cli.BoolFlag{
+		Name:   "storage-parallel-listing",
+		Usage:  "with the hashed storage layout, list amazon and google buckets in 16 concurrent ranges",
+		EnvVar: "STORAGE_PARALLEL_LISTING",
+	},
 	cli.StringFlag{
 		Name:   "storage-local-rootdir",
 		Usage:  "directory to store charts for local storage backend",
@@ -221,6 +1299,31 @@ var cliFlags = []cli.Flag{
 		Usage:  "alternative s3 endpoint",
 		EnvVar: "STORAGE_AMAZON_ENDPOINT",
 	},
+	cli.StringFlag{
+		Name:   "storage-amazon-role-arn",
+		Usage:  "arn of an iam role to assume for accessing --storage-amazon-bucket",
+		EnvVar: "STORAGE_AMAZON_ROLE_ARN",
+	},
+	cli.StringFlag{
+		Name:   "storage-amazon-external-id",
+		Usage:  "external id to pass when assuming --storage-amazon-role-arn",
+		EnvVar: "STORAGE_AMAZON_EXTERNAL_ID",
+	},
+	cli.StringFlag{
+		Name:   "storage-amazon-role-session-name",
+		Usage:  "session name to use when assuming --storage-amazon-role-arn (default chartmuseum)",
+		EnvVar: "STORAGE_AMAZON_ROLE_SESSION_NAME",
+	},
+	cli.StringFlag{
+		Name:   "storage-amazon-web-identity-token-file",
+		Usage:  "file containing a web identity token to assume --storage-amazon-role-arn with",
+		EnvVar: "STORAGE_AMAZON_WEB_IDENTITY_TOKEN_FILE",
+	},
+	cli.StringFlag{
+		Name:   "storage-amazon-change-queue",
+		Usage:  "url of an SQS queue receiving the event notifications of the bucket, to sync changes only",
+		EnvVar: "STORAGE_AMAZON_CHANGE_QUEUE",
+	},
 	cli.StringFlag{
 		Name:   "storage-google-bucket",
 		Usage:  "gcs bucket to store charts for google storage backend",
@@ -231,16 +1334,54 @@ var cliFlags = []cli.Flag{
 		Usage:  "prefix to store charts for --storage-google-bucket",
 		EnvVar: "STORAGE_GOOGLE_PREFIX",
 	},
+}
+
+var migrateFlags = flagSets([]cli.Flag{
 	cli.StringFlag{
-		Name:   "chart-post-form-field-name",
-		Value:  "chart",
-		Usage:  "form field which will be queried for the chart file content",
-		EnvVar: "CHART_POST_FORM_FIELD_NAME",
+		Name:   "to",
+		Usage:  "url of the backend to copy files to, e.g. gs://bucket/prefix",
+		EnvVar: "MIGRATE_TO",
 	},
+}, storageFlags)
+
+var backupCommandFlags = flagSets(backupFlags, logFlags, []cli.Flag{chartURLFlag}, storageFlags)
+
+var restoreFlags = flagSets([]cli.Flag{
 	cli.StringFlag{
-		Name:   "prov-post-form-field-name",
-		Value:  "prov",
-		Usage:  "form field which will be queried for the provenance file content",
-		EnvVar: "PROV_POST_FORM_FIELD_NAME",
+		Name:   "from",
+		Usage:  "backup location, either a backup url (e.g. s3://bucket/prefix?region=us-east-1) or a .tar.gz file",
+		EnvVar: "RESTORE_FROM",
 	},
-}
+	cli.StringFlag{
+		Name:   "snapshot",
+		Usage:  "id of the backup snapshot to restore (defaults to the latest)",
+		EnvVar: "RESTORE_SNAPSHOT",
+	},
+}, storageFlags)
+
+var publishCommandFlags = flagSets([]cli.Flag{
+	cli.StringFlag{
+		Name:   "publish-url",
+		Usage:  "url of a backend to publish index.yaml to for static hosting, e.g. s3://bucket/prefix?region=us-east-1",
+		EnvVar: "PUBLISH_URL",
+	},
+	cli.BoolFlag{
+		Name:   "publish-charts",
+		Usage:  "also publish all chart packages and provenance files to --publish-url",
+		EnvVar: "PUBLISH_CHARTS",
+	},
+}, logFlags, []cli.Flag{chartURLFlag}, storageFlags)
+
+var genIndexFlags = flagSets([]cli.Flag{
+	cli.StringFlag{
+		Name:   "output, o",
+		Value:  "-",
+		Usage:  "file to write index.yaml to (\"-\" for stdout)",
+		EnvVar: "GEN_INDEX_OUTPUT",
+	},
+	cli.BoolFlag{
+		Name:   "upload",
+		Usage:  "also write index.yaml and index.yaml.gz to the root of the storage backend",
+		EnvVar: "GEN_INDEX_UPLOAD",
+	},
+}, logFlags, []cli.Flag{chartURLFlag}, storageFlags)
@@ -7,7 +7,9 @@ import (
 	"testing"
 
 	"github.com/kubernetes-helm/chartmuseum/pkg/chartmuseum"
+	"github.com/kubernetes-helm/chartmuseum/pkg/leader"
 	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/winsvc"
 
 	"github.com/stretchr/testify/suite"
 )
@@ -59,10 +61,68 @@ func (suite *MainTestSuite) TestMain() {
 	suite.Panics(main, "amazon storage, alt endpoint")
 	suite.Equal("graceful crash", suite.LastCrashMessage, "no error with amazon backend, alt endpoint")
 
+	os.Args = []string{"chartmuseum", "--storage", "amazon", "--storage-amazon-bucket", "x", "--storage-amazon-region", "x",
+		"--storage-amazon-role-arn", "arn:aws:iam::123456789012:role/x", "--storage-amazon-external-id", "x"}
+	suite.Panics(main, "amazon storage, assume role")
+	suite.Equal("graceful crash", suite.LastCrashMessage, "no error with amazon backend, assume role")
+
+	os.Args = []string{"chartmuseum", "--storage", "amazon", "--storage-amazon-bucket", "x", "--storage-amazon-region", "x",
+		"--storage-amazon-web-identity-token-file", "/var/run/secrets/token"}
+	suite.Panics(main, "amazon storage, web identity without role")
+	suite.Equal("Missing required flags(s): --storage-amazon-role-arn", suite.LastCrashMessage, "crashes with web identity token but no role")
+
 	os.Args = []string{"chartmuseum", "--storage", "google", "--storage-google-bucket", "x"}
 	suite.Panics(main, "google storage")
 	suite.Equal("graceful crash", suite.LastCrashMessage, "no error with google backend")
 
+	os.Args = []string{"chartmuseum", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage", "--storage-layout", "garage"}
+	suite.Panics(main, "bad storage layout")
+	suite.Equal("unsupported storage layout: garage", suite.LastCrashMessage, "crashes with bad storage layout")
+
+	os.Args = []string{"chartmuseum", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage", "--storage-layout", "hashed"}
+	suite.Panics(main, "hashed storage layout")
+	suite.Equal("graceful crash", suite.LastCrashMessage, "no error with hashed storage layout")
+
+	os.Args = []string{"chartmuseum", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage",
+		"--storage-federated", "local://../../.chartstorage-legacy", "--storage-federated", "gs://x/prefix"}
+	suite.Panics(main, "federated storage")
+	suite.Equal("graceful crash", suite.LastCrashMessage, "no error with federated storage")
+
+	os.Args = []string{"chartmuseum", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage", "--storage-federated", "ftp://x"}
+	suite.Panics(main, "bad federated storage url")
+	suite.Equal("Unsupported storage url: ftp://x", suite.LastCrashMessage, "crashes with bad federated storage url")
+
+	os.Args = []string{"chartmuseum", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage", "--storage-dual-write", "local://../../.chartstorage-new"}
+	suite.Panics(main, "dual-write storage")
+	suite.Equal("graceful crash", suite.LastCrashMessage, "no error with dual-write storage")
+
+	os.Args = []string{"chartmuseum", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage", "--storage-dual-write", "ftp://x"}
+	suite.Panics(main, "bad dual-write storage url")
+	suite.Equal("Unsupported storage url: ftp://x", suite.LastCrashMessage, "crashes with bad dual-write storage url")
+
+	os.Args = []string{"chartmuseum", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage", "--backup-url", "local://../../.chartstorage-backup", "--backup-interval", "24h"}
+	suite.Panics(main, "backups")
+	suite.Equal("graceful crash", suite.LastCrashMessage, "no error with backups")
+
+	os.Args = []string{"chartmuseum", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage", "--cache", "garage"}
+	suite.Panics(main, "bad cache")
+	suite.Equal("Unsupported cache store: garage", suite.LastCrashMessage, "crashes with bad cache")
+
+	os.Args = []string{"chartmuseum", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage", "--cache", "redis"}
+	suite.Panics(main, "redis cache, no addr")
+	suite.Equal("Missing required flags(s): --cache-redis-addr", suite.LastCrashMessage, "crashes with redis cache, no addr")
+
+	os.Args = []string{"chartmuseum", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage",
+		"--cache", "redis", "--cache-redis-addr", "localhost:6379"}
+	suite.Panics(main, "redis cache")
+	suite.Equal("graceful crash", suite.LastCrashMessage, "no error with redis cache")
+
+	os.Args = []string{"chartmuseum", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage", "--leader-election"}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		suite.Panics(main, "leader election outside of cluster")
+		suite.Equal(leader.ErrorNotInCluster.Error(), suite.LastCrashMessage, "crashes with leader election outside of cluster")
+	}
+
 	// test the --gen-index option
 	newServer = func(options chartmuseum.ServerOptions) (*chartmuseum.Server, error) {
 		s := &chartmuseum.Server{}
@@ -75,6 +135,102 @@ func (suite *MainTestSuite) TestMain() {
 	suite.Equal("exited 0", suite.LastCrashMessage, "no error with --gen-index")
 	suite.Equal(0, suite.LastExitCode, "--gen-index flag exits 0")
 	suite.Contains(suite.LastPrinted, "apiVersion:", "--gen-index prints yaml")
+
+	// test the gen-index command
+	suite.LastPrinted = ""
+	os.Args = []string{"chartmuseum", "gen-index", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage"}
+	suite.NotPanics(main, "gen-index command")
+	suite.Contains(suite.LastPrinted, "apiVersion:", "gen-index command prints yaml")
+
+	os.Args = []string{"chartmuseum", "gen-index"}
+	suite.Panics(main, "gen-index command, no storage")
+	suite.Equal("Missing required flags(s): --storage", suite.LastCrashMessage, "gen-index crashes with no storage")
+
+	// test the version command
+	Version, Revision, BuildDate = "0.2.4", "abc1234", "2018-01-02T03:04:05Z"
+	os.Args = []string{"chartmuseum", "version"}
+	suite.Panics(main, "version command exits")
+	suite.Equal(0, suite.LastExitCode, "version command exits 0")
+	suite.Equal("Version: 0.2.4\nRevision: abc1234\nBuild date: 2018-01-02T03:04:05Z\n", suite.LastPrinted, "version command prints build info")
+	Version, Revision, BuildDate = "", "", ""
+
+	// test the check command
+	os.Args = []string{"chartmuseum", "check", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage"}
+	suite.NotPanics(main, "check command")
+	suite.Contains(suite.LastPrinted, "[ OK ] storage", "check command reports storage ok")
+
+	os.Args = []string{"chartmuseum", "check", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage",
+		"--tls-cert", "cant-possibly-exist.crt"}
+	suite.Panics(main, "check command, bad tls")
+	suite.Equal(1, suite.LastExitCode, "check command exits 1 on failure")
+	suite.Contains(suite.LastPrinted, "[FAIL] tls", "check command reports tls failure")
+
+	os.Args = []string{"chartmuseum", "check", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage",
+		"--basic-auth-user", "user"}
+	suite.Panics(main, "check command, partial basic auth")
+	suite.Contains(suite.LastPrinted, "[FAIL] basic auth", "check command reports basic auth failure")
+
+	// test the restore command
+	os.Args = []string{"chartmuseum", "restore", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage"}
+	suite.Panics(main, "restore command, no backup location")
+	suite.Equal("Missing required flags(s): --from", suite.LastCrashMessage, "restore crashes with no backup location")
+
+	os.Args = []string{"chartmuseum", "restore", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage",
+		"--from", "local://../../.chartstorage-emptybackup"}
+	suite.Panics(main, "restore command, no snapshots")
+	suite.Equal("No backup snapshots found in local://../../.chartstorage-emptybackup", suite.LastCrashMessage, "restore crashes with no snapshots")
+
+	os.Args = []string{"chartmuseum", "restore", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage",
+		"--from", "cant-possibly-exist.tgz"}
+	suite.Panics(main, "restore command, missing tarball")
+	suite.Contains(suite.LastCrashMessage, "no such file or directory", "restore crashes with missing tarball")
+
+	// test the publish command
+	os.Args = []string{"chartmuseum", "publish", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage"}
+	suite.Panics(main, "publish command, no publish url")
+	suite.Equal("Missing required flags(s): --publish-url", suite.LastCrashMessage, "publish crashes with no publish url")
+
+	// test the serve command
+	os.Args = []string{"chartmuseum", "serve"}
+	suite.Panics(main, "serve command, no storage")
+	suite.Equal("Missing required flags(s): --storage", suite.LastCrashMessage, "serve crashes with no storage")
+
+	os.Args = []string{"chartmuseum", "serve", "--gen-index", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage",
+		"--basic-auth-user", "user", "--basic-auth-pass", "pass"}
+	suite.Panics(main, "serve command exits with --gen-index")
+	suite.Equal(0, suite.LastExitCode, "serve command accepts the server flags")
+
+	// test the migrate command
+	os.Args = []string{"chartmuseum", "migrate", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage"}
+	suite.Panics(main, "migrate command, no target")
+	suite.Equal("Missing required flags(s): --to", suite.LastCrashMessage, "migrate crashes with no target")
+
+	defer os.RemoveAll("../../.chartstorage-migrated")
+	os.Args = []string{"chartmuseum", "migrate", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage",
+		"--to", "local://../../.chartstorage-migrated"}
+	suite.NotPanics(main, "migrate command")
+	suite.Contains(suite.LastPrinted, "files to local://../../.chartstorage-migrated", "migrate command reports files copied")
+
+	// test the service command (windows only)
+	os.Args = []string{"chartmuseum", "service", "install", "--", "--storage", "local"}
+	suite.Panics(main, "service install command")
+	suite.Equal(winsvc.ErrNotSupported.Error(), suite.LastCrashMessage, "service install crashes outside of windows")
+
+	os.Args = []string{"chartmuseum", "service", "uninstall"}
+	suite.Panics(main, "service uninstall command")
+	suite.Equal(winsvc.ErrNotSupported.Error(), suite.LastCrashMessage, "service uninstall crashes outside of windows")
+
+	// test the backup command
+	os.Args = []string{"chartmuseum", "backup", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage"}
+	suite.Panics(main, "backup command, no backup url")
+	suite.Equal("Missing required flags(s): --backup-url", suite.LastCrashMessage, "backup crashes with no backup url")
+
+	newServer = chartmuseum.NewServer
+	defer os.RemoveAll("../../.chartstorage-backup")
+	os.Args = []string{"chartmuseum", "backup", "--storage", "local", "--storage-local-rootdir", "../../.chartstorage",
+		"--backup-url", "local://../../.chartstorage-backup"}
+	suite.NotPanics(main, "backup command")
+	suite.Contains(suite.LastPrinted, "Created backup snapshot", "backup command reports snapshot")
 }
 
 func TestMainTestSuite(t *testing.T) {
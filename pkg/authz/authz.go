@@ -0,0 +1,25 @@
+package authz
+
+const (
+	// ActionGet covers reading charts: the index, the chart API, downloads, rendering, etc.
+	ActionGet = "get"
+
+	// ActionPush covers uploading chart packages and provenance files
+	ActionPush = "push"
+
+	// ActionDelete covers deleting chart versions
+	ActionDelete = "delete"
+)
+
+type (
+	// Authorizer decides whether an identity may perform an action on a resource. Applications
+	// embedding ChartMuseum can supply their own, e.g. backed by their own permission system.
+	Authorizer interface {
+		// Authorize returns whether identity (the basic auth username, "bearer" for the bearer
+		// token or "anonymous") may perform action (ActionGet, ActionPush or ActionDelete) on
+		// the chart called resource. Requests which are not about one chart (the index, listings)
+		// ask with resource "" whether identity may perform action on some charts; what they
+		// return is then filtered by asking chart by chart.
+		Authorize(identity string, action string, resource string) (bool, error)
+	}
+)
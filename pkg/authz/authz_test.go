@@ -0,0 +1,85 @@
+package authz
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AuthzTestSuite struct {
+	suite.Suite
+	TempDirectory string
+}
+
+func (suite *AuthzTestSuite) SetupSuite() {
+	tempDirectory, err := ioutil.TempDir("", "chartmuseum-authz")
+	suite.Nil(err, "no error creating temp directory")
+	suite.TempDirectory = tempDirectory
+}
+
+func (suite *AuthzTestSuite) TearDownSuite() {
+	os.RemoveAll(suite.TempDirectory)
+}
+
+func (suite *AuthzTestSuite) writePolicy(content string) string {
+	filename := path.Join(suite.TempDirectory, "policy.yaml")
+	err := ioutil.WriteFile(filename, []byte(content), 0644)
+	suite.Nil(err, "no error writing policy file")
+	return filename
+}
+
+func (suite *AuthzTestSuite) TestAllowAllAuthorizer() {
+	authorizer := Authorizer(NewAllowAllAuthorizer())
+	allowed, err := authorizer.Authorize("anonymous", ActionDelete, "mychart")
+	suite.Nil(err, "no error authorizing")
+	suite.True(allowed, "everything allowed")
+}
+
+func (suite *AuthzTestSuite) TestPolicyAuthorizer() {
+	_, err := NewPolicyAuthorizer(path.Join(suite.TempDirectory, "missing.yaml"))
+	suite.NotNil(err, "error loading missing policy file")
+	_, err = NewPolicyAuthorizer(suite.writePolicy("rules:\n- identities: [\"*\"]\n  charts: [\"[\"]\n  verbs: [\"get\"]\n"))
+	suite.NotNil(err, "error loading policy with invalid chart pattern")
+	_, err = NewPolicyAuthorizer(suite.writePolicy("rules:\n- identities: [\"*\"]\n  charts: [\"*\"]\n  verbs: [\"fly\"]\n"))
+	suite.NotNil(err, "error loading policy with invalid verb")
+
+	authorizer, err := NewPolicyAuthorizer(suite.writePolicy(`rules:
+- identities: ["*"]
+  charts: ["common"]
+  verbs: ["get"]
+- identities: ["alice", "bearer"]
+  charts: ["team-a-*"]
+  verbs: ["get", "push"]
+`))
+	suite.Nil(err, "no error loading policy")
+
+	tests := []struct {
+		identity string
+		action   string
+		resource string
+		allowed  bool
+	}{
+		{"bob", ActionGet, "common", true},
+		{"bob", ActionPush, "common", false},
+		{"bob", ActionGet, "team-a-app", false},
+		{"alice", ActionPush, "team-a-app", true},
+		{"bearer", ActionGet, "team-a-app", true},
+		{"alice", ActionDelete, "team-a-app", false},
+		{"alice", ActionPush, "", true},
+		{"bob", ActionPush, "", false},
+		{"bob", ActionGet, "", true},
+		{"bob", ActionGet, "team-a-", false},
+	}
+	for _, test := range tests {
+		allowed, err := authorizer.Authorize(test.identity, test.action, test.resource)
+		suite.Nil(err, "no error authorizing")
+		suite.Equal(test.allowed, allowed, "%s %s %q", test.identity, test.action, test.resource)
+	}
+}
+
+func TestAuthzTestSuite(t *testing.T) {
+	suite.Run(t, new(AuthzTestSuite))
+}
@@ -0,0 +1,98 @@
+package authz
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/ghodss/yaml"
+)
+
+// AnyIdentity matches every identity in a policy rule
+const AnyIdentity = "*"
+
+type (
+	// PolicyAuthorizer grants identities actions on charts by name pattern, following a static
+	// policy. Anything which is not granted by a rule is denied.
+	PolicyAuthorizer struct {
+		Rules []PolicyRule `json:"rules"`
+	}
+
+	// PolicyRule grants Verbs (get, push and/or delete) on charts whose name matches one of
+	// Charts (shell patterns, e.g. "team-a-*") to Identities (AnyIdentity for anyone)
+	PolicyRule struct {
+		Identities []string `json:"identities"`
+		Charts     []string `json:"charts"`
+		Verbs      []string `json:"verbs"`
+	}
+)
+
+// NewPolicyAuthorizer creates a new instance of PolicyAuthorizer from the policy file at filename
+func NewPolicyAuthorizer(filename string) (*PolicyAuthorizer, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	a := &PolicyAuthorizer{}
+	err = yaml.Unmarshal(content, a)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access policy %s: %s", filename, err)
+	}
+	for _, rule := range a.Rules {
+		for _, pattern := range rule.Charts {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid chart pattern %q in access policy: %s", pattern, err)
+			}
+		}
+		for _, verb := range rule.Verbs {
+			if verb != ActionGet && verb != ActionPush && verb != ActionDelete {
+				return nil, fmt.Errorf("invalid verb %q in access policy, expected get, push or delete", verb)
+			}
+		}
+	}
+	return a, nil
+}
+
+// Authorize allows action if any rule grants it to identity on resource. If resource is "", action
+// is allowed if any rule grants it to identity on some charts.
+func (a PolicyAuthorizer) Authorize(identity string, action string, resource string) (bool, error) {
+	for _, rule := range a.Rules {
+		if !rule.appliesTo(identity, action) {
+			continue
+		}
+		if resource == "" && len(rule.Charts) > 0 {
+			return true, nil
+		}
+		if rule.matches(resource) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// appliesTo returns whether rule grants verb to identity, on the charts it matches
+func (rule PolicyRule) appliesTo(identity string, verb string) bool {
+	if !containsString(rule.Identities, identity) && !containsString(rule.Identities, AnyIdentity) {
+		return false
+	}
+	return containsString(rule.Verbs, verb)
+}
+
+// matches returns whether the chart called name matches one of the patterns of rule
+func (rule PolicyRule) matches(name string) bool {
+	for _, pattern := range rule.Charts {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
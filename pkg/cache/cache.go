@@ -0,0 +1,20 @@
+package cache
+
+import (
+	"errors"
+)
+
+var (
+	// ErrorKeyNotFound is raised when a key does not exist in a store
+	ErrorKeyNotFound = errors.New("key not found")
+)
+
+type (
+	// Store is a generic interface for key-value stores used to share state
+	// between multiple ChartMuseum instances
+	Store interface {
+		Get(key string) ([]byte, error)
+		Set(key string, content []byte) error
+		Delete(key string) error
+	}
+)
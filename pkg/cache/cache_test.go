@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CacheTestSuite struct {
+	suite.Suite
+	Stores map[string]Store
+	Prefix string
+}
+
+func (suite *CacheTestSuite) SetupSuite() {
+	suite.Prefix = fmt.Sprintf("unittest/%s", time.Now().Format("20060102150405"))
+	suite.Stores = make(map[string]Store)
+	suite.Stores["Memory"] = Store(NewMemoryStore())
+
+	if addr := os.Getenv("TEST_CACHE_REDIS_ADDR"); addr != "" {
+		suite.Stores["Redis"] = Store(NewRedisStore(addr, "", 0))
+	}
+}
+
+func (suite *CacheTestSuite) TestSetGetDelete() {
+	for key, store := range suite.Stores {
+		k := fmt.Sprintf("%s/testkey", suite.Prefix)
+
+		_, err := store.Get(k)
+		message := fmt.Sprintf("ErrorKeyNotFound getting missing key using %s store", key)
+		suite.Equal(ErrorKeyNotFound, err, message)
+
+		err = store.Set(k, []byte("test content"))
+		message = fmt.Sprintf("no error setting key using %s store", key)
+		suite.Nil(err, message)
+
+		content, err := store.Get(k)
+		message = fmt.Sprintf("no error getting key using %s store", key)
+		suite.Nil(err, message)
+		message = fmt.Sprintf("content as expected using %s store", key)
+		suite.Equal([]byte("test content"), content, message)
+
+		err = store.Delete(k)
+		message = fmt.Sprintf("no error deleting key using %s store", key)
+		suite.Nil(err, message)
+
+		_, err = store.Get(k)
+		message = fmt.Sprintf("ErrorKeyNotFound getting deleted key using %s store", key)
+		suite.Equal(ErrorKeyNotFound, err, message)
+	}
+}
+
+func TestCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(CacheTestSuite))
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"sync"
+)
+
+// MemoryStore is a cache store kept in process memory (not shared between instances)
+type MemoryStore struct {
+	items map[string][]byte
+	lock  *sync.RWMutex
+}
+
+// NewMemoryStore creates a new instance of MemoryStore
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		items: map[string][]byte{},
+		lock:  &sync.RWMutex{},
+	}
+	return s
+}
+
+// Get retrieves the content stored at key
+func (s MemoryStore) Get(key string) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	content, ok := s.items[key]
+	if !ok {
+		return nil, ErrorKeyNotFound
+	}
+	return content, nil
+}
+
+// Set stores content at key
+func (s MemoryStore) Set(key string, content []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.items[key] = content
+	return nil
+}
+
+// Delete removes the content stored at key
+func (s MemoryStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.items, key)
+	return nil
+}
@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"github.com/go-redis/redis"
+)
+
+// RedisStore is a cache store backed by Redis
+type RedisStore struct {
+	Client *redis.Client
+}
+
+// NewRedisStore creates a new instance of RedisStore
+func NewRedisStore(addr string, password string, db int) *RedisStore {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+	s := &RedisStore{Client: client}
+	return s
+}
+
+// Get retrieves the content stored at key
+func (s RedisStore) Get(key string) ([]byte, error) {
+	content, err := s.Client.Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrorKeyNotFound
+	}
+	return content, err
+}
+
+// Set stores content at key
+func (s RedisStore) Set(key string, content []byte) error {
+	err := s.Client.Set(key, content, 0).Err()
+	return err
+}
+
+// Delete removes the content stored at key
+func (s RedisStore) Delete(key string) error {
+	err := s.Client.Del(key).Err()
+	return err
+}
@@ -0,0 +1,103 @@
+package chartmuseum
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/authz"
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessDeniedError is returned when an identity is not authorized to perform an action on a chart
+type accessDeniedError struct {
+	identity string
+	verb     string
+	name     string
+}
+
+func (err accessDeniedError) Error() string {
+	if err.name == "" {
+		return fmt.Sprintf("%s is not allowed to %s charts", err.identity, err.verb)
+	}
+	return fmt.Sprintf("%s is not allowed to %s chart %s", err.identity, err.verb, err.name)
+}
+
+// checkAccess returns an accessDeniedError unless the Authorizer (if any) allows identity to perform
+// verb on the chart called name. Requests which are not about one chart (e.g. the index, listings)
+// are checked with name "", and only return what is in visibleIndex. Authorizer errors deny access.
+func (server *Server) checkAccess(identity string, verb string, name string) error {
+	if server.Authorizer == nil {
+		return nil
+	}
+	allowed, err := server.Authorizer.Authorize(identity, verb, name)
+	if err != nil {
+		server.Logger.Warnw("Unable to authorize request, denying it",
+			"identity", identity,
+			"action", verb,
+			"chart", name,
+			"error", err.Error(),
+		)
+	}
+	if err != nil || !allowed {
+		return accessDeniedError{identity: identity, verb: verb, name: name}
+	}
+	return nil
+}
+
+// visibleIndex returns the index as identity may see it, without the charts the Authorizer doesn't
+// allow it to get. The index itself is returned if no chart is left out.
+func (server *Server) visibleIndex(identity string) (*repo.Index, error) {
+	index := server.RepositoryIndex
+	if server.Authorizer == nil {
+		return index, nil
+	}
+	hidden := map[string]bool{}
+	for name := range index.Entries {
+		if server.checkAccess(identity, authz.ActionGet, name) != nil {
+			hidden[name] = true
+		}
+	}
+	if len(hidden) == 0 {
+		return index, nil
+	}
+	return index.Filter(func(name string) bool {
+		return !hidden[name]
+	})
+}
+
+// checkUploadAccess checks that identity may push the chart of an uploaded chart package or provenance
+// file. Invalid uploads pass, since they are reported when saving them.
+func (server *Server) checkUploadAccess(content []byte, identity string) error {
+	name, err := repo.ChartNameFromContent(content)
+	if err != nil {
+		return nil
+	}
+	return server.checkAccess(identity, authz.ActionPush, name)
+}
+
+// authorizeAccess returns a middleware rejecting requests with 403 unless the Authorizer allows the
+// identity of the request to perform verb, on the chart named in the route (by :name, or by :filename for
+// chart packages, provenance files and signatures) or else on any chart. Pushes are checked again
+// once the chart is known from the uploaded content.
+func (server *Server) authorizeAccess(verb string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if server.Authorizer == nil {
+			return
+		}
+		name := c.Param("name")
+		if filename := c.Param("filename"); name == "" && filename != "" {
+			// files which are not in the index are checked by filename
+			name = filename
+			if chartVersion := server.RepositoryIndex.GetByPackage(strings.TrimSuffix(strings.TrimSuffix(filename, ".prov"), ".sig")); chartVersion != nil {
+				name = chartVersion.Name
+			}
+		}
+		err := server.checkAccess(requestIdentity(c), verb, name)
+		if err != nil {
+			c.JSON(403, newErrorResponse(errorCodeAccessDenied, err.Error(), nil))
+			c.Abort()
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package chartmuseum
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminKey is set on requests by administrators, who may use the administrative routes
+const adminKey = "admin"
+
+// identifyAdmin returns a middleware marking requests by administrators with adminKey: all requests
+// to the admin port, which has credentials of its own, and else requests by one of AdminIdentities
+func (server *Server) identifyAdmin(adminPort bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminPort || server.isAdminIdentity(requestIdentity(c)) {
+			c.Set(adminKey, true)
+		}
+	}
+}
+
+// adminIdentitiesFromOptions returns the identities which may use administrative routes on the main
+// port: AdminIdentities, or else the basic auth user, so that e.g. a bearer token given to CI to push
+// charts doesn't allow deleting backups or restoring storage. Nil means everyone.
+func adminIdentitiesFromOptions(options ServerOptions) []string {
+	if len(options.AdminIdentities) > 0 {
+		return options.AdminIdentities
+	}
+	if options.Username != "" && options.Password != "" {
+		return []string{options.Username}
+	}
+	return nil
+}
+
+// isAdminIdentity returns whether identity is an administrator on the main port. Without
+// AdminIdentities (e.g. if authentication is disabled), everyone is.
+func (server *Server) isAdminIdentity(identity string) bool {
+	if len(server.AdminIdentities) == 0 {
+		return true
+	}
+	for _, admin := range server.AdminIdentities {
+		if admin == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// requireAdmin rejects requests which were not marked by identifyAdmin with 403
+func (server *Server) requireAdmin(c *gin.Context) {
+	if !c.GetBool(adminKey) {
+		message := fmt.Sprintf("%s is not allowed to use administrative routes", requestIdentity(c))
+		c.JSON(403, newErrorResponse(errorCodeAccessDenied, message, nil))
+		c.Abort()
+	}
+}
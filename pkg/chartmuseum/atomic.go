@@ -0,0 +1,112 @@
+package chartmuseum
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+)
+
+// storeUploadedFiles writes the files of an upload (a chart package and/or its provenance file and
+// cosign signature, by filename) to storage, chart packages last so that a chart is never listed
+// before its signatures.
+// Either all files are written or none: if a write fails, the files already written are put back the
+// way they were. The returned func does the same for all files (and the upload record and SBOM of
+// chart packages), for when a later step of the upload fails, and then updates the index: overwritten
+// chart packages are indexed again with their restored content, new ones are removed from it. Upload
+// locks must be held for all files.
+func (server *Server) storeUploadedFiles(files map[string][]byte) (func(), error) {
+	var filenames []string
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.SliceStable(filenames, func(i, j int) bool {
+		return !isChartPackageFile(filenames[i]) && isChartPackageFile(filenames[j])
+	})
+
+	previous := map[string][]byte{}
+	var written []string
+	restore := func() {
+		server.restoreObjects(written, previous)
+	}
+	for _, filename := range filenames {
+		paths := []string{filename}
+		if server.RecordUploads && isChartPackageFile(filename) {
+			paths = append(paths, uploadRecordPath(filename))
+		}
+		if server.GenerateSBOM && isChartPackageFile(filename) {
+			paths = append(paths, sbomPath(filename))
+		}
+		for _, path := range paths {
+			previous[path] = nil
+			if object, err := server.StorageBackend.GetObject(path); err == nil {
+				previous[path] = object.Content
+			}
+		}
+		if previous[filename] != nil {
+			// the previous version kept of an earlier upload is replaced, see keepPreviousVersion
+			path := previousVersionPath(filename)
+			paths = append(paths, path)
+			previous[path] = nil
+			if object, err := server.StorageBackend.GetObject(path); err == nil {
+				previous[path] = object.Content
+			}
+		}
+		server.Logger.Debugw("Adding file to storage",
+			"filename", filename,
+		)
+		err := server.putUploadedObject(filename, files[filename])
+		if _, ok := err.(writeVerificationError); ok && previous[filename] != nil {
+			// the unverified file was deleted, put back what it overwrote
+			written = append(written, filename)
+		}
+		if err != nil {
+			restore()
+			return nil, err
+		}
+		written = append(written, paths...)
+		if previous[filename] != nil {
+			err = server.keepPreviousVersion(filename, previous[filename])
+			if err != nil {
+				restore()
+				return nil, err
+			}
+		}
+	}
+	rollback := func() {
+		restore()
+		for _, filename := range filenames {
+			if isChartPackageFile(filename) {
+				server.indexRolledBackPackage(filename, previous[filename] != nil)
+			}
+		}
+	}
+	return rollback, nil
+}
+
+// restoreObjects puts the objects at paths back to their previous content, deleting those which
+// did not exist before. Failures are logged, there is nothing more to do about them.
+func (server *Server) restoreObjects(paths []string, previous map[string][]byte) {
+	for _, path := range paths {
+		var err error
+		if content := previous[path]; content != nil {
+			err = server.StorageBackend.PutObject(path, content)
+		} else {
+			err = server.StorageBackend.DeleteObject(path)
+		}
+		if err != nil {
+			server.Logger.Warnw("Unable to roll back file of failed upload",
+				"filename", path,
+				"error", err.Error(),
+			)
+		}
+	}
+}
+
+func isChartPackageFile(filename string) bool {
+	return strings.HasSuffix(filename, repo.ChartPackageFileExtension)
+}
+
+func isProvenanceFile(filename string) bool {
+	return strings.HasSuffix(filename, repo.ProvenanceFileExtension)
+}
@@ -0,0 +1,200 @@
+package chartmuseum
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+// attestationsExtension is appended to the filename of a package to name the object holding its attestations
+const attestationsExtension = ".attestations.json"
+
+// storedAttestation is an attestation attached to a chart version, identified by the sha256 of its content
+type storedAttestation struct {
+	ID            string    `json:"id"`
+	PredicateType string    `json:"predicateType,omitempty"`
+	Uploader      string    `json:"uploader,omitempty"`
+	Created       time.Time `json:"created"`
+	Content       []byte    `json:"content,omitempty"` // exactly as attached
+}
+
+func attestationsPath(filename string) string {
+	return filename + attestationsExtension
+}
+
+// getAttestations returns the attestations attached to a package, in the order they were attached
+func (server *Server) getAttestations(ctx context.Context, filename string) ([]storedAttestation, error) {
+	object, err := storage.GetObjectWithContext(ctx, server.StorageBackend, attestationsPath(filename))
+	if err != nil {
+		return []storedAttestation{}, nil // no attestations
+	}
+	var attestations []storedAttestation
+	err = json.Unmarshal(object.Content, &attestations)
+	return attestations, err
+}
+
+// chartVersionForAttestations returns the chart version in the route, responding with 404 if there is none
+func (server *Server) chartVersionForAttestations(c *gin.Context) (*helm_repo.ChartVersion, bool) {
+	name := c.Param("name")
+	version := c.Param("version")
+	if version == "latest" {
+		version = ""
+	}
+	err := server.syncRepositoryIndexOnRequest(c.Request.Context())
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return nil, false
+	}
+	chartVersion, err := server.RepositoryIndex.Get(name, version)
+	if err != nil {
+		c.JSON(404, server.chartNotFoundResponse(c, name, version))
+		return nil, false
+	}
+	return chartVersion, true
+}
+
+func (server *Server) getChartVersionAttestationsRequestHandler(c *gin.Context) {
+	chartVersion, ok := server.chartVersionForAttestations(c)
+	if !ok {
+		return
+	}
+	filename := repo.ChartPackageFilenameFromNameVersion(chartVersion.Name, chartVersion.Version)
+	attestations, err := server.getAttestations(c.Request.Context(), filename)
+	if server.clientWentAway(c) {
+		return
+	}
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	predicateType := c.Query("predicateType")
+	listed := []storedAttestation{}
+	for _, attestation := range attestations {
+		if predicateType != "" && attestation.PredicateType != predicateType {
+			continue
+		}
+		attestation.Content = nil
+		listed = append(listed, attestation)
+	}
+	c.JSON(200, listed)
+}
+
+func (server *Server) getChartVersionAttestationRequestHandler(c *gin.Context) {
+	chartVersion, ok := server.chartVersionForAttestations(c)
+	if !ok {
+		return
+	}
+	filename := repo.ChartPackageFilenameFromNameVersion(chartVersion.Name, chartVersion.Version)
+	attestations, err := server.getAttestations(c.Request.Context(), filename)
+	if server.clientWentAway(c) {
+		return
+	}
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	for _, attestation := range attestations {
+		if attestation.ID == c.Param("id") {
+			c.Data(200, repo.AttestationContentType, attestation.Content)
+			return
+		}
+	}
+	c.JSON(404, notFoundErrorResponse)
+}
+
+// postChartVersionAttestationRequestHandler attaches the attestation in the request body to a chart
+// version. The predicate type of documents which are not in-toto statements can be given with
+// ?predicateType=. Attaching the same attestation again is a no-op.
+func (server *Server) postChartVersionAttestationRequestHandler(c *gin.Context) {
+	err := server.checkChartOwner(c.Param("name"), requestIdentity(c))
+	if err != nil {
+		c.JSON(403, newErrorResponse(errorCodeNotChartOwner, err.Error(), nil))
+		return
+	}
+	content, status, err := server.readRequestBody(c)
+	if err != nil {
+		c.JSON(status, errorResponse(status, err))
+		return
+	}
+	attestation, err := repo.ParseAttestation(content)
+	if err != nil {
+		c.JSON(400, newErrorResponse(errorCodeInvalidAttestation, err.Error(), nil))
+		return
+	}
+	chartVersion, ok := server.chartVersionForAttestations(c)
+	if !ok {
+		return
+	}
+	err = attestation.CheckSubject(chartVersion.Digest)
+	if err != nil {
+		c.JSON(400, newErrorResponse(errorCodeInvalidAttestation, err.Error(), gin.H{
+			"digest": chartVersion.Digest,
+		}))
+		return
+	}
+	err = server.scanForMalware("attestation", content)
+	if err != nil {
+		c.JSON(malwareErrorResponse(err))
+		return
+	}
+
+	digest := sha256.Sum256(content)
+	stored := storedAttestation{
+		ID:            hex.EncodeToString(digest[:]),
+		PredicateType: attestation.PredicateType,
+		Created:       time.Now().UTC(),
+		Content:       content,
+	}
+	if stored.PredicateType == "" {
+		stored.PredicateType = c.Query("predicateType")
+	}
+	if _, ok := c.Get(gin.AuthUserKey); ok {
+		stored.Uploader, _ = uploaderFromAuthorization(c.Request.Header.Get("Authorization"))
+	}
+
+	filename := repo.ChartPackageFilenameFromNameVersion(chartVersion.Name, chartVersion.Version)
+	unlock, status, err := server.acquireUploadLock(attestationsPath(filename))
+	if err != nil {
+		c.JSON(status, errorResponse(status, err))
+		return
+	}
+	defer unlock()
+	attestations, err := server.getAttestations(c.Request.Context(), filename)
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	for _, attestation := range attestations {
+		if attestation.ID == stored.ID {
+			attestation.Content = nil
+			c.JSON(200, attestation)
+			return
+		}
+	}
+	attestations = append(attestations, stored)
+	object, err := json.Marshal(attestations)
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	server.Logger.Debugw("Attaching attestation to chart version",
+		"package", filename,
+		"attestation", stored.ID,
+		"predicate_type", stored.PredicateType,
+	)
+	err = server.StorageBackend.PutObject(attestationsPath(filename), object)
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	stored.Content = nil
+	c.JSON(201, stored)
+}
@@ -0,0 +1,155 @@
+package chartmuseum
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+var auditRunningErrorResponse = newErrorResponse(errorCodeAuditRunning, "audit already running", nil)
+
+// auditReport is the result of downloading every package in the index again and comparing it
+// against the digest recorded in the index
+type auditReport struct {
+	Running      bool           `json:"running"`
+	Started      time.Time      `json:"started"`
+	Finished     *time.Time     `json:"finished,omitempty"`
+	Checked      int            `json:"checked"`
+	Unverifiable int            `json:"unverifiable"` // no digest recorded in the index
+	Corrupt      []auditFinding `json:"corrupt"`
+	Missing      []auditFinding `json:"missing"`
+}
+
+// auditFinding is a package which failed the audit
+type auditFinding struct {
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// startAudit runs an audit in the background, returning false if one is already running
+func (server *Server) startAudit() (auditReport, bool) {
+	server.AuditLock.Lock()
+	defer server.AuditLock.Unlock()
+	if server.Audit != nil && server.Audit.Running {
+		return *server.Audit, false
+	}
+	server.Audit = &auditReport{Running: true, Started: time.Now(), Corrupt: []auditFinding{}, Missing: []auditFinding{}}
+	go server.runAudit(server.indexedDigests())
+	return *server.Audit, true
+}
+
+// indexedDigests returns the digest recorded in the index for each chart package
+func (server *Server) indexedDigests() map[string]string {
+	// the index is only modified while holding the storage cache lock
+	server.StorageCacheLock.Lock()
+	defer server.StorageCacheLock.Unlock()
+	digests := map[string]string{}
+	for _, chartVersions := range server.RepositoryIndex.Entries {
+		for _, chartVersion := range chartVersions {
+			digests[repo.ChartPackageFilenameFromNameVersion(chartVersion.Name, chartVersion.Version)] = chartVersion.Digest
+		}
+	}
+	return digests
+}
+
+// runAudit downloads each package again and compares it against its digest
+func (server *Server) runAudit(digests map[string]string) {
+	server.Logger.Infow("Starting integrity audit",
+		"packages", len(digests),
+	)
+	var paths []string
+	for path := range digests {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		finding := auditFinding{Path: path, Expected: digests[path]}
+		if finding.Expected == "" {
+			server.updateAudit(func(report *auditReport) { report.Unverifiable++ })
+			continue
+		}
+		object, err := server.StorageBackend.GetObject(path)
+		if err != nil {
+			finding.Error = err.Error()
+			server.updateAudit(func(report *auditReport) {
+				report.Checked++
+				report.Missing = append(report.Missing, finding)
+			})
+			continue
+		}
+		finding.Actual, err = repo.ChartPackageDigest(object.Content)
+		if err != nil {
+			finding.Error = err.Error()
+		}
+		server.updateAudit(func(report *auditReport) {
+			report.Checked++
+			if finding.Actual != finding.Expected {
+				report.Corrupt = append(report.Corrupt, finding)
+			}
+		})
+	}
+
+	report := server.updateAudit(func(report *auditReport) {
+		now := time.Now()
+		report.Running = false
+		report.Finished = &now
+	})
+	auditCorruptPackagesGauge.Set(float64(len(report.Corrupt)))
+	auditMissingPackagesGauge.Set(float64(len(report.Missing)))
+	auditLastRunGauge.Set(float64(report.Finished.Unix()))
+	logFn := server.Logger.Infow
+	if len(report.Corrupt) > 0 || len(report.Missing) > 0 {
+		logFn = server.Logger.Warnw
+	}
+	logFn("Finished integrity audit",
+		"checked", report.Checked,
+		"corrupt", len(report.Corrupt),
+		"missing", len(report.Missing),
+		"unverifiable", report.Unverifiable,
+	)
+}
+
+// updateAudit applies fn to the running audit, returning a copy of the report
+func (server *Server) updateAudit(fn func(report *auditReport)) auditReport {
+	server.AuditLock.Lock()
+	defer server.AuditLock.Unlock()
+	fn(server.Audit)
+	return *server.Audit
+}
+
+// getAudit returns a copy of the report of the last (or running) audit, if any
+func (server *Server) getAudit() (auditReport, bool) {
+	server.AuditLock.Lock()
+	defer server.AuditLock.Unlock()
+	if server.Audit == nil {
+		return auditReport{}, false
+	}
+	report := *server.Audit
+	report.Corrupt = append([]auditFinding{}, report.Corrupt...)
+	report.Missing = append([]auditFinding{}, report.Missing...)
+	return report, true
+}
+
+func (server *Server) getAuditRequestHandler(c *gin.Context) {
+	report, ok := server.getAudit()
+	if !ok {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	c.JSON(200, report)
+}
+
+func (server *Server) postAuditRequestHandler(c *gin.Context) {
+	report, ok := server.startAudit()
+	if !ok {
+		c.JSON(409, auditRunningErrorResponse)
+		return
+	}
+	c.JSON(202, report)
+}
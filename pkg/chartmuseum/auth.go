@@ -0,0 +1,136 @@
+package chartmuseum
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// basicAuthRealm is sent in WWW-Authenticate when credentials are missing or wrong
+const basicAuthRealm = "ChartMuseum"
+
+// basicAuthVerifier checks basic auth credentials against a username and a password,
+// which may be given as a bcrypt hash (e.g. "$2y$10$...") so that it never appears in plain text.
+// A bearer token (as sent by e.g. `helm push --access-token`) can be accepted as well.
+type basicAuthVerifier struct {
+	username string
+	password string
+	hashed   bool
+	token    string
+
+	// digests of passwords which matched the bcrypt hash, so each request
+	// doesn't pay for a deliberately slow bcrypt comparison
+	verified     map[[sha256.Size]byte]bool
+	verifiedLock *sync.RWMutex
+}
+
+func newBasicAuthVerifier(username string, password string) *basicAuthVerifier {
+	v := &basicAuthVerifier{
+		username:     username,
+		password:     password,
+		hashed:       isBcryptHash(password),
+		verified:     map[[sha256.Size]byte]bool{},
+		verifiedLock: &sync.RWMutex{},
+	}
+	return v
+}
+
+// authVerifierFromOptions returns a verifier for the configured basic auth credentials and
+// bearer token, or nil if authentication is disabled
+func authVerifierFromOptions(options ServerOptions) *basicAuthVerifier {
+	basicAuth := options.Username != "" && options.Password != ""
+	if !basicAuth && options.BearerToken == "" {
+		return nil
+	}
+	v := newBasicAuthVerifier(options.Username, options.Password)
+	if !basicAuth {
+		v.username, v.password = "", ""
+	}
+	v.token = options.BearerToken
+	return v
+}
+
+// isBcryptHash determines whether a configured password is a bcrypt hash, by its prefix
+func isBcryptHash(password string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(password, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// verify checks the given credentials
+func (v *basicAuthVerifier) verify(username string, password string) bool {
+	if v.username == "" || v.password == "" {
+		return false // only a bearer token is configured
+	}
+	if subtle.ConstantTimeCompare([]byte(username), []byte(v.username)) != 1 {
+		return false
+	}
+	if !v.hashed {
+		return subtle.ConstantTimeCompare([]byte(password), []byte(v.password)) == 1
+	}
+
+	digest := sha256.Sum256([]byte(password))
+	v.verifiedLock.RLock()
+	verified := v.verified[digest]
+	v.verifiedLock.RUnlock()
+	if verified {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(v.password), []byte(password)) != nil {
+		return false
+	}
+	v.verifiedLock.Lock()
+	v.verified[digest] = true
+	v.verifiedLock.Unlock()
+	return true
+}
+
+// verifyHeader checks the credentials in an Authorization header value ("Basic <base64>" or "Bearer <token>")
+func (v *basicAuthVerifier) verifyHeader(authorization string) bool {
+	if strings.HasPrefix(authorization, "Bearer ") {
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		return v.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(v.token)) == 1
+	}
+	if !strings.HasPrefix(authorization, "Basic ") {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "Basic "))
+	if err != nil {
+		return false
+	}
+	userpass := strings.SplitN(string(decoded), ":", 2)
+	if len(userpass) != 2 {
+		return false
+	}
+	return v.verify(userpass[0], userpass[1])
+}
+
+// probePaths are served without credentials, so that liveness and readiness probes (e.g. of
+// Kubernetes or a load balancer) don't need any
+var probePaths = map[string]bool{"/health": true, "/ready": true}
+
+// basicAuthMiddleware rejects requests without valid basic auth credentials with 401, except for
+// probes and metrics authorized with credentials of their own
+func basicAuthMiddleware(verifier *basicAuthVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool(metricsAuthorizedKey) || probePaths[c.Request.URL.Path] {
+			return
+		}
+		authorization := c.Request.Header.Get("Authorization")
+		if !verifier.verifyHeader(authorization) {
+			recordAuthFailure(c.Request.Method, mapURLWithParamsBackToRouteTemplate(c), authorization)
+			c.Header("WWW-Authenticate", "Basic realm=\""+basicAuthRealm+"\"")
+			c.AbortWithStatus(401)
+			return
+		}
+		c.Set(gin.AuthUserKey, verifier.username)
+	}
+}
@@ -0,0 +1,98 @@
+package chartmuseum
+
+import (
+	"context"
+	"time"
+)
+
+// startBackgroundJobs starts leader election (if configured) and all periodic jobs.
+// Every instance keeps serving traffic, but periodic jobs only run on the leader, except
+// those about the instance itself (storage health checks and resumable uploads).
+func (server *Server) startBackgroundJobs() {
+	if server.LeaderElector != nil {
+		go server.runLeaderElection()
+	}
+	if server.HealthCheckInterval > 0 {
+		go server.runStorageHealthChecks()
+	}
+	if server.ResumableUploads != nil {
+		go server.runResumableUploadReaper()
+	}
+	if server.ResyncInterval > 0 {
+		go server.runPeriodically("index resync", server.ResyncInterval, func() error {
+			return server.syncRepositoryIndex(context.Background())
+		})
+	}
+	if server.BackupBackend != nil && server.BackupInterval > 0 {
+		go server.runPeriodically("backup", server.BackupInterval, func() error {
+			_, err := server.BackupRepository()
+			return err
+		})
+	}
+	if server.PublishBackend != nil && server.PublishInterval > 0 {
+		go server.runPeriodically("publish", server.PublishInterval, func() error {
+			err := server.syncRepositoryIndex(context.Background())
+			if err != nil {
+				return err
+			}
+			_, err = server.PublishRepository()
+			return err
+		})
+	}
+}
+
+func (server *Server) runLeaderElection() {
+	for {
+		leader, err := server.LeaderElector.TryAcquireOrRenew()
+		if err != nil {
+			server.Logger.Warnw("Leader election failed",
+				"error", err.Error(),
+			)
+		}
+		server.setLeader(leader)
+		time.Sleep(server.LeaderElector.RetryPeriod())
+	}
+}
+
+func (server *Server) runPeriodically(job string, interval time.Duration, fn func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !server.isLeader() {
+			server.Logger.Debugw("Skipping background job, not leader",
+				"job", job,
+			)
+			continue
+		}
+		server.Logger.Debugw("Running background job",
+			"job", job,
+		)
+		err := fn()
+		if err != nil {
+			server.Logger.Errorw("Background job failed",
+				"job", job,
+				"error", err.Error(),
+			)
+		}
+	}
+}
+
+func (server *Server) isLeader() bool {
+	if server.LeaderElector == nil {
+		return true
+	}
+	server.LeaderLock.RLock()
+	defer server.LeaderLock.RUnlock()
+	return server.Leader
+}
+
+func (server *Server) setLeader(leader bool) {
+	server.LeaderLock.Lock()
+	defer server.LeaderLock.Unlock()
+	if server.Leader != leader {
+		server.Logger.Infow("Leadership changed",
+			"leader", leader,
+		)
+	}
+	server.Leader = leader
+}
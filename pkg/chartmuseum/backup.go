@@ -0,0 +1,60 @@
+package chartmuseum
+
+import (
+	"context"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+var noBackupBackendErrorResponse = newErrorResponse(errorCodeNoBackupBackend, "no backup backend configured", nil)
+
+// BackupRepository snapshots all charts and the current index to the backup backend,
+// then prunes snapshots beyond the configured retention
+func (server *Server) BackupRepository() (storage.BackupManifest, error) {
+	err := server.syncRepositoryIndex(context.Background())
+	if err != nil {
+		return storage.BackupManifest{}, err
+	}
+	extra := map[string][]byte{repo.IndexFileName: server.RepositoryIndex.Raw}
+	manifest, err := storage.CreateBackupSnapshot(server.StorageBackend, server.BackupBackend, extra)
+	if err != nil {
+		return manifest, err
+	}
+	server.Logger.Infow("Created backup snapshot",
+		"snapshot", manifest.ID,
+		"objects", len(manifest.Objects),
+	)
+	if server.BackupRetention > 0 {
+		err = storage.PruneBackupSnapshots(server.BackupBackend, server.BackupRetention)
+	}
+	return manifest, err
+}
+
+func (server *Server) getBackupsRequestHandler(c *gin.Context) {
+	if server.BackupBackend == nil {
+		c.JSON(404, noBackupBackendErrorResponse)
+		return
+	}
+	ids, err := storage.ListBackupSnapshots(server.BackupBackend)
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	c.JSON(200, gin.H{"snapshots": ids})
+}
+
+func (server *Server) postBackupRequestHandler(c *gin.Context) {
+	if server.BackupBackend == nil {
+		c.JSON(404, noBackupBackendErrorResponse)
+		return
+	}
+	manifest, err := server.BackupRepository()
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	c.JSON(201, manifest)
+}
@@ -0,0 +1,92 @@
+package chartmuseum
+
+import (
+	"encoding/json"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/cache"
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+)
+
+var (
+	// cacheStateKey is the key in the cache store holding the shared index state
+	cacheStateKey = "chartmuseum/state"
+)
+
+// cachedState is the storage object cache and generated index shared between instances.
+// Everything is stored under a single key so that readers never see a partial state.
+// Pending objects are shared too, so that other instances don't drop freshly uploaded
+// packages from the index while storage listings catch up.
+type cachedState struct {
+	Objects []storage.Object         `json:"objects"`
+	Pending map[string]pendingObject `json:"pending"`
+	Index   []byte                   `json:"index"`
+	Library []byte                   `json:"library,omitempty"` // library charts left out of Index
+	Pruned  []byte                   `json:"pruned,omitempty"`  // chart versions pruned from Index
+}
+
+// loadCachedState replaces the local storage cache and index with the ones found in the
+// cache store, returning false if there is nothing stored yet
+func (server *Server) loadCachedState() (bool, error) {
+	content, err := server.CacheStore.Get(cacheStateKey)
+	if err == cache.ErrorKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var state cachedState
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return false, err
+	}
+
+	index, err := repo.LoadIndex(state.Index, server.RepositoryIndex.ChartURL)
+	if err != nil {
+		return false, err
+	}
+	if server.RepositoryIndex.Shards != nil {
+		index.Shards = repo.NewIndexShards()
+	}
+	index.LibraryCharts = server.RepositoryIndex.LibraryCharts
+	if len(state.Library) > 0 {
+		err = index.LoadLibraryIndex(state.Library)
+		if err != nil {
+			return false, err
+		}
+	}
+	index.Pruning = server.RepositoryIndex.Pruning
+	if len(state.Pruned) > 0 {
+		err = index.LoadPrunedIndex(state.Pruned)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	server.Logger.Debugw("Loaded index from cache store",
+		"objects", len(state.Objects),
+	)
+	server.RepositoryIndex = index
+	server.StorageCache = state.Objects
+	server.addPendingObjects(state.Pending)
+	return true, nil
+}
+
+func (server *Server) storeCachedState() error {
+	state := cachedState{
+		Objects: server.StorageCache,
+		Pending: server.getPendingObjects(),
+		Index:   server.RepositoryIndex.Raw,
+		Library: server.RepositoryIndex.LibraryRaw,
+		Pruned:  server.RepositoryIndex.PrunedRaw,
+	}
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	server.Logger.Debugw("Storing index in cache store",
+		"objects", len(state.Objects),
+	)
+	return server.CacheStore.Set(cacheStateKey, content)
+}
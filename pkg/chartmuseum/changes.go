@@ -0,0 +1,208 @@
+package chartmuseum
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/authz"
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxRetainedChanges bounds how many changes are kept for clients following the changes feed
+	maxRetainedChanges = 10000
+
+	// maxChangesPerResponse bounds how many changes are returned at once, clients follow the cursor for more
+	maxChangesPerResponse = 1000
+
+	chartChangeAdded   = "added"
+	chartChangeUpdated = "updated"
+	chartChangeDeleted = "deleted"
+)
+
+var (
+	errInvalidCursor = errors.New("invalid cursor")
+	errExpiredCursor = errors.New("cursor expired, fetch index.yaml again")
+)
+
+type (
+	// chartChange is a chart version added to, updated in (with different content) or deleted from the index
+	chartChange struct {
+		Cursor  string    `json:"cursor"`
+		Type    string    `json:"type"`
+		Name    string    `json:"name"`
+		Version string    `json:"version"`
+		Digest  string    `json:"digest,omitempty"`
+		Time    time.Time `json:"time"`
+		seq     int64
+	}
+
+	// chartVersionKey identifies a chart version in an indexSnapshot
+	chartVersionKey struct {
+		name    string
+		version string
+	}
+
+	// indexSnapshot is the digest of each chart version of an index at some point
+	indexSnapshot map[chartVersionKey]string
+
+	// changeLog is the recent changes to the index, numbered in order. Cursors are only valid for
+	// the process which issued them (they start with an epoch), since every instance numbers the
+	// changes it sees on its own.
+	changeLog struct {
+		epoch   string
+		lastSeq int64
+		changes []chartChange
+		lock    *sync.RWMutex
+	}
+)
+
+func newChangeLog() *changeLog {
+	return &changeLog{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		lock:  &sync.RWMutex{},
+	}
+}
+
+func (feed *changeLog) cursor(seq int64) string {
+	return fmt.Sprintf("%s.%d", feed.epoch, seq)
+}
+
+// record appends the differences between previous and current to the log
+func (feed *changeLog) record(previous indexSnapshot, current indexSnapshot, now time.Time) int {
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+	var changes []chartChange
+	for key, digest := range current {
+		previousDigest, ok := previous[key]
+		if !ok {
+			changes = append(changes, chartChange{Type: chartChangeAdded, Name: key.name, Version: key.version, Digest: digest})
+		} else if previousDigest != digest {
+			changes = append(changes, chartChange{Type: chartChangeUpdated, Name: key.name, Version: key.version, Digest: digest})
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			changes = append(changes, chartChange{Type: chartChangeDeleted, Name: key.name, Version: key.version})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Name != changes[j].Name {
+			return changes[i].Name < changes[j].Name
+		}
+		return changes[i].Version < changes[j].Version
+	})
+	for _, change := range changes {
+		feed.lastSeq++
+		change.seq = feed.lastSeq
+		change.Cursor = feed.cursor(feed.lastSeq)
+		change.Time = now
+		feed.changes = append(feed.changes, change)
+	}
+	if len(feed.changes) > maxRetainedChanges {
+		feed.changes = append([]chartChange{}, feed.changes[len(feed.changes)-maxRetainedChanges:]...)
+	}
+	return len(changes)
+}
+
+// since returns the changes after cursor (at most maxChangesPerResponse), the cursor to continue
+// from, and whether there are more changes. An empty cursor returns no changes and the current cursor.
+func (feed *changeLog) since(cursor string) ([]chartChange, string, bool, error) {
+	feed.lock.RLock()
+	defer feed.lock.RUnlock()
+	if cursor == "" {
+		return []chartChange{}, feed.cursor(feed.lastSeq), false, nil
+	}
+	parts := strings.SplitN(cursor, ".", 2)
+	if len(parts) != 2 {
+		return nil, "", false, errInvalidCursor
+	}
+	seq, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || seq < 0 {
+		return nil, "", false, errInvalidCursor
+	}
+	firstSeq := feed.lastSeq + 1
+	if len(feed.changes) > 0 {
+		firstSeq = feed.changes[0].seq
+	}
+	if parts[0] != feed.epoch || seq > feed.lastSeq || seq < firstSeq-1 {
+		return nil, "", false, errExpiredCursor
+	}
+	start := int(seq - firstSeq + 1)
+	end := len(feed.changes)
+	more := end-start > maxChangesPerResponse
+	if more {
+		end = start + maxChangesPerResponse
+	}
+	changes := append([]chartChange{}, feed.changes[start:end]...)
+	next := cursor
+	if len(changes) > 0 {
+		next = changes[len(changes)-1].Cursor
+	}
+	return changes, next, more, nil
+}
+
+// snapshotIndex returns the digest of each chart version of index
+func snapshotIndex(index *repo.Index) indexSnapshot {
+	snapshot := indexSnapshot{}
+	for name, chartVersions := range index.Entries {
+		for _, chartVersion := range chartVersions {
+			snapshot[chartVersionKey{name, chartVersion.Version}] = chartVersion.Digest
+		}
+	}
+	return snapshot
+}
+
+// recordIndexChanges records how the index changed since previous was taken
+func (server *Server) recordIndexChanges(previous indexSnapshot) {
+	count := server.Changes.record(previous, snapshotIndex(server.RepositoryIndex), time.Now())
+	if count > 0 {
+		server.Logger.Debugw("Recorded index changes",
+			"changes", count,
+		)
+	}
+}
+
+func (server *Server) getChangesRequestHandler(c *gin.Context) {
+	err := server.syncRepositoryIndexOnRequest(c.Request.Context())
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	changes, cursor, more, err := server.Changes.since(c.Query("since"))
+	switch err {
+	case nil:
+	case errExpiredCursor:
+		c.JSON(410, newErrorResponse(errorCodeCursorExpired, err.Error(), nil))
+		return
+	default:
+		c.JSON(400, newErrorResponse(errorCodeBadRequest, err.Error(), nil))
+		return
+	}
+	if server.Authorizer != nil {
+		changes = server.visibleChanges(requestIdentity(c), changes)
+	}
+	c.JSON(200, gin.H{"changes": changes, "cursor": cursor, "more": more})
+}
+
+// visibleChanges leaves out the changes to charts the Authorizer doesn't allow identity to get
+func (server *Server) visibleChanges(identity string, changes []chartChange) []chartChange {
+	visible := []chartChange{}
+	allowed := map[string]bool{}
+	for _, change := range changes {
+		if _, ok := allowed[change.Name]; !ok {
+			allowed[change.Name] = server.checkAccess(identity, authz.ActionGet, change.Name) == nil
+		}
+		if allowed[change.Name] {
+			visible = append(visible, change)
+		}
+	}
+	return visible
+}
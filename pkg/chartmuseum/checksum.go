@@ -0,0 +1,60 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// checksumHeader holds the expected sha256 of the body of binary uploads
+	checksumHeader = "Content-SHA256"
+
+	// checksumFormFieldSuffix is appended to the name of a multipart form field to get the
+	// field holding the expected sha256 of its file (e.g. chart-sha256)
+	checksumFormFieldSuffix = "-sha256"
+)
+
+// checksumMismatchError is returned when an upload does not match the checksum sent along with it
+type checksumMismatchError struct {
+	expected string
+	actual   string
+}
+
+func (err checksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected sha256 %s, received content has sha256 %s", err.expected, err.actual)
+}
+
+// verifyChecksum checks that content has the given sha256 (hex, optionally prefixed with "sha256:"),
+// so that truncated or corrupted uploads are never written to storage. An empty checksum is not checked.
+func verifyChecksum(checksum string, content []byte) error {
+	return verifyChecksumReader(checksum, bytes.NewReader(content))
+}
+
+// verifyChecksumReader is verifyChecksum for content read from r (e.g. a file on disk)
+func verifyChecksumReader(checksum string, r io.Reader) error {
+	expected := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(checksum), "sha256:"))
+	if expected == "" {
+		return nil
+	}
+	hash := sha256.New()
+	_, err := io.Copy(hash, r)
+	if err != nil {
+		return err
+	}
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != expected {
+		return checksumMismatchError{expected, actual}
+	}
+	return nil
+}
+
+// verifyFormFileChecksum checks a file from a multipart form against the <field>-sha256 form field, if present
+func verifyFormFileChecksum(c *gin.Context, ppf *packageOrProvenanceFile) error {
+	return verifyChecksum(c.Request.FormValue(ppf.field+checksumFormFieldSuffix), ppf.content)
+}
@@ -0,0 +1,98 @@
+package chartmuseum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// clamdTimeout is how long scanning an uploaded file with clamd may take
+	clamdTimeout = 30 * time.Second
+
+	// clamdChunkSize is the size of the chunks files are streamed to clamd in
+	clamdChunkSize = 64 * 1024
+)
+
+// malwareFoundError is returned when clamd finds an uploaded file to be infected
+type malwareFoundError struct {
+	filename  string
+	signature string
+}
+
+func (err malwareFoundError) Error() string {
+	return fmt.Sprintf("%s is infected: %s", err.filename, err.signature)
+}
+
+// clamdNetworkAddress splits a clamd address (unix:///path/to/clamd.sock, tcp://host:port or host:port)
+// into the network and address to dial
+func clamdNetworkAddress(address string) (string, string) {
+	if strings.HasPrefix(address, "unix://") {
+		return "unix", strings.TrimPrefix(address, "unix://")
+	}
+	if strings.HasPrefix(address, "/") {
+		return "unix", address
+	}
+	return "tcp", strings.TrimPrefix(address, "tcp://")
+}
+
+// scanForMalware streams content to clamd (INSTREAM command), returning malwareFoundError if it is infected
+func (server *Server) scanForMalware(filename string, content []byte) error {
+	if server.ClamdAddress == "" {
+		return nil
+	}
+	network, address := clamdNetworkAddress(server.ClamdAddress)
+	conn, err := net.DialTimeout(network, address, clamdTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(clamdTimeout))
+
+	w := bufio.NewWriter(conn)
+	w.WriteString("zINSTREAM\x00")
+	for start := 0; start < len(content); start += clamdChunkSize {
+		end := start + clamdChunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		binary.Write(w, binary.BigEndian, uint32(end-start))
+		w.Write(content[start:end])
+	}
+	binary.Write(w, binary.BigEndian, uint32(0))
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && len(reply) == 0 {
+		return err
+	}
+	result := strings.TrimPrefix(string(bytes.TrimRight(reply, "\x00\n")), "stream: ")
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		server.Logger.Warnw("Rejecting infected upload",
+			"filename", filename,
+			"signature", strings.TrimSuffix(result, " FOUND"),
+		)
+		return malwareFoundError{filename, strings.TrimSuffix(result, " FOUND")}
+	}
+	return fmt.Errorf("unable to scan %s for malware: %s", filename, result)
+}
+
+// malwareErrorResponse returns the status and body to respond with when scanForMalware fails
+func malwareErrorResponse(err error) (int, gin.H) {
+	if _, ok := err.(malwareFoundError); ok {
+		return 400, errorResponse(400, err)
+	}
+	return 500, errorResponse(500, err)
+}
@@ -0,0 +1,143 @@
+package chartmuseum
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseTrustedProxies parses a list of CIDRs and/or plain IP addresses
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", proxy)
+			}
+			if ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", proxy)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (server *Server) isTrustedProxy(ip net.IP) bool {
+	for _, network := range server.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultClientIPHeaders are the headers gin takes the client address from, in order
+var defaultClientIPHeaders = []string{"X-Forwarded-For", "X-Real-Ip"}
+
+// parseClientIPHeaders validates the headers to take the client address from, e.g. "CF-Connecting-IP"
+func parseClientIPHeaders(headers []string) ([]string, error) {
+	var names []string
+	for _, name := range headers {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, " :") {
+			return nil, fmt.Errorf("invalid client ip header: %q", name)
+		}
+		names = append(names, http.CanonicalHeaderKey(name))
+	}
+	return names, nil
+}
+
+// forwardedForClientIP returns the client address in an X-Forwarded-For value: with ForwardedForDepth,
+// the address added by the outermost of that many proxies, else with TrustedProxies, the last
+// address which was not added by a trusted proxy, else the first address (as gin does).
+func (server *Server) forwardedForClientIP(forwardedFor string) string {
+	addresses := strings.Split(forwardedFor, ",")
+	if server.ForwardedForDepth > 0 {
+		i := len(addresses) - server.ForwardedForDepth
+		if i < 0 {
+			i = 0
+		}
+		return parseClientIP(addresses[i])
+	}
+	if len(server.TrustedProxies) == 0 {
+		return parseClientIP(addresses[0])
+	}
+	clientIP := ""
+	for i := len(addresses) - 1; i >= 0; i-- {
+		address := parseClientIP(addresses[i])
+		if address == "" {
+			break
+		}
+		clientIP = address
+		if !server.isTrustedProxy(net.ParseIP(address)) {
+			break
+		}
+	}
+	return clientIP
+}
+
+// parseClientIP returns the ip address in value, or "" if it is not one
+func parseClientIP(value string) string {
+	ip := net.ParseIP(strings.TrimSpace(value))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// remoteIP returns the address a request was received from, without its port
+func remoteIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// clientIPMiddleware decides the address c.ClientIP() returns (as logged, rate limited and audited):
+// for requests from TrustedProxies, it is taken from the first of ClientIPHeaders (X-Forwarded-For
+// and X-Real-Ip by default) holding a valid address, see forwardedForClientIP for X-Forwarded-For.
+// For anyone else, these headers are dropped so that the address of the connection is used.
+func (server *Server) clientIPMiddleware(c *gin.Context) {
+	header := c.Request.Header
+	headers := server.ClientIPHeaders
+	if headers == nil {
+		headers = defaultClientIPHeaders
+	}
+
+	clientIP := ""
+	if remote := remoteIP(c.Request); remote != nil && server.isTrustedProxy(remote) {
+		for _, name := range headers {
+			value := header.Get(name)
+			if value == "" {
+				continue
+			}
+			if name == "X-Forwarded-For" {
+				clientIP = server.forwardedForClientIP(value)
+			} else {
+				clientIP = parseClientIP(value)
+			}
+			if clientIP != "" {
+				break
+			}
+		}
+	}
+	// gin takes the client address from these headers, or else from the connection
+	header.Del("X-Forwarded-For")
+	header.Del("X-Real-Ip")
+	if clientIP != "" {
+		header.Set("X-Forwarded-For", clientIP)
+	}
+}
@@ -0,0 +1,204 @@
+package chartmuseum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	pathutil "path"
+	"strings"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInvalidClonePrefix  = errors.New("prefix must be a relative path below the storage root, e.g. \"staging\"")
+	errCloneExists         = errors.New("a repository already exists at prefix")
+	errCloneNotNested      = errors.New("storage backend does not support listing objects below a prefix")
+	errCloneChanged        = errors.New("objects below prefix changed since the confirmation token was issued, list them again")
+	errCloneNotFound       = errors.New("no objects below prefix")
+	errCloneDeleteNoPrefix = errors.New("prefix query parameter is required")
+)
+
+// cloneResult describes a copy of the repository made by cloneRepository
+type cloneResult struct {
+	Prefix          string `json:"prefix"`
+	Charts          int    `json:"charts"`
+	ProvenanceFiles int    `json:"provenanceFiles"`
+}
+
+// cleanClonePrefix validates the prefix a repository is cloned to, returning it without slashes around
+func cleanClonePrefix(prefix string) (string, error) {
+	prefix = strings.Trim(prefix, "/")
+	cleaned := pathutil.Clean(prefix)
+	if prefix == "" || cleaned != prefix || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", errInvalidClonePrefix
+	}
+	return cleaned, nil
+}
+
+// cloneRepository copies all valid chart packages and all provenance files below prefix in storage,
+// along with an index.yaml of the copied charts, so that the copy can be served as a repository of its own
+func (server *Server) cloneRepository(prefix string) (cloneResult, int, error) {
+	result := cloneResult{Prefix: prefix}
+	if _, err := server.StorageBackend.GetObject(pathutil.Join(prefix, repo.IndexFileName)); err == nil {
+		return result, 409, errCloneExists
+	}
+	objects, err := server.StorageBackend.ListObjects()
+	if err != nil {
+		return result, 500, err
+	}
+
+	index := repo.NewIndex("")
+	index.NoMetrics = true
+	for _, object := range objects {
+		isChartPackage := object.HasExtension(repo.ChartPackageFileExtension)
+		if !isChartPackage && !strings.HasSuffix(object.Path, repo.ProvenanceFileExtension) {
+			continue
+		}
+		object, err = server.StorageBackend.GetObject(object.Path)
+		if err != nil {
+			return result, 500, err
+		}
+		if isChartPackage {
+			chartVersion, err := repo.ChartVersionFromStorageObject(object)
+			if err != nil {
+				server.Logger.Debugw("Not cloning invalid package",
+					"package", object.Path,
+				)
+				continue
+			}
+			index.AddEntry(chartVersion)
+			result.Charts++
+		} else {
+			result.ProvenanceFiles++
+		}
+		err = server.StorageBackend.PutObject(pathutil.Join(prefix, object.Path), object.Content)
+		if err != nil {
+			return result, 500, err
+		}
+	}
+
+	err = index.Regenerate()
+	if err != nil {
+		return result, 500, err
+	}
+	err = server.StorageBackend.PutObject(pathutil.Join(prefix, repo.IndexFileName), index.Raw)
+	if err != nil {
+		return result, 500, err
+	}
+	err = server.StorageBackend.PutObject(pathutil.Join(prefix, repo.IndexGzipFileName), index.RawGzip)
+	if err != nil {
+		return result, 500, err
+	}
+	server.Logger.Infow("Cloned repository",
+		"prefix", prefix,
+		"charts", result.Charts,
+		"provenanceFiles", result.ProvenanceFiles,
+	)
+	return result, 201, nil
+}
+
+func (server *Server) postCloneRequestHandler(c *gin.Context) {
+	var body struct {
+		Prefix string `json:"prefix"`
+	}
+	content, err := c.GetRawData()
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	err = json.Unmarshal(content, &body)
+	if err != nil {
+		c.JSON(400, errorResponse(400, err))
+		return
+	}
+	prefix, err := cleanClonePrefix(body.Prefix)
+	if err != nil {
+		c.JSON(400, errorResponse(400, err))
+		return
+	}
+	result, status, err := server.cloneRepository(prefix)
+	if err != nil {
+		c.JSON(status, errorResponse(status, err))
+		return
+	}
+	c.JSON(status, result)
+}
+
+// clonedObjects lists the objects below prefix in storage, sorted by path
+func (server *Server) clonedObjects(prefix string) ([]storage.Object, error) {
+	objects, err := storage.ListObjectsWithPrefix(server.StorageBackend, prefix+"/")
+	if err == storage.ErrPrefixListingUnsupported {
+		return nil, errCloneNotNested
+	}
+	return objects, err
+}
+
+// cloneDeleteToken confirms the deletion of exactly objects below prefix: it changes as soon as
+// any object is added, removed or modified, so no state needs to be kept between both calls
+func cloneDeleteToken(prefix string, objects []storage.Object) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n", prefix)
+	for _, object := range objects {
+		fmt.Fprintf(hash, "%s\t%d\n", object.Path, object.LastModified.UnixNano())
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// deleteCloneRequestHandler deletes everything below a prefix (e.g. a clone). Without ?confirm, nothing
+// is deleted: the objects which would be are listed along with a token, which must be passed as ?confirm.
+func (server *Server) deleteCloneRequestHandler(c *gin.Context) {
+	if c.Query("prefix") == "" {
+		c.JSON(400, errorResponse(400, errCloneDeleteNoPrefix))
+		return
+	}
+	prefix, err := cleanClonePrefix(c.Query("prefix"))
+	if err != nil {
+		c.JSON(400, errorResponse(400, err))
+		return
+	}
+	objects, err := server.clonedObjects(prefix)
+	if err == errCloneNotNested {
+		c.JSON(400, errorResponse(400, err))
+		return
+	}
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	if len(objects) == 0 {
+		c.JSON(404, errorResponse(404, errCloneNotFound))
+		return
+	}
+	paths := []string{}
+	for _, object := range objects {
+		paths = append(paths, object.Path)
+	}
+	token := cloneDeleteToken(prefix, objects)
+	confirm := c.Query("confirm")
+	if confirm == "" {
+		c.JSON(200, gin.H{"prefix": prefix, "objects": paths, "token": token, "deleted": false})
+		return
+	}
+	if confirm != token {
+		c.JSON(409, errorResponse(409, errCloneChanged))
+		return
+	}
+	for _, path := range paths {
+		err = server.StorageBackend.DeleteObject(path)
+		if err != nil {
+			c.JSON(500, errorResponse(500, err))
+			return
+		}
+	}
+	server.Logger.Infow("Deleted objects below prefix",
+		"prefix", prefix,
+		"objects", len(paths),
+	)
+	c.JSON(200, gin.H{"prefix": prefix, "objects": paths, "deleted": true})
+}
@@ -0,0 +1,90 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errCompressionLevel = errors.New("compression level must be between 1 and 9")
+
+// compressingWriter holds back JSON responses until they are complete, to gzip those of at least
+// minSize bytes. Other responses (e.g. chart packages, which are compressed already) are written
+// through as they are.
+type compressingWriter struct {
+	gin.ResponseWriter
+	level     int
+	minSize   int
+	buf       bytes.Buffer
+	decided   bool
+	buffering bool
+}
+
+// compressionMiddleware gzips JSON responses for clients accepting it, if CompressResponses is set
+func (server *Server) compressionMiddleware(c *gin.Context) {
+	if c.Request.Method == "HEAD" || !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Next()
+		return
+	}
+	writer := &compressingWriter{ResponseWriter: c.Writer, level: server.CompressionLevel, minSize: server.CompressionMinSize}
+	c.Writer = writer
+	c.Next()
+	c.Writer = writer.ResponseWriter
+	err := writer.finish()
+	if err != nil {
+		server.Logger.Warnw("Unable to write compressed response",
+			"path", c.Request.URL.Path,
+			"error", err.Error(),
+		)
+	}
+}
+
+// Write buffers the body of JSON responses, and writes through the body of any other response
+func (w *compressingWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		w.buffering = strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+	}
+	if !w.buffering {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+// WriteString buffers or writes through like Write
+func (w *compressingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// finish writes a buffered response, compressed if it is large enough
+func (w *compressingWriter) finish() error {
+	if !w.buffering {
+		return nil
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	if w.buf.Len() < w.minSize {
+		_, err := w.ResponseWriter.Write(w.buf.Bytes())
+		return err
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	gzw, err := gzip.NewWriterLevel(w.ResponseWriter, w.level)
+	if err != nil {
+		return err
+	}
+	_, err = gzw.Write(w.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+func validateCompressionLevel(level int) error {
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		return errCompressionLevel
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package chartmuseum
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// statusClientClosedRequest is the status logged for requests given up because the client went
+// away (as nginx does), which is never received by anyone
+const statusClientClosedRequest = 499
+
+// clientWentAway aborts the request and returns true if its context is done, i.e. the client
+// disconnected, so that a failure of storage reads given up with it is not reported as an error
+func (server *Server) clientWentAway(c *gin.Context) bool {
+	err := c.Request.Context().Err()
+	if err == nil {
+		return false
+	}
+	server.Logger.Debugw("Client went away, giving up request",
+		"path", c.Request.URL.Path,
+		"error", err.Error(),
+	)
+	c.AbortWithStatus(statusClientClosedRequest)
+	return true
+}
@@ -0,0 +1,170 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cosignSignatureFormFieldName is the form field of uploads holding a cosign signature of the chart package
+const cosignSignatureFormFieldName = "sig"
+
+var errCosignSignatureRequired = errors.New("chart packages must be uploaded along with a valid cosign signature")
+
+// invalidSignatureError is returned when a cosign signature is missing, malformed or doesn't verify
+type invalidSignatureError struct {
+	err error
+}
+
+func (err invalidSignatureError) Error() string {
+	return err.err.Error()
+}
+
+// loadCosignVerifier creates the verifier of cosign signatures from the files of a public key
+// and/or root certificates, nil if neither is configured
+func loadCosignVerifier(keyFilename string, rootsFilename string, identity string, issuer string) (*repo.CosignVerifier, error) {
+	if keyFilename == "" && rootsFilename == "" {
+		if identity != "" || issuer != "" {
+			return nil, errors.New("cosign identity and issuer can only be verified with cosign root certificates")
+		}
+		return nil, nil
+	}
+	var key, roots []byte
+	var err error
+	if keyFilename != "" {
+		key, err = ioutil.ReadFile(keyFilename)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rootsFilename != "" {
+		roots, err = ioutil.ReadFile(rootsFilename)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return repo.NewCosignVerifier(key, roots, identity, issuer)
+}
+
+func isCosignSignatureFile(filename string) bool {
+	return strings.HasSuffix(filename, repo.CosignSignatureExtension)
+}
+
+// cosignSignaturePath returns the filename of the cosign signature of a chart package
+func cosignSignaturePath(filename string) string {
+	return filename + ".sig"
+}
+
+// checkCosignSignature verifies the cosign signature of a chart package with the configured
+// verifier. Without one, signatures are only checked to be well-formed and, when they come with a
+// certificate, to match the package.
+func (server *Server) checkCosignSignature(content []byte, signatureContent []byte) error {
+	var err error
+	if server.CosignVerifier != nil {
+		err = server.CosignVerifier.Verify(content, signatureContent)
+	} else {
+		var signature *repo.CosignSignature
+		signature, err = repo.ParseCosignSignature(signatureContent)
+		if err == nil && signature.Certificate != nil {
+			err = signature.VerifyKey(signature.Certificate.PublicKey, content)
+		}
+	}
+	if err != nil {
+		return invalidSignatureError{err}
+	}
+	return nil
+}
+
+// extractCosignSignatureFormFile returns the cosign signature uploaded in a form along with a
+// chart package, named after the package, once verified. It is nil if there is none.
+func (server *Server) extractCosignSignatureFormFile(req *http.Request, ppFiles []*packageOrProvenanceFile) (*packageOrProvenanceFile, int, error) {
+	var chartPackage *packageOrProvenanceFile
+	for _, ppf := range ppFiles {
+		if server.isChartFormField(ppf.field) {
+			chartPackage = ppf
+		}
+	}
+	file, header, _ := req.FormFile(cosignSignatureFormFieldName)
+	if file == nil || header == nil {
+		if chartPackage != nil && server.RequireCosignSignature {
+			return nil, 400, invalidSignatureError{errCosignSignatureRequired}
+		}
+		return nil, 200, nil
+	}
+	if chartPackage == nil {
+		return nil, 400, fmt.Errorf("no chart package found in form field %s for the cosign signature", server.ChartPostFormFieldName)
+	}
+	buf := bytes.NewBuffer(nil)
+	_, err := io.Copy(buf, file)
+	if err != nil {
+		return nil, 500, err
+	}
+	content := buf.Bytes()
+	err = server.checkCosignSignature(chartPackage.content, content)
+	if err != nil {
+		return nil, 400, err
+	}
+	return &packageOrProvenanceFile{cosignSignaturePath(chartPackage.filename), content, cosignSignatureFormFieldName}, 200, nil
+}
+
+// postChartVersionSignatureRequestHandler adds a cosign signature to a chart version already uploaded
+func (server *Server) postChartVersionSignatureRequestHandler(c *gin.Context) {
+	name := c.Param("name")
+	version := c.Param("version")
+	err := server.checkChartOwner(name, requestIdentity(c))
+	if err != nil {
+		c.JSON(403, newErrorResponse(errorCodeNotChartOwner, err.Error(), nil))
+		return
+	}
+	content, status, err := server.readRequestBody(c)
+	if err != nil {
+		c.JSON(status, errorResponse(status, err))
+		return
+	}
+	packageFilename := repo.ChartPackageFilenameFromNameVersion(name, version)
+	chartPackage, err := storage.GetObjectWithContext(c.Request.Context(), server.StorageBackend, packageFilename)
+	if server.clientWentAway(c) {
+		return
+	}
+	if err != nil {
+		c.JSON(404, server.chartNotFoundResponse(c, name, version))
+		return
+	}
+	err = server.checkCosignSignature(chartPackage.Content, content)
+	if err != nil {
+		c.JSON(400, errorResponse(400, err))
+		return
+	}
+	filename := repo.CosignSignatureFilenameFromNameVersion(name, version)
+	unlock, status, err := server.acquireUploadLock(filename)
+	if err != nil {
+		c.JSON(status, errorResponse(status, err))
+		return
+	}
+	defer unlock()
+	if !server.allowOverwrite(c) {
+		_, err = server.StorageBackend.GetObject(filename)
+		if err == nil {
+			c.JSON(409, newErrorResponse(errorCodeAlreadyExists, fmt.Sprintf("%s already exists", filename), nil)) // conflict
+			return
+		}
+	}
+	server.Logger.Debugw("Adding cosign signature to storage",
+		"signature", filename,
+	)
+	err = server.putUploadedObject(filename, content)
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	c.JSON(201, objectSavedResponse)
+}
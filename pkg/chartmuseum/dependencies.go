@@ -0,0 +1,93 @@
+package chartmuseum
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+)
+
+const (
+	// dependencyValidationWarn logs uploaded charts with unresolvable dependencies
+	dependencyValidationWarn = "warn"
+
+	// dependencyValidationReject refuses uploaded charts with unresolvable dependencies
+	dependencyValidationReject = "reject"
+)
+
+// chartDependency is a dependency of a chart version, and the version it resolves to in this repository, if any
+type chartDependency struct {
+	repo.ChartDependency
+	Resolvable      bool   `json:"resolvable"`
+	ResolvedVersion string `json:"resolvedVersion,omitempty"`
+}
+
+func validateDependencyValidationMode(mode string) error {
+	switch mode {
+	case "", dependencyValidationWarn, dependencyValidationReject:
+		return nil
+	}
+	return fmt.Errorf("invalid dependency validation mode %q, must be %q or %q",
+		mode, dependencyValidationWarn, dependencyValidationReject)
+}
+
+// resolveChartDependencies looks up dependencies on repositoryURL (the url of this repository) in the index
+func (server *Server) resolveChartDependencies(dependencies []repo.ChartDependency, repositoryURL string) []chartDependency {
+	resolved := []chartDependency{}
+	for _, dependency := range dependencies {
+		d := chartDependency{ChartDependency: dependency}
+		if repositoryURL != "" && strings.TrimSuffix(dependency.Repository, "/") == repositoryURL {
+			chartVersion, err := server.RepositoryIndex.Get(dependency.Name, dependency.Version)
+			if err == nil {
+				d.Resolvable = true
+				d.ResolvedVersion = chartVersion.Version
+			}
+		}
+		resolved = append(resolved, d)
+	}
+	return resolved
+}
+
+// isAllowedDependencyRepo checks whether repository is one of the upstream repositories trusted
+// to provide dependencies
+func (server *Server) isAllowedDependencyRepo(repository string) bool {
+	for _, allowed := range server.DependencyRepos {
+		if strings.TrimSuffix(repository, "/") == strings.TrimSuffix(allowed, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkChartDependencies verifies that all dependencies of an uploaded chart package are either
+// bundled with it, available in this repository or in an allowed upstream repository. Depending on
+// DependencyValidation, unresolvable dependencies are only logged, or returned as an error.
+func (server *Server) checkChartDependencies(content []byte, repositoryURL string) error {
+	if server.DependencyValidation == "" {
+		return nil
+	}
+	dependencies, err := repo.ChartDependenciesFromContent(content)
+	if err == repo.ErrorInvalidChartPackage {
+		return nil // reported when saving the package
+	}
+	if err != nil {
+		return err
+	}
+	var unresolvable []string
+	for _, d := range server.resolveChartDependencies(dependencies, repositoryURL) {
+		if d.Bundled || d.Resolvable || server.isAllowedDependencyRepo(d.Repository) {
+			continue
+		}
+		unresolvable = append(unresolvable, fmt.Sprintf("%s %s (%s)", d.Name, d.Version, d.Repository))
+	}
+	if len(unresolvable) == 0 {
+		return nil
+	}
+	if server.DependencyValidation == dependencyValidationWarn {
+		server.Logger.Warnw("Accepting chart package with unresolvable dependencies",
+			"dependencies", unresolvable,
+		)
+		return nil
+	}
+	return fmt.Errorf("unresolvable dependencies: %s", strings.Join(unresolvable, ", "))
+}
@@ -0,0 +1,101 @@
+package chartmuseum
+
+import (
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Codes of error responses, which clients can rely on instead of parsing messages. Codes are
+// never changed or reused once released.
+const (
+	errorCodeBadRequest             = "bad_request"
+	errorCodeForbidden              = "forbidden"
+	errorCodeNotFound               = "not_found"
+	errorCodeConflict               = "conflict"
+	errorCodeUnprocessable          = "unprocessable"
+	errorCodeTooManyRequests        = "too_many_requests"
+	errorCodeInternal               = "internal_error"
+	errorCodeUnavailable            = "unavailable"
+	errorCodeChartNotFound          = "chart_not_found"
+	errorCodeChartVersionNotFound   = "chart_version_not_found"
+	errorCodeInvalidChartPackage    = "invalid_chart_package"
+	errorCodeUnsupportedExtension   = "unsupported_file_extension"
+	errorCodeAlreadyExists          = "already_exists"
+	errorCodeReadOnly               = "read_only"
+	errorCodeMaintenanceMode        = "maintenance_mode"
+	errorCodeTooManyUploads         = "too_many_uploads"
+	errorCodeUploadQueueFull        = "upload_queue_full"
+	errorCodeChecksumMismatch       = "checksum_mismatch"
+	errorCodeUnsafeChartPackage     = "unsafe_chart_package"
+	errorCodeUnresolvedDependencies = "unresolvable_dependencies"
+	errorCodeSecretsDetected        = "secrets_detected"
+	errorCodePolicyViolation        = "policy_violation"
+	errorCodeMalwareFound           = "malware_found"
+	errorCodeAuditRunning           = "audit_running"
+	errorCodeNoBackupBackend        = "no_backup_backend"
+	errorCodeNotDualWrite           = "not_dual_write"
+	errorCodeAuthLockedOut          = "auth_locked_out"
+	errorCodeCursorExpired          = "cursor_expired"
+	errorCodeNotChartOwner          = "not_chart_owner"
+	errorCodeAccessDenied           = "access_denied"
+	errorCodeWriteNotVerified       = "write_not_verified"
+	errorCodeInvalidSignature       = "invalid_signature"
+	errorCodeInvalidAttestation     = "invalid_attestation"
+)
+
+// newErrorResponse returns the body of an error response: a stable code, a human readable
+// message (also as "error", for clients predating codes), and optional details
+func newErrorResponse(code string, message string, details interface{}) gin.H {
+	response := gin.H{"code": code, "message": message, "error": message}
+	if details != nil {
+		response["details"] = details
+	}
+	return response
+}
+
+// errorResponse describes err in an error response with the given status, using the code of
+// the kind of error if it is known, or else the generic code for status
+func errorResponse(status int, err error) gin.H {
+	return newErrorResponse(errorCode(status, err), err.Error(), nil)
+}
+
+func errorCode(status int, err error) string {
+	switch err.(type) {
+	case checksumMismatchError:
+		return errorCodeChecksumMismatch
+	case malwareFoundError:
+		return errorCodeMalwareFound
+	case policyViolationError:
+		return errorCodePolicyViolation
+	case writeVerificationError:
+		return errorCodeWriteNotVerified
+	case invalidSignatureError:
+		return errorCodeInvalidSignature
+	case unsafeChartPackageError:
+		return errorCodeUnsafeChartPackage
+	}
+	switch err {
+	case repo.ErrorInvalidChartPackage:
+		return errorCodeInvalidChartPackage
+	case errorAlreadyExists:
+		return errorCodeAlreadyExists
+	}
+	switch status {
+	case 400:
+		return errorCodeBadRequest
+	case 403:
+		return errorCodeForbidden
+	case 404:
+		return errorCodeNotFound
+	case 409:
+		return errorCodeConflict
+	case 422:
+		return errorCodeUnprocessable
+	case 429:
+		return errorCodeTooManyRequests
+	case 503:
+		return errorCodeUnavailable
+	}
+	return errorCodeInternal
+}
@@ -0,0 +1,29 @@
+package chartmuseum
+
+import (
+	"github.com/kubernetes-helm/chartmuseum/pkg/winsvc"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// withEventLog returns a Logger writing to the Windows event log as source, in addition to logger
+func withEventLog(logger *Logger, source string, json bool, debug bool) (*Logger, error) {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoder := zapcore.NewConsoleEncoder(encoderConfig)
+	if json {
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	}
+	level := zapcore.InfoLevel
+	if debug {
+		level = zapcore.DebugLevel
+	}
+	eventLogCore, err := winsvc.NewEventLogCore(source, encoder, level)
+	if err != nil {
+		return logger, err
+	}
+	tee := zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, eventLogCore)
+	})
+	return &Logger{logger.Desugar().WithOptions(tee).Sugar()}, nil
+}
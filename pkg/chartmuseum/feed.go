@@ -0,0 +1,108 @@
+package chartmuseum
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+const (
+	// chartFeedFileName is requested in place of a version to get the Atom feed of a chart
+	chartFeedFileName = "feed.atom"
+
+	// chartFeedContentType is the http content-type header for Atom feeds
+	chartFeedContentType = "application/atom+xml"
+
+	// maxChartFeedEntries is how many of the most recently created versions of a chart are in its feed
+	maxChartFeedEntries = 20
+)
+
+type (
+	// atomFeed is an Atom feed (RFC 4287) of the versions of a chart
+	atomFeed struct {
+		XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string      `xml:"id"`
+		Title   string      `xml:"title"`
+		Updated string      `xml:"updated"`
+		Link    []atomLink  `xml:"link"`
+		Entries []atomEntry `xml:"entry"`
+	}
+
+	atomLink struct {
+		Rel  string `xml:"rel,attr,omitempty"`
+		Href string `xml:"href,attr"`
+	}
+
+	atomEntry struct {
+		ID      string     `xml:"id"`
+		Title   string     `xml:"title"`
+		Updated string     `xml:"updated"`
+		Summary string     `xml:"summary,omitempty"`
+		Link    []atomLink `xml:"link"`
+	}
+)
+
+// chartFeed returns the Atom feed of the most recently created versions of a chart,
+// with links relative to repositoryURL
+func chartFeed(name string, chartVersions helm_repo.ChartVersions, repositoryURL string) atomFeed {
+	recent := append(helm_repo.ChartVersions{}, chartVersions...)
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].Created.After(recent[j].Created)
+	})
+	if len(recent) > maxChartFeedEntries {
+		recent = recent[:maxChartFeedEntries]
+	}
+
+	chartURL := fmt.Sprintf("%s/api/charts/%s", repositoryURL, name)
+	feed := atomFeed{
+		ID:      chartURL,
+		Title:   fmt.Sprintf("%s chart versions", name),
+		Updated: time.Time{}.Format(time.RFC3339),
+		Link:    []atomLink{{Rel: "self", Href: fmt.Sprintf("%s/%s", chartURL, chartFeedFileName)}},
+	}
+	if len(recent) > 0 {
+		feed.Updated = recent[0].Created.UTC().Format(time.RFC3339)
+	}
+	for _, chartVersion := range recent {
+		entry := atomEntry{
+			ID:      fmt.Sprintf("%s/%s", chartURL, chartVersion.Version),
+			Title:   fmt.Sprintf("%s %s", name, chartVersion.Version),
+			Updated: chartVersion.Created.UTC().Format(time.RFC3339),
+			Summary: chartVersion.Description,
+		}
+		if len(chartVersion.URLs) > 0 {
+			href := chartVersion.URLs[0]
+			if !strings.Contains(href, "://") {
+				href = fmt.Sprintf("%s/%s", repositoryURL, href)
+			}
+			entry.Link = append(entry.Link, atomLink{Rel: "enclosure", Href: href})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+func (server *Server) getChartFeedRequestHandler(c *gin.Context) {
+	name := c.Param("name")
+	err := server.syncRepositoryIndexOnRequest(c.Request.Context())
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	chartVersions, ok := server.RepositoryIndex.Entries[name]
+	if !ok {
+		c.JSON(404, server.chartNotFoundResponse(c, name, ""))
+		return
+	}
+	content, err := xml.MarshalIndent(chartFeed(name, chartVersions, server.repositoryURL(c)), "", "  ")
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	c.Data(200, chartFeedContentType, append([]byte(xml.Header), content...))
+}
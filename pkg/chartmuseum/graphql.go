@@ -0,0 +1,316 @@
+package chartmuseum
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+
+	"github.com/gin-gonic/gin"
+	graphql "github.com/graph-gophers/graphql-go"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+var graphQLSchema = `
+	schema {
+		query: Query
+	}
+
+	type Query {
+		# all charts, optionally filtered by a search term matched against name, description and keywords,
+		# by annotations of their latest version ("key=value", or just "key" for any value),
+		# and by the type of their latest version ("application" or "library")
+		charts(search: String, annotations: [String!], type: String): [Chart!]!
+		chart(name: String!): Chart
+		# version may be omitted (or "latest") for the latest version
+		chartVersion(name: String!, version: String): ChartVersion
+		stats: Stats!
+	}
+
+	type Chart {
+		name: String!
+		latest: ChartVersion!
+		versions: [ChartVersion!]!
+	}
+
+	type ChartVersion {
+		name: String!
+		version: String!
+		appVersion: String!
+		description: String!
+		home: String!
+		icon: String!
+		keywords: [String!]!
+		sources: [String!]!
+		maintainers: [Maintainer!]!
+		annotations: [Annotation!]!
+		apiVersion: String!
+		# "application" or "library"
+		type: String!
+		urls: [String!]!
+		digest: String!
+		created: String!
+		deprecated: Boolean!
+	}
+
+	type Maintainer {
+		name: String!
+		email: String!
+	}
+
+	type Annotation {
+		key: String!
+		value: String!
+	}
+
+	type Stats {
+		charts: Int!
+		chartVersions: Int!
+		generated: String!
+	}
+`
+
+type (
+	graphQLRequest struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+
+	graphQLQueryResolver struct {
+		server *Server
+	}
+	graphQLChartResolver struct {
+		versions helm_repo.ChartVersions
+	}
+	graphQLChartVersionResolver struct {
+		chartVersion *helm_repo.ChartVersion
+	}
+	graphQLMaintainerResolver struct {
+		maintainer *chart.Maintainer
+	}
+	graphQLAnnotationResolver struct {
+		key   string
+		value string
+	}
+	graphQLStatsResolver struct {
+		index *repo.Index
+	}
+
+	// graphQLIndexKey is the context key of the index a query may see
+	graphQLIndexKey struct{}
+)
+
+func (server *Server) newGraphQLRequestHandler() gin.HandlerFunc {
+	schema := graphql.MustParseSchema(graphQLSchema, &graphQLQueryResolver{server})
+	return func(c *gin.Context) {
+		var params graphQLRequest
+		if c.Request.Method == "GET" {
+			params.Query = c.Query("query")
+			params.OperationName = c.Query("operationName")
+			if variables := c.Query("variables"); variables != "" {
+				err := json.Unmarshal([]byte(variables), &params.Variables)
+				if err != nil {
+					c.JSON(400, errorResponse(400, err))
+					return
+				}
+			}
+		} else {
+			err := json.NewDecoder(c.Request.Body).Decode(&params)
+			if err != nil {
+				c.JSON(400, errorResponse(400, err))
+				return
+			}
+		}
+		index, ok := server.visibleIndexForRequest(c)
+		if !ok {
+			return
+		}
+		ctx := context.WithValue(c.Request.Context(), graphQLIndexKey{}, index)
+		response := schema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+		c.JSON(200, response)
+	}
+}
+
+// index returns the index the query may see, set by the request handler
+func (r *graphQLQueryResolver) index(ctx context.Context) *repo.Index {
+	if index, ok := ctx.Value(graphQLIndexKey{}).(*repo.Index); ok {
+		return index
+	}
+	return r.server.RepositoryIndex
+}
+
+func (r *graphQLQueryResolver) Charts(ctx context.Context, args struct {
+	Search      *string
+	Annotations *[]string
+	Type        *string
+}) []*graphQLChartResolver {
+	index := r.index(ctx)
+	var names []string
+	for name := range index.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	charts := []*graphQLChartResolver{}
+	for _, name := range names {
+		versions := index.Entries[name]
+		if len(versions) == 0 {
+			continue
+		}
+		if args.Search != nil && !chartVersionMatchesSearch(versions[0], *args.Search) {
+			continue
+		}
+		if args.Annotations != nil && !repo.ChartVersionMatchesAnnotations(versions[0], *args.Annotations) {
+			continue
+		}
+		if args.Type != nil && repo.ChartVersionType(versions[0]) != *args.Type {
+			continue
+		}
+		charts = append(charts, &graphQLChartResolver{versions})
+	}
+	return charts
+}
+
+func (r *graphQLQueryResolver) Chart(ctx context.Context, args struct{ Name string }) *graphQLChartResolver {
+	versions := r.index(ctx).Entries[args.Name]
+	if len(versions) == 0 {
+		return nil
+	}
+	return &graphQLChartResolver{versions}
+}
+
+func (r *graphQLQueryResolver) ChartVersion(ctx context.Context, args struct {
+	Name    string
+	Version *string
+}) *graphQLChartVersionResolver {
+	version := ""
+	if args.Version != nil && *args.Version != "latest" {
+		version = *args.Version
+	}
+	chartVersion, err := r.index(ctx).Get(args.Name, version)
+	if err != nil {
+		return nil
+	}
+	return &graphQLChartVersionResolver{chartVersion}
+}
+
+func (r *graphQLQueryResolver) Stats(ctx context.Context) *graphQLStatsResolver {
+	return &graphQLStatsResolver{r.index(ctx)}
+}
+
+func (r *graphQLChartResolver) Name() string {
+	return r.versions[0].Name
+}
+
+func (r *graphQLChartResolver) Latest() *graphQLChartVersionResolver {
+	return &graphQLChartVersionResolver{r.versions[0]}
+}
+
+func (r *graphQLChartResolver) Versions() []*graphQLChartVersionResolver {
+	var versions []*graphQLChartVersionResolver
+	for _, chartVersion := range r.versions {
+		versions = append(versions, &graphQLChartVersionResolver{chartVersion})
+	}
+	return versions
+}
+
+func (r *graphQLChartVersionResolver) Name() string        { return r.chartVersion.Name }
+func (r *graphQLChartVersionResolver) Version() string     { return r.chartVersion.Version }
+func (r *graphQLChartVersionResolver) AppVersion() string  { return r.chartVersion.AppVersion }
+func (r *graphQLChartVersionResolver) Description() string { return r.chartVersion.Description }
+func (r *graphQLChartVersionResolver) Home() string        { return r.chartVersion.Home }
+func (r *graphQLChartVersionResolver) Icon() string        { return r.chartVersion.Icon }
+func (r *graphQLChartVersionResolver) Keywords() []string {
+	return nonNilStrings(r.chartVersion.Keywords)
+}
+func (r *graphQLChartVersionResolver) Sources() []string {
+	return nonNilStrings(r.chartVersion.Sources)
+}
+func (r *graphQLChartVersionResolver) Urls() []string   { return nonNilStrings(r.chartVersion.URLs) }
+func (r *graphQLChartVersionResolver) Digest() string   { return r.chartVersion.Digest }
+func (r *graphQLChartVersionResolver) Deprecated() bool { return r.chartVersion.Deprecated }
+
+func (r *graphQLChartVersionResolver) Created() string {
+	return r.chartVersion.Created.Format(time.RFC3339)
+}
+
+func (r *graphQLChartVersionResolver) Maintainers() []*graphQLMaintainerResolver {
+	maintainers := []*graphQLMaintainerResolver{}
+	for _, maintainer := range r.chartVersion.Maintainers {
+		maintainers = append(maintainers, &graphQLMaintainerResolver{maintainer})
+	}
+	return maintainers
+}
+
+// APIVersion defaults to "v1", as for charts without apiVersion in Chart.yaml
+func (r *graphQLChartVersionResolver) APIVersion() string {
+	if r.chartVersion.ApiVersion == "" {
+		return repo.ChartAPIVersionV1
+	}
+	return r.chartVersion.ApiVersion
+}
+
+func (r *graphQLChartVersionResolver) Type() string {
+	return repo.ChartVersionType(r.chartVersion)
+}
+
+// Annotations are sorted by key, as the order in Chart.yaml is not preserved
+func (r *graphQLChartVersionResolver) Annotations() []*graphQLAnnotationResolver {
+	var keys []string
+	for key := range r.chartVersion.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	annotations := []*graphQLAnnotationResolver{}
+	for _, key := range keys {
+		annotations = append(annotations, &graphQLAnnotationResolver{key, r.chartVersion.Annotations[key]})
+	}
+	return annotations
+}
+
+func (r *graphQLAnnotationResolver) Key() string   { return r.key }
+func (r *graphQLAnnotationResolver) Value() string { return r.value }
+
+func (r *graphQLMaintainerResolver) Name() string  { return r.maintainer.Name }
+func (r *graphQLMaintainerResolver) Email() string { return r.maintainer.Email }
+
+func (r *graphQLStatsResolver) Charts() int32 {
+	return int32(len(r.index.Entries))
+}
+
+func (r *graphQLStatsResolver) ChartVersions() int32 {
+	var count int32
+	for _, versions := range r.index.Entries {
+		count += int32(len(versions))
+	}
+	return count
+}
+
+func (r *graphQLStatsResolver) Generated() string {
+	return r.index.Generated.Format(time.RFC3339)
+}
+
+func chartVersionMatchesSearch(chartVersion *helm_repo.ChartVersion, search string) bool {
+	search = strings.ToLower(search)
+	if strings.Contains(strings.ToLower(chartVersion.Name), search) ||
+		strings.Contains(strings.ToLower(chartVersion.Description), search) {
+		return true
+	}
+	for _, keyword := range chartVersion.Keywords {
+		if strings.Contains(strings.ToLower(keyword), search) {
+			return true
+		}
+	}
+	return false
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
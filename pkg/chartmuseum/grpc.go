@@ -0,0 +1,446 @@
+package chartmuseum
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/authz"
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+// GRPCServiceName is the fully qualified name of the chart gRPC service
+const GRPCServiceName = "chartmuseum.ChartService"
+
+var errProvenanceMismatch = errors.New("provenance file is not for the uploaded chart package")
+
+type (
+	// ListChartsRequest is the request message for ChartService/ListCharts
+	ListChartsRequest struct{}
+
+	// ListChartsResponse is the response message for ChartService/ListCharts
+	ListChartsResponse struct {
+		Charts map[string]helm_repo.ChartVersions `json:"charts"`
+	}
+
+	// SearchChartsRequest is the request message for ChartService/SearchCharts
+	SearchChartsRequest struct {
+		Query string `json:"query"`
+		Type  string `json:"type,omitempty"` // "application" or "library", any type if empty
+	}
+
+	// SearchChartsResponse is the response message for ChartService/SearchCharts,
+	// containing the latest version of each matching chart
+	SearchChartsResponse struct {
+		ChartVersions []*helm_repo.ChartVersion `json:"chartVersions"`
+	}
+
+	// GetChartRequest is the request message for ChartService/GetChart
+	GetChartRequest struct {
+		Name    string `json:"name"`
+		Version string `json:"version"` // empty or "latest" for the latest version
+	}
+
+	// GetChartResponse is the response message for ChartService/GetChart
+	GetChartResponse struct {
+		ChartVersion *helm_repo.ChartVersion `json:"chartVersion"`
+	}
+
+	// UploadChartRequest is the request message for ChartService/UploadChart
+	UploadChartRequest struct {
+		Package    []byte `json:"package"`
+		Provenance []byte `json:"provenance,omitempty"`
+		Signature  []byte `json:"signature,omitempty"` // cosign signature of the package
+	}
+
+	// UploadChartResponse is the response message for ChartService/UploadChart
+	UploadChartResponse struct {
+		Saved bool `json:"saved"`
+	}
+
+	// DeleteChartRequest is the request message for ChartService/DeleteChart
+	DeleteChartRequest struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+
+	// DeleteChartResponse is the response message for ChartService/DeleteChart
+	DeleteChartResponse struct {
+		Deleted bool `json:"deleted"`
+	}
+
+	// GRPCCodec encodes gRPC messages as JSON, so that the service can be
+	// used without generated protobuf code
+	GRPCCodec struct{}
+
+	grpcService struct {
+		server       *Server
+		auth         *basicAuthVerifier
+		enableAPI    bool
+		enableDelete bool
+	}
+)
+
+// Marshal returns the JSON encoding of v
+func (GRPCCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal parses the JSON encoded data into v
+func (GRPCCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// String returns the name of the codec
+func (GRPCCodec) String() string {
+	return "json"
+}
+
+func (server *Server) newGRPCServer(options ServerOptions) (*grpc.Server, error) {
+	service := &grpcService{
+		server:       server,
+		enableAPI:    options.Routes.APIWrite,
+		enableDelete: options.Routes.APIDelete,
+	}
+	service.auth = authVerifierFromOptions(options)
+
+	serverOptions := []grpc.ServerOption{
+		grpc.CustomCodec(GRPCCodec{}),
+		grpc.UnaryInterceptor(service.authInterceptor),
+	}
+	if options.TlsCert != "" && options.TlsKey != "" {
+		creds, err := credentials.NewServerTLSFromFile(options.TlsCert, options.TlsKey)
+		if err != nil {
+			return nil, err
+		}
+		serverOptions = append(serverOptions, grpc.Creds(creds))
+	}
+
+	grpcServer := grpc.NewServer(serverOptions...)
+	grpcServer.RegisterService(&grpc.ServiceDesc{
+		ServiceName: GRPCServiceName,
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: "ListCharts", Handler: grpcMethodHandler(func() interface{} { return new(ListChartsRequest) }, service.listCharts)},
+			{MethodName: "SearchCharts", Handler: grpcMethodHandler(func() interface{} { return new(SearchChartsRequest) }, service.searchCharts)},
+			{MethodName: "GetChart", Handler: grpcMethodHandler(func() interface{} { return new(GetChartRequest) }, service.getChart)},
+			{MethodName: "UploadChart", Handler: grpcMethodHandler(func() interface{} { return new(UploadChartRequest) }, service.uploadChart)},
+			{MethodName: "DeleteChart", Handler: grpcMethodHandler(func() interface{} { return new(DeleteChartRequest) }, service.deleteChart)},
+		},
+		Streams: []grpc.StreamDesc{},
+	}, service)
+	return grpcServer, nil
+}
+
+func (server *Server) serveGRPC(listener net.Listener) {
+	server.Logger.Fatal(server.GRPCServer.Serve(listener))
+}
+
+// grpcMethodHandler adapts fn into a grpc method handler, decoding each request into a message from newReq
+func grpcMethodHandler(newReq func() interface{}, fn func(context.Context, interface{}) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := newReq()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return fn(ctx, in)
+		}
+		return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv}, fn)
+	}
+}
+
+func (service *grpcService) authInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if service.auth != nil {
+		md, _ := metadata.FromIncomingContext(ctx)
+		var authorization string
+		if values := md["authorization"]; len(values) > 0 {
+			authorization = values[0]
+		}
+		tarpit, ip := service.server.AuthTarpit, grpcClientIP(ctx)
+		if tarpit != nil {
+			delay, lockedOut := tarpit.check(ip, time.Now())
+			if lockedOut > 0 {
+				authLockedOutRequestsCounter.Inc()
+				return nil, grpc.Errorf(codes.ResourceExhausted, "too many authentication failures, try again later")
+			}
+			time.Sleep(delay)
+		}
+		if !service.auth.verifyHeader(authorization) {
+			if tarpit != nil {
+				tarpit.fail(ip, time.Now())
+			}
+			recordAuthFailure("grpc", info.FullMethod, authorization)
+			return nil, grpc.Errorf(codes.Unauthenticated, "unauthorized")
+		}
+		if tarpit != nil {
+			tarpit.succeed(ip)
+		}
+	}
+	if service.server.inMaintenanceMode() {
+		return nil, grpc.Errorf(codes.Unavailable, "server is in maintenance mode")
+	}
+	return handler(ctx, req)
+}
+
+func (service *grpcService) listCharts(ctx context.Context, in interface{}) (interface{}, error) {
+	err := service.server.checkAccess(service.identity(ctx), authz.ActionGet, "")
+	if err != nil {
+		return nil, grpc.Errorf(codes.PermissionDenied, "%s", err)
+	}
+	index, err := service.visibleIndex(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "%s", err)
+	}
+	return &ListChartsResponse{Charts: index.Entries}, nil
+}
+
+// visibleIndex syncs the index, returning the index the identity of the call may see
+func (service *grpcService) visibleIndex(ctx context.Context) (*repo.Index, error) {
+	err := service.server.syncRepositoryIndexOnRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return service.server.visibleIndex(service.identity(ctx))
+}
+
+func (service *grpcService) searchCharts(ctx context.Context, in interface{}) (interface{}, error) {
+	req := in.(*SearchChartsRequest)
+	err := service.server.checkAccess(service.identity(ctx), authz.ActionGet, "")
+	if err != nil {
+		return nil, grpc.Errorf(codes.PermissionDenied, "%s", err)
+	}
+	index, err := service.visibleIndex(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "%s", err)
+	}
+	var names []string
+	for name := range index.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	chartVersions := []*helm_repo.ChartVersion{}
+	for _, name := range names {
+		versions := index.Entries[name]
+		if len(versions) > 0 && chartVersionMatchesSearch(versions[0], req.Query) &&
+			(req.Type == "" || repo.ChartVersionType(versions[0]) == req.Type) {
+			chartVersions = append(chartVersions, versions[0])
+		}
+	}
+	return &SearchChartsResponse{ChartVersions: chartVersions}, nil
+}
+
+func (service *grpcService) getChart(ctx context.Context, in interface{}) (interface{}, error) {
+	req := in.(*GetChartRequest)
+	version := req.Version
+	if version == "latest" {
+		version = ""
+	}
+	err := service.server.checkAccess(service.identity(ctx), authz.ActionGet, req.Name)
+	if err != nil {
+		return nil, grpc.Errorf(codes.PermissionDenied, "%s", err)
+	}
+	err = service.server.syncRepositoryIndexOnRequest(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "%s", err)
+	}
+	chartVersion, err := service.server.RepositoryIndex.Get(req.Name, version)
+	if err != nil {
+		return nil, grpc.Errorf(codes.NotFound, "not found")
+	}
+	return &GetChartResponse{ChartVersion: chartVersion}, nil
+}
+
+// scanForMalware scans an uploaded file with clamd, converting errors to gRPC status errors
+func (service *grpcService) scanForMalware(filename string, content []byte) error {
+	err := service.server.scanForMalware(filename, content)
+	if _, ok := err.(malwareFoundError); ok {
+		return grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if err != nil {
+		return grpc.Errorf(codes.Unavailable, "%s", err)
+	}
+	return nil
+}
+
+func (service *grpcService) uploadChart(ctx context.Context, in interface{}) (interface{}, error) {
+	req := in.(*UploadChartRequest)
+	server := service.server
+	if !service.enableAPI {
+		return nil, grpc.Errorf(codes.Unimplemented, "upload is disabled")
+	}
+	if server.ReadOnly {
+		return nil, grpc.Errorf(codes.PermissionDenied, "server is in read-only mode")
+	}
+	if !server.acquireUploadSlot() {
+		return nil, grpc.Errorf(codes.ResourceExhausted, "too many concurrent uploads, try again later")
+	}
+	defer server.releaseUploadSlot()
+
+	// before anything unpacks it
+	err := server.checkChartPackageLimits(req.Package)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	filename, err := repo.ChartPackageFilenameFromContent(req.Package)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	err = service.scanForMalware(filename, req.Package)
+	if err != nil {
+		return nil, err
+	}
+	err = server.checkChartDependencies(req.Package, strings.TrimSuffix(server.RepositoryIndex.ChartURL, "/"))
+	if err != nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "%s", err)
+	}
+	err = server.checkChartSecrets(req.Package)
+	if err != nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "%s", err)
+	}
+	err = server.checkChartPolicy(req.Package)
+	if _, ok := err.(policyViolationError); ok {
+		return nil, grpc.Errorf(codes.PermissionDenied, "%s", err)
+	}
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "%s", err)
+	}
+	err = server.checkUploadAccess(req.Package, service.identity(ctx))
+	if err != nil {
+		return nil, grpc.Errorf(codes.PermissionDenied, "%s", err)
+	}
+	err = server.checkUploadOwner(req.Package, service.identity(ctx))
+	if err != nil {
+		return nil, grpc.Errorf(codes.PermissionDenied, "%s", err)
+	}
+	files := map[string][]byte{filename: req.Package}
+	if len(req.Provenance) > 0 {
+		provFilename, err := repo.ProvenanceFilenameFromContent(req.Provenance)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+		}
+		if provFilename != filename+".prov" {
+			return nil, grpc.Errorf(codes.InvalidArgument, "%s", errProvenanceMismatch)
+		}
+		err = service.scanForMalware(provFilename, req.Provenance)
+		if err != nil {
+			return nil, err
+		}
+		err = server.checkUploadAccess(req.Provenance, service.identity(ctx))
+		if err != nil {
+			return nil, grpc.Errorf(codes.PermissionDenied, "%s", err)
+		}
+		err = server.checkUploadOwner(req.Provenance, service.identity(ctx))
+		if err != nil {
+			return nil, grpc.Errorf(codes.PermissionDenied, "%s", err)
+		}
+		files[provFilename] = req.Provenance
+	}
+	if len(req.Signature) > 0 {
+		err = server.checkCosignSignature(req.Package, req.Signature)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+		}
+		files[cosignSignaturePath(filename)] = req.Signature
+	} else if server.RequireCosignSignature {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", errCosignSignatureRequired)
+	}
+
+	for f := range files {
+		unlock, status, err := server.acquireUploadLock(f)
+		if err != nil {
+			return nil, grpcErrorFromStatus(status, err)
+		}
+		defer unlock()
+		if !server.AllowOverwrite {
+			_, err = server.StorageBackend.GetObject(f)
+			if err == nil {
+				return nil, grpc.Errorf(codes.AlreadyExists, "%s already exists", f)
+			}
+		}
+	}
+
+	// the chart package, provenance file and signature are stored and indexed together, or not at all
+	rollback, err := server.storeUploadedFiles(files)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "%s", err)
+	}
+	server.saveUploadRecord(filename, service.newUploadRecord(ctx))
+	server.saveSBOM(filename, req.Package)
+	err = server.indexUploadedPackage(filename)
+	if err != nil {
+		rollback()
+		return nil, grpc.Errorf(codes.Internal, "%s", err)
+	}
+	for f := range files {
+		if isProvenanceFile(f) {
+			server.addProvenanceFile(f)
+		}
+	}
+	chartPushesCounter.WithLabelValues(service.identity(ctx)).Inc()
+	return &UploadChartResponse{Saved: true}, nil
+}
+
+func (service *grpcService) deleteChart(ctx context.Context, in interface{}) (interface{}, error) {
+	req := in.(*DeleteChartRequest)
+	server := service.server
+	if !service.enableDelete {
+		return nil, grpc.Errorf(codes.Unimplemented, "delete is disabled")
+	}
+	if server.ReadOnly {
+		return nil, grpc.Errorf(codes.PermissionDenied, "server is in read-only mode")
+	}
+	err := server.checkAccess(service.identity(ctx), authz.ActionDelete, req.Name)
+	if err != nil {
+		return nil, grpc.Errorf(codes.PermissionDenied, "%s", err)
+	}
+	err = server.checkChartOwner(req.Name, service.identity(ctx))
+	if err != nil {
+		return nil, grpc.Errorf(codes.PermissionDenied, "%s", err)
+	}
+	filename := repo.ChartPackageFilenameFromNameVersion(req.Name, req.Version)
+	server.Logger.Debugw("Deleting package from storage (gRPC)",
+		"package", filename,
+	)
+	err = server.StorageBackend.DeleteObject(filename)
+	if err != nil {
+		return nil, grpc.Errorf(codes.NotFound, "not found")
+	}
+	server.deleteChartSidecars(filename)
+	server.indexDeletedPackage(filename)
+	chartDeletesCounter.WithLabelValues(service.identity(ctx)).Inc()
+	return &DeleteChartResponse{Deleted: true}, nil
+}
+
+// identity returns the identity of a gRPC request which passed authInterceptor, see identityFromAuthorization
+func (service *grpcService) identity(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var authorization string
+	if values := md["authorization"]; len(values) > 0 {
+		authorization = values[0]
+	}
+	return identityFromAuthorization(authorization, service.auth != nil)
+}
+
+func grpcErrorFromStatus(status int, err error) error {
+	code := codes.Internal
+	switch status {
+	case 400:
+		code = codes.InvalidArgument
+	case 404:
+		code = codes.NotFound
+	case 409:
+		code = codes.Aborted
+	}
+	return grpc.Errorf(code, "%s", err)
+}
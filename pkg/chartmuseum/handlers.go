@@ -2,24 +2,42 @@ package chartmuseum
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 
 	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
 
+	"github.com/Masterminds/semver"
 	"github.com/gin-gonic/gin"
+	helm_repo "k8s.io/helm/pkg/repo"
 )
 
 var (
-	objectSavedResponse        = gin.H{"saved": true}
-	objectDeletedResponse      = gin.H{"deleted": true}
-	notFoundErrorResponse      = gin.H{"error": "not found"}
-	badExtensionErrorResponse  = gin.H{"error": "unsupported file extension"}
-	alreadyExistsErrorResponse = gin.H{"error": "file already exists"}
+	objectSavedResponse          = gin.H{"saved": true}
+	objectDeletedResponse        = gin.H{"deleted": true}
+	notFoundErrorResponse        = newErrorResponse(errorCodeNotFound, "not found", nil)
+	badExtensionErrorResponse    = newErrorResponse(errorCodeUnsupportedExtension, "unsupported file extension", nil)
+	alreadyExistsErrorResponse   = newErrorResponse(errorCodeAlreadyExists, "file already exists", nil)
+	readOnlyErrorResponse        = newErrorResponse(errorCodeReadOnly, "server is in read-only mode", nil)
+	maintenanceErrorResponse     = newErrorResponse(errorCodeMaintenanceMode, "server is in maintenance mode", nil)
+	tooManyUploadsErrorResponse  = newErrorResponse(errorCodeTooManyUploads, "too many concurrent uploads, try again later", nil)
+	uploadQueueFullErrorResponse = newErrorResponse(errorCodeUploadQueueFull, "upload queue is full, try again later", nil)
+	notDualWriteErrorResponse    = newErrorResponse(errorCodeNotDualWrite, "storage backend is not in dual-write mode", nil)
+	syncForbiddenErrorResponse   = newErrorResponse(errorCodeForbidden, "sync=true requires basic auth or --enable-admin", nil)
+	authLockedOutErrorResponse   = newErrorResponse(errorCodeAuthLockedOut, "too many authentication failures, try again later", nil)
+
+	errorAlreadyExists = errors.New("file already exists")
 )
 
+// maxNotFoundSuggestions is how many similar charts or versions are suggested when one is not found
+const maxNotFoundSuggestions = 3
+
 type (
 	packageOrProvenanceFile struct {
 		filename string
@@ -29,93 +47,490 @@ type (
 	filenameFromContentFn func([]byte) (string, error)
 )
 
+func (server *Server) getInfoRequestHandler(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"readOnly":    server.ReadOnly,
+		"maintenance": server.inMaintenanceMode(),
+		"leader":      server.isLeader(),
+		"build":       server.BuildInfo,
+	})
+}
+
+func (server *Server) checkReadOnly(c *gin.Context) {
+	if server.ReadOnly {
+		c.JSON(403, readOnlyErrorResponse)
+		c.Abort()
+	}
+}
+
+// limitConcurrentUploads rejects the request with 429 if the maximum number of uploads are already in progress
+func (server *Server) limitConcurrentUploads(c *gin.Context) {
+	if !server.acquireUploadSlot() {
+		c.JSON(429, tooManyUploadsErrorResponse)
+		c.Abort()
+		return
+	}
+	defer server.releaseUploadSlot()
+	c.Next()
+}
+
+func (server *Server) acquireUploadSlot() bool {
+	if server.UploadSemaphore == nil {
+		return true
+	}
+	select {
+	case server.UploadSemaphore <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (server *Server) releaseUploadSlot() {
+	if server.UploadSemaphore != nil {
+		<-server.UploadSemaphore
+	}
+}
+
 func (server *Server) getIndexFileRequestHandler(c *gin.Context) {
-	err := server.syncRepositoryIndex()
-	if err != nil {
-		c.JSON(500, errorResponse(err))
+	index, ok := server.syncRepositoryIndexForIndexRequest(c)
+	if !ok {
 		return
 	}
-	c.Data(200, repo.IndexFileContentType, server.RepositoryIndex.Raw)
+	c.Data(200, repo.IndexFileContentType, index.Raw)
 }
 
-func (server *Server) getAllChartsRequestHandler(c *gin.Context) {
-	err := server.syncRepositoryIndex()
+func (server *Server) getIndexGzipFileRequestHandler(c *gin.Context) {
+	index, ok := server.syncRepositoryIndexForIndexRequest(c)
+	if !ok {
+		return
+	}
+	c.Data(200, repo.IndexGzipFileContentType, index.RawGzip)
+}
+
+func (server *Server) getLibraryIndexFileRequestHandler(c *gin.Context) {
+	index, ok := server.syncRepositoryIndexForIndexRequest(c)
+	if !ok {
+		return
+	}
+	c.Data(200, repo.IndexFileContentType, index.LibraryRaw)
+}
+
+func (server *Server) getLibraryIndexGzipFileRequestHandler(c *gin.Context) {
+	index, ok := server.syncRepositoryIndexForIndexRequest(c)
+	if !ok {
+		return
+	}
+	c.Data(200, repo.IndexGzipFileContentType, index.LibraryRawGzip)
+}
+
+func validateLibraryChartsMode(mode string) error {
+	switch mode {
+	case "", repo.LibraryChartsInclude, repo.LibraryChartsExclude, repo.LibraryChartsSeparate:
+		return nil
+	}
+	return fmt.Errorf("invalid library charts mode %q, must be %q, %q or %q",
+		mode, repo.LibraryChartsInclude, repo.LibraryChartsExclude, repo.LibraryChartsSeparate)
+}
+
+// syncRepositoryIndexForIndexRequest syncs the index before serving it, returning the index the
+// identity of the request may see. It responds with an error and returns false if that fails.
+func (server *Server) syncRepositoryIndexForIndexRequest(c *gin.Context) (*repo.Index, bool) {
+	// ?sync=true is only honored where it can't be used by anonymous clients to hammer storage
+	if c.Query("sync") == "true" && !server.AllowForceSync {
+		c.JSON(403, syncForbiddenErrorResponse)
+		return nil, false
+	}
+	var err error
+	if c.Query("sync") == "true" {
+		// a forced sync always lists storage
+		server.forgetStorageChanges()
+		err = server.syncRepositoryIndex(c.Request.Context())
+	} else {
+		err = server.syncRepositoryIndexOnRequest(c.Request.Context())
+	}
+	if server.clientWentAway(c) {
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return nil, false
+	}
+	index, err := server.visibleIndex(requestIdentity(c))
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		c.JSON(500, errorResponse(500, err))
+		return nil, false
+	}
+	return index, true
+}
+
+// visibleIndexForRequest syncs the index, returning the index the identity of the request may see.
+// It responds with an error and returns false if that fails.
+func (server *Server) visibleIndexForRequest(c *gin.Context) (*repo.Index, bool) {
+	err := server.syncRepositoryIndexOnRequest(c.Request.Context())
+	if err == nil {
+		var index *repo.Index
+		index, err = server.visibleIndex(requestIdentity(c))
+		if err == nil {
+			return index, true
+		}
+	}
+	c.JSON(500, errorResponse(500, err))
+	return nil, false
+}
+
+func (server *Server) getAllChartsRequestHandler(c *gin.Context) {
+	index, ok := server.visibleIndexForRequest(c)
+	if !ok {
+		return
+	}
+	server.respondWithIndexJSON(c, index, func() (int, interface{}) {
+		if len(c.QueryArray("annotation")) == 0 && c.Query("type") == "" {
+			return 200, index.Entries
+		}
+		entries := map[string]helm_repo.ChartVersions{}
+		for name, chartVersions := range index.Entries {
+			filtered := filterChartVersionsByQuery(c, chartVersions)
+			if len(filtered) > 0 {
+				entries[name] = filtered
+			}
+		}
+		return 200, entries
+	})
+}
+
+// filterChartVersionsByQuery applies the ?annotation= and ?type= filters of a request to chartVersions
+func filterChartVersionsByQuery(c *gin.Context, chartVersions helm_repo.ChartVersions) helm_repo.ChartVersions {
+	if annotations := c.QueryArray("annotation"); len(annotations) > 0 {
+		chartVersions = repo.FilterChartVersionsByAnnotations(chartVersions, annotations)
+	}
+	if chartType := c.Query("type"); chartType != "" {
+		chartVersions = repo.FilterChartVersionsByType(chartVersions, chartType)
+	}
+	return chartVersions
+}
+
+func (server *Server) getKeywordsRequestHandler(c *gin.Context) {
+	index, ok := server.visibleIndexForRequest(c)
+	if !ok {
+		return
+	}
+	server.respondWithIndexJSON(c, index, func() (int, interface{}) {
+		return 200, index.Keywords()
+	})
+}
+
+func (server *Server) getMaintainersRequestHandler(c *gin.Context) {
+	index, ok := server.visibleIndexForRequest(c)
+	if !ok {
 		return
 	}
-	c.JSON(200, server.RepositoryIndex.Entries)
+	server.respondWithIndexJSON(c, index, func() (int, interface{}) {
+		return 200, index.Maintainers()
+	})
+}
+
+func (server *Server) getAnnotationsRequestHandler(c *gin.Context) {
+	index, ok := server.visibleIndexForRequest(c)
+	if !ok {
+		return
+	}
+	server.respondWithIndexJSON(c, index, func() (int, interface{}) {
+		return 200, index.Annotations()
+	})
 }
 
 func (server *Server) getChartRequestHandler(c *gin.Context) {
 	name := c.Param("name")
-	err := server.syncRepositoryIndex()
+	err := server.syncRepositoryIndexOnRequest(c.Request.Context())
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		c.JSON(500, errorResponse(500, err))
 		return
 	}
-	chart := server.RepositoryIndex.Entries[name]
-	if chart == nil {
-		c.JSON(404, notFoundErrorResponse)
+	server.respondWithIndexJSON(c, server.RepositoryIndex, func() (int, interface{}) {
+		chart := server.RepositoryIndex.Entries[name]
+		if len(chart) == 0 {
+			return 404, server.chartNotFoundResponse(c, name, "")
+		}
+		chart = filterChartVersionsByQuery(c, chart)
+		if len(chart) == 0 {
+			return 404, notFoundErrorResponse
+		}
+		return 200, chart
+	})
+}
+
+func (server *Server) getChartVersionRequestHandler(c *gin.Context) {
+	name := c.Param("name")
+	version := c.Param("version")
+	switch version {
+	case "resolve":
+		server.resolveChartVersionRequestHandler(c)
+		return
+	case chartFeedFileName:
+		server.getChartFeedRequestHandler(c)
+		return
+	}
+	if version == "latest" {
+		version = ""
+	}
+	err := server.syncRepositoryIndexOnRequest(c.Request.Context())
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
 		return
 	}
-	c.JSON(200, chart)
+	chartVersion, err := server.RepositoryIndex.Get(name, version)
+	if err != nil {
+		c.JSON(404, server.chartNotFoundResponse(c, name, version))
+		return
+	}
+	provenance := ""
+	if server.hasProvenanceFile(name, chartVersion.Version) {
+		provenance = fmt.Sprintf("%s.prov", chartVersion.URLs[0])
+	}
+	record := server.getUploadRecord(repo.ChartPackageFilenameFromNameVersion(name, chartVersion.Version))
+	c.JSON(200, struct {
+		*helm_repo.ChartVersion
+		Provenance string        `json:"provenance,omitempty"`
+		Upload     *uploadRecord `json:"upload,omitempty"`
+	}{chartVersion, provenance, record})
 }
 
-func (server *Server) getChartVersionRequestHandler(c *gin.Context) {
+// resolveChartVersionRequestHandler returns the newest version of a chart satisfying a semver
+// constraint, the same way dependencies of charts are resolved against this repository
+func (server *Server) resolveChartVersionRequestHandler(c *gin.Context) {
+	name := c.Param("name")
+	constraint := c.Query("constraint")
+	if constraint == "" {
+		c.JSON(400, newErrorResponse(errorCodeBadRequest, "missing constraint query parameter", nil))
+		return
+	}
+	if _, err := semver.NewConstraint(constraint); err != nil {
+		c.JSON(400, newErrorResponse(errorCodeBadRequest, fmt.Sprintf("invalid constraint %q: %s", constraint, err), gin.H{
+			"constraint": constraint,
+		}))
+		return
+	}
+	err := server.syncRepositoryIndexOnRequest(c.Request.Context())
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	chartVersions, ok := server.RepositoryIndex.Entries[name]
+	if !ok {
+		c.JSON(404, server.chartNotFoundResponse(c, name, ""))
+		return
+	}
+	chartVersion, err := server.RepositoryIndex.Get(name, constraint)
+	if err != nil {
+		versions := []string{}
+		for i := 0; i < len(chartVersions) && i < maxNotFoundSuggestions; i++ {
+			versions = append(versions, chartVersions[i].Version)
+		}
+		c.JSON(404, newErrorResponse(errorCodeChartVersionNotFound, fmt.Sprintf("no version of chart %s satisfies %s", name, constraint), gin.H{
+			"chart":       name,
+			"constraint":  constraint,
+			"suggestions": versions,
+		}))
+		return
+	}
+	c.JSON(200, gin.H{
+		"name":         name,
+		"constraint":   constraint,
+		"version":      chartVersion.Version,
+		"chartVersion": chartVersion,
+	})
+}
+
+func (server *Server) getChartVersionDependenciesRequestHandler(c *gin.Context) {
+	name := c.Param("name")
+	version := c.Param("version")
+	if version == "latest" {
+		version = ""
+	}
+	err := server.syncRepositoryIndexOnRequest(c.Request.Context())
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	chartVersion, err := server.RepositoryIndex.Get(name, version)
+	if err != nil {
+		c.JSON(404, server.chartNotFoundResponse(c, name, version))
+		return
+	}
+	dependencies, ok := server.ResponseCache.getChartPackageMetadata("dependencies", chartVersion).([]repo.ChartDependency)
+	if !ok {
+		object, err := storage.GetObjectWithContext(c.Request.Context(), server.StorageBackend, repo.ChartPackageFilenameFromNameVersion(name, chartVersion.Version))
+		if server.clientWentAway(c) {
+			return
+		}
+		if err != nil {
+			c.JSON(404, notFoundErrorResponse)
+			return
+		}
+		dependencies, err = repo.ChartDependenciesFromContent(object.Content)
+		if err != nil {
+			c.JSON(500, errorResponse(500, err))
+			return
+		}
+		server.ResponseCache.addChartPackageMetadata("dependencies", chartVersion, dependencies)
+	}
+	c.JSON(200, gin.H{"dependencies": server.resolveChartDependencies(dependencies, server.repositoryURL(c))})
+}
+
+func (server *Server) postChartVersionRenderRequestHandler(c *gin.Context) {
 	name := c.Param("name")
 	version := c.Param("version")
 	if version == "latest" {
 		version = ""
 	}
-	err := server.syncRepositoryIndex()
+	values, err := c.GetRawData()
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	err = server.syncRepositoryIndexOnRequest(c.Request.Context())
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
 		return
 	}
 	chartVersion, err := server.RepositoryIndex.Get(name, version)
+	if err != nil {
+		c.JSON(404, server.chartNotFoundResponse(c, name, version))
+		return
+	}
+	object, err := storage.GetObjectWithContext(c.Request.Context(), server.StorageBackend, repo.ChartPackageFilenameFromNameVersion(name, chartVersion.Version))
+	if server.clientWentAway(c) {
+		return
+	}
 	if err != nil {
 		c.JSON(404, notFoundErrorResponse)
 		return
 	}
-	c.JSON(200, chartVersion)
+	rendered, err := repo.RenderChartPackage(object.Content, values, c.Query("release"), c.Query("namespace"))
+	if err == repo.ErrorInvalidChartPackage {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	if err != nil {
+		c.JSON(400, errorResponse(400, err)) // bad values, or a template failing with them
+		return
+	}
+	c.JSON(200, rendered)
+}
+
+// chartNotFoundResponse describes a chart version missing from the index, along with suggestions:
+// charts with similar names if there is no such chart, otherwise its nearest versions. Only charts
+// the request may get are suggested.
+func (server *Server) chartNotFoundResponse(c *gin.Context, name string, version string) gin.H {
+	index, err := server.visibleIndex(requestIdentity(c))
+	if err != nil {
+		index = repo.NewIndex("")
+	}
+	if _, ok := index.Entries[name]; !ok {
+		return newErrorResponse(errorCodeChartNotFound, fmt.Sprintf("chart %s not found", name), gin.H{
+			"chart":       name,
+			"suggestions": index.SuggestChartNames(name, maxNotFoundSuggestions),
+		})
+	}
+	return newErrorResponse(errorCodeChartVersionNotFound, fmt.Sprintf("chart %s version %s not found", name, version), gin.H{
+		"chart":       name,
+		"version":     version,
+		"suggestions": index.SuggestChartVersions(name, version, maxNotFoundSuggestions),
+	})
+}
+
+// repositoryURL returns the url to use with "helm repo add", preferring the configured chart url
+func (server *Server) repositoryURL(c *gin.Context) string {
+	if server.RepositoryIndex.ChartURL != "" {
+		return strings.TrimSuffix(server.RepositoryIndex.ChartURL, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, c.Request.Host)
 }
 
 func (server *Server) deleteChartVersionRequestHandler(c *gin.Context) {
 	name := c.Param("name")
 	version := c.Param("version")
+	err := server.checkChartOwner(name, requestIdentity(c))
+	if err != nil {
+		c.JSON(403, newErrorResponse(errorCodeNotChartOwner, err.Error(), nil))
+		return
+	}
 	filename := repo.ChartPackageFilenameFromNameVersion(name, version)
 	server.Logger.Debugw("Deleting package from storage",
 		"package", filename,
 	)
-	err := server.StorageBackend.DeleteObject(filename)
+	err = server.StorageBackend.DeleteObject(filename)
 	if err != nil {
 		c.JSON(404, notFoundErrorResponse)
 		return
 	}
-	provFilename := repo.ProvenanceFilenameFromNameVersion(name, version)
-	server.StorageBackend.DeleteObject(provFilename) // ignore error here, may be no prov file
+	server.deleteChartSidecars(filename)
+	server.indexDeletedPackage(filename)
+	chartDeletesCounter.WithLabelValues(requestIdentity(c)).Inc()
 	c.JSON(200, objectDeletedResponse)
 }
 
+// deleteChartSidecars deletes the provenance file and everything else stored along with a deleted
+// chart package, ignoring errors since most of them may not exist
+func (server *Server) deleteChartSidecars(filename string) {
+	provFilename := strings.TrimSuffix(filename, repo.ChartPackageFileExtension) + repo.ProvenanceFileExtension
+	server.StorageBackend.DeleteObject(provFilename)
+	server.removeProvenanceFile(provFilename)
+	if server.RecordUploads {
+		server.StorageBackend.DeleteObject(uploadRecordPath(filename))
+	}
+	if server.GenerateSBOM {
+		server.StorageBackend.DeleteObject(sbomPath(filename))
+	}
+	server.StorageBackend.DeleteObject(cosignSignaturePath(filename))
+	server.StorageBackend.DeleteObject(attestationsPath(filename))
+	server.StorageBackend.DeleteObject(previousVersionPath(filename))
+	server.StorageBackend.DeleteObject(previousVersionPath(provFilename))
+}
+
 func (server *Server) getStorageObjectRequestHandler(c *gin.Context) {
 	filename := c.Param("filename")
 	isChartPackage := strings.HasSuffix(filename, repo.ChartPackageFileExtension)
 	isProvenanceFile := strings.HasSuffix(filename, repo.ProvenanceFileExtension)
-	if !isChartPackage && !isProvenanceFile {
+	isSignature := isCosignSignatureFile(filename)
+	if !isChartPackage && !isProvenanceFile && !isSignature {
 		c.JSON(500, badExtensionErrorResponse)
 		return
 	}
-	object, err := server.StorageBackend.GetObject(filename)
+	object, err := storage.GetObjectWithContext(c.Request.Context(), server.StorageBackend, filename)
+	if server.clientWentAway(c) {
+		return
+	}
 	if err != nil {
 		c.JSON(404, notFoundErrorResponse)
 		return
 	}
 	if isProvenanceFile {
-		c.Data(200, repo.ProvenanceFileContentType, object.Content)
+		serveStorageObject(c, object, repo.ProvenanceFileContentType)
+		return
+	}
+	if isSignature {
+		serveStorageObject(c, object, repo.CosignSignatureContentType)
 		return
 	}
-	c.Data(200, repo.ChartPackageContentType, object.Content)
+	serveStorageObject(c, object, repo.ChartPackageContentType)
+}
+
+// serveStorageObject serves a chart package or provenance file for GET and HEAD, with its Content-Length,
+// and an ETag (its sha256 digest) and Last-Modified date so that clients and caches can revalidate it
+// with conditional requests. Range requests are supported as well.
+func serveStorageObject(c *gin.Context, object storage.Object, contentType string) {
+	digest := sha256.Sum256(object.Content)
+	c.Header("Content-Type", contentType)
+	c.Header("ETag", fmt.Sprintf("\"%s\"", hex.EncodeToString(digest[:])))
+	// may be overwritten or deleted and pushed again, so always revalidate
+	c.Header("Cache-Control", "no-cache")
+	http.ServeContent(c.Writer, c.Request, object.Path, object.LastModified, bytes.NewReader(object.Content))
 }
 
 func (server *Server) extractAndValidateFormFile(req *http.Request, field string, fnFromContent filenameFromContentFn) (*packageOrProvenanceFile, int, error) {
@@ -130,20 +545,50 @@ func (server *Server) extractAndValidateFormFile(req *http.Request, field string
 		return ppf, 500, err // IO error
 	}
 	content := buf.Bytes()
+	if server.isChartFormField(field) {
+		// before anything unpacks it
+		err = server.checkChartPackageLimits(content)
+		if err != nil {
+			return ppf, 400, err
+		}
+	}
 	filename, err := fnFromContent(content)
 	if err != nil {
 		return ppf, 400, err // validation error (bad request)
 	}
-	if !server.AllowOverwrite {
-		_, err = server.StorageBackend.GetObject(filename)
-		if err == nil {
-			return ppf, 409, fmt.Errorf("%s already exists", filename) // conflict
+	return &packageOrProvenanceFile{filename, content, field}, 200, nil
+}
+
+// acquireUploadLock locks filename for the duration of an upload so that concurrent uploads
+// of the same file (possibly to other instances) cannot interleave. The returned func releases it.
+func (server *Server) acquireUploadLock(filename string) (func(), int, error) {
+	key := fmt.Sprintf("upload/%s", filename)
+	locked, err := server.Locker.TryLock(key)
+	if err != nil {
+		return nil, 500, err
+	}
+	if !locked {
+		return nil, 409, fmt.Errorf("%s is already being uploaded", filename) // conflict
+	}
+	unlock := func() {
+		err := server.Locker.Unlock(key)
+		if err != nil {
+			server.Logger.Warnw("Unable to release upload lock",
+				"filename", filename,
+				"error", err.Error(),
+			)
 		}
 	}
-	return &packageOrProvenanceFile{filename, content, field}, 200, nil
+	return unlock, 200, nil
 }
 
 func (server *Server) postPackageAndProvenanceRequestHandler(c *gin.Context) {
+	err := server.parseSpooledMultipartForm(c)
+	if err != nil {
+		c.JSON(400, errorResponse(400, err))
+		return
+	}
+
 	var ppFiles []*packageOrProvenanceFile
 
 	type fieldFuncPair struct {
@@ -155,41 +600,127 @@ func (server *Server) postPackageAndProvenanceRequestHandler(c *gin.Context) {
 		{server.ChartPostFormFieldName, repo.ChartPackageFilenameFromContent},
 		{server.ProvPostFormFieldName, repo.ProvenanceFilenameFromContent},
 	}
+	if server.HelmPush && server.ChartPostFormFieldName != helmPushChartFieldName {
+		ffp = append(ffp, fieldFuncPair{helmPushChartFieldName, repo.ChartPackageFilenameFromContent})
+	}
+	if server.HelmPush && server.ProvPostFormFieldName != helmPushProvFieldName {
+		ffp = append(ffp, fieldFuncPair{helmPushProvFieldName, repo.ProvenanceFilenameFromContent})
+	}
 
 	for _, ff := range ffp {
 		ppf, status, err := server.extractAndValidateFormFile(c.Request, ff.field, ff.fn)
 		if err != nil {
-			c.JSON(status, errorResponse(err))
+			c.JSON(status, errorResponse(status, err))
+			return
+		}
+		if ppf == nil {
+			continue
+		}
+		err = verifyFormFileChecksum(c, ppf)
+		if err != nil {
+			c.JSON(422, errorResponse(422, err))
+			return
+		}
+		err = server.scanForMalware(ppf.filename, ppf.content)
+		if err != nil {
+			c.JSON(malwareErrorResponse(err))
 			return
 		}
-		if ppf != nil {
-			ppFiles = append(ppFiles, ppf)
+		err = server.checkUploadAccess(ppf.content, requestIdentity(c))
+		if err != nil {
+			c.JSON(403, newErrorResponse(errorCodeAccessDenied, err.Error(), nil))
+			return
+		}
+		err = server.checkUploadOwner(ppf.content, requestIdentity(c))
+		if err != nil {
+			c.JSON(403, newErrorResponse(errorCodeNotChartOwner, err.Error(), nil))
+			return
 		}
+		if server.isChartFormField(ppf.field) {
+			err = server.checkChartDependencies(ppf.content, server.repositoryURL(c))
+			if err != nil {
+				c.JSON(400, newErrorResponse(errorCodeUnresolvedDependencies, err.Error(), nil))
+				return
+			}
+			err = server.checkChartSecrets(ppf.content)
+			if err != nil {
+				c.JSON(400, newErrorResponse(errorCodeSecretsDetected, err.Error(), nil))
+				return
+			}
+			err = server.checkChartPolicy(ppf.content)
+			if err != nil {
+				c.JSON(policyErrorResponse(err))
+				return
+			}
+		}
+		ppFiles = append(ppFiles, ppf)
+	}
+
+	sig, status, err := server.extractCosignSignatureFormFile(c.Request, ppFiles)
+	if err != nil {
+		c.JSON(status, errorResponse(status, err))
+		return
+	}
+	if sig != nil {
+		ppFiles = append(ppFiles, sig)
 	}
 
 	if len(ppFiles) == 0 {
-		c.JSON(400, errorResponse(
+		c.JSON(400, errorResponse(400,
 			fmt.Errorf("no package or provenance file found in form fields %s and %s",
 				server.ChartPostFormFieldName, server.ProvPostFormFieldName)))
 		return
 	}
 
-	// At this point input is presumed valid, we now proceed to store it
-	var storedFiles []*packageOrProvenanceFile
+	for _, ppf := range ppFiles {
+		unlock, status, err := server.acquireUploadLock(ppf.filename)
+		if err != nil {
+			c.JSON(status, errorResponse(status, err))
+			return
+		}
+		defer unlock()
+		if !server.allowOverwrite(c) {
+			_, err = server.StorageBackend.GetObject(ppf.filename)
+			if err == nil {
+				c.JSON(409, newErrorResponse(errorCodeAlreadyExists, fmt.Sprintf("%s already exists", ppf.filename), nil)) // conflict
+				return
+			}
+		}
+	}
+
+	// At this point input is presumed valid, we now proceed to store it: the chart package and
+	// provenance file are stored and indexed together, or not at all
+	files := map[string][]byte{}
 	for _, ppf := range ppFiles {
 		server.Logger.Debugw("Adding file to storage (form field)",
 			"filename", ppf.filename,
 			"field", ppf.field,
 		)
-		err := server.StorageBackend.PutObject(ppf.filename, ppf.content)
-		if err == nil {
-			storedFiles = append(storedFiles, ppf)
-		} else {
-			// Clean up what's already been saved
-			for _, ppf := range storedFiles {
-				server.StorageBackend.DeleteObject(ppf.filename)
-			}
-			c.JSON(500, errorResponse(err))
+		files[ppf.filename] = ppf.content
+	}
+	rollback, err := server.storeUploadedFiles(files)
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	for _, ppf := range ppFiles {
+		if !server.isChartFormField(ppf.field) {
+			continue
+		}
+		server.saveUploadRecord(ppf.filename, server.newUploadRecord(c, uploadMethodForm))
+		server.saveSBOM(ppf.filename, ppf.content)
+		err = server.indexUploadedPackage(ppf.filename)
+		if err != nil {
+			rollback()
+			c.JSON(500, errorResponse(500, err))
+			return
+		}
+	}
+	for _, ppf := range ppFiles {
+		if server.isChartFormField(ppf.field) {
+			chartPushesCounter.WithLabelValues(requestIdentity(c)).Inc()
+		} else if isProvenanceFile(ppf.filename) {
+			server.addProvenanceFile(ppf.filename)
 		}
 	}
 	c.JSON(201, objectSavedResponse)
@@ -204,46 +735,166 @@ func (server *Server) postRequestHandler(c *gin.Context) {
 }
 
 func (server *Server) postPackageRequestHandler(c *gin.Context) {
-	content, err := c.GetRawData()
+	content, status, err := server.readRequestBody(c)
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		c.JSON(status, errorResponse(status, err))
 		return
 	}
-	filename, err := repo.ChartPackageFilenameFromContent(content)
+	server.uploadPackage(c, content, uploadMethodBinary)
+}
+
+// uploadPackage runs all checks on the content of an uploaded chart package, then saves it
+// (or queues it with AsyncUploads) and responds
+func (server *Server) uploadPackage(c *gin.Context, content []byte, method string) {
+	// before anything unpacks it
+	err := server.checkChartPackageLimits(content)
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		c.JSON(400, errorResponse(400, err))
 		return
 	}
-	if !server.AllowOverwrite {
+	if server.RequireCosignSignature {
+		c.JSON(400, errorResponse(400, invalidSignatureError{errCosignSignatureRequired}))
+		return
+	}
+	err = server.scanForMalware("chart package", content)
+	if err != nil {
+		c.JSON(malwareErrorResponse(err))
+		return
+	}
+	err = server.checkChartDependencies(content, server.repositoryURL(c))
+	if err != nil {
+		c.JSON(400, newErrorResponse(errorCodeUnresolvedDependencies, err.Error(), nil))
+		return
+	}
+	err = server.checkChartSecrets(content)
+	if err != nil {
+		c.JSON(400, newErrorResponse(errorCodeSecretsDetected, err.Error(), nil))
+		return
+	}
+	err = server.checkChartPolicy(content)
+	if err != nil {
+		c.JSON(policyErrorResponse(err))
+		return
+	}
+	err = server.checkUploadAccess(content, requestIdentity(c))
+	if err != nil {
+		c.JSON(403, newErrorResponse(errorCodeAccessDenied, err.Error(), nil))
+		return
+	}
+	err = server.checkUploadOwner(content, requestIdentity(c))
+	if err != nil {
+		c.JSON(403, newErrorResponse(errorCodeNotChartOwner, err.Error(), nil))
+		return
+	}
+	if server.AsyncUploads {
+		job, ok := server.enqueueUploadJob(content, server.allowOverwrite(c), server.newUploadRecord(c, method))
+		if !ok {
+			c.JSON(429, uploadQueueFullErrorResponse)
+			return
+		}
+		chartPushesCounter.WithLabelValues(requestIdentity(c)).Inc()
+		c.JSON(202, gin.H{"job": job.ID})
+		return
+	}
+	_, status, err := server.savePackage(content, server.allowOverwrite(c), server.newUploadRecord(c, method))
+	if err != nil {
+		c.JSON(status, errorResponse(status, err))
+		return
+	}
+	chartPushesCounter.WithLabelValues(requestIdentity(c)).Inc()
+	c.JSON(201, objectSavedResponse)
+}
+
+// unsafeChartPackageError is returned for chart packages rejected by checkChartPackageLimits
+type unsafeChartPackageError struct {
+	error
+}
+
+// checkChartPackageLimits rejects chart packages which unpack to too much data or outside of their
+// directory with an unsafeChartPackageError. Invalid packages pass, since they are reported when
+// saving the package. It must run before anything else unpacks an uploaded package.
+func (server *Server) checkChartPackageLimits(content []byte) error {
+	return server.checkChartPackageLimitsReader(bytes.NewReader(content))
+}
+
+// checkChartPackageLimitsReader is checkChartPackageLimits for a package read from r, e.g. the
+// chunks of a resumable upload received so far
+func (server *Server) checkChartPackageLimitsReader(r io.Reader) error {
+	err := repo.CheckChartPackageLimitsReader(r, server.ChartPackageLimits)
+	if err == nil || err == repo.ErrorInvalidChartPackage {
+		return nil
+	}
+	return unsafeChartPackageError{err}
+}
+
+// savePackage validates a chart package, writes it (and record, if any) to storage and adds it to the index.
+// If it cannot be indexed, it is rolled back so that an upload is only saved once it can be read back.
+func (server *Server) savePackage(content []byte, overwrite bool, record *uploadRecord) (string, int, error) {
+	filename, err := repo.ChartPackageFilenameFromContent(content)
+	if err != nil {
+		return "", 500, err
+	}
+	unlock, status, err := server.acquireUploadLock(filename)
+	if err != nil {
+		return filename, status, err
+	}
+	defer unlock()
+	if !overwrite {
 		_, err = server.StorageBackend.GetObject(filename)
 		if err == nil {
-			c.JSON(500, alreadyExistsErrorResponse)
-			return
+			return filename, 500, errorAlreadyExists
 		}
 	}
 	server.Logger.Debugw("Adding package to storage",
 		"package", filename,
 	)
-	err = server.StorageBackend.PutObject(filename, content)
+	rollback, err := server.storeUploadedFiles(map[string][]byte{filename: content})
 	if err != nil {
-		c.JSON(500, errorResponse(err))
-		return
+		return filename, 500, err
 	}
-	c.JSON(201, objectSavedResponse)
+	server.saveUploadRecord(filename, record)
+	server.saveSBOM(filename, content)
+	err = server.indexUploadedPackage(filename)
+	if err != nil {
+		rollback()
+		return filename, 500, err
+	}
+	return filename, 201, nil
 }
 
 func (server *Server) postProvenanceFileRequestHandler(c *gin.Context) {
-	content, err := c.GetRawData()
+	content, status, err := server.readRequestBody(c)
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		c.JSON(status, errorResponse(status, err))
 		return
 	}
 	filename, err := repo.ProvenanceFilenameFromContent(content)
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	err = server.scanForMalware(filename, content)
+	if err != nil {
+		c.JSON(malwareErrorResponse(err))
+		return
+	}
+	err = server.checkUploadAccess(content, requestIdentity(c))
+	if err != nil {
+		c.JSON(403, newErrorResponse(errorCodeAccessDenied, err.Error(), nil))
+		return
+	}
+	err = server.checkUploadOwner(content, requestIdentity(c))
+	if err != nil {
+		c.JSON(403, newErrorResponse(errorCodeNotChartOwner, err.Error(), nil))
 		return
 	}
-	if !server.AllowOverwrite {
+	unlock, status, err := server.acquireUploadLock(filename)
+	if err != nil {
+		c.JSON(status, errorResponse(status, err))
+		return
+	}
+	defer unlock()
+	if !server.allowOverwrite(c) {
 		_, err = server.StorageBackend.GetObject(filename)
 		if err == nil {
 			c.JSON(500, alreadyExistsErrorResponse)
@@ -253,15 +904,48 @@ func (server *Server) postProvenanceFileRequestHandler(c *gin.Context) {
 	server.Logger.Debugw("Adding provenance file to storage",
 		"provenance_file", filename,
 	)
-	err = server.StorageBackend.PutObject(filename, content)
+	err = server.putUploadedObjectKeepingPrevious(filename, content)
 	if err != nil {
-		c.JSON(500, errorResponse(err))
+		c.JSON(500, errorResponse(500, err))
 		return
 	}
+	server.addProvenanceFile(filename)
 	c.JSON(201, objectSavedResponse)
 }
 
-func errorResponse(err error) map[string]interface{} {
-	errResp := gin.H{"error": fmt.Sprintf("%s", err)}
-	return errResp
+func (server *Server) getUploadJobRequestHandler(c *gin.Context) {
+	job, ok := server.getUploadJob(c.Param("id"))
+	if !ok {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	c.JSON(200, job)
+}
+
+func (server *Server) getMaintenanceModeRequestHandler(c *gin.Context) {
+	c.JSON(200, gin.H{"maintenance": server.inMaintenanceMode()})
+}
+
+func (server *Server) putMaintenanceModeRequestHandler(c *gin.Context) {
+	server.setMaintenanceMode(true)
+	c.JSON(200, gin.H{"maintenance": true})
+}
+
+func (server *Server) deleteMaintenanceModeRequestHandler(c *gin.Context) {
+	server.setMaintenanceMode(false)
+	c.JSON(200, gin.H{"maintenance": false})
+}
+
+func (server *Server) getStorageConsistencyRequestHandler(c *gin.Context) {
+	checker, ok := server.StorageBackend.(storage.ConsistencyChecker)
+	if !ok {
+		c.JSON(404, notDualWriteErrorResponse)
+		return
+	}
+	report, err := checker.CheckConsistency()
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	c.JSON(200, report)
 }
@@ -0,0 +1,107 @@
+package chartmuseum
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// errIndexNotBuilt is reported by /ready until the index was built from storage for the first time
+	errIndexNotBuilt = errors.New("index is being built from storage")
+
+	errStorageHealthCheckTimeout = errors.New("storage health check timed out")
+)
+
+// storageHealthCheckTimeout is how long storage may take to answer a health check before it is
+// considered unhealthy
+var storageHealthCheckTimeout = 10 * time.Second
+
+// runStorageHealthChecks probes the storage backend every HealthCheckInterval. Unlike
+// other background jobs it runs on every instance, since each one has its own credentials.
+func (server *Server) runStorageHealthChecks() {
+	ticker := time.NewTicker(server.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		server.checkStorageHealth()
+		<-ticker.C
+	}
+}
+
+// checkStorageHealth probes the storage backend and records whether it succeeded
+func (server *Server) checkStorageHealth() error {
+	err := server.probeStorage()
+	server.StorageHealthLock.Lock()
+	defer server.StorageHealthLock.Unlock()
+	if (err == nil) != (server.StorageHealthError == nil) {
+		if err != nil {
+			server.Logger.Errorw("Storage health check failed",
+				"error", err.Error(),
+			)
+		} else {
+			server.Logger.Infow("Storage health check recovered")
+		}
+	}
+	server.StorageHealthError = err
+	if err != nil {
+		storageHealthyGauge.Set(0)
+	} else {
+		storageHealthyGauge.Set(1)
+	}
+	return err
+}
+
+// probeStorage lists a single object if the storage backend can list a page of objects, and
+// otherwise all of them. It gives up after storageHealthCheckTimeout.
+func (server *Server) probeStorage() error {
+	ctx, cancel := context.WithTimeout(context.Background(), storageHealthCheckTimeout)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		var err error
+		if lister, ok := server.StorageBackend.(storage.PageLister); ok {
+			_, err = lister.ListObjectsPage("", "", 1)
+		} else {
+			_, err = storage.ListObjectsWithContext(ctx, server.StorageBackend)
+		}
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return errStorageHealthCheckTimeout
+	}
+}
+
+func (server *Server) storageHealthError() error {
+	server.StorageHealthLock.RLock()
+	defer server.StorageHealthLock.RUnlock()
+	return server.StorageHealthError
+}
+
+func (server *Server) getHealthRequestHandler(c *gin.Context) {
+	c.JSON(200, gin.H{"healthy": true})
+}
+
+func (server *Server) getReadyRequestHandler(c *gin.Context) {
+	response := gin.H{"ready": true}
+	if progress, building := server.getIndexBuildProgress(); building {
+		response["indexBuild"] = progress
+	}
+	err := server.storageHealthError()
+	if err == nil && !server.indexBuilt() {
+		err = errIndexNotBuilt
+	}
+	if err != nil {
+		response["ready"] = false
+		response["error"] = err.Error()
+		c.JSON(503, response)
+		return
+	}
+	c.JSON(200, response)
+}
@@ -0,0 +1,49 @@
+package chartmuseum
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// helmPushAPIVersion is the version of the upload API reported to the helm-push plugin
+	helmPushAPIVersion = "v1"
+
+	// helmPushChartFieldName and helmPushProvFieldName are the form fields used by the helm-push plugin,
+	// which are accepted in helm-push mode regardless of the configured field names
+	helmPushChartFieldName = "chart"
+	helmPushProvFieldName  = "prov"
+)
+
+// allowOverwrite determines whether an upload may replace existing files, which the helm-push
+// plugin requests with ?force (helm push --force). Values other than booleans (e.g. ?force=no)
+// don't allow it. Callers check the owners and the access policy before overwriting anyway.
+func (server *Server) allowOverwrite(c *gin.Context) bool {
+	if server.AllowOverwrite {
+		return true
+	}
+	value, ok := c.GetQuery("force")
+	if !server.HelmPush || !ok {
+		return false
+	}
+	if value == "" {
+		return true
+	}
+	force, err := strconv.ParseBool(value)
+	return err == nil && force
+}
+
+// isChartFormField checks whether a multipart form field holds a chart package
+func (server *Server) isChartFormField(field string) bool {
+	return field == server.ChartPostFormFieldName || (server.HelmPush && field == helmPushChartFieldName)
+}
+
+func (server *Server) getHelmPushVersionRequestHandler(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"apiVersion":         helmPushAPIVersion,
+		"chartFormFieldName": server.ChartPostFormFieldName,
+		"provFormFieldName":  server.ProvPostFormFieldName,
+		"forceOverwrite":     true,
+	})
+}
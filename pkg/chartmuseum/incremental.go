@@ -0,0 +1,81 @@
+package chartmuseum
+
+import (
+	"context"
+	"time"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+)
+
+// listAllObjects lists all objects in storage, or returns those listed last if that was less than
+// MetadataCacheTTL ago. Backends which are storage.ChangeListers are only asked what changed since
+// the previous sync, which is applied to the objects known from then, and are listed in full on the
+// first sync or whenever changes since then are no longer known. Listing is given up when ctx is done.
+func (server *Server) listAllObjects(ctx context.Context) ([]storage.Object, error) {
+	server.StorageObjectsLock.Lock()
+	defer server.StorageObjectsLock.Unlock()
+	if server.MetadataCacheTTL > 0 && time.Since(server.StorageObjectsListed) < server.MetadataCacheTTL {
+		return server.StorageObjects, nil
+	}
+	objects, err := server.listStorageObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	server.StorageObjects = objects
+	server.StorageObjectsListed = time.Now()
+	return objects, nil
+}
+
+// listStorageObjects lists all objects in storage, must hold StorageObjectsLock
+func (server *Server) listStorageObjects(ctx context.Context) ([]storage.Object, error) {
+	lister, ok := server.StorageBackend.(storage.ChangeLister)
+	if !ok {
+		return storage.ListObjectsWithContext(ctx, server.StorageBackend)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if server.StorageChangeToken != "" {
+		changes, err := lister.ListChanges(server.StorageChangeToken)
+		if err == nil {
+			server.Logger.Debugw("Listed changes to storage",
+				"updated", len(changes.Updated),
+				"removed", len(changes.Removed),
+			)
+			server.StorageChangeToken = changes.Token
+			return storage.ApplyObjectChanges(server.StorageObjects, changes), nil
+		}
+		if err != storage.ErrChangeTokenExpired {
+			return nil, err
+		}
+		server.Logger.Debugw("Changes to storage are no longer known, listing all objects")
+	}
+
+	objects, token, err := lister.ListObjectsWithChangeToken()
+	if err != nil {
+		return nil, err
+	}
+	server.StorageChangeToken = token
+	return objects, nil
+}
+
+// invalidateListedObjects makes the next sync list storage again, after files were written or
+// deleted through the API
+func (server *Server) invalidateListedObjects() {
+	if server.MetadataCacheTTL <= 0 {
+		return
+	}
+	server.StorageObjectsLock.Lock()
+	defer server.StorageObjectsLock.Unlock()
+	server.StorageObjectsListed = time.Time{}
+}
+
+// forgetStorageChanges makes the next sync list all objects in storage, rather than only changes
+// since the previous one, for a forced sync
+func (server *Server) forgetStorageChanges() {
+	server.invalidateListedObjects()
+	server.StorageObjectsLock.Lock()
+	defer server.StorageObjectsLock.Unlock()
+	server.StorageChangeToken = ""
+}
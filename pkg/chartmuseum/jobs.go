@@ -0,0 +1,119 @@
+package chartmuseum
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+var (
+	// uploadJobQueueSize is how many accepted uploads may be waiting to be processed
+	uploadJobQueueSize = 100
+
+	// uploadJobRetention is how long finished upload jobs can be looked up
+	uploadJobRetention = time.Hour
+)
+
+const (
+	uploadJobStatusPending   = "pending"
+	uploadJobStatusRunning   = "running"
+	uploadJobStatusSucceeded = "succeeded"
+	uploadJobStatusFailed    = "failed"
+)
+
+// uploadJob is an upload accepted with 202, which is processed in the background
+type uploadJob struct {
+	ID        string     `json:"id"`
+	Status    string     `json:"status"`
+	Filename  string     `json:"filename,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Created   time.Time  `json:"created"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	content   []byte
+	overwrite bool
+	record    *uploadRecord
+}
+
+// enqueueUploadJob queues content for processing, returning false if the queue is full
+func (server *Server) enqueueUploadJob(content []byte, overwrite bool, record *uploadRecord) (*uploadJob, bool) {
+	job := &uploadJob{
+		ID:        newUploadJobID(),
+		Status:    uploadJobStatusPending,
+		Created:   time.Now(),
+		content:   content,
+		overwrite: overwrite,
+		record:    record,
+	}
+	server.UploadJobsLock.Lock()
+	server.pruneUploadJobs()
+	server.UploadJobs[job.ID] = job
+	server.UploadJobsLock.Unlock()
+
+	select {
+	case server.UploadJobQueue <- job:
+		return job, true
+	default:
+		server.UploadJobsLock.Lock()
+		delete(server.UploadJobs, job.ID)
+		server.UploadJobsLock.Unlock()
+		return nil, false
+	}
+}
+
+func (server *Server) processUploadJobs() {
+	for job := range server.UploadJobQueue {
+		server.setUploadJobStatus(job, uploadJobStatusRunning, "", nil)
+		filename, _, err := server.savePackage(job.content, job.overwrite, job.record)
+		if err != nil {
+			server.Logger.Warnw("Upload job failed",
+				"job", job.ID,
+				"error", err.Error(),
+			)
+			server.setUploadJobStatus(job, uploadJobStatusFailed, filename, err)
+			continue
+		}
+		server.setUploadJobStatus(job, uploadJobStatusSucceeded, filename, nil)
+	}
+}
+
+func (server *Server) setUploadJobStatus(job *uploadJob, status string, filename string, err error) {
+	server.UploadJobsLock.Lock()
+	defer server.UploadJobsLock.Unlock()
+	job.Status = status
+	job.Filename = filename
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if status == uploadJobStatusSucceeded || status == uploadJobStatusFailed {
+		now := time.Now()
+		job.Finished = &now
+		job.content = nil
+	}
+}
+
+// getUploadJob returns a copy of the upload job with the given id, if it exists
+func (server *Server) getUploadJob(id string) (uploadJob, bool) {
+	server.UploadJobsLock.RLock()
+	defer server.UploadJobsLock.RUnlock()
+	job, ok := server.UploadJobs[id]
+	if !ok {
+		return uploadJob{}, false
+	}
+	return *job, true
+}
+
+// pruneUploadJobs forgets jobs finished longer ago than uploadJobRetention, must hold UploadJobsLock
+func (server *Server) pruneUploadJobs() {
+	now := time.Now()
+	for id, job := range server.UploadJobs {
+		if job.Finished != nil && now.Sub(*job.Finished) > uploadJobRetention {
+			delete(server.UploadJobs, id)
+		}
+	}
+}
+
+func newUploadJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,228 @@
+package chartmuseum
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Size of request bodies, by method and route
+	requestSizeHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "chartmuseum",
+			Name:      "http_request_size_bytes",
+			Help:      "Size of HTTP request bodies",
+			Buckets:   prometheus.ExponentialBuckets(100, 10, 7), // 100B to 100MB
+		},
+		[]string{"method", "url"},
+	)
+	// Size of response bodies, by method and route
+	responseSizeHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "chartmuseum",
+			Name:      "http_response_size_bytes",
+			Help:      "Size of HTTP response bodies",
+			Buckets:   prometheus.ExponentialBuckets(100, 10, 7), // 100B to 100MB
+		},
+		[]string{"method", "url"},
+	)
+	// Number of requests currently being served
+	inFlightRequestsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "http_requests_in_flight",
+			Help:      "Current number of HTTP requests being served",
+		},
+	)
+	// Resumable uploads in progress on this instance, and the bytes received for them so far
+	resumableUploadsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "resumable_uploads",
+			Help:      "Current number of resumable uploads in progress",
+		},
+	)
+	resumableUploadBytesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "resumable_upload_bytes",
+			Help:      "Bytes received so far for the resumable uploads in progress",
+		},
+	)
+	// Resumable uploads aborted because they received nothing for too long, and their bytes
+	resumableUploadsReapedCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "chartmuseum",
+			Name:      "resumable_uploads_reaped_total",
+			Help:      "Total number of expired resumable uploads aborted",
+		},
+	)
+	resumableUploadReapedBytesCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "chartmuseum",
+			Name:      "resumable_upload_reaped_bytes_total",
+			Help:      "Total bytes of orphaned resumable uploads removed",
+		},
+	)
+	// Result of the last storage health check
+	storageHealthyGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "storage_healthy",
+			Help:      "Whether the last storage health check succeeded (1) or failed (0)",
+		},
+	)
+	// Number of packages which could not be added to the index
+	quarantinedObjectsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "quarantined_packages",
+			Help:      "Number of packages in storage which could not be added to the index",
+		},
+	)
+	// Results of the last integrity audit
+	auditCorruptPackagesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "audit_corrupt_packages",
+			Help:      "Number of packages which did not match their digest in the last integrity audit",
+		},
+	)
+	auditMissingPackagesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "audit_missing_packages",
+			Help:      "Number of packages in the index which could not be read in the last integrity audit",
+		},
+	)
+	auditLastRunGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "audit_last_run_timestamp_seconds",
+			Help:      "When the last integrity audit finished",
+		},
+	)
+	// Progress of loading chart packages from storage into the index
+	indexBuildProgressGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "index_build_progress_ratio",
+			Help:      "Fraction of chart packages loaded by the current index build (1 once finished)",
+		},
+	)
+	// Number of storage objects the index was last built from
+	storageCacheObjectsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "storage_cache_objects",
+			Help:      "Current number of chart packages in the storage listing cached to update the index",
+		},
+	)
+	// Requests rejected for missing or wrong credentials, by method and route (or gRPC method)
+	authFailuresCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "chartmuseum",
+			Name:      "auth_failures_total",
+			Help:      "Number of requests rejected for missing or invalid credentials",
+		},
+		[]string{"method", "url", "reason"},
+	)
+	// Chart packages pushed and deleted, by the identity which authenticated the request
+	chartPushesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "chartmuseum",
+			Name:      "chart_pushes_total",
+			Help:      "Number of chart packages pushed, by identity",
+		},
+		[]string{"identity"},
+	)
+	// Clients locked out after repeated authentication failures, and requests rejected while locked out
+	authLockoutsCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "chartmuseum",
+			Name:      "auth_lockouts_total",
+			Help:      "Number of times a client was locked out after repeated authentication failures",
+		},
+	)
+	authLockedOutRequestsCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "chartmuseum",
+			Name:      "auth_locked_out_requests_total",
+			Help:      "Number of requests rejected because the client was locked out",
+		},
+	)
+	chartDeletesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "chartmuseum",
+			Name:      "chart_deletes_total",
+			Help:      "Number of chart versions deleted, by identity",
+		},
+		[]string{"identity"},
+	)
+)
+
+const (
+	authFailureMissingCredentials = "missing_credentials"
+	authFailureInvalidCredentials = "invalid_credentials"
+
+	// identities of requests without a username, for the per-identity counters
+	identityAnonymous   = "anonymous"
+	identityBearerToken = "bearer"
+)
+
+func init() {
+	prometheus.MustRegister(requestSizeHistogram, responseSizeHistogram, inFlightRequestsGauge, storageHealthyGauge, quarantinedObjectsGauge, indexBuildProgressGauge,
+		storageCacheObjectsGauge, auditCorruptPackagesGauge, auditMissingPackagesGauge, auditLastRunGauge, authFailuresCounter, chartPushesCounter, chartDeletesCounter,
+		authLockoutsCounter, authLockedOutRequestsCounter, resumableUploadsGauge, resumableUploadBytesGauge, resumableUploadsReapedCounter,
+		resumableUploadReapedBytesCounter)
+}
+
+func metricsMiddleware(c *gin.Context) {
+	inFlightRequestsGauge.Inc()
+	defer inFlightRequestsGauge.Dec()
+
+	c.Next()
+
+	url := mapURLWithParamsBackToRouteTemplate(c)
+	requestSize := c.Request.ContentLength
+	if requestSize < 0 {
+		requestSize = 0 // unknown (e.g. chunked)
+	}
+	responseSize := c.Writer.Size()
+	if responseSize < 0 {
+		responseSize = 0 // nothing written
+	}
+	requestSizeHistogram.WithLabelValues(c.Request.Method, url).Observe(float64(requestSize))
+	responseSizeHistogram.WithLabelValues(c.Request.Method, url).Observe(float64(responseSize))
+}
+
+// recordAuthFailure counts a request which was rejected for the given Authorization header value
+func recordAuthFailure(method string, url string, authorization string) {
+	reason := authFailureInvalidCredentials
+	if authorization == "" {
+		reason = authFailureMissingCredentials
+	}
+	authFailuresCounter.WithLabelValues(method, url, reason).Inc()
+}
+
+// identityFromAuthorization names who sent a verified Authorization header value: the basic auth
+// username, "bearer" for a bearer token, or "anonymous" if authentication is disabled
+func identityFromAuthorization(authorization string, verified bool) string {
+	if !verified {
+		return identityAnonymous
+	}
+	username, auth := uploaderFromAuthorization(authorization)
+	if auth == "bearer" {
+		return identityBearerToken
+	}
+	if username == "" {
+		return identityAnonymous
+	}
+	return username
+}
+
+// requestIdentity returns the identity of an HTTP request, see identityFromAuthorization
+func requestIdentity(c *gin.Context) string {
+	_, verified := c.Get(gin.AuthUserKey)
+	return identityFromAuthorization(c.Request.Header.Get("Authorization"), verified)
+}
@@ -0,0 +1,98 @@
+package chartmuseum
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricsPath is where Prometheus metrics are served
+const metricsPath = "/metrics"
+
+// metricsAuthorizedKey is set on requests to metricsPath authorized with the metrics credentials,
+// which don't need the main credentials
+const metricsAuthorizedKey = "metricsAuthorized"
+
+var errMetricsClientCAWithoutTLS = errors.New("a metrics client CA needs TLS, set --tls-cert and --tls-key")
+
+// metricsAuth protects metricsPath with credentials of its own, a bearer token and/or client
+// certificates issued by a CA, so that metrics can stay private while charts are public (or the
+// other way around). Requests with either are authorized.
+type metricsAuth struct {
+	token     string
+	clientCAs *x509.CertPool
+}
+
+// newMetricsAuth creates the metrics auth from a bearer token and the file of PEM CA certificates
+// client certificates must be issued by, nil if neither is configured
+func newMetricsAuth(token string, clientCAFilename string) (*metricsAuth, error) {
+	if token == "" && clientCAFilename == "" {
+		return nil, nil
+	}
+	auth := &metricsAuth{token: token}
+	if clientCAFilename != "" {
+		content, err := ioutil.ReadFile(clientCAFilename)
+		if err != nil {
+			return nil, err
+		}
+		auth.clientCAs = x509.NewCertPool()
+		if !auth.clientCAs.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("invalid metrics client CA %s, expected PEM certificates", clientCAFilename)
+		}
+	}
+	return auth, nil
+}
+
+// authorize checks the bearer token or client certificate of a request
+func (auth *metricsAuth) authorize(req *http.Request) bool {
+	authorization := req.Header.Get("Authorization")
+	if auth.token != "" && strings.HasPrefix(authorization, "Bearer ") {
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(auth.token)) == 1 {
+			return true
+		}
+	}
+	if auth.clientCAs == nil || req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return false
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range req.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := req.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         auth.clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err == nil
+}
+
+// requestsClientCertificates tells whether TLS connections should ask clients for a certificate.
+// Certificates are only verified for metricsPath, so clients without one are not affected.
+func (auth *metricsAuth) requestsClientCertificates() bool {
+	return auth != nil && auth.clientCAs != nil
+}
+
+// metricsAuthMiddleware rejects requests to metricsPath without the metrics credentials with 401,
+// whether or not other routes need credentials
+func (server *Server) metricsAuthMiddleware(c *gin.Context) {
+	if server.MetricsAuth == nil || c.Request.URL.Path != metricsPath {
+		return
+	}
+	if !server.MetricsAuth.authorize(c.Request) {
+		authorization := c.Request.Header.Get("Authorization")
+		recordAuthFailure(c.Request.Method, metricsPath, authorization)
+		if server.MetricsAuth.token != "" {
+			c.Header("WWW-Authenticate", "Bearer realm=\""+basicAuthRealm+"\"")
+		}
+		c.AbortWithStatus(401)
+		return
+	}
+	c.Set(metricsAuthorizedKey, true)
+}
@@ -0,0 +1,178 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/smtp"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+// notificationTimeout is how long to wait for a Slack webhook to accept a notification
+var notificationTimeout = 10 * time.Second
+
+var errNotificationsWithoutSMTP = errors.New("email notifications require an smtp address and from address")
+
+type (
+	// notificationsConfig maps chart name patterns to where new versions of matching charts are announced
+	notificationsConfig struct {
+		SMTP  smtpConfig         `json:"smtp"`
+		Rules []notificationRule `json:"rules"`
+	}
+
+	smtpConfig struct {
+		Address  string `json:"address"` // host:port
+		From     string `json:"from"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	// notificationRule announces new versions of charts whose name matches one of Charts (shell
+	// patterns, e.g. "team-*") to a Slack incoming webhook and/or email recipients
+	notificationRule struct {
+		Charts []string `json:"charts"`
+		Slack  string   `json:"slack"`
+		Email  []string `json:"email"`
+	}
+)
+
+// loadNotificationsConfig reads and validates the notifications config file at filename
+func loadNotificationsConfig(filename string) (*notificationsConfig, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := &notificationsConfig{}
+	err = yaml.Unmarshal(content, config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications config %s: %s", filename, err)
+	}
+	for _, rule := range config.Rules {
+		for _, pattern := range rule.Charts {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid chart pattern %q in notifications config: %s", pattern, err)
+			}
+		}
+		if len(rule.Email) > 0 && (config.SMTP.Address == "" || config.SMTP.From == "") {
+			return nil, errNotificationsWithoutSMTP
+		}
+	}
+	return config, nil
+}
+
+// matches returns whether rule applies to the chart called name
+func (rule notificationRule) matches(name string) bool {
+	for _, pattern := range rule.Charts {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// notificationMessage describes a new chart version to humans
+func notificationMessage(chartVersion *helm_repo.ChartVersion, uploader string) string {
+	message := fmt.Sprintf("New version of chart %s: %s", chartVersion.Name, chartVersion.Version)
+	if uploader != "" {
+		message += fmt.Sprintf(" (uploaded by %s)", uploader)
+	}
+	if chartVersion.Description != "" {
+		message += "\n" + chartVersion.Description
+	}
+	if len(chartVersion.URLs) > 0 {
+		message += "\n" + chartVersion.URLs[0]
+	}
+	return message
+}
+
+// notifyNewChartVersion announces a newly uploaded chart version, in the background, following
+// every rule matching its name. Failures are logged, they never fail the upload.
+func (server *Server) notifyNewChartVersion(chartVersion *helm_repo.ChartVersion, uploader string) {
+	if server.Notifications == nil {
+		return
+	}
+	message := notificationMessage(chartVersion, uploader)
+	for _, rule := range server.Notifications.Rules {
+		if !rule.matches(chartVersion.Name) {
+			continue
+		}
+		if rule.Slack != "" {
+			go server.logNotificationError("slack", chartVersion, server.sendSlackNotification(rule.Slack, message))
+		}
+		if len(rule.Email) > 0 {
+			subject := fmt.Sprintf("New version of chart %s: %s", chartVersion.Name, chartVersion.Version)
+			go server.logNotificationError("email", chartVersion, server.sendEmailNotification(rule.Email, subject, message))
+		}
+	}
+}
+
+// notifyUploadedPackage announces the chart version of a package which was just uploaded and indexed
+func (server *Server) notifyUploadedPackage(filename string) {
+	if server.Notifications == nil {
+		return
+	}
+	chartVersion := server.RepositoryIndex.GetByPackage(filename)
+	if chartVersion == nil {
+		return
+	}
+	uploader := ""
+	if record := server.getUploadRecord(filename); record != nil {
+		uploader = record.Uploader
+	}
+	server.notifyNewChartVersion(chartVersion, uploader)
+}
+
+func (server *Server) logNotificationError(channel string, chartVersion *helm_repo.ChartVersion, send func() error) {
+	err := send()
+	if err != nil {
+		server.Logger.Warnw("Unable to send notification of new chart version",
+			"channel", channel,
+			"name", chartVersion.Name,
+			"version", chartVersion.Version,
+			"error", err.Error(),
+		)
+	}
+}
+
+// sendSlackNotification returns a function posting message to a Slack incoming webhook
+func (server *Server) sendSlackNotification(webhookURL string, message string) func() error {
+	return func() error {
+		body, err := json.Marshal(map[string]string{"text": message})
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Timeout: notificationTimeout}
+		response, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("slack webhook responded with status %d", response.StatusCode)
+		}
+		return nil
+	}
+}
+
+// sendEmailNotification returns a function mailing message to recipients through the configured SMTP server
+func (server *Server) sendEmailNotification(recipients []string, subject string, message string) func() error {
+	return func() error {
+		config := server.Notifications.SMTP
+		var auth smtp.Auth
+		if config.Username != "" {
+			host := strings.Split(config.Address, ":")[0]
+			auth = smtp.PlainAuth("", config.Username, config.Password, host)
+		}
+		body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n",
+			config.From, strings.Join(recipients, ", "), subject, strings.Replace(message, "\n", "\r\n", -1))
+		return smtp.SendMail(config.Address, auth, config.From, recipients, []byte(body))
+	}
+}
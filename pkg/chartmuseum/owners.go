@@ -0,0 +1,260 @@
+package chartmuseum
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+
+	"github.com/ghodss/yaml"
+	"github.com/gin-gonic/gin"
+)
+
+// chartOwnersFileName is the object in storage holding owners registered through the API
+var chartOwnersFileName = "chart-owners.json"
+
+// chartOwnersLockKey is the Locker key held while chartOwnersFileName is updated
+var chartOwnersLockKey = "owners"
+
+var (
+	errNoChartOwners           = errors.New("at least one owner is required, delete the owners of the chart instead")
+	errChartOwnersBeingUpdated = errors.New("chart owners are already being updated, try again")
+)
+
+type (
+	// chartOwnersConfig lists the owners of charts by name pattern, like a CODEOWNERS file: the
+	// last rule matching a chart decides its owners
+	chartOwnersConfig struct {
+		Rules []chartOwnersRule `json:"rules"`
+	}
+
+	// chartOwnersRule makes Owners (identities, see identityFromAuthorization) the owners of charts
+	// whose name matches one of Charts (shell patterns, e.g. "team-*")
+	chartOwnersRule struct {
+		Charts []string `json:"charts"`
+		Owners []string `json:"owners"`
+	}
+
+	// chartOwnerError is returned when an identity pushes or deletes a chart it does not own
+	chartOwnerError struct {
+		name     string
+		identity string
+	}
+)
+
+func (err chartOwnerError) Error() string {
+	return fmt.Sprintf("%s is not an owner of chart %s", err.identity, err.name)
+}
+
+// loadChartOwnersConfig reads and validates the chart owners config file at filename
+func loadChartOwnersConfig(filename string) (*chartOwnersConfig, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := &chartOwnersConfig{}
+	err = yaml.Unmarshal(content, config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chart owners config %s: %s", filename, err)
+	}
+	for _, rule := range config.Rules {
+		for _, pattern := range rule.Charts {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid chart pattern %q in chart owners config: %s", pattern, err)
+			}
+		}
+	}
+	return config, nil
+}
+
+// registeredChartOwners returns the owners registered through the API, by chart name. They are
+// read from storage so that all instances agree, falling back to the last ones read.
+func (server *Server) registeredChartOwners() map[string][]string {
+	object, err := server.StorageBackend.GetObject(chartOwnersFileName)
+	if err == nil {
+		owners := map[string][]string{}
+		if json.Unmarshal(object.Content, &owners) == nil {
+			server.ChartOwnersLock.Lock()
+			server.ChartOwners = owners
+			server.ChartOwnersLock.Unlock()
+		}
+	}
+	server.ChartOwnersLock.RLock()
+	defer server.ChartOwnersLock.RUnlock()
+	return server.ChartOwners
+}
+
+// chartOwners returns the owners of a chart, registered through the API or else from the config
+// file, and whether they were registered. Charts without owners can be pushed and deleted by anyone.
+func (server *Server) chartOwners(name string) ([]string, bool) {
+	if owners, ok := server.registeredChartOwners()[name]; ok {
+		return owners, true
+	}
+	var owners []string
+	if server.ChartOwnersConfig != nil {
+		for _, rule := range server.ChartOwnersConfig.Rules {
+			for _, pattern := range rule.Charts {
+				if matched, _ := path.Match(pattern, name); matched {
+					owners = rule.Owners
+					break
+				}
+			}
+		}
+	}
+	return owners, false
+}
+
+// checkChartOwner returns a chartOwnerError unless the chart has no owners or identity is one of them
+func (server *Server) checkChartOwner(name string, identity string) error {
+	owners, _ := server.chartOwners(name)
+	if len(owners) == 0 {
+		return nil
+	}
+	for _, owner := range owners {
+		if owner == identity {
+			return nil
+		}
+	}
+	return chartOwnerError{name: name, identity: identity}
+}
+
+// checkUploadOwner checks that identity owns the chart of an uploaded chart package or provenance
+// file. Invalid uploads pass, since they are reported when saving them.
+func (server *Server) checkUploadOwner(content []byte, identity string) error {
+	name, err := repo.ChartNameFromContent(content)
+	if err != nil {
+		return nil
+	}
+	return server.checkChartOwner(name, identity)
+}
+
+// requireChartOwnerOrAdmin rejects requests about the chart in the route with 403 unless they were
+// marked by identifyAdmin or their identity is one of its current owners. Charts without owners are
+// only claimed by administrators.
+func (server *Server) requireChartOwnerOrAdmin(c *gin.Context) {
+	if c.GetBool(adminKey) {
+		return
+	}
+	name, identity := c.Param("name"), requestIdentity(c)
+	owners, _ := server.chartOwners(name)
+	for _, owner := range owners {
+		if owner == identity {
+			return
+		}
+	}
+	err := chartOwnerError{name: name, identity: identity}
+	c.JSON(403, newErrorResponse(errorCodeNotChartOwner, err.Error(), nil))
+	c.Abort()
+}
+
+// setRegisteredChartOwners registers the owners of a chart, or unregisters them if owners is empty.
+// The owners registered so far are read and written back while holding the Locker, so that updates
+// from other instances sharing it are not lost.
+func (server *Server) setRegisteredChartOwners(name string, owners []string) (int, error) {
+	server.ChartOwnersUpdateLock.Lock()
+	defer server.ChartOwnersUpdateLock.Unlock()
+	locked, err := server.Locker.TryLock(chartOwnersLockKey)
+	if err != nil {
+		return 500, err
+	}
+	if !locked {
+		return 409, errChartOwnersBeingUpdated // conflict
+	}
+	defer func() {
+		err := server.Locker.Unlock(chartOwnersLockKey)
+		if err != nil {
+			server.Logger.Warnw("Unable to release chart owners lock",
+				"error", err.Error(),
+			)
+		}
+	}()
+	registered := map[string][]string{}
+	for chart, chartOwners := range server.registeredChartOwners() {
+		registered[chart] = chartOwners
+	}
+	if len(owners) == 0 {
+		delete(registered, name)
+	} else {
+		registered[name] = owners
+	}
+	content, err := json.Marshal(registered)
+	if err != nil {
+		return 500, err
+	}
+	err = server.StorageBackend.PutObject(chartOwnersFileName, content)
+	if err != nil {
+		return 500, err
+	}
+	server.ChartOwnersLock.Lock()
+	server.ChartOwners = registered
+	server.ChartOwnersLock.Unlock()
+	return 200, nil
+}
+
+func (server *Server) getChartOwnersRequestHandler(c *gin.Context) {
+	var rules []chartOwnersRule
+	if server.ChartOwnersConfig != nil {
+		rules = server.ChartOwnersConfig.Rules
+	}
+	c.JSON(200, gin.H{"charts": server.registeredChartOwners(), "rules": rules})
+}
+
+func (server *Server) getChartOwnerRequestHandler(c *gin.Context) {
+	name := c.Param("name")
+	owners, registered := server.chartOwners(name)
+	if owners == nil {
+		owners = []string{}
+	}
+	c.JSON(200, gin.H{"chart": name, "owners": owners, "registered": registered})
+}
+
+func (server *Server) putChartOwnerRequestHandler(c *gin.Context) {
+	name := c.Param("name")
+	var body struct {
+		Owners []string `json:"owners"`
+	}
+	content, err := c.GetRawData()
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	err = json.Unmarshal(content, &body)
+	if err != nil {
+		c.JSON(400, errorResponse(400, err))
+		return
+	}
+	if len(body.Owners) == 0 {
+		c.JSON(400, errorResponse(400, errNoChartOwners))
+		return
+	}
+	status, err := server.setRegisteredChartOwners(name, body.Owners)
+	if err != nil {
+		c.JSON(status, errorResponse(status, err))
+		return
+	}
+	server.Logger.Infow("Registered chart owners",
+		"chart", name,
+		"owners", body.Owners,
+	)
+	c.JSON(200, gin.H{"chart": name, "owners": body.Owners, "registered": true})
+}
+
+func (server *Server) deleteChartOwnerRequestHandler(c *gin.Context) {
+	name := c.Param("name")
+	if _, ok := server.registeredChartOwners()[name]; !ok {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	status, err := server.setRegisteredChartOwners(name, nil)
+	if err != nil {
+		c.JSON(status, errorResponse(status, err))
+		return
+	}
+	server.Logger.Infow("Unregistered chart owners",
+		"chart", name,
+	)
+	c.JSON(200, objectDeletedResponse)
+}
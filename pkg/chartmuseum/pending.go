@@ -0,0 +1,132 @@
+package chartmuseum
+
+import (
+	"time"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+)
+
+var (
+	// pendingObjectTimeout is how long an uploaded package is assumed to exist even though
+	// it does not show up when listing storage (for eventually consistent backends)
+	pendingObjectTimeout = 5 * time.Minute
+)
+
+// pendingObject is a package which was successfully written to storage, but may not be listed yet
+type pendingObject struct {
+	Object  storage.Object `json:"object"`
+	Expires time.Time      `json:"expires"`
+}
+
+// indexUploadedPackage makes sure a package which was just written to storage is part of
+// the index by the time the upload request returns, so that clients pushing a chart and
+// immediately running `helm repo update` always see the new version. Failing to do so is logged
+// and returned, so that the upload can be rolled back (see storeUploadedFiles); otherwise the
+// package is indexed by the next sync.
+func (server *Server) indexUploadedPackage(filename string) error {
+	server.invalidateListedObjects()
+	now := time.Now()
+	server.addPendingObjects(map[string]pendingObject{
+		filename: {
+			Object:  storage.Object{Path: filename, Content: []byte{}, LastModified: now},
+			Expires: now.Add(pendingObjectTimeout),
+		},
+	})
+	err := server.regenerateRepositoryIndex()
+	if err != nil {
+		server.Logger.Warnw("Unable to add uploaded package to index",
+			"package", filename,
+			"error", err.Error(),
+		)
+		return err
+	}
+	server.notifyUploadedPackage(filename)
+	return nil
+}
+
+// indexDeletedPackage removes a package which was just deleted from storage from the index,
+// rather than waiting for the next sync
+func (server *Server) indexDeletedPackage(filename string) {
+	server.invalidateListedObjects()
+	server.PendingObjectsLock.Lock()
+	delete(server.PendingObjects, filename)
+	server.PendingObjectsLock.Unlock()
+	err := server.regenerateRepositoryIndex()
+	if err != nil {
+		server.Logger.Warnw("Unable to remove deleted package from index",
+			"package", filename,
+			"error", err.Error(),
+		)
+	}
+}
+
+// indexRolledBackPackage updates the index for a package whose upload was rolled back: a package
+// which was overwritten and then restored is loaded again, since the index may hold the content of
+// the failed upload, and a new package is removed like a deleted one
+func (server *Server) indexRolledBackPackage(filename string, restored bool) {
+	if !restored {
+		server.indexDeletedPackage(filename)
+		return
+	}
+	server.invalidateListedObjects()
+	now := time.Now()
+	server.PendingObjectsLock.Lock()
+	server.PendingObjects[filename] = pendingObject{
+		Object:  storage.Object{Path: filename, Content: []byte{}, LastModified: now},
+		Expires: now.Add(pendingObjectTimeout),
+	}
+	server.PendingObjectsLock.Unlock()
+	err := server.regenerateRepositoryIndex()
+	if err != nil {
+		server.Logger.Warnw("Unable to index restored package",
+			"package", filename,
+			"error", err.Error(),
+		)
+	}
+}
+
+func (server *Server) addPendingObjects(objects map[string]pendingObject) {
+	server.PendingObjectsLock.Lock()
+	defer server.PendingObjectsLock.Unlock()
+	for path, p := range objects {
+		if _, ok := server.PendingObjects[path]; !ok {
+			server.PendingObjects[path] = p
+		}
+	}
+}
+
+func (server *Server) getPendingObjects() map[string]pendingObject {
+	server.PendingObjectsLock.Lock()
+	defer server.PendingObjectsLock.Unlock()
+	objects := map[string]pendingObject{}
+	for path, p := range server.PendingObjects {
+		objects[path] = p
+	}
+	return objects
+}
+
+// mergePendingObjects adds pending objects missing from a storage listing. Pending objects
+// are forgotten once they are listed, or once they expire.
+func (server *Server) mergePendingObjects(objects []storage.Object) []storage.Object {
+	server.PendingObjectsLock.Lock()
+	defer server.PendingObjectsLock.Unlock()
+
+	if len(server.PendingObjects) == 0 {
+		return objects
+	}
+
+	listed := map[string]bool{}
+	for _, object := range objects {
+		listed[object.Path] = true
+	}
+
+	now := time.Now()
+	for path, p := range server.PendingObjects {
+		if listed[path] || now.After(p.Expires) {
+			delete(server.PendingObjects, path)
+			continue
+		}
+		objects = append(objects, p.Object)
+	}
+	return objects
+}
@@ -0,0 +1,95 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// policyTimeout is how long to wait for the policy engine to decide on an upload
+var policyTimeout = 10 * time.Second
+
+var errPolicyUndefined = errors.New("policy decision is undefined, check --policy-url")
+
+// policyInput is sent to the policy engine as input for each uploaded chart package
+type policyInput struct {
+	Chart *repo.ChartPackageContents `json:"chart"`
+}
+
+// policyDecision is the result of evaluating the upload policy, either a list of violations
+// (deny), or whether the upload is allowed at all (allow)
+type policyDecision struct {
+	Deny  []string `json:"deny"`
+	Allow *bool    `json:"allow"`
+}
+
+// policyViolationError lists the reasons the policy engine gave for rejecting an upload
+type policyViolationError struct {
+	violations []string
+}
+
+func (err policyViolationError) Error() string {
+	return fmt.Sprintf("chart package violates policy: %s", strings.Join(err.violations, ", "))
+}
+
+// checkChartPolicy asks the policy engine at PolicyURL (the OPA data API, e.g.
+// http://localhost:8181/v1/data/chartmuseum/upload) whether an uploaded chart package may be saved
+func (server *Server) checkChartPolicy(content []byte) error {
+	if server.PolicyURL == "" {
+		return nil
+	}
+	contents, err := repo.ChartPackageContentsFromContent(content)
+	if err == repo.ErrorInvalidChartPackage {
+		return nil // reported when saving the package
+	}
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(gin.H{"input": policyInput{Chart: contents}})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: policyTimeout}
+	res, err := client.Post(server.PolicyURL, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("policy engine responded with status %d", res.StatusCode)
+	}
+	var response struct {
+		Result *policyDecision `json:"result"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+	decision := response.Result
+	if decision == nil || (decision.Deny == nil && decision.Allow == nil) {
+		return errPolicyUndefined
+	}
+	if len(decision.Deny) > 0 {
+		return policyViolationError{decision.Deny}
+	}
+	if decision.Allow != nil && !*decision.Allow {
+		return policyViolationError{[]string{"upload not allowed"}}
+	}
+	return nil
+}
+
+// policyErrorResponse returns the status and body to respond with when checkChartPolicy fails
+func policyErrorResponse(err error) (int, gin.H) {
+	if violation, ok := err.(policyViolationError); ok {
+		return 403, newErrorResponse(errorCodePolicyViolation, violation.Error(), gin.H{"violations": violation.violations})
+	}
+	return 500, errorResponse(500, err)
+}
@@ -0,0 +1,91 @@
+package chartmuseum
+
+import (
+	"time"
+)
+
+var (
+	// indexBuildProgressInterval is how often progress of loading chart packages into the index is logged
+	indexBuildProgressInterval = 10 * time.Second
+)
+
+// indexBuildProgress tracks chart packages being loaded from storage while building the index
+type indexBuildProgress struct {
+	Loaded     int       `json:"loaded"`
+	Total      int       `json:"total"`
+	Percent    float64   `json:"percent"`
+	ETA        string    `json:"eta,omitempty"`
+	Started    time.Time `json:"started"`
+	lastLogged time.Time
+}
+
+// eta estimates the time left from the average time taken per package so far
+func (progress *indexBuildProgress) eta(now time.Time) time.Duration {
+	if progress.Loaded == 0 {
+		return 0
+	}
+	perObject := now.Sub(progress.Started) / time.Duration(progress.Loaded)
+	return (perObject * time.Duration(progress.Total-progress.Loaded)).Round(time.Second)
+}
+
+func (server *Server) startIndexBuildProgress(total int) {
+	server.IndexProgressLock.Lock()
+	defer server.IndexProgressLock.Unlock()
+	now := time.Now()
+	server.IndexProgress = &indexBuildProgress{Total: total, Started: now, lastLogged: now}
+	indexBuildProgressGauge.Set(0)
+}
+
+// updateIndexBuildProgress records that loaded packages are done, logging progress every indexBuildProgressInterval
+func (server *Server) updateIndexBuildProgress(loaded int) {
+	server.IndexProgressLock.Lock()
+	defer server.IndexProgressLock.Unlock()
+	progress := server.IndexProgress
+	if progress == nil {
+		return
+	}
+	now := time.Now()
+	progress.Loaded = loaded
+	progress.Percent = float64(loaded) * 100 / float64(progress.Total)
+	progress.ETA = progress.eta(now).String()
+	indexBuildProgressGauge.Set(float64(loaded) / float64(progress.Total))
+	if now.Sub(progress.lastLogged) >= indexBuildProgressInterval {
+		progress.lastLogged = now
+		server.Logger.Infow("Loading chart packages from storage",
+			"loaded", loaded,
+			"total", progress.Total,
+			"percent", int(progress.Percent),
+			"eta", progress.ETA,
+		)
+	}
+}
+
+func (server *Server) finishIndexBuildProgress() {
+	server.IndexProgressLock.Lock()
+	defer server.IndexProgressLock.Unlock()
+	if server.IndexProgress != nil && time.Since(server.IndexProgress.Started) >= indexBuildProgressInterval {
+		server.Logger.Infow("Finished loading chart packages from storage",
+			"total", server.IndexProgress.Total,
+			"duration", time.Since(server.IndexProgress.Started).Round(time.Second).String(),
+		)
+	}
+	server.IndexProgress = nil
+	indexBuildProgressGauge.Set(1)
+}
+
+// getIndexBuildProgress returns a copy of the progress of the index build in progress, if any
+func (server *Server) getIndexBuildProgress() (indexBuildProgress, bool) {
+	server.IndexProgressLock.RLock()
+	defer server.IndexProgressLock.RUnlock()
+	if server.IndexProgress == nil {
+		return indexBuildProgress{}, false
+	}
+	return *server.IndexProgress, true
+}
+
+// indexBuilt returns whether the index was built from storage for the first time
+func (server *Server) indexBuilt() bool {
+	server.IndexProgressLock.RLock()
+	defer server.IndexProgressLock.RUnlock()
+	return server.IndexBuilt
+}
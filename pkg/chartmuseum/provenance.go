@@ -0,0 +1,59 @@
+package chartmuseum
+
+import (
+	"strings"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+)
+
+// updateProvenanceFiles records which provenance files are in a storage listing, so that provenance
+// files added or removed out-of-band (not through the API) are noticed by the next sync
+func (server *Server) updateProvenanceFiles(objects []storage.Object) {
+	provenanceFiles := map[string]bool{}
+	for _, object := range objects {
+		if strings.HasSuffix(object.Path, repo.ProvenanceFileExtension) {
+			provenanceFiles[object.Path] = true
+		}
+	}
+	server.ProvenanceFilesLock.Lock()
+	defer server.ProvenanceFilesLock.Unlock()
+	for filename := range provenanceFiles {
+		if !server.ProvenanceFiles[filename] {
+			server.Logger.Debugw("Provenance file added",
+				"provenance_file", filename,
+			)
+		}
+	}
+	for filename := range server.ProvenanceFiles {
+		if !provenanceFiles[filename] {
+			server.Logger.Debugw("Provenance file removed",
+				"provenance_file", filename,
+			)
+		}
+	}
+	server.ProvenanceFiles = provenanceFiles
+}
+
+// addProvenanceFile records a provenance file uploaded through the API
+func (server *Server) addProvenanceFile(filename string) {
+	server.invalidateListedObjects()
+	server.ProvenanceFilesLock.Lock()
+	defer server.ProvenanceFilesLock.Unlock()
+	server.ProvenanceFiles[filename] = true
+}
+
+// removeProvenanceFile records that a provenance file was deleted through the API
+func (server *Server) removeProvenanceFile(filename string) {
+	server.invalidateListedObjects()
+	server.ProvenanceFilesLock.Lock()
+	defer server.ProvenanceFilesLock.Unlock()
+	delete(server.ProvenanceFiles, filename)
+}
+
+// hasProvenanceFile returns whether a chart version was signed, as of the last storage sync or upload
+func (server *Server) hasProvenanceFile(name string, version string) bool {
+	server.ProvenanceFilesLock.RLock()
+	defer server.ProvenanceFilesLock.RUnlock()
+	return server.ProvenanceFiles[repo.ProvenanceFilenameFromNameVersion(name, version)]
+}
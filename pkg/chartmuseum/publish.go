@@ -0,0 +1,57 @@
+package chartmuseum
+
+import (
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+)
+
+// publishedChartsDirectory is where chart packages are published, matching the relative urls in index.yaml
+const publishedChartsDirectory = "charts"
+
+// PublishRepository writes the current index to the publish backend, along with all chart
+// packages and provenance files if PublishCharts is set, so it can be served as a static site
+func (server *Server) PublishRepository() (storage.PublishResult, error) {
+	server.PublishLock.Lock()
+	defer server.PublishLock.Unlock()
+	index := server.RepositoryIndex
+
+	var result storage.PublishResult
+	if server.PublishCharts {
+		var err error
+		result, err = storage.PublishObjects(server.StorageBackend, server.PublishBackend, publishedChartsDirectory,
+			[]string{repo.ChartPackageFileExtension, repo.ProvenanceFileExtension})
+		if err != nil {
+			return result, err
+		}
+	}
+	// the index goes last, so it never refers to packages which are not published yet
+	err := server.PublishBackend.PutObject(repo.IndexGzipFileName, index.RawGzip)
+	if err != nil {
+		return result, err
+	}
+	err = server.PublishBackend.PutObject(repo.IndexFileName, index.Raw)
+	if err != nil {
+		return result, err
+	}
+	server.Logger.Infow("Published repository",
+		"copied", result.Copied,
+		"deleted", result.Deleted,
+		"unchanged", result.Unchanged,
+	)
+	return result, nil
+}
+
+// publishRepositoryOnChange publishes the index in the background, unless publishing runs on a schedule
+func (server *Server) publishRepositoryOnChange() {
+	if server.PublishBackend == nil || server.PublishInterval > 0 {
+		return
+	}
+	go func() {
+		_, err := server.PublishRepository()
+		if err != nil {
+			server.Logger.Errorw("Unable to publish repository",
+				"error", err.Error(),
+			)
+		}
+	}()
+}
@@ -0,0 +1,172 @@
+package chartmuseum
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quarantinedObject is a package in storage which could not be added to the index
+type quarantinedObject struct {
+	Path        string    `json:"path"`
+	Error       string    `json:"error"`
+	Invalid     bool      `json:"invalid"` // not a valid chart package, only retried once the object changes
+	Quarantined time.Time `json:"quarantined"`
+}
+
+// quarantineObject records that object could not be loaded into the index, so that
+// the index can still be built from the remaining packages
+func (server *Server) quarantineObject(object storage.Object, err error) {
+	server.Logger.Warnw("Quarantining package which cannot be added to index",
+		"package", object.Path,
+		"error", err.Error(),
+	)
+	server.QuarantineLock.Lock()
+	defer server.QuarantineLock.Unlock()
+	server.Quarantine[object.Path] = quarantinedObject{
+		Path:        object.Path,
+		Error:       err.Error(),
+		Invalid:     err == repo.ErrorInvalidChartPackage,
+		Quarantined: time.Now(),
+	}
+	quarantinedObjectsGauge.Set(float64(len(server.Quarantine)))
+}
+
+// releaseQuarantinedObject forgets about a package once it was indexed or removed from storage
+func (server *Server) releaseQuarantinedObject(path string) {
+	server.QuarantineLock.Lock()
+	defer server.QuarantineLock.Unlock()
+	if _, ok := server.Quarantine[path]; !ok {
+		return
+	}
+	server.Logger.Infow("Releasing package from quarantine",
+		"package", path,
+	)
+	delete(server.Quarantine, path)
+	quarantinedObjectsGauge.Set(float64(len(server.Quarantine)))
+}
+
+// getQuarantinedObjects returns all quarantined packages, sorted by path
+func (server *Server) getQuarantinedObjects() []quarantinedObject {
+	server.QuarantineLock.RLock()
+	defer server.QuarantineLock.RUnlock()
+	objects := []quarantinedObject{}
+	for _, object := range server.Quarantine {
+		objects = append(objects, object)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Path < objects[j].Path
+	})
+	return objects
+}
+
+// withoutRetryableQuarantinedObjects leaves out packages which failed to load for reasons other
+// than being invalid (e.g. a storage error), so that they show up as added on the next sync
+func (server *Server) withoutRetryableQuarantinedObjects(objects []storage.Object) []storage.Object {
+	server.QuarantineLock.RLock()
+	defer server.QuarantineLock.RUnlock()
+	if len(server.Quarantine) == 0 {
+		return objects
+	}
+	filteredObjects := []storage.Object{}
+	for _, object := range objects {
+		if q, ok := server.Quarantine[object.Path]; ok && !q.Invalid {
+			continue
+		}
+		filteredObjects = append(filteredObjects, object)
+	}
+	return filteredObjects
+}
+
+// getQuarantinedObject returns the quarantined package with the given path, if it exists
+func (server *Server) getQuarantinedObject(path string) (quarantinedObject, bool) {
+	server.QuarantineLock.RLock()
+	defer server.QuarantineLock.RUnlock()
+	object, ok := server.Quarantine[path]
+	return object, ok
+}
+
+// revalidateQuarantinedObject forgets the cached listing of a quarantined package and regenerates
+// the index, so that the package is loaded again (and quarantined again if it still fails). With a
+// CacheStore, the listing is forgotten there too, since the index is regenerated from it.
+func (server *Server) revalidateQuarantinedObject(path string) error {
+	server.StorageCacheLock.Lock()
+	if server.CacheStore != nil {
+		_, err := server.loadCachedState()
+		if err != nil {
+			server.StorageCacheLock.Unlock()
+			return err
+		}
+	}
+	cachedObjects := []storage.Object{}
+	for _, object := range server.StorageCache {
+		if object.Path != path {
+			cachedObjects = append(cachedObjects, object)
+		}
+	}
+	server.StorageCache = cachedObjects
+	if server.CacheStore != nil {
+		err := server.storeCachedState()
+		if err != nil {
+			server.StorageCacheLock.Unlock()
+			return err
+		}
+	}
+	server.StorageCacheLock.Unlock()
+	server.releaseQuarantinedObject(path)
+	return server.regenerateRepositoryIndex()
+}
+
+func (server *Server) getQuarantineRequestHandler(c *gin.Context) {
+	c.JSON(200, gin.H{"quarantined": server.getQuarantinedObjects()})
+}
+
+func (server *Server) getQuarantinedObjectRequestHandler(c *gin.Context) {
+	object, ok := server.getQuarantinedObject(c.Param("filename"))
+	if !ok {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	c.JSON(200, object)
+}
+
+func (server *Server) postQuarantinedObjectValidateRequestHandler(c *gin.Context) {
+	filename := c.Param("filename")
+	if _, ok := server.getQuarantinedObject(filename); !ok {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	err := server.revalidateQuarantinedObject(filename)
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	if object, ok := server.getQuarantinedObject(filename); ok {
+		c.JSON(200, gin.H{"valid": false, "error": object.Error})
+		return
+	}
+	c.JSON(200, gin.H{"valid": true})
+}
+
+func (server *Server) deleteQuarantinedObjectRequestHandler(c *gin.Context) {
+	filename := c.Param("filename")
+	if _, ok := server.getQuarantinedObject(filename); !ok {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	server.Logger.Debugw("Deleting quarantined package from storage",
+		"package", filename,
+	)
+	err := server.StorageBackend.DeleteObject(filename)
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	server.releaseQuarantinedObject(filename)
+	server.indexDeletedPackage(filename)
+	c.JSON(200, objectDeletedResponse)
+}
@@ -0,0 +1,160 @@
+package chartmuseum
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+
+	"github.com/gin-gonic/gin"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+// jsonContentType is the content type gin sets for JSON responses
+const jsonContentType = "application/json; charset=utf-8"
+
+type (
+	// responseCache keeps computed API responses, so that browsing the repository (e.g. from a
+	// catalog UI) doesn't recompute them on every request. Responses computed from the index
+	// (listings, search results and aggregations) are dropped whenever the index changes, while
+	// metadata read from chart packages is keyed by package digest, so it never goes stale. Past
+	// maxEntries, the least recently used entries are evicted.
+	responseCache struct {
+		maxEntries int
+		index      *repo.Index // index the cached index responses were computed from
+		entries    map[string]*list.Element
+		order      *list.List // most recently used first
+		lock       *sync.Mutex
+	}
+
+	responseCacheEntry struct {
+		key     string
+		indexed bool // computed from the index rather than from a chart package
+		value   interface{}
+	}
+
+	// chartPackageDocs is the documentation read from a chart package, for the web UI
+	chartPackageDocs struct {
+		readme string
+		values string
+	}
+)
+
+func newResponseCache(maxEntries int) *responseCache {
+	return &responseCache{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+		lock:       &sync.Mutex{},
+	}
+}
+
+// getIndexResponse returns the JSON response cached for key, if it was computed from index
+func (cache *responseCache) getIndexResponse(key string, index *repo.Index) ([]byte, bool) {
+	if cache == nil {
+		return nil, false
+	}
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.setIndex(index)
+	value := cache.get("index:" + key)
+	body, ok := value.([]byte)
+	return body, ok
+}
+
+// addIndexResponse caches the JSON response for key, computed from index
+func (cache *responseCache) addIndexResponse(key string, index *repo.Index, body []byte) {
+	if cache == nil {
+		return
+	}
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.setIndex(index)
+	cache.add("index:"+key, true, body)
+}
+
+// getChartPackageMetadata returns the metadata of some kind cached for the package of chartVersion,
+// nil if there is none
+func (cache *responseCache) getChartPackageMetadata(kind string, chartVersion *helm_repo.ChartVersion) interface{} {
+	if cache == nil || chartVersion.Digest == "" {
+		return nil
+	}
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return cache.get(kind + ":" + chartVersion.Digest)
+}
+
+// addChartPackageMetadata caches the metadata of some kind read from the package of chartVersion
+func (cache *responseCache) addChartPackageMetadata(kind string, chartVersion *helm_repo.ChartVersion, value interface{}) {
+	if cache == nil || chartVersion.Digest == "" {
+		return
+	}
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.add(kind+":"+chartVersion.Digest, false, value)
+}
+
+// setIndex drops the responses computed from any other index than index, must hold lock
+func (cache *responseCache) setIndex(index *repo.Index) {
+	if cache.index == index {
+		return
+	}
+	for key, element := range cache.entries {
+		if element.Value.(*responseCacheEntry).indexed {
+			cache.order.Remove(element)
+			delete(cache.entries, key)
+		}
+	}
+	cache.index = index
+}
+
+func (cache *responseCache) get(key string) interface{} {
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil
+	}
+	cache.order.MoveToFront(element)
+	return element.Value.(*responseCacheEntry).value
+}
+
+func (cache *responseCache) add(key string, indexed bool, value interface{}) {
+	if element, ok := cache.entries[key]; ok {
+		element.Value.(*responseCacheEntry).value = value
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(&responseCacheEntry{key: key, indexed: indexed, value: value})
+	for len(cache.entries) > cache.maxEntries {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*responseCacheEntry).key)
+	}
+}
+
+// respondWithIndexJSON responds with compute's response, which must only depend on index and the
+// request url, from the response cache if possible. Only successful responses are cached, and only
+// if index is the whole repository index (not the part of it some identity may see).
+func (server *Server) respondWithIndexJSON(c *gin.Context, index *repo.Index, compute func() (int, interface{})) {
+	if server.ResponseCache == nil || index != server.RepositoryIndex {
+		c.JSON(compute())
+		return
+	}
+	key := c.Request.URL.Path + "?" + c.Request.URL.Query().Encode()
+	if body, ok := server.ResponseCache.getIndexResponse(key, index); ok {
+		c.Data(200, jsonContentType, body)
+		return
+	}
+	status, obj := compute()
+	if status != 200 {
+		c.JSON(status, obj)
+		return
+	}
+	body, err := json.Marshal(obj)
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	server.ResponseCache.addIndexResponse(key, index, body)
+	c.Data(200, jsonContentType, body)
+}
@@ -0,0 +1,444 @@
+package chartmuseum
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultResumableUploadTTL is how long a resumable upload is kept without receiving any chunk, by default
+const defaultResumableUploadTTL = time.Hour
+
+// defaultResumableUploadMaxSize is how large a resumable upload may grow, by default (100MiB)
+const defaultResumableUploadMaxSize = 100 << 20
+
+// resumableUploadFilePrefix prefixes the names of the temporary files resumable uploads are kept in
+const resumableUploadFilePrefix = "chartmuseum-upload-"
+
+// resumableUploadDirPrefix prefixes the name of the temporary directory of a server's resumable
+// uploads, unless ResumableUploadDir is set
+const resumableUploadDirPrefix = "chartmuseum-uploads-"
+
+// resumableUploadReapInterval is how often expired resumable uploads are looked for
+var resumableUploadReapInterval = time.Minute
+
+var (
+	errInvalidContentRange     = errors.New("invalid Content-Range, expected <start>-<end>")
+	errResumableUploadNotFound = errors.New("upload not found, it may have expired")
+)
+
+// resumableUpload is a chart package uploaded in chunks, which are appended to a temporary file
+// until the upload is completed. Like OCI blob uploads, chunks must be sent in order.
+type resumableUpload struct {
+	ID      string    `json:"id"`
+	Offset  int64     `json:"offset"`
+	Updated time.Time `json:"updated"`
+	path    string
+	lock    *sync.Mutex // held while the upload is read or changed, before ResumableUploadsLock
+	limits  *packageLimitsChecker
+	removed bool
+}
+
+// packageLimitsChecker checks a chart package against the chart package limits as it is written,
+// e.g. one chunk of a resumable upload at a time, without unpacking what was checked before again
+type packageLimitsChecker struct {
+	input   chan []byte   // what was written, closed once there is no more
+	waiting chan struct{} // signalled once everything written was checked
+	done    chan struct{} // closed once the check finished, with err
+	err     error
+	pending []byte
+	closed  bool
+}
+
+func (server *Server) newPackageLimitsChecker() *packageLimitsChecker {
+	checker := &packageLimitsChecker{
+		input:   make(chan []byte),
+		waiting: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		checker.err = server.checkChartPackageLimitsReader(checker)
+		close(checker.done)
+	}()
+	checker.wait()
+	return checker
+}
+
+// Read hands what was written to the check, waiting for more once everything was checked
+func (checker *packageLimitsChecker) Read(p []byte) (int, error) {
+	for len(checker.pending) == 0 {
+		if checker.closed {
+			return 0, io.EOF
+		}
+		checker.waiting <- struct{}{}
+		chunk, ok := <-checker.input
+		checker.pending, checker.closed = chunk, !ok
+	}
+	n := copy(p, checker.pending)
+	checker.pending = checker.pending[n:]
+	return n, nil
+}
+
+// Write checks p along with what was written before, returning an error once the package exceeds limits
+func (checker *packageLimitsChecker) Write(p []byte) (int, error) {
+	select {
+	case checker.input <- p:
+	case <-checker.done:
+		return len(p), checker.err
+	}
+	return len(p), checker.wait()
+}
+
+// wait returns once everything written was checked, with the error the check failed with, if any
+func (checker *packageLimitsChecker) wait() error {
+	select {
+	case <-checker.waiting:
+		return nil
+	case <-checker.done:
+		return checker.err
+	}
+}
+
+// Close ends the check, once the package is complete or abandoned
+func (checker *packageLimitsChecker) Close() error {
+	close(checker.input)
+	<-checker.done
+	return checker.err
+}
+
+// createResumableUpload starts a new resumable upload
+func (server *Server) createResumableUpload() (*resumableUpload, error) {
+	dir, err := server.resumableUploadDir()
+	if err != nil {
+		return nil, err
+	}
+	file, err := ioutil.TempFile(dir, resumableUploadFilePrefix)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	upload := &resumableUpload{
+		ID:      newUploadJobID(),
+		Updated: time.Now(),
+		path:    file.Name(),
+		lock:    &sync.Mutex{},
+		limits:  server.newPackageLimitsChecker(),
+	}
+	server.ResumableUploadsLock.Lock()
+	defer server.ResumableUploadsLock.Unlock()
+	server.ResumableUploads[upload.ID] = upload
+	resumableUploadsGauge.Inc()
+	return upload, nil
+}
+
+// resumableUploadDir returns the directory the files of resumable uploads are kept in, which is only
+// used by this server: ResumableUploadDir, or else a temporary directory created on first use
+func (server *Server) resumableUploadDir() (string, error) {
+	server.ResumableUploadsLock.Lock()
+	defer server.ResumableUploadsLock.Unlock()
+	if server.ResumableUploadDir == "" {
+		dir, err := ioutil.TempDir("", resumableUploadDirPrefix)
+		if err != nil {
+			return "", err
+		}
+		server.ResumableUploadDir = dir
+	}
+	err := os.MkdirAll(server.ResumableUploadDir, 0700)
+	if err != nil {
+		return "", err
+	}
+	return server.ResumableUploadDir, nil
+}
+
+func (server *Server) getResumableUpload(id string) (*resumableUpload, bool) {
+	server.ResumableUploadsLock.Lock()
+	defer server.ResumableUploadsLock.Unlock()
+	upload, ok := server.ResumableUploads[id]
+	return upload, ok
+}
+
+// removeResumableUpload forgets an upload and removes its temporary file, must hold the upload's lock
+func (server *Server) removeResumableUpload(upload *resumableUpload) {
+	if upload.removed {
+		return
+	}
+	server.ResumableUploadsLock.Lock()
+	delete(server.ResumableUploads, upload.ID)
+	server.ResumableUploadsLock.Unlock()
+	os.Remove(upload.path)
+	upload.limits.Close()
+	upload.removed = true
+	resumableUploadsGauge.Dec()
+	resumableUploadBytesGauge.Sub(float64(upload.Offset))
+}
+
+// runResumableUploadReaper periodically aborts expired resumable uploads. Uploads are only known to
+// the instance they were started on, so this runs on every instance, not just the leader.
+func (server *Server) runResumableUploadReaper() {
+	ticker := time.NewTicker(resumableUploadReapInterval)
+	defer ticker.Stop()
+	for {
+		server.reapResumableUploads()
+		<-ticker.C
+	}
+}
+
+// reapResumableUploads aborts the uploads which received no chunk for ResumableUploadTTL, and removes
+// the files in ResumableUploadDir of uploads left behind by previous processes (e.g. after a crash)
+// once they are as old. It returns the number of uploads and bytes reaped.
+func (server *Server) reapResumableUploads() (int, int64) {
+	server.ResumableUploadsLock.Lock()
+	var uploads []*resumableUpload
+	known := map[string]bool{}
+	for _, upload := range server.ResumableUploads {
+		uploads = append(uploads, upload)
+		known[upload.path] = true
+	}
+	dir := server.ResumableUploadDir
+	server.ResumableUploadsLock.Unlock()
+
+	now := time.Now()
+	reaped, bytes := 0, int64(0)
+	for _, upload := range uploads {
+		upload.lock.Lock()
+		if !upload.removed && now.Sub(upload.Updated) > server.ResumableUploadTTL {
+			reaped, bytes = reaped+1, bytes+upload.Offset
+			server.Logger.Debugw("Aborting expired resumable upload",
+				"id", upload.ID,
+				"offset", upload.Offset,
+				"updated", upload.Updated,
+			)
+			server.removeResumableUpload(upload)
+		}
+		upload.lock.Unlock()
+	}
+
+	var paths []string
+	if dir != "" {
+		paths, _ = filepath.Glob(filepath.Join(dir, resumableUploadFilePrefix+"*"))
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if known[path] || err != nil || now.Sub(info.ModTime()) <= server.ResumableUploadTTL {
+			continue
+		}
+		if os.Remove(path) == nil {
+			reaped, bytes = reaped+1, bytes+info.Size()
+		}
+	}
+
+	if reaped > 0 {
+		resumableUploadsReapedCounter.Add(float64(reaped))
+		resumableUploadReapedBytesCounter.Add(float64(bytes))
+		server.Logger.Infow("Reaped expired resumable uploads",
+			"uploads", reaped,
+			"bytes", bytes,
+		)
+	}
+	return reaped, bytes
+}
+
+// appendChunk appends body to the upload, if start (from Content-Range, -1 if absent) is where it ends
+// so far and the upload doesn't grow beyond maxSize
+func (upload *resumableUpload) appendChunk(body io.Reader, start int64, maxSize int64) (int, error) {
+	if upload.removed {
+		return 404, errResumableUploadNotFound
+	}
+	if start >= 0 && start != upload.Offset {
+		return 416, fmt.Errorf("chunk starts at %d, expected %d", start, upload.Offset)
+	}
+	file, err := os.OpenFile(upload.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return 500, err
+	}
+	defer file.Close()
+	n, err := io.Copy(file, io.LimitReader(body, maxSize-upload.Offset+1))
+	upload.Updated = time.Now()
+	if err != nil {
+		// drop what was written of a broken chunk, so it can be sent again
+		file.Truncate(upload.Offset)
+		return 500, err
+	}
+	if upload.Offset+n > maxSize {
+		file.Truncate(upload.Offset)
+		return 413, fmt.Errorf("upload exceeds the maximum size of %d bytes", maxSize)
+	}
+	upload.Offset += n
+	resumableUploadBytesGauge.Add(float64(n))
+	return 202, nil
+}
+
+// appendResumableChunk appends the request body to an upload (see appendChunk), then checks the chunk
+// against the chart package limits along with those received before, so that e.g. a zip bomb is
+// aborted as soon as it unpacks to too much rather than once it is complete
+func (server *Server) appendResumableChunk(c *gin.Context, upload *resumableUpload, start int64) (int, error) {
+	offset := upload.Offset
+	status, err := upload.appendChunk(c.Request.Body, start, server.ResumableUploadMaxSize)
+	if err != nil {
+		return status, err
+	}
+	file, err := os.Open(upload.path)
+	if err != nil {
+		return 500, err
+	}
+	defer file.Close()
+	_, err = io.Copy(upload.limits, io.NewSectionReader(file, offset, upload.Offset-offset))
+	if err != nil {
+		// the check can't pick up where it stopped, so neither can the upload
+		server.removeResumableUpload(upload)
+		if _, ok := err.(unsafeChartPackageError); ok {
+			return 400, err
+		}
+		return 500, err
+	}
+	return status, nil
+}
+
+// contentRangeStart returns where the chunk in a Content-Range header ("<start>-<end>") starts,
+// or -1 if there is no such header
+func contentRangeStart(c *gin.Context) (int64, error) {
+	contentRange := strings.TrimPrefix(c.GetHeader("Content-Range"), "bytes ")
+	if contentRange == "" {
+		return -1, nil
+	}
+	parts := strings.SplitN(contentRange, "-", 2)
+	if len(parts) != 2 {
+		return 0, errInvalidContentRange
+	}
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start < 0 {
+		return 0, errInvalidContentRange
+	}
+	return start, nil
+}
+
+// respondResumableUpload describes where an upload is at, with the Location to send chunks to and
+// the Range received so far (as for OCI blob uploads)
+func respondResumableUpload(c *gin.Context, status int, upload *resumableUpload) {
+	c.Header("Location", fmt.Sprintf("/api/uploads/%s", upload.ID))
+	if upload.Offset > 0 {
+		c.Header("Range", fmt.Sprintf("0-%d", upload.Offset-1))
+	}
+	c.JSON(status, upload)
+}
+
+func (server *Server) postResumableUploadRequestHandler(c *gin.Context) {
+	upload, err := server.createResumableUpload()
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	respondResumableUpload(c, 202, upload)
+}
+
+func (server *Server) getResumableUploadRequestHandler(c *gin.Context) {
+	upload, ok := server.getResumableUpload(c.Param("id"))
+	if !ok {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	upload.lock.Lock()
+	defer upload.lock.Unlock()
+	if upload.removed {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	respondResumableUpload(c, 200, upload)
+}
+
+func (server *Server) patchResumableUploadRequestHandler(c *gin.Context) {
+	upload, ok := server.getResumableUpload(c.Param("id"))
+	if !ok {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	start, err := contentRangeStart(c)
+	if err != nil {
+		c.JSON(400, errorResponse(400, err))
+		return
+	}
+	upload.lock.Lock()
+	defer upload.lock.Unlock()
+	status, err := server.appendResumableChunk(c, upload, start)
+	if err != nil {
+		if upload.Offset > 0 && !upload.removed {
+			c.Header("Range", fmt.Sprintf("0-%d", upload.Offset-1))
+		}
+		c.JSON(status, errorResponse(status, err))
+		return
+	}
+	respondResumableUpload(c, status, upload)
+}
+
+// putResumableUploadRequestHandler completes an upload, with an optional last chunk in the body:
+// the whole package is then checked against Content-SHA256 (or ?digest=sha256:<hex>) and handled
+// like a binary upload. The upload is gone afterwards, whether the package was accepted or not.
+func (server *Server) putResumableUploadRequestHandler(c *gin.Context) {
+	upload, ok := server.getResumableUpload(c.Param("id"))
+	if !ok {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	start, err := contentRangeStart(c)
+	if err != nil {
+		c.JSON(400, errorResponse(400, err))
+		return
+	}
+	upload.lock.Lock()
+	defer upload.lock.Unlock()
+	status, err := server.appendResumableChunk(c, upload, start)
+	if err != nil {
+		c.JSON(status, errorResponse(status, err))
+		return
+	}
+	checksum := c.GetHeader(checksumHeader)
+	if checksum == "" {
+		checksum = c.Query("digest")
+	}
+	content, err := readResumableUpload(upload, checksum)
+	server.removeResumableUpload(upload)
+	if err != nil {
+		if _, ok := err.(checksumMismatchError); ok {
+			c.JSON(422, errorResponse(422, err))
+			return
+		}
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	server.uploadPackage(c, content, uploadMethodResumable)
+}
+
+// readResumableUpload loads the chunks received for a completed upload, once they matched checksum
+func readResumableUpload(upload *resumableUpload, checksum string) ([]byte, error) {
+	file, err := os.Open(upload.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readSpooledFile(file, upload.Offset, checksum)
+}
+
+func (server *Server) deleteResumableUploadRequestHandler(c *gin.Context) {
+	upload, ok := server.getResumableUpload(c.Param("id"))
+	if !ok {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	upload.lock.Lock()
+	defer upload.lock.Unlock()
+	if upload.removed {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	server.removeResumableUpload(upload)
+	c.JSON(200, objectDeletedResponse)
+}
@@ -1,17 +1,118 @@
 package chartmuseum
 
-func (server *Server) setRoutes(enableAPI bool) {
+import (
+	"github.com/kubernetes-helm/chartmuseum/pkg/authz"
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+)
+
+func (server *Server) setRoutes(options ServerOptions) {
+	// Server Info
+	server.Router.GET("/info", server.getInfoRequestHandler)
+	server.Router.GET("/health", server.getHealthRequestHandler)
+	server.Router.GET("/ready", server.getReadyRequestHandler)
+
 	// Helm Chart Repository
-	server.Router.GET("/index.yaml", server.getIndexFileRequestHandler)
-	server.Router.GET("/charts/:filename", server.getStorageObjectRequestHandler)
+	if options.Routes.Index {
+		server.Router.GET("/index.yaml", server.authorizeAccess(authz.ActionGet), server.getIndexFileRequestHandler)
+		server.Router.GET("/index.yaml.gz", server.authorizeAccess(authz.ActionGet), server.getIndexGzipFileRequestHandler)
+	}
+	if options.Routes.ChartGet {
+		server.Router.GET("/charts/:filename", server.authorizeAccess(authz.ActionGet), server.getStorageObjectRequestHandler)
+		server.Router.HEAD("/charts/:filename", server.authorizeAccess(authz.ActionGet), server.getStorageObjectRequestHandler)
+	}
+
+	// Library charts, as a repository of their own
+	if options.LibraryCharts == repo.LibraryChartsSeparate {
+		if options.Routes.Index {
+			server.Router.GET("/library/index.yaml", server.authorizeAccess(authz.ActionGet), server.getLibraryIndexFileRequestHandler)
+			server.Router.GET("/library/index.yaml.gz", server.authorizeAccess(authz.ActionGet), server.getLibraryIndexGzipFileRequestHandler)
+		}
+		if options.Routes.ChartGet {
+			server.Router.GET("/library/charts/:filename", server.authorizeAccess(authz.ActionGet), server.getStorageObjectRequestHandler)
+			server.Router.HEAD("/library/charts/:filename", server.authorizeAccess(authz.ActionGet), server.getStorageObjectRequestHandler)
+		}
+	}
 
 	// Chart Manipulation
-	if enableAPI {
-		server.Router.GET("/api/charts", server.getAllChartsRequestHandler)
-		server.Router.POST("/api/charts", server.postRequestHandler)
-		server.Router.POST("/api/prov", server.postProvenanceFileRequestHandler)
-		server.Router.GET("/api/charts/:name", server.getChartRequestHandler)
-		server.Router.GET("/api/charts/:name/:version", server.getChartVersionRequestHandler)
-		server.Router.DELETE("/api/charts/:name/:version", server.deleteChartVersionRequestHandler)
+	if options.Routes.APIWrite {
+		server.Router.POST("/api/charts", server.authorizeAccess(authz.ActionPush), server.checkReadOnly, server.limitConcurrentUploads, server.postRequestHandler)
+		server.Router.POST("/api/prov", server.authorizeAccess(authz.ActionPush), server.checkReadOnly, server.limitConcurrentUploads, server.postProvenanceFileRequestHandler)
+		server.Router.POST("/api/charts/:name/:version/rollback", server.authorizeAccess(authz.ActionPush), server.checkReadOnly, server.postChartVersionRollbackRequestHandler)
+		server.Router.POST("/api/charts/:name/:version/sig", server.authorizeAccess(authz.ActionPush), server.checkReadOnly, server.postChartVersionSignatureRequestHandler)
+		server.Router.POST("/api/charts/:name/:version/attestations", server.authorizeAccess(authz.ActionPush), server.checkReadOnly, server.postChartVersionAttestationRequestHandler)
+		server.Router.POST("/api/uploads", server.authorizeAccess(authz.ActionPush), server.checkReadOnly, server.postResumableUploadRequestHandler)
+		server.Router.GET("/api/uploads/:id", server.authorizeAccess(authz.ActionPush), server.getResumableUploadRequestHandler)
+		server.Router.PATCH("/api/uploads/:id", server.authorizeAccess(authz.ActionPush), server.checkReadOnly, server.patchResumableUploadRequestHandler)
+		server.Router.PUT("/api/uploads/:id", server.authorizeAccess(authz.ActionPush), server.checkReadOnly, server.limitConcurrentUploads, server.putResumableUploadRequestHandler)
+		server.Router.DELETE("/api/uploads/:id", server.authorizeAccess(authz.ActionPush), server.deleteResumableUploadRequestHandler)
+		server.Router.GET("/api/quarantine", server.authorizeAccess(authz.ActionPush), server.getQuarantineRequestHandler)
+		server.Router.GET("/api/quarantine/:filename", server.authorizeAccess(authz.ActionPush), server.getQuarantinedObjectRequestHandler)
+		server.Router.POST("/api/quarantine/:filename/validate", server.authorizeAccess(authz.ActionPush), server.postQuarantinedObjectValidateRequestHandler)
+		if options.HelmPush {
+			server.Router.GET("/api/version", server.authorizeAccess(authz.ActionPush), server.getHelmPushVersionRequestHandler)
+		}
+		if options.AsyncUploads {
+			server.Router.GET("/api/jobs/:id", server.authorizeAccess(authz.ActionPush), server.getUploadJobRequestHandler)
+		}
+	}
+	if options.Routes.APIRead {
+		server.Router.GET("/api/charts", server.authorizeAccess(authz.ActionGet), server.getAllChartsRequestHandler)
+		server.Router.GET("/api/keywords", server.authorizeAccess(authz.ActionGet), server.getKeywordsRequestHandler)
+		server.Router.GET("/api/maintainers", server.authorizeAccess(authz.ActionGet), server.getMaintainersRequestHandler)
+		server.Router.GET("/api/annotations", server.authorizeAccess(authz.ActionGet), server.getAnnotationsRequestHandler)
+		server.Router.GET("/api/changes", server.authorizeAccess(authz.ActionGet), server.getChangesRequestHandler)
+		server.Router.GET("/api/charts/:name", server.authorizeAccess(authz.ActionGet), server.getChartRequestHandler)
+		server.Router.GET("/api/charts/:name/:version", server.authorizeAccess(authz.ActionGet), server.getChartVersionRequestHandler)
+		server.Router.GET("/api/charts/:name/:version/dependencies", server.authorizeAccess(authz.ActionGet), server.getChartVersionDependenciesRequestHandler)
+		server.Router.GET("/api/charts/:name/:version/sbom", server.authorizeAccess(authz.ActionGet), server.getChartVersionSBOMRequestHandler)
+		server.Router.GET("/api/charts/:name/:version/attestations", server.authorizeAccess(authz.ActionGet), server.getChartVersionAttestationsRequestHandler)
+		server.Router.GET("/api/charts/:name/:version/attestations/:id", server.authorizeAccess(authz.ActionGet), server.getChartVersionAttestationRequestHandler)
+		server.Router.POST("/api/charts/:name/:version/render", server.authorizeAccess(authz.ActionGet), server.postChartVersionRenderRequestHandler)
 	}
+	if options.Routes.APIDelete {
+		server.Router.DELETE("/api/charts/:name/:version", server.authorizeAccess(authz.ActionDelete), server.checkReadOnly, server.deleteChartVersionRequestHandler)
+		server.Router.DELETE("/api/quarantine/:filename", server.authorizeAccess(authz.ActionDelete), server.checkReadOnly, server.deleteQuarantinedObjectRequestHandler)
+	}
+
+	// GraphQL
+	if options.EnableGraphQL {
+		graphQLRequestHandler := server.newGraphQLRequestHandler()
+		server.Router.GET("/graphql", server.authorizeAccess(authz.ActionGet), graphQLRequestHandler)
+		server.Router.POST("/graphql", server.authorizeAccess(authz.ActionGet), graphQLRequestHandler)
+	}
+
+	// Web UI
+	if options.EnableWebUI {
+		server.Router.GET("/ui", server.authorizeAccess(authz.ActionGet), server.getWebUIChartsRequestHandler)
+		server.Router.GET("/ui/charts/:name", server.authorizeAccess(authz.ActionGet), server.getWebUIChartRequestHandler)
+		server.Router.GET("/ui/charts/:name/:version", server.authorizeAccess(authz.ActionGet), server.getWebUIChartVersionRequestHandler)
+	}
+
+	// Administration, on its own listener if there is one
+	if server.AdminRouter != nil {
+		server.setAdminRoutes(server.AdminRouter, true)
+	} else if options.Routes.Admin {
+		server.setAdminRoutes(server.Router, false)
+	}
+}
+
+func (server *Server) setAdminRoutes(router *Router, adminPort bool) {
+	admin := router.Group("", server.identifyAdmin(adminPort), server.requireAdmin)
+	admin.GET("/admin/maintenance", server.getMaintenanceModeRequestHandler)
+	admin.PUT("/admin/maintenance", server.putMaintenanceModeRequestHandler)
+	admin.DELETE("/admin/maintenance", server.deleteMaintenanceModeRequestHandler)
+	admin.GET("/admin/storage/consistency", server.getStorageConsistencyRequestHandler)
+	admin.GET("/admin/backups", server.getBackupsRequestHandler)
+	admin.POST("/admin/backups", server.postBackupRequestHandler)
+	admin.POST("/admin/clone", server.checkReadOnly, server.postCloneRequestHandler)
+	admin.DELETE("/admin/clone", server.checkReadOnly, server.deleteCloneRequestHandler)
+	admin.GET("/api/owners", server.getChartOwnersRequestHandler)
+	admin.GET("/api/owners/:name", server.getChartOwnerRequestHandler)
+	admin.GET("/api/audit", server.getAuditRequestHandler)
+	admin.POST("/api/audit", server.postAuditRequestHandler)
+
+	// the owners of a chart may change them as well
+	owners := router.Group("", server.identifyAdmin(adminPort), server.requireChartOwnerOrAdmin)
+	owners.PUT("/api/owners/:name", server.checkReadOnly, server.putChartOwnerRequestHandler)
+	owners.DELETE("/api/owners/:name", server.checkReadOnly, server.deleteChartOwnerRequestHandler)
 }
@@ -0,0 +1,110 @@
+package chartmuseum
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+// sbomExtension is appended to the filename of a package to name the object holding its SBOM
+const sbomExtension = ".sbom.json"
+
+func sbomPath(filename string) string {
+	return filename + sbomExtension
+}
+
+// saveSBOM generates the SBOM of an uploaded package and stores it next to the package, if SBOMs
+// are generated on upload. Failing to do so doesn't fail the upload.
+func (server *Server) saveSBOM(filename string, content []byte) {
+	if !server.GenerateSBOM {
+		return
+	}
+	sbom, err := repo.ChartPackageSBOM(content, time.Now())
+	if err == nil {
+		content, err = json.Marshal(sbom)
+	}
+	if err == nil {
+		err = server.StorageBackend.PutObject(sbomPath(filename), content)
+	}
+	if err != nil {
+		server.Logger.Warnw("Unable to generate SBOM",
+			"package", filename,
+			"error", err.Error(),
+		)
+	}
+}
+
+// getSBOM returns the SBOM of chartVersion stored on upload, or generates it from its package if
+// there is none, or the package changed since
+func (server *Server) getSBOM(c *gin.Context, chartVersion *helm_repo.ChartVersion) (*repo.SBOM, int, error) {
+	filename := repo.ChartPackageFilenameFromNameVersion(chartVersion.Name, chartVersion.Version)
+	if object, err := storage.GetObjectWithContext(c.Request.Context(), server.StorageBackend, sbomPath(filename)); err == nil {
+		var sbom repo.SBOM
+		err = json.Unmarshal(object.Content, &sbom)
+		if err == nil && sbom.Digest == chartVersion.Digest {
+			return &sbom, 200, nil
+		}
+	}
+	object, err := storage.GetObjectWithContext(c.Request.Context(), server.StorageBackend, filename)
+	if err != nil {
+		return nil, 404, err
+	}
+	sbom, err := repo.ChartPackageSBOM(object.Content, chartVersion.Created)
+	if err != nil {
+		return nil, 500, err
+	}
+	return sbom, 200, nil
+}
+
+func (server *Server) getChartVersionSBOMRequestHandler(c *gin.Context) {
+	name := c.Param("name")
+	version := c.Param("version")
+	if version == "latest" {
+		version = ""
+	}
+	format := c.DefaultQuery("format", repo.SBOMFormatSPDX)
+	if format != repo.SBOMFormatSPDX && format != repo.SBOMFormatCycloneDX {
+		c.JSON(400, newErrorResponse(errorCodeBadRequest, repo.ErrorUnknownSBOMFormat.Error(), gin.H{
+			"format": format,
+		}))
+		return
+	}
+	err := server.syncRepositoryIndexOnRequest(c.Request.Context())
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	chartVersion, err := server.RepositoryIndex.Get(name, version)
+	if err != nil {
+		c.JSON(404, server.chartNotFoundResponse(c, name, version))
+		return
+	}
+	sbom, ok := server.ResponseCache.getChartPackageMetadata("sbom", chartVersion).(*repo.SBOM)
+	if !ok {
+		var status int
+		sbom, status, err = server.getSBOM(c, chartVersion)
+		if server.clientWentAway(c) {
+			return
+		}
+		if status == 404 {
+			c.JSON(404, notFoundErrorResponse)
+			return
+		}
+		if err != nil {
+			c.JSON(status, errorResponse(status, err))
+			return
+		}
+		server.ResponseCache.addChartPackageMetadata("sbom", chartVersion, sbom)
+	}
+	body, err := sbom.Render(format)
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	c.Data(200, jsonContentType, body)
+}
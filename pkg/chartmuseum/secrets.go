@@ -0,0 +1,54 @@
+package chartmuseum
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+)
+
+const (
+	// secretScanWarn logs uploaded charts which likely contain secrets
+	secretScanWarn = "warn"
+
+	// secretScanReject refuses uploaded charts which likely contain secrets
+	secretScanReject = "reject"
+)
+
+func validateSecretScanMode(mode string) error {
+	switch mode {
+	case "", secretScanWarn, secretScanReject:
+		return nil
+	}
+	return fmt.Errorf("invalid secret scan mode %q, must be %q or %q",
+		mode, secretScanWarn, secretScanReject)
+}
+
+// checkChartSecrets scans the values and templates of an uploaded chart package for likely
+// secrets. Depending on SecretScan, findings are only logged, or returned as an error.
+func (server *Server) checkChartSecrets(content []byte) error {
+	if server.SecretScan == "" {
+		return nil
+	}
+	findings, err := repo.FindChartPackageSecrets(content)
+	if err == repo.ErrorInvalidChartPackage {
+		return nil // reported when saving the package
+	}
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+	var locations []string
+	for _, finding := range findings {
+		locations = append(locations, fmt.Sprintf("%s:%d (%s)", finding.File, finding.Line, finding.Rule))
+	}
+	if server.SecretScan == secretScanWarn {
+		server.Logger.Warnw("Accepting chart package which likely contains secrets",
+			"secrets", locations,
+		)
+		return nil
+	}
+	return fmt.Errorf("chart package likely contains secrets: %s", strings.Join(locations, ", "))
+}
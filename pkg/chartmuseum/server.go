@@ -2,21 +2,45 @@ package chartmuseum
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/kubernetes-helm/chartmuseum/pkg/authz"
+	"github.com/kubernetes-helm/chartmuseum/pkg/cache"
+	"github.com/kubernetes-helm/chartmuseum/pkg/leader"
+	"github.com/kubernetes-helm/chartmuseum/pkg/lock"
+	"github.com/kubernetes-helm/chartmuseum/pkg/proxyproto"
 	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
 	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+	"github.com/kubernetes-helm/chartmuseum/pkg/systemd"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zsais/go-gin-prometheus"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
 	helm_repo "k8s.io/helm/pkg/repo"
 )
 
+// proxyProtocolHeaderTimeout is how long to wait for the PROXY protocol header of a new connection
+var proxyProtocolHeaderTimeout = 10 * time.Second
+
+var (
+	errTLSPortWithoutFiles        = errors.New("a TLS port requires a TLS certificate and key")
+	errHTTPDisabledWithoutTLSPort = errors.New("plain HTTP can only be disabled when serving HTTPS on a TLS port")
+	errAdminPortWithoutAuth       = errors.New("an admin port requires an admin username and password")
+)
+
 type (
 	// Logger handles all logging from application
 	Logger struct {
@@ -28,36 +52,217 @@ type (
 		*gin.Engine
 	}
 
-	// Server contains a Logger, Router, storage backend and object cache
+	// BuildInfo identifies the build of ChartMuseum a Server runs (set at compile time)
+	BuildInfo struct {
+		Version   string `json:"version"`
+		Revision  string `json:"revision"`
+		BuildDate string `json:"buildDate"`
+	}
+
+	// Server contains a Logger, Router, storage backend, object cache and optional shared cache store
 	Server struct {
 		Logger                 *Logger
 		Router                 *Router
+		BuildInfo              BuildInfo
 		RepositoryIndex        *repo.Index
 		StorageBackend         storage.Backend
 		StorageCache           []storage.Object
 		StorageCacheLock       *sync.Mutex
+		StorageObjects         []storage.Object
+		StorageObjectsListed   time.Time
+		StorageChangeToken     string
+		StorageObjectsLock     *sync.Mutex
+		MetadataCacheTTL       time.Duration
+		ProvenanceFiles        map[string]bool
+		ProvenanceFilesLock    *sync.RWMutex
+		StorageHealthError     error
+		StorageHealthLock      *sync.RWMutex
+		HealthCheckInterval    time.Duration
+		PendingObjects         map[string]pendingObject
+		PendingObjectsLock     *sync.Mutex
+		CacheStore             cache.Store
+		Locker                 lock.Locker
+		LeaderElector          leader.Elector
+		Leader                 bool
+		LeaderLock             *sync.RWMutex
+		ResyncInterval         time.Duration
+		AllowForceSync         bool
+		DisableRequestSync     bool
+		StoreIndex             bool
+		BackupBackend          storage.Backend
+		BackupInterval         time.Duration
+		BackupRetention        int
+		PublishBackend         storage.Backend
+		PublishCharts          bool
+		PublishInterval        time.Duration
+		PublishLock            *sync.Mutex
 		AllowOverwrite         bool
+		HelmPush               bool
+		DependencyValidation   string
+		DependencyRepos        []string
+		RecordUploads          bool
+		GenerateSBOM           bool
+		CosignVerifier         *repo.CosignVerifier
+		RequireCosignSignature bool
+		VerifyWrites           bool
+		ChartPackageLimits     repo.ChartPackageLimits
+		SecretScan             string
+		PolicyURL              string
+		ClamdAddress           string
+		ReadOnly               bool
+		MaintenanceMode        bool
+		MaintenanceModeLock    *sync.RWMutex
+		MaintenanceRetryAfter  int
 		TlsCert                string
 		TlsKey                 string
+		TlsPort                int
+		DisableHTTP            bool
 		ChartPostFormFieldName string
 		ProvPostFormFieldName  string
+		UploadSemaphore        chan struct{}
+		TrustedProxies         []*net.IPNet
+		ClientIPHeaders        []string
+		ForwardedForDepth      int
+		ProxyProtocol          bool
+		EnableH2C              bool
+		AsyncUploads           bool
+		UploadJobs             map[string]*uploadJob
+		UploadJobsLock         *sync.RWMutex
+		UploadJobQueue         chan *uploadJob
+		ResumableUploads       map[string]*resumableUpload
+		ResumableUploadsLock   *sync.Mutex
+		ResumableUploadTTL     time.Duration
+		ResumableUploadMaxSize int64
+		ResumableUploadDir     string
+		SpoolThreshold         int64
+		CompressResponses      bool
+		CompressionLevel       int
+		CompressionMinSize     int
+		ResponseCache          *responseCache
+		IndexProgress          *indexBuildProgress
+		IndexProgressLock      *sync.RWMutex
+		DeferIndexBuild        bool
+		IndexBuilt             bool // guarded by IndexProgressLock
+		Quarantine             map[string]quarantinedObject
+		QuarantineLock         *sync.RWMutex
+		Audit                  *auditReport
+		AuditLock              *sync.Mutex
+		GRPCServer             *grpc.Server
+		GRPCPort               int
+		AdminRouter            *Router
+		AdminPort              int
+		AdminIdentities        []string
+		AuthTarpit             *authTarpit
+		MetricsAuth            *metricsAuth
+		Changes                *changeLog
+		Notifications          *notificationsConfig
+		ChartOwnersConfig      *chartOwnersConfig
+		ChartOwners            map[string][]string
+		ChartOwnersLock        *sync.RWMutex
+		ChartOwnersUpdateLock  *sync.Mutex
+		Authorizer             authz.Authorizer
+	}
+
+	// RouteConfig enumerates the groups of routes a Server registers. Routes for GraphQL and the
+	// web UI are enabled separately. The zero value serves the chart repository only (Index and ChartGet).
+	RouteConfig struct {
+		Index     bool // GET /index.yaml
+		ChartGet  bool // GET /charts/<filename>, chart packages and provenance files
+		APIRead   bool // GET /api/charts... and other read-only API routes
+		APIWrite  bool // POST /api/charts and /api/prov, rolling back chart versions, and managing quarantined packages
+		APIDelete bool // DELETE /api/charts/<name>/<version> and /api/quarantine/<filename>
+		Admin     bool // routes prefixed with /admin, and /api/audit
 	}
 
 	// ServerOptions are options for constructing a Server
 	ServerOptions struct {
+		BuildInfo              BuildInfo
 		StorageBackend         storage.Backend
+		CacheStore             cache.Store
+		Locker                 lock.Locker
+		LeaderElector          leader.Elector
+		ResyncInterval         time.Duration
+		DisableRequestSync     bool
+		DeferIndexBuild        bool
+		IndexSharding          bool
+		LibraryCharts          string
+		IndexMaxAge            time.Duration
+		IndexHidePrereleases   bool
+		StoreIndex             bool
+		HealthCheckInterval    time.Duration
+		MetadataCacheTTL       time.Duration
+		BackupBackend          storage.Backend
+		BackupInterval         time.Duration
+		BackupRetention        int
+		PublishBackend         storage.Backend
+		PublishCharts          bool
+		PublishInterval        time.Duration
 		LogJSON                bool
 		Debug                  bool
-		EnableAPI              bool
+		EventLogSource         string
+		Routes                 RouteConfig
 		AllowOverwrite         bool
+		DependencyValidation   string
+		DependencyRepos        []string
+		RecordUploads          bool
+		GenerateSBOM           bool
+		CosignKey              string
+		CosignRoots            string
+		CosignIdentity         string
+		CosignIssuer           string
+		RequireCosignSignature bool
+		VerifyWrites           bool
+		MaxUnpackedSize        int64
+		MaxChartFiles          int
+		SecretScan             string
+		PolicyURL              string
+		ClamdAddress           string
+		NotificationsConfig    string
+		ChartOwnersConfig      string
+		AccessPolicy           string
+		Authorizer             authz.Authorizer
 		EnableMetrics          bool
 		ChartURL               string
 		TlsCert                string
 		TlsKey                 string
+		TlsPort                int
+		DisableHTTP            bool
 		Username               string
 		Password               string
+		BearerToken            string
+		MetricsBearerToken     string
+		MetricsClientCA        string
+		HelmPush               bool
+		TrustedProxies         []string
+		ClientIPHeaders        []string
+		ForwardedForDepth      int
+		ProxyProtocol          bool
+		EnableH2C              bool
 		ChartPostFormFieldName string
 		ProvPostFormFieldName  string
+		ReadOnly               bool
+		EnableGraphQL          bool
+		EnableWebUI            bool
+		GRPCPort               int
+		AdminPort              int
+		AdminUsername          string
+		AdminPassword          string
+		AdminIdentities        []string
+		AuthFailureDelay       time.Duration
+		AuthLockoutFailures    int
+		AuthLockoutDuration    time.Duration
+		MaintenanceMode        bool
+		MaintenanceRetryAfter  int
+		MaxConcurrentUploads   int
+		SpoolThreshold         int64
+		AsyncUploads           bool
+		ResumableUploadTTL     time.Duration
+		ResumableUploadMaxSize int64
+		ResumableUploadDir     string
+		CompressResponses      bool
+		CompressionLevel       int
+		CompressionMinSize     int
+		ResponseCacheSize      int
 	}
 )
 
@@ -91,15 +296,15 @@ func mapURLWithParamsBackToRouteTemplate(c *gin.Context) string {
 	return url
 }
 
-// NewRouter creates a new Router instance
-func NewRouter(logger *Logger, username string, password string, enableMetrics bool) *Router {
+// NewRouter creates a new Router instance. The beforeAuth middleware (if any) runs before credentials are checked.
+func NewRouter(logger *Logger, username string, password string, bearerToken string, enableMetrics bool, beforeAuth ...gin.HandlerFunc) *Router {
 	gin.SetMode(gin.ReleaseMode)
 	engine := gin.New()
 	engine.Use(loggingMiddleware(logger), gin.Recovery())
-	if username != "" && password != "" {
-		users := make(map[string]string)
-		users[username] = password
-		engine.Use(gin.BasicAuthForRealm(users, "ChartMuseum"))
+	engine.Use(beforeAuth...)
+	verifier := authVerifierFromOptions(ServerOptions{Username: username, Password: password, BearerToken: bearerToken})
+	if verifier != nil {
+		engine.Use(basicAuthMiddleware(verifier))
 	}
 	if enableMetrics {
 		p := ginprometheus.NewPrometheus("chartmuseum")
@@ -108,6 +313,7 @@ func NewRouter(logger *Logger, username string, password string, enableMetrics b
 		// `chartmuseum_requests_total{url=..}` Prometheus counter.
 		p.ReqCntURLLabelMappingFn = mapURLWithParamsBackToRouteTemplate
 		p.Use(engine)
+		engine.Use(metricsMiddleware)
 	}
 	return &Router{engine}
 }
@@ -118,39 +324,388 @@ func NewServer(options ServerOptions) (*Server, error) {
 	if err != nil {
 		return new(Server), nil
 	}
+	if options.EventLogSource != "" {
+		logger, err = withEventLog(logger, options.EventLogSource, options.LogJSON, options.Debug)
+		if err != nil {
+			return new(Server), err
+		}
+	}
 
-	router := NewRouter(logger, options.Username, options.Password, options.EnableMetrics)
+	if options.Routes == (RouteConfig{}) {
+		options.Routes = RouteConfig{Index: true, ChartGet: true}
+	}
+
+	locker := options.Locker
+	if locker == nil {
+		locker = lock.NewLocalLocker()
+	}
 
 	server := &Server{
 		Logger:                 logger,
-		Router:                 router,
+		BuildInfo:              options.BuildInfo,
 		RepositoryIndex:        repo.NewIndex(options.ChartURL),
 		StorageBackend:         options.StorageBackend,
 		StorageCache:           []storage.Object{},
 		StorageCacheLock:       &sync.Mutex{},
+		StorageObjectsLock:     &sync.Mutex{},
+		ProvenanceFiles:        map[string]bool{},
+		ProvenanceFilesLock:    &sync.RWMutex{},
+		StorageHealthLock:      &sync.RWMutex{},
+		HealthCheckInterval:    options.HealthCheckInterval,
+		MetadataCacheTTL:       options.MetadataCacheTTL,
+		PendingObjects:         map[string]pendingObject{},
+		PendingObjectsLock:     &sync.Mutex{},
+		CacheStore:             options.CacheStore,
+		Locker:                 locker,
+		LeaderElector:          options.LeaderElector,
+		LeaderLock:             &sync.RWMutex{},
+		ResyncInterval:         options.ResyncInterval,
+		AllowForceSync:         options.Routes.Admin || authVerifierFromOptions(options) != nil,
+		DisableRequestSync:     options.DisableRequestSync,
+		StoreIndex:             options.StoreIndex,
+		BackupBackend:          options.BackupBackend,
+		BackupInterval:         options.BackupInterval,
+		BackupRetention:        options.BackupRetention,
+		PublishBackend:         options.PublishBackend,
+		PublishCharts:          options.PublishCharts,
+		PublishInterval:        options.PublishInterval,
+		PublishLock:            &sync.Mutex{},
 		AllowOverwrite:         options.AllowOverwrite,
+		HelmPush:               options.HelmPush,
+		DependencyValidation:   options.DependencyValidation,
+		DependencyRepos:        options.DependencyRepos,
+		RecordUploads:          options.RecordUploads,
+		GenerateSBOM:           options.GenerateSBOM,
+		RequireCosignSignature: options.RequireCosignSignature,
+		VerifyWrites:           options.VerifyWrites,
+		ChartPackageLimits:     repo.ChartPackageLimits{MaxUnpackedSize: options.MaxUnpackedSize, MaxFiles: options.MaxChartFiles},
+		SecretScan:             options.SecretScan,
+		PolicyURL:              options.PolicyURL,
+		ClamdAddress:           options.ClamdAddress,
+		ReadOnly:               options.ReadOnly,
+		MaintenanceMode:        options.MaintenanceMode,
+		MaintenanceModeLock:    &sync.RWMutex{},
+		MaintenanceRetryAfter:  options.MaintenanceRetryAfter,
 		TlsCert:                options.TlsCert,
 		TlsKey:                 options.TlsKey,
+		TlsPort:                options.TlsPort,
+		DisableHTTP:            options.DisableHTTP,
 		ChartPostFormFieldName: options.ChartPostFormFieldName,
 		ProvPostFormFieldName:  options.ProvPostFormFieldName,
+		ProxyProtocol:          options.ProxyProtocol,
+		EnableH2C:              options.EnableH2C,
+		GRPCPort:               options.GRPCPort,
+		AdminPort:              options.AdminPort,
+		AdminIdentities:        adminIdentitiesFromOptions(options),
+		AsyncUploads:           options.AsyncUploads,
+		UploadJobs:             map[string]*uploadJob{},
+		UploadJobsLock:         &sync.RWMutex{},
+		ResumableUploadsLock:   &sync.Mutex{},
+		ResumableUploadTTL:     options.ResumableUploadTTL,
+		ResumableUploadMaxSize: options.ResumableUploadMaxSize,
+		ResumableUploadDir:     options.ResumableUploadDir,
+		SpoolThreshold:         options.SpoolThreshold,
+		CompressResponses:      options.CompressResponses,
+		CompressionLevel:       options.CompressionLevel,
+		CompressionMinSize:     options.CompressionMinSize,
+		IndexProgressLock:      &sync.RWMutex{},
+		DeferIndexBuild:        options.DeferIndexBuild,
+		Quarantine:             map[string]quarantinedObject{},
+		QuarantineLock:         &sync.RWMutex{},
+		AuditLock:              &sync.Mutex{},
+		AuthTarpit:             newAuthTarpit(logger, options.AuthFailureDelay, options.AuthLockoutFailures, options.AuthLockoutDuration),
+		Changes:                newChangeLog(),
+		ChartOwners:            map[string][]string{},
+		ChartOwnersLock:        &sync.RWMutex{},
+		ChartOwnersUpdateLock:  &sync.Mutex{},
 	}
 
-	server.setRoutes(options.EnableAPI)
+	if options.IndexSharding {
+		server.RepositoryIndex.Shards = repo.NewIndexShards()
+	}
 
-	err = server.regenerateRepositoryIndex()
+	err = validateLibraryChartsMode(options.LibraryCharts)
+	if err != nil {
+		return server, err
+	}
+	server.RepositoryIndex.LibraryCharts = options.LibraryCharts
+	if options.IndexMaxAge < 0 {
+		return server, errors.New("index max age must not be negative")
+	}
+	server.RepositoryIndex.Pruning = &repo.IndexPruning{
+		MaxAge:          options.IndexMaxAge,
+		HidePrereleases: options.IndexHidePrereleases,
+	}
+
+	server.TrustedProxies, err = parseTrustedProxies(options.TrustedProxies)
+	if err != nil {
+		return server, err
+	}
+	server.ClientIPHeaders, err = parseClientIPHeaders(options.ClientIPHeaders)
+	if err != nil {
+		return server, err
+	}
+	if options.ForwardedForDepth < 0 {
+		return server, errors.New("forwarded-for depth must not be negative")
+	}
+	server.ForwardedForDepth = options.ForwardedForDepth
+	if len(server.TrustedProxies) == 0 && (server.ClientIPHeaders != nil || server.ForwardedForDepth > 0) {
+		return server, errors.New("client ip headers and forwarded-for depth require trusted proxies")
+	}
+
+	server.MetricsAuth, err = newMetricsAuth(options.MetricsBearerToken, options.MetricsClientCA)
+	if err != nil {
+		return server, err
+	}
+	if server.MetricsAuth.requestsClientCertificates() && !server.useTLS() {
+		return server, errMetricsClientCAWithoutTLS
+	}
+
+	// client addresses must be known before auth, for the tarpit
+	server.Router = NewRouter(logger, options.Username, options.Password, options.BearerToken, options.EnableMetrics,
+		server.clientIPMiddleware, server.authTarpitMiddleware, server.metricsAuthMiddleware)
+
+	err = validateListeners(options)
+	if err != nil {
+		return server, err
+	}
+
+	err = validateDependencyValidationMode(options.DependencyValidation)
+	if err != nil {
+		return server, err
+	}
+
+	err = validateSecretScanMode(options.SecretScan)
+	if err != nil {
+		return server, err
+	}
+
+	if options.CompressResponses {
+		err = validateCompressionLevel(options.CompressionLevel)
+		if err != nil {
+			return server, err
+		}
+	}
+
+	if options.ResponseCacheSize > 0 {
+		server.ResponseCache = newResponseCache(options.ResponseCacheSize)
+	}
+
+	server.CosignVerifier, err = loadCosignVerifier(options.CosignKey, options.CosignRoots, options.CosignIdentity, options.CosignIssuer)
+	if err != nil {
+		return server, err
+	}
+	if options.RequireCosignSignature && server.CosignVerifier == nil {
+		return server, errors.New("a cosign key or cosign root certificates are needed to require cosign signatures")
+	}
+
+	if options.NotificationsConfig != "" {
+		server.Notifications, err = loadNotificationsConfig(options.NotificationsConfig)
+		if err != nil {
+			return server, err
+		}
+	}
+
+	if options.ChartOwnersConfig != "" {
+		server.ChartOwnersConfig, err = loadChartOwnersConfig(options.ChartOwnersConfig)
+		if err != nil {
+			return server, err
+		}
+	}
+
+	server.Authorizer = options.Authorizer
+	if options.AccessPolicy != "" {
+		if options.Authorizer != nil {
+			return server, errors.New("an access policy cannot be used along with an authorizer")
+		}
+		server.Authorizer, err = authz.NewPolicyAuthorizer(options.AccessPolicy)
+		if err != nil {
+			return server, err
+		}
+	}
+
+	if options.ResumableUploadTTL < 0 {
+		return server, errors.New("resumable upload ttl must not be negative")
+	}
+	if options.ResumableUploadTTL == 0 {
+		server.ResumableUploadTTL = defaultResumableUploadTTL
+	}
+	if options.Routes.APIWrite {
+		server.ResumableUploads = map[string]*resumableUpload{}
+	}
+	if options.ResumableUploadMaxSize < 0 {
+		return server, errors.New("resumable upload max size must not be negative")
+	}
+	if options.ResumableUploadMaxSize == 0 {
+		server.ResumableUploadMaxSize = defaultResumableUploadMaxSize
+	}
+
+	if options.MaxConcurrentUploads > 0 {
+		server.UploadSemaphore = make(chan struct{}, options.MaxConcurrentUploads)
+	}
+
+	if options.AsyncUploads {
+		server.UploadJobQueue = make(chan *uploadJob, uploadJobQueueSize)
+		go server.processUploadJobs()
+	}
+
+	if options.GRPCPort != 0 {
+		server.GRPCServer, err = server.newGRPCServer(options)
+		if err != nil {
+			return server, err
+		}
+	}
+
+	server.Router.Use(server.maintenanceMiddleware)
+	if options.CompressResponses {
+		server.Router.Use(server.compressionMiddleware)
+	}
+	if options.AdminPort != 0 {
+		// the admin port must never serve destructive operations unauthenticated
+		if options.AdminUsername == "" || options.AdminPassword == "" {
+			return server, errAdminPortWithoutAuth
+		}
+		server.AdminRouter = NewRouter(logger, options.AdminUsername, options.AdminPassword, "", false,
+			server.clientIPMiddleware, server.authTarpitMiddleware)
+	}
+	server.setRoutes(options)
+
+	// with DeferIndexBuild, Listen builds the index once serving, so that /ready reports progress
+	if options.DeferIndexBuild {
+		return server, nil
+	}
+	err = server.buildIndex()
 	return server, err
 }
 
-// Listen starts server on a given port
+// buildIndex builds the index from storage for the first time, after which the server is ready
+func (server *Server) buildIndex() error {
+	err := server.regenerateRepositoryIndex()
+	if err != nil {
+		return err
+	}
+	server.IndexProgressLock.Lock()
+	defer server.IndexProgressLock.Unlock()
+	server.IndexBuilt = true
+	return nil
+}
+
+// notifyReady tells systemd that the server is ready once the index is built. With DeferIndexBuild,
+// the index is built in the background, so the server is listening in the meantime.
+func (server *Server) notifyReady() {
+	if !server.DeferIndexBuild {
+		server.notifySystemd(systemd.NotifyReady)
+		return
+	}
+	go func() {
+		err := server.buildIndex()
+		if err != nil {
+			server.Logger.Fatal(err)
+		}
+		server.notifySystemd(systemd.NotifyReady)
+	}()
+}
+
+// Listen starts server on a given port. If TlsPort is set, HTTPS is served on TlsPort as well,
+// and plain HTTP on port (unless DisableHTTP is set). Sockets passed by systemd socket activation
+// are used instead of listening on these ports, and systemd is notified once all are set up and
+// the index is built.
 func (server *Server) Listen(port int) {
 	server.Logger.Infow("Starting ChartMuseum",
 		"port", port,
+		"version", server.BuildInfo.Version,
+		"revision", server.BuildInfo.Revision,
+		"build_date", server.BuildInfo.BuildDate,
 	)
-	if server.TlsCert != "" && server.TlsKey != "" {
-		server.Logger.Fatal(server.Router.RunTLS(fmt.Sprintf(":%d", port), server.TlsCert, server.TlsKey))
+	server.startBackgroundJobs()
+	inherited, err := systemd.Listeners()
+	if err != nil {
+		server.Logger.Fatal(err)
+	}
+	if server.GRPCServer != nil {
+		server.Logger.Infow("Starting gRPC server",
+			"port", server.GRPCPort,
+		)
+		go server.serveGRPC(server.listen(inherited, systemdSocketGRPC, server.GRPCPort))
+	}
+	if server.AdminRouter != nil {
+		server.Logger.Infow("Starting admin server",
+			"port", server.AdminPort,
+		)
+		go server.serveHTTP(server.AdminRouter, server.listen(inherited, systemdSocketAdmin, server.AdminPort), server.useTLS())
+	}
+	var httpListener, tlsListener net.Listener
+	if server.TlsPort == 0 || !server.DisableHTTP {
+		httpListener = server.listen(inherited, systemdSocketHTTP, port)
+	}
+	if server.TlsPort != 0 {
+		server.Logger.Infow("Starting HTTPS server",
+			"port", server.TlsPort,
+		)
+		tlsListener = server.listen(inherited, systemdSocketHTTPS, server.TlsPort)
+	}
+	if server.ProxyProtocol {
+		for _, listener := range []*net.Listener{&httpListener, &tlsListener} {
+			if *listener != nil {
+				*listener = proxyproto.NewListener(*listener, proxyProtocolHeaderTimeout)
+			}
+		}
+	}
+	server.notifyReady()
+	if tlsListener != nil {
+		if httpListener == nil {
+			server.serveHTTP(server.Router, tlsListener, true)
+			return
+		}
+		go server.serveHTTP(server.Router, tlsListener, true)
+	}
+	server.serveHTTP(server.Router, httpListener, server.TlsPort == 0 && server.useTLS())
+}
+
+// serveHTTP serves router on listener, over HTTPS if useTLS is set, until it fails
+func (server *Server) serveHTTP(router *Router, listener net.Listener, useTLS bool) {
+	httpServer, err := server.newHTTPServer(router, useTLS)
+	if err != nil {
+		server.Logger.Fatal(err)
+	}
+	if useTLS {
+		server.Logger.Fatal(httpServer.ServeTLS(listener, server.TlsCert, server.TlsKey))
 	} else {
-		server.Logger.Fatal(server.Router.Run(fmt.Sprintf(":%d", port)))
+		server.Logger.Fatal(httpServer.Serve(listener))
+	}
+}
+
+func (server *Server) useTLS() bool {
+	return server.TlsCert != "" && server.TlsKey != ""
+}
+
+// validateListeners checks that a separate HTTPS port comes with TLS files, and that plain
+// HTTP is only disabled while HTTPS is served on its own port
+func validateListeners(options ServerOptions) error {
+	if options.TlsPort != 0 && (options.TlsCert == "" || options.TlsKey == "") {
+		return errTLSPortWithoutFiles
+	}
+	if options.DisableHTTP && options.TlsPort == 0 {
+		return errHTTPDisabledWithoutTLSPort
+	}
+	return nil
+}
+
+// newHTTPServer creates the http server for router, with HTTP/2 enabled for TLS, and for
+// cleartext connections if EnableH2C is set
+func (server *Server) newHTTPServer(router *Router, useTLS bool) (*http.Server, error) {
+	httpServer := &http.Server{Handler: router}
+	if useTLS {
+		if server.MetricsAuth.requestsClientCertificates() {
+			httpServer.TLSConfig = &tls.Config{ClientAuth: tls.RequestClientCert}
+		}
+		err := http2.ConfigureServer(httpServer, &http2.Server{})
+		return httpServer, err
 	}
+	if server.EnableH2C {
+		httpServer.Handler = h2c.NewHandler(router, &http2.Server{})
+	}
+	return httpServer, nil
 }
 
 func loggingMiddleware(logger *Logger) gin.HandlerFunc {
@@ -181,24 +736,68 @@ func loggingMiddleware(logger *Logger) gin.HandlerFunc {
 	}
 }
 
-func (server *Server) syncRepositoryIndex() error {
-	_, diff, err := server.listObjectsGetDiff()
+func (server *Server) maintenanceMiddleware(c *gin.Context) {
+	// liveness checks keep succeeding, so instances in maintenance mode are not restarted
+	if !server.inMaintenanceMode() || strings.HasPrefix(c.Request.URL.Path, "/admin/") || c.Request.URL.Path == "/health" {
+		return
+	}
+	if server.MaintenanceRetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(server.MaintenanceRetryAfter))
+	}
+	c.JSON(503, maintenanceErrorResponse)
+	c.Abort()
+}
+
+func (server *Server) inMaintenanceMode() bool {
+	server.MaintenanceModeLock.RLock()
+	defer server.MaintenanceModeLock.RUnlock()
+	return server.MaintenanceMode
+}
+
+func (server *Server) setMaintenanceMode(enabled bool) {
+	server.MaintenanceModeLock.Lock()
+	defer server.MaintenanceModeLock.Unlock()
+	if server.MaintenanceMode != enabled {
+		server.Logger.Infow("Maintenance mode changed",
+			"enabled", enabled,
+		)
+	}
+	server.MaintenanceMode = enabled
+}
+
+// syncRepositoryIndexOnRequest syncs the index with storage before serving a request,
+// unless DisableRequestSync is set (then only uploads, deletes and the periodic resync update it)
+func (server *Server) syncRepositoryIndexOnRequest(ctx context.Context) error {
+	if server.DisableRequestSync {
+		return nil
+	}
+	return server.syncRepositoryIndex(ctx)
+}
+
+// syncRepositoryIndex regenerates the index if storage changed, or chart versions aged out of it
+// with IndexMaxAge. Listing storage is given up when ctx is done (e.g. the client which requested
+// the sync went away), but once started, regenerating the index is not, as other requests may be
+// waiting for it.
+func (server *Server) syncRepositoryIndex(ctx context.Context) error {
+	_, diff, err := server.listObjectsGetDiff(ctx)
 	if err != nil {
 		return err
 	}
-	if !diff.Change {
+	if !diff.Change && !server.RepositoryIndex.PruningDue() {
 		return nil
 	}
 	err = server.regenerateRepositoryIndex()
 	return err
 }
 
-func (server *Server) listObjectsGetDiff() ([]storage.Object, storage.ObjectSliceDiff, error) {
-	allObjects, err := server.StorageBackend.ListObjects()
+func (server *Server) listObjectsGetDiff(ctx context.Context) ([]storage.Object, storage.ObjectSliceDiff, error) {
+	allObjects, err := server.listAllObjects(ctx)
 	if err != nil {
 		return []storage.Object{}, storage.ObjectSliceDiff{}, err
 	}
 
+	server.updateProvenanceFiles(allObjects)
+
 	// filter out storage objects that dont have extension used for chart packages (.tgz)
 	filteredObjects := []storage.Object{}
 	for _, object := range allObjects {
@@ -207,6 +806,8 @@ func (server *Server) listObjectsGetDiff() ([]storage.Object, storage.ObjectSlic
 		}
 	}
 
+	filteredObjects = server.mergePendingObjects(filteredObjects)
+
 	diff := storage.GetObjectSliceDiff(server.StorageCache, filteredObjects)
 	return filteredObjects, diff, nil
 }
@@ -220,15 +821,40 @@ func (server *Server) regenerateRepositoryIndex() error {
 		server.StorageCacheLock.Unlock()
 	}()
 
-	objects, diff, err := server.listObjectsGetDiff()
+	// whichever way the index ends up changing, record it for the changes feed
+	defer server.recordIndexChanges(snapshotIndex(server.RepositoryIndex))
+	defer func() {
+		storageCacheObjectsGauge.Set(float64(len(server.StorageCache)))
+	}()
+
+	cacheLoaded := false
+	if server.CacheStore != nil {
+		loaded, err := server.loadCachedState()
+		if err != nil {
+			server.Logger.Warnw("Unable to load index from cache store",
+				"error", err.Error(),
+			)
+		}
+		cacheLoaded = loaded
+	}
+
+	objects, diff, err := server.listObjectsGetDiff(context.Background())
 	if err != nil {
 		return err
 	}
 
+	// Another instance has already built an index matching what is in storage
+	if cacheLoaded && !diff.Change && !server.RepositoryIndex.PruningDue() {
+		return nil
+	}
+
 	index := &repo.Index{
-		IndexFile: server.RepositoryIndex.IndexFile,
-		Raw:       server.RepositoryIndex.Raw,
-		ChartURL:  server.RepositoryIndex.ChartURL,
+		IndexFile:     server.RepositoryIndex.IndexFile,
+		Raw:           server.RepositoryIndex.Raw,
+		ChartURL:      server.RepositoryIndex.ChartURL,
+		Shards:        server.RepositoryIndex.Shards,
+		LibraryCharts: server.RepositoryIndex.LibraryCharts,
+		Pruning:       server.RepositoryIndex.Pruning,
 	}
 
 	for _, object := range diff.Removed {
@@ -236,21 +862,23 @@ func (server *Server) regenerateRepositoryIndex() error {
 		if err != nil {
 			return err
 		}
+		server.releaseQuarantinedObject(object.Path)
 	}
 
 	for _, object := range diff.Updated {
-		err := server.updateIndexObject(index, object)
-		if err != nil {
-			return err
-		}
+		server.updateIndexObject(index, object)
 	}
 
-	// Parallelize retrieval of added objects to improve startup speed
-	err = server.addIndexObjectsAsync(index, diff.Added)
-	if err != nil {
-		return err
+	// Content of renamed objects is already indexed, no need to download them again
+	for _, rename := range diff.Renamed {
+		server.renameIndexObject(index, rename)
 	}
 
+	// Parallelize retrieval of added objects to improve startup speed. Copied objects are loaded
+	// as well, since their content may not be in the index (e.g. if it was quarantined).
+	added := append([]storage.Object{}, diff.Added...)
+	server.addIndexObjectsAsync(index, append(added, diff.Copied...))
+
 	server.Logger.Debug("Regenerating index.yaml")
 	err = index.Regenerate()
 	if err != nil {
@@ -258,10 +886,39 @@ func (server *Server) regenerateRepositoryIndex() error {
 	}
 
 	server.RepositoryIndex = index
-	server.StorageCache = objects
+	server.StorageCache = server.withoutRetryableQuarantinedObjects(objects)
+
+	if server.CacheStore != nil {
+		err = server.storeCachedState()
+		if err != nil {
+			server.Logger.Warnw("Unable to store index in cache store",
+				"error", err.Error(),
+			)
+		}
+	}
+
+	if server.StoreIndex {
+		err = server.storeRepositoryIndex()
+		if err != nil {
+			server.Logger.Warnw("Unable to write index to storage",
+				"error", err.Error(),
+			)
+		}
+	}
+
+	server.publishRepositoryOnChange()
 	return nil
 }
 
+// storeRepositoryIndex writes index.yaml and index.yaml.gz to the root of the storage backend
+func (server *Server) storeRepositoryIndex() error {
+	err := server.StorageBackend.PutObject(repo.IndexFileName, server.RepositoryIndex.Raw)
+	if err != nil {
+		return err
+	}
+	return server.StorageBackend.PutObject(repo.IndexGzipFileName, server.RepositoryIndex.RawGzip)
+}
+
 func (server *Server) removeIndexObject(index *repo.Index, object storage.Object) error {
 	chartVersion, err := server.getObjectChartVersion(object, false)
 	if err != nil {
@@ -275,23 +932,45 @@ func (server *Server) removeIndexObject(index *repo.Index, object storage.Object
 	return nil
 }
 
-func (server *Server) updateIndexObject(index *repo.Index, object storage.Object) error {
+// updateIndexObject reloads a changed package, quarantining it if that fails
+func (server *Server) updateIndexObject(index *repo.Index, object storage.Object) {
 	chartVersion, err := server.getObjectChartVersion(object, true)
 	if err != nil {
-		return server.checkInvalidChartPackageError(object, err, "updated")
+		server.quarantineObject(object, err)
+		return
 	}
+	server.releaseQuarantinedObject(object.Path)
 	server.Logger.Debugw("Updating chart in index",
 		"name", chartVersion.Name,
 		"version", chartVersion.Version,
 	)
+	if !index.Has(chartVersion.Name, chartVersion.Version) {
+		// previously quarantined, so never made it into the index
+		index.AddEntry(chartVersion)
+		return
+	}
 	index.UpdateEntry(chartVersion)
-	return nil
 }
 
-func (server *Server) addIndexObjectsAsync(index *repo.Index, objects []storage.Object) error {
+func (server *Server) renameIndexObject(index *repo.Index, rename storage.ObjectRename) {
+	server.Logger.Debugw("Renaming chart in index",
+		"from", rename.From.Path,
+		"to", rename.To.Path,
+	)
+	if !index.RenameEntry(rename.From.Path, rename.To.Path) {
+		server.Logger.Debugw("Renamed package not found in index",
+			"package", rename.From.Path,
+		)
+	}
+}
+
+// addIndexObjectsAsync loads added packages in parallel. Packages which cannot be loaded are
+// quarantined rather than failing the whole build, and packages of chart versions which are
+// already in the index are skipped, so that there is a single entry per version.
+func (server *Server) addIndexObjectsAsync(index *repo.Index, objects []storage.Object) {
 	numObjects := len(objects)
 	if numObjects == 0 {
-		return nil
+		return
 	}
 
 	server.Logger.Debugw("Loading charts packages from storage (this could take awhile)",
@@ -299,40 +978,38 @@ func (server *Server) addIndexObjectsAsync(index *repo.Index, objects []storage.
 	)
 
 	type cvResult struct {
-		cv  *helm_repo.ChartVersion
-		err error
+		object storage.Object
+		cv     *helm_repo.ChartVersion
+		err    error
 	}
 
 	cvChan := make(chan cvResult)
 
-	// Provide a mechanism to short-circuit object downloads in case of error
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	server.startIndexBuildProgress(numObjects)
+	defer server.finishIndexBuildProgress()
 
 	for _, object := range objects {
 		go func(o storage.Object) {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				chartVersion, err := server.getObjectChartVersion(o, true)
-				if err != nil {
-					err = server.checkInvalidChartPackageError(o, err, "added")
-				}
-				if err != nil {
-					cancel()
-				}
-				cvChan <- cvResult{chartVersion, err}
-			}
+			chartVersion, err := server.getObjectChartVersion(o, true)
+			cvChan <- cvResult{o, chartVersion, err}
 		}(object)
 	}
 
 	for validCount := 0; validCount < numObjects; validCount++ {
 		cvRes := <-cvChan
+		server.updateIndexBuildProgress(validCount + 1)
 		if cvRes.err != nil {
-			return cvRes.err
+			server.quarantineObject(cvRes.object, cvRes.err)
+			continue
 		}
-		if cvRes.cv == nil {
+		server.releaseQuarantinedObject(cvRes.object.Path)
+		if index.Has(cvRes.cv.Name, cvRes.cv.Version) {
+			// e.g. a copy of a package under another name
+			server.Logger.Debugw("Skipping package of chart version already in index",
+				"package", cvRes.object.Path,
+				"name", cvRes.cv.Name,
+				"version", cvRes.cv.Version,
+			)
 			continue
 		}
 		server.Logger.Debugw("Adding chart to index",
@@ -341,8 +1018,6 @@ func (server *Server) addIndexObjectsAsync(index *repo.Index, objects []storage.
 		)
 		index.AddEntry(cvRes.cv)
 	}
-
-	return nil
 }
 
 func (server *Server) getObjectChartVersion(object storage.Object, load bool) (*helm_repo.ChartVersion, error) {
@@ -0,0 +1,96 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readRequestBody reads the body of an upload and checks it against the Content-SHA256 header, if
+// present (returning a status for the response on errors). With SpoolThreshold, bodies above it are
+// written to a temporary file while they are received, and only loaded from it once they matched
+// their checksum, so that slow or corrupted uploads don't hold memory.
+func (server *Server) readRequestBody(c *gin.Context) ([]byte, int, error) {
+	checksum := c.GetHeader(checksumHeader)
+	if server.SpoolThreshold <= 0 {
+		content, err := c.GetRawData()
+		if err != nil {
+			return nil, 500, err
+		}
+		return checkedRequestBody(content, checksum)
+	}
+	buf := bytes.NewBuffer(nil)
+	n, err := io.Copy(buf, io.LimitReader(c.Request.Body, server.SpoolThreshold+1))
+	if err != nil {
+		return nil, 500, err
+	}
+	if n <= server.SpoolThreshold {
+		return checkedRequestBody(buf.Bytes(), checksum)
+	}
+
+	file, err := ioutil.TempFile("", "chartmuseum-spool-")
+	if err != nil {
+		return nil, 500, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	size, err := io.Copy(file, io.MultiReader(buf, c.Request.Body))
+	if err != nil {
+		return nil, 500, err
+	}
+	server.Logger.Debugw("Spooled request body to disk",
+		"path", c.Request.URL.Path,
+		"size", size,
+	)
+	content, err := readSpooledFile(file, size, checksum)
+	if err != nil {
+		if _, ok := err.(checksumMismatchError); ok {
+			return nil, 422, err
+		}
+		return nil, 500, err
+	}
+	return content, 200, nil
+}
+
+func checkedRequestBody(content []byte, checksum string) ([]byte, int, error) {
+	err := verifyChecksum(checksum, content)
+	if err != nil {
+		return nil, 422, err
+	}
+	return content, 200, nil
+}
+
+// readSpooledFile checks the size bytes written to file against checksum, reading them back from
+// disk, and only then loads them into memory
+func readSpooledFile(file *os.File, size int64, checksum string) ([]byte, error) {
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	err = verifyChecksumReader(checksum, file)
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	content := make([]byte, size)
+	_, err = io.ReadFull(file, content)
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// parseSpooledMultipartForm parses a multipart upload, keeping at most SpoolThreshold bytes of
+// files in memory and writing the rest to temporary files (removed once the request is done)
+func (server *Server) parseSpooledMultipartForm(c *gin.Context) error {
+	if server.SpoolThreshold <= 0 {
+		return nil
+	}
+	return c.Request.ParseMultipartForm(server.SpoolThreshold)
+}
@@ -0,0 +1,51 @@
+package chartmuseum
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/systemd"
+)
+
+// Names of sockets passed by systemd socket activation (FileDescriptorName= in the socket unit).
+// A single socket without a name is used for the main HTTP listener.
+const (
+	systemdSocketHTTP    = "http"
+	systemdSocketHTTPS   = "https"
+	systemdSocketAdmin   = "admin"
+	systemdSocketGRPC    = "grpc"
+	systemdSocketUnnamed = "unknown"
+)
+
+// listen returns the socket with the given name passed by systemd, or else starts listening on port
+func (server *Server) listen(inherited map[string][]net.Listener, name string, port int) net.Listener {
+	listeners := inherited[name]
+	if len(listeners) == 0 && name == systemdSocketHTTP {
+		name = systemdSocketUnnamed
+		listeners = inherited[name]
+	}
+	if len(listeners) > 0 {
+		inherited[name] = listeners[1:]
+		server.Logger.Infow("Using socket passed by systemd",
+			"socket", name,
+			"address", listeners[0].Addr().String(),
+		)
+		return listeners[0]
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		server.Logger.Fatal(err)
+	}
+	return listener
+}
+
+// notifySystemd sends state to systemd, if it started the server with a notify socket
+func (server *Server) notifySystemd(state string) {
+	err := systemd.Notify(state)
+	if err != nil && err != systemd.ErrNoNotifySocket {
+		server.Logger.Warnw("Unable to notify systemd",
+			"state", state,
+			"error", err.Error(),
+		)
+	}
+}
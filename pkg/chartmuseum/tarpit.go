@@ -0,0 +1,164 @@
+package chartmuseum
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxAuthFailureDelay caps the delay of requests from clients which keep failing to authenticate
+	maxAuthFailureDelay = 30 * time.Second
+
+	// authFailureMemory is how long failures are remembered for when lockout is disabled
+	authFailureMemory = 15 * time.Minute
+
+	// maxAuthFailureClients bounds how many clients are tracked before forgetting expired ones
+	maxAuthFailureClients = 10000
+)
+
+// authFailures are the recent authentication failures of one client
+type authFailures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// authTarpit slows down clients which repeatedly fail to authenticate, by delaying each of their
+// requests exponentially in the number of failures, and optionally locks them out for a while
+// after too many failures. Clients are identified by IP address.
+type authTarpit struct {
+	logger          *Logger
+	delay           time.Duration
+	lockoutFailures int
+	lockoutDuration time.Duration
+	clients         map[string]*authFailures
+	lock            *sync.Mutex
+}
+
+// newAuthTarpit creates a new authTarpit, or returns nil if both delays and lockout are disabled
+func newAuthTarpit(logger *Logger, delay time.Duration, lockoutFailures int, lockoutDuration time.Duration) *authTarpit {
+	if delay <= 0 && lockoutFailures <= 0 {
+		return nil
+	}
+	if lockoutDuration <= 0 {
+		lockoutDuration = authFailureMemory
+	}
+	return &authTarpit{
+		logger:          logger,
+		delay:           delay,
+		lockoutFailures: lockoutFailures,
+		lockoutDuration: lockoutDuration,
+		clients:         map[string]*authFailures{},
+		lock:            &sync.Mutex{},
+	}
+}
+
+// check returns how long to delay a request from ip, or how long ip is still locked out for
+func (tarpit *authTarpit) check(ip string, now time.Time) (delay time.Duration, lockedOut time.Duration) {
+	tarpit.lock.Lock()
+	defer tarpit.lock.Unlock()
+	failures := tarpit.clients[ip]
+	if failures == nil {
+		return 0, 0
+	}
+	if now.Before(failures.lockedUntil) {
+		return 0, failures.lockedUntil.Sub(now)
+	}
+	if now.Sub(failures.lastFailure) >= tarpit.lockoutDuration {
+		delete(tarpit.clients, ip)
+		return 0, 0
+	}
+	if tarpit.delay <= 0 {
+		return 0, 0
+	}
+	delay = tarpit.delay
+	for i := 1; i < failures.count && delay < maxAuthFailureDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxAuthFailureDelay {
+		delay = maxAuthFailureDelay
+	}
+	return delay, 0
+}
+
+// fail records an authentication failure of ip, locking it out once there were too many
+func (tarpit *authTarpit) fail(ip string, now time.Time) {
+	tarpit.lock.Lock()
+	defer tarpit.lock.Unlock()
+	failures := tarpit.clients[ip]
+	if failures == nil {
+		if len(tarpit.clients) >= maxAuthFailureClients {
+			tarpit.forgetExpired(now)
+		}
+		failures = &authFailures{}
+		tarpit.clients[ip] = failures
+	}
+	failures.count++
+	failures.lastFailure = now
+	if tarpit.lockoutFailures > 0 && failures.count >= tarpit.lockoutFailures {
+		failures.count = 0
+		failures.lockedUntil = now.Add(tarpit.lockoutDuration)
+		authLockoutsCounter.Inc()
+		tarpit.logger.Warnw("Locking out client after repeated authentication failures",
+			"clientIP", ip,
+			"failures", tarpit.lockoutFailures,
+			"duration", tarpit.lockoutDuration.String(),
+		)
+	}
+}
+
+// succeed forgets the failures of ip once it authenticated successfully
+func (tarpit *authTarpit) succeed(ip string) {
+	tarpit.lock.Lock()
+	defer tarpit.lock.Unlock()
+	delete(tarpit.clients, ip)
+}
+
+// forgetExpired removes clients which are neither locked out nor failed recently
+func (tarpit *authTarpit) forgetExpired(now time.Time) {
+	for ip, failures := range tarpit.clients {
+		if !now.Before(failures.lockedUntil) && now.Sub(failures.lastFailure) >= tarpit.lockoutDuration {
+			delete(tarpit.clients, ip)
+		}
+	}
+}
+
+// authTarpitMiddleware runs before the auth middleware: it rejects requests from locked out clients
+// with 429, delays requests from clients with recent failures, and records the outcome. Clients are
+// told apart by the address of the connection, unless TrustedProxies tell their real address.
+func (server *Server) authTarpitMiddleware(c *gin.Context) {
+	tarpit := server.AuthTarpit
+	if tarpit == nil {
+		return
+	}
+	ip := c.ClientIP()
+	if len(server.TrustedProxies) == 0 {
+		if remote := remoteIP(c.Request); remote != nil {
+			ip = remote.String()
+		}
+	}
+	delay, lockedOut := tarpit.check(ip, time.Now())
+	if lockedOut > 0 {
+		authLockedOutRequestsCounter.Inc()
+		c.Header("Retry-After", strconv.Itoa(int(lockedOut.Seconds()+1)))
+		c.JSON(429, authLockedOutErrorResponse)
+		c.Abort()
+		return
+	}
+	if delay > 0 {
+		server.Logger.Debugw("Delaying request from client with authentication failures",
+			"clientIP", ip,
+			"delay", delay.String(),
+		)
+		time.Sleep(delay)
+	}
+	c.Next()
+	if c.Writer.Status() == 401 {
+		tarpit.fail(ip, time.Now())
+	} else if _, ok := c.Get(gin.AuthUserKey); ok {
+		tarpit.succeed(ip)
+	}
+}
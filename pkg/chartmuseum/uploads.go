@@ -0,0 +1,135 @@
+package chartmuseum
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// uploadRecordExtension is appended to the filename of a package to name the object recording its upload
+const uploadRecordExtension = ".upload.json"
+
+const (
+	uploadMethodBinary    = "binary"
+	uploadMethodForm      = "form"
+	uploadMethodGRPC      = "grpc"
+	uploadMethodResumable = "resumable"
+)
+
+// uploadRecord describes who uploaded a package, from where, how and when
+type uploadRecord struct {
+	Uploader  string    `json:"uploader,omitempty"`
+	Auth      string    `json:"auth,omitempty"` // "basic" or "bearer", empty for anonymous uploads
+	ClientIP  string    `json:"clientIP,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Method    string    `json:"method"` // "binary", "form", "grpc" or "resumable"
+	Uploaded  time.Time `json:"uploaded"`
+}
+
+func uploadRecordPath(filename string) string {
+	return filename + uploadRecordExtension
+}
+
+// newUploadRecord records an upload over HTTP, or returns nil if uploads are not recorded
+func (server *Server) newUploadRecord(c *gin.Context, method string) *uploadRecord {
+	if !server.RecordUploads {
+		return nil
+	}
+	record := &uploadRecord{
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Method:    method,
+		Uploaded:  time.Now(),
+	}
+	// only trust credentials which were verified by the auth middleware
+	if _, ok := c.Get(gin.AuthUserKey); ok {
+		record.Uploader, record.Auth = uploaderFromAuthorization(c.Request.Header.Get("Authorization"))
+	}
+	return record
+}
+
+// newUploadRecord records an upload over gRPC, or returns nil if uploads are not recorded
+func (service *grpcService) newUploadRecord(ctx context.Context) *uploadRecord {
+	if !service.server.RecordUploads {
+		return nil
+	}
+	record := &uploadRecord{
+		Method:   uploadMethodGRPC,
+		Uploaded: time.Now(),
+	}
+	record.ClientIP = grpcClientIP(ctx)
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md["user-agent"]; len(values) > 0 {
+		record.UserAgent = values[0]
+	}
+	if values := md["authorization"]; len(values) > 0 && service.auth != nil {
+		record.Uploader, record.Auth = uploaderFromAuthorization(values[0])
+	}
+	return record
+}
+
+// grpcClientIP returns the address of the client of a gRPC request
+func grpcClientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// uploaderFromAuthorization returns the username and kind of credentials in an Authorization header
+// value which was already verified
+func uploaderFromAuthorization(authorization string) (string, string) {
+	if strings.HasPrefix(authorization, "Bearer ") {
+		return "", "bearer"
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "Basic "))
+	if err != nil {
+		return "", ""
+	}
+	return strings.SplitN(string(decoded), ":", 2)[0], "basic"
+}
+
+// saveUploadRecord stores record next to the uploaded package. Failing to do so doesn't fail the upload.
+func (server *Server) saveUploadRecord(filename string, record *uploadRecord) {
+	if record == nil {
+		return
+	}
+	content, err := json.Marshal(record)
+	if err == nil {
+		err = server.StorageBackend.PutObject(uploadRecordPath(filename), content)
+	}
+	if err != nil {
+		server.Logger.Warnw("Unable to record upload",
+			"package", filename,
+			"error", err.Error(),
+		)
+	}
+}
+
+// getUploadRecord returns how a package was uploaded, or nil if that was not recorded
+func (server *Server) getUploadRecord(filename string) *uploadRecord {
+	if !server.RecordUploads {
+		return nil
+	}
+	object, err := server.StorageBackend.GetObject(uploadRecordPath(filename))
+	if err != nil {
+		return nil
+	}
+	var record uploadRecord
+	err = json.Unmarshal(object.Content, &record)
+	if err != nil {
+		return nil
+	}
+	return &record
+}
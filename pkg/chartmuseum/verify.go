@@ -0,0 +1,64 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+var (
+	// writeVerificationAttempts is how many times an uploaded file is read back with VerifyWrites,
+	// waiting writeVerificationDelay in between, before giving up on seeing what was written
+	writeVerificationAttempts = 5
+	writeVerificationDelay    = 200 * time.Millisecond
+)
+
+// writeVerificationError is returned when an uploaded file can't be read back as it was written
+type writeVerificationError struct {
+	filename string
+	reason   string
+}
+
+func (err writeVerificationError) Error() string {
+	return fmt.Sprintf("unable to verify that %s was written to storage: %s", err.filename, err.reason)
+}
+
+// putUploadedObject writes an uploaded file to storage. With VerifyWrites, it is then read back
+// until its content matches, to catch backends which lose or corrupt writes without an error or
+// which don't list them yet: if that doesn't happen, the file is deleted and a writeVerificationError
+// is returned.
+func (server *Server) putUploadedObject(filename string, content []byte) error {
+	err := server.StorageBackend.PutObject(filename, content)
+	if err != nil || !server.VerifyWrites {
+		return err
+	}
+	err = server.verifyWrite(filename, content)
+	if err != nil {
+		server.Logger.Warnw("Uploaded file could not be read back from storage",
+			"filename", filename,
+			"error", err.Error(),
+		)
+		server.StorageBackend.DeleteObject(filename)
+	}
+	return err
+}
+
+func (server *Server) verifyWrite(filename string, content []byte) error {
+	var reason string
+	for attempt := 1; attempt <= writeVerificationAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(writeVerificationDelay)
+		}
+		object, err := server.StorageBackend.GetObject(filename)
+		if err != nil {
+			reason = err.Error()
+			continue
+		}
+		if !bytes.Equal(object.Content, content) {
+			reason = fmt.Sprintf("read back %d bytes which differ from the %d bytes written", len(object.Content), len(content))
+			continue
+		}
+		return nil
+	}
+	return writeVerificationError{filename: filename, reason: reason}
+}
@@ -0,0 +1,115 @@
+package chartmuseum
+
+import (
+	"fmt"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// previousVersionExtension is appended to the filename of a chart package or provenance file to
+// name the object keeping its content from before it was last overwritten
+const previousVersionExtension = ".previous"
+
+func previousVersionPath(filename string) string {
+	return filename + previousVersionExtension
+}
+
+// keepPreviousVersion writes the content an uploaded file had before it was overwritten aside, so
+// that it can be rolled back to. Only the last previous version is kept, so it must only be called
+// once the upload was written: a failed upload must not replace the previous version of an earlier one.
+func (server *Server) keepPreviousVersion(filename string, previous []byte) error {
+	server.Logger.Debugw("Keeping previous version of overwritten file",
+		"filename", filename,
+	)
+	return server.StorageBackend.PutObject(previousVersionPath(filename), previous)
+}
+
+// putUploadedObjectKeepingPrevious writes an uploaded file like putUploadedObject, keeping the content
+// it overwrote (if any) as its previous version. If either fails, the overwritten content is put back.
+func (server *Server) putUploadedObjectKeepingPrevious(filename string, content []byte) error {
+	current, err := server.StorageBackend.GetObject(filename)
+	overwriting := err == nil
+	err = server.putUploadedObject(filename, content)
+	if _, ok := err.(writeVerificationError); ok && overwriting {
+		// the unverified file was deleted
+		server.restoreObjects([]string{filename}, map[string][]byte{filename: current.Content})
+	}
+	if err != nil || !overwriting {
+		return err
+	}
+	err = server.keepPreviousVersion(filename, current.Content)
+	if err != nil {
+		server.restoreObjects([]string{filename}, map[string][]byte{filename: current.Content})
+	}
+	return err
+}
+
+// rollbackFile swaps the current content of a file with its previous version, so that rolling back
+// twice restores the content from before. It returns false if there is no previous version.
+func (server *Server) rollbackFile(filename string) (bool, error) {
+	previous, err := server.StorageBackend.GetObject(previousVersionPath(filename))
+	if err != nil {
+		return false, nil
+	}
+	current, err := server.StorageBackend.GetObject(filename)
+	if err != nil {
+		return false, err
+	}
+	err = server.StorageBackend.PutObject(previousVersionPath(filename), current.Content)
+	if err != nil {
+		return false, err
+	}
+	err = server.StorageBackend.PutObject(filename, previous.Content)
+	if err != nil {
+		server.StorageBackend.PutObject(previousVersionPath(filename), previous.Content)
+		return false, err
+	}
+	return true, nil
+}
+
+// postChartVersionRollbackRequestHandler restores the content a chart version had before it was
+// last overwritten, along with its provenance file if that was overwritten as well
+func (server *Server) postChartVersionRollbackRequestHandler(c *gin.Context) {
+	name := c.Param("name")
+	version := c.Param("version")
+	err := server.checkChartOwner(name, requestIdentity(c))
+	if err != nil {
+		c.JSON(403, newErrorResponse(errorCodeNotChartOwner, err.Error(), nil))
+		return
+	}
+	filename := repo.ChartPackageFilenameFromNameVersion(name, version)
+	provFilename := repo.ProvenanceFilenameFromNameVersion(name, version)
+	for _, f := range []string{filename, provFilename} {
+		unlock, status, err := server.acquireUploadLock(f)
+		if err != nil {
+			c.JSON(status, errorResponse(status, err))
+			return
+		}
+		defer unlock()
+	}
+
+	rolledBack, err := server.rollbackFile(filename)
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	if !rolledBack {
+		c.JSON(404, newErrorResponse(errorCodeNotFound, fmt.Sprintf("no previous version of %s", filename), nil))
+		return
+	}
+	provRolledBack, err := server.rollbackFile(provFilename)
+	if err != nil {
+		server.Logger.Warnw("Unable to roll back provenance file",
+			"provenance_file", provFilename,
+			"error", err.Error(),
+		)
+	}
+	server.Logger.Infow("Rolled back chart version to its previous content",
+		"package", filename,
+		"provenance", provRolledBack,
+	)
+	server.indexUploadedPackage(filename)
+	c.JSON(200, gin.H{"rolledBack": true, "provenance": provRolledBack})
+}
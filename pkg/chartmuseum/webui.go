@@ -0,0 +1,166 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+var webUITemplates = template.Must(template.New("webui").Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - ChartMuseum</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; color: #333; }
+a { color: #0b6ea8; text-decoration: none; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .4em; border-bottom: 1px solid #ddd; }
+pre { background: #f5f5f5; padding: 1em; overflow: auto; }
+.muted { color: #888; }
+</style>
+</head>
+<body>
+<p><a href="/ui">ChartMuseum</a></p>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "charts"}}{{template "header" .}}
+<h1>Charts</h1>
+<form method="get" action="/ui"><input type="text" name="q" value="{{.Search}}" placeholder="search charts"> <input type="submit" value="Search"></form>
+<table>
+<tr><th>Name</th><th>Latest version</th><th>Description</th></tr>
+{{range .Charts}}<tr><td><a href="/ui/charts/{{.Name}}">{{.Name}}</a></td><td>{{.Version}}</td><td>{{.Description}}</td></tr>
+{{else}}<tr><td colspan="3" class="muted">No charts found</td></tr>
+{{end}}</table>
+{{template "footer" .}}{{end}}
+
+{{define "chart"}}{{template "header" .}}
+<h1>{{.Name}}</h1>
+<table>
+<tr><th>Version</th><th>App version</th><th>Created</th></tr>
+{{range .Versions}}<tr><td><a href="/ui/charts/{{.Name}}/{{.Version}}">{{.Version}}</a></td><td>{{.AppVersion}}</td><td>{{.Created.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+{{template "footer" .}}{{end}}
+
+{{define "version"}}{{template "header" .}}
+<h1>{{.ChartVersion.Name}} <span class="muted">{{.ChartVersion.Version}}</span></h1>
+<p>{{.ChartVersion.Description}}</p>
+{{if .ChartVersion.Home}}<p>Home: <a href="{{.ChartVersion.Home}}">{{.ChartVersion.Home}}</a></p>{{end}}
+<h2>Install</h2>
+<pre>helm repo add chartmuseum {{.RepoURL}}
+helm install chartmuseum/{{.ChartVersion.Name}} --version {{.ChartVersion.Version}}</pre>
+<h2>README</h2>
+{{if .Readme}}<pre>{{.Readme}}</pre>{{else}}<p class="muted">This chart has no README</p>{{end}}
+<h2>Values</h2>
+{{if .Values}}<pre>{{.Values}}</pre>{{else}}<p class="muted">This chart has no default values</p>{{end}}
+{{template "footer" .}}{{end}}
+`))
+
+func (server *Server) getWebUIChartsRequestHandler(c *gin.Context) {
+	search := c.Query("q")
+	index, ok := server.visibleIndexForRequest(c)
+	if !ok {
+		return
+	}
+	var names []string
+	for name := range index.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	charts := []*helm_repo.ChartVersion{}
+	for _, name := range names {
+		versions := index.Entries[name]
+		if len(versions) == 0 {
+			continue
+		}
+		if search != "" && !chartVersionMatchesSearch(versions[0], search) {
+			continue
+		}
+		charts = append(charts, versions[0])
+	}
+	server.renderWebUITemplate(c, "charts", gin.H{
+		"Title":  "Charts",
+		"Search": search,
+		"Charts": charts,
+	})
+}
+
+func (server *Server) getWebUIChartRequestHandler(c *gin.Context) {
+	name := c.Param("name")
+	err := server.syncRepositoryIndexOnRequest(c.Request.Context())
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	versions := server.RepositoryIndex.Entries[name]
+	if len(versions) == 0 {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	server.renderWebUITemplate(c, "chart", gin.H{
+		"Title":    name,
+		"Name":     name,
+		"Versions": versions,
+	})
+}
+
+func (server *Server) getWebUIChartVersionRequestHandler(c *gin.Context) {
+	name := c.Param("name")
+	version := c.Param("version")
+	err := server.syncRepositoryIndexOnRequest(c.Request.Context())
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	chartVersion, err := server.RepositoryIndex.Get(name, version)
+	if err != nil {
+		c.JSON(404, notFoundErrorResponse)
+		return
+	}
+	docs, ok := server.ResponseCache.getChartPackageMetadata("docs", chartVersion).(chartPackageDocs)
+	if !ok {
+		object, err := storage.GetObjectWithContext(c.Request.Context(), server.StorageBackend, repo.ChartPackageFilenameFromNameVersion(name, version))
+		if server.clientWentAway(c) {
+			return
+		}
+		if err != nil {
+			c.JSON(404, notFoundErrorResponse)
+			return
+		}
+		docs.readme, docs.values, err = repo.ChartPackageDocsFromContent(object.Content)
+		if err != nil {
+			c.JSON(500, errorResponse(500, err))
+			return
+		}
+		server.ResponseCache.addChartPackageMetadata("docs", chartVersion, docs)
+	}
+	server.renderWebUITemplate(c, "version", gin.H{
+		"Title":        fmt.Sprintf("%s %s", name, version),
+		"ChartVersion": chartVersion,
+		"RepoURL":      server.repositoryURL(c),
+		"Readme":       docs.readme,
+		"Values":       docs.values,
+	})
+}
+
+func (server *Server) renderWebUITemplate(c *gin.Context, name string, data gin.H) {
+	buf := bytes.NewBuffer(nil)
+	err := webUITemplates.ExecuteTemplate(buf, name, data)
+	if err != nil {
+		c.JSON(500, errorResponse(500, err))
+		return
+	}
+	c.Data(200, "text/html; charset=utf-8", buf.Bytes())
+}
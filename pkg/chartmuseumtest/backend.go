@@ -0,0 +1,144 @@
+package chartmuseumtest
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+)
+
+// ErrObjectNotFound is returned by FakeBackend for objects it doesn't have
+var ErrObjectNotFound = errors.New("object not found")
+
+// FakeBackend is an in-memory storage backend for tests. Besides storing objects, it can be told to
+// leave objects out of listings (like eventually consistent backends do for a while), to return a
+// fixed listing, or to fail operations, and counts how many times each operation was called.
+type FakeBackend struct {
+	lock     *sync.Mutex
+	objects  map[string]storage.Object
+	unlisted map[string]bool
+	listing  []storage.Object
+	errors   map[string]error
+	calls    map[string]int
+}
+
+// NewFakeBackend creates a new, empty FakeBackend
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{
+		lock:     &sync.Mutex{},
+		objects:  map[string]storage.Object{},
+		unlisted: map[string]bool{},
+		errors:   map[string]error{},
+		calls:    map[string]int{},
+	}
+}
+
+// ListObjects lists all objects in path order, except unlisted ones, or the listing set with SetListing
+func (b *FakeBackend) ListObjects() ([]storage.Object, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.calls[storage.OperationList]++
+	if err := b.errors[storage.OperationList]; err != nil {
+		return nil, err
+	}
+	if b.listing != nil {
+		return append([]storage.Object{}, b.listing...), nil
+	}
+	objects := []storage.Object{}
+	for path, object := range b.objects {
+		if !b.unlisted[path] {
+			object.Content = []byte{}
+			objects = append(objects, object)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Path < objects[j].Path
+	})
+	return objects, nil
+}
+
+// GetObject retrieves an object, even if it is unlisted
+func (b *FakeBackend) GetObject(path string) (storage.Object, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.calls[storage.OperationGet]++
+	if err := b.errors[storage.OperationGet]; err != nil {
+		return storage.Object{Path: path}, err
+	}
+	object, ok := b.objects[path]
+	if !ok {
+		return storage.Object{Path: path}, ErrObjectNotFound
+	}
+	object.Content = append([]byte{}, object.Content...)
+	return object, nil
+}
+
+// PutObject stores an object, modified now
+func (b *FakeBackend) PutObject(path string, content []byte) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.calls[storage.OperationPut]++
+	if err := b.errors[storage.OperationPut]; err != nil {
+		return err
+	}
+	b.objects[path] = storage.Object{Path: path, Content: append([]byte{}, content...), LastModified: time.Now()}
+	return nil
+}
+
+// DeleteObject removes an object
+func (b *FakeBackend) DeleteObject(path string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.calls[storage.OperationDelete]++
+	if err := b.errors[storage.OperationDelete]; err != nil {
+		return err
+	}
+	if _, ok := b.objects[path]; !ok {
+		return ErrObjectNotFound
+	}
+	delete(b.objects, path)
+	delete(b.unlisted, path)
+	return nil
+}
+
+// Unlist leaves an object out of listings until Relist is called, while it can still be retrieved
+func (b *FakeBackend) Unlist(path string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.unlisted[path] = true
+}
+
+// Relist makes an object left out with Unlist show up in listings again
+func (b *FakeBackend) Relist(path string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.unlisted, path)
+}
+
+// SetListing makes ListObjects return objects, whatever is stored, or list stored objects again if nil
+func (b *FakeBackend) SetListing(objects []storage.Object) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.listing = objects
+}
+
+// FailOperation makes an operation (storage.OperationList, OperationGet, OperationPut or OperationDelete)
+// fail with err, or succeed again if err is nil
+func (b *FakeBackend) FailOperation(operation string, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err == nil {
+		delete(b.errors, operation)
+		return
+	}
+	b.errors[operation] = err
+}
+
+// Calls returns how many times an operation was called, including failed calls
+func (b *FakeBackend) Calls(operation string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.calls[operation]
+}
@@ -0,0 +1,85 @@
+package chartmuseumtest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ChartMuseumTestTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ChartMuseumTestTestSuite) TestFakeBackend() {
+	backend := NewFakeBackend()
+	var _ storage.Backend = backend
+
+	suite.Nil(backend.PutObject("b.tgz", []byte("b")), "no error putting object")
+	suite.Nil(backend.PutObject("a.tgz", []byte("a")), "no error putting object")
+	objects, err := backend.ListObjects()
+	suite.Nil(err, "no error listing objects")
+	suite.Len(objects, 2, "objects listed")
+	suite.Equal("a.tgz", objects[0].Path, "objects listed in path order")
+	suite.Empty(objects[0].Content, "listed objects have no content")
+
+	object, err := backend.GetObject("b.tgz")
+	suite.Nil(err, "no error getting object")
+	suite.Equal([]byte("b"), object.Content, "object content")
+	_, err = backend.GetObject("c.tgz")
+	suite.Equal(ErrObjectNotFound, err, "error getting missing object")
+
+	backend.Unlist("b.tgz")
+	objects, _ = backend.ListObjects()
+	suite.Len(objects, 1, "unlisted object left out")
+	_, err = backend.GetObject("b.tgz")
+	suite.Nil(err, "unlisted object can still be retrieved")
+	backend.Relist("b.tgz")
+	objects, _ = backend.ListObjects()
+	suite.Len(objects, 2, "relisted object listed")
+
+	backend.SetListing([]storage.Object{{Path: "z.tgz"}})
+	objects, _ = backend.ListObjects()
+	suite.Equal([]storage.Object{{Path: "z.tgz"}}, objects, "programmed listing")
+	backend.SetListing(nil)
+
+	failure := errors.New("boom")
+	backend.FailOperation(storage.OperationPut, failure)
+	suite.Equal(failure, backend.PutObject("c.tgz", []byte("c")), "put fails")
+	backend.FailOperation(storage.OperationPut, nil)
+	suite.Nil(backend.PutObject("c.tgz", []byte("c")), "put succeeds again")
+	suite.Equal(4, backend.Calls(storage.OperationPut), "put calls counted")
+
+	suite.Nil(backend.DeleteObject("c.tgz"), "no error deleting object")
+	suite.Equal(ErrObjectNotFound, backend.DeleteObject("c.tgz"), "error deleting missing object")
+}
+
+func (suite *ChartMuseumTestTestSuite) TestChartPackage() {
+	content := ChartPackage("mychart", "0.2.0", map[string]string{"values.yaml": "replicas: 1\n"})
+	filename, err := repo.ChartPackageFilenameFromContent(content)
+	suite.Nil(err, "no error reading chart package")
+	suite.Equal("mychart-0.2.0.tgz", filename, "chart package filename")
+
+	chartVersion, err := repo.ChartVersionFromStorageObject(storage.Object{Path: filename, Content: content})
+	suite.Nil(err, "no error reading chart version")
+	suite.Equal("A Helm chart for testing", chartVersion.Description, "generated Chart.yaml")
+
+	content = ChartPackage("mychart", "0.2.0", map[string]string{"Chart.yaml": "name: mychart\nversion: 0.2.0\ndescription: custom\n"})
+	chartVersion, err = repo.ChartVersionFromStorageObject(storage.Object{Path: filename, Content: content})
+	suite.Nil(err, "no error reading chart version")
+	suite.Equal("custom", chartVersion.Description, "given Chart.yaml")
+}
+
+func (suite *ChartMuseumTestTestSuite) TestProvenanceFile() {
+	content := ProvenanceFile("mychart", "0.2.0", ChartPackage("mychart", "0.2.0", nil))
+	filename, err := repo.ProvenanceFilenameFromContent(content)
+	suite.Nil(err, "no error reading provenance file")
+	suite.Equal("mychart-0.2.0.tgz.prov", filename, "provenance filename")
+}
+
+func TestChartMuseumTestTestSuite(t *testing.T) {
+	suite.Run(t, new(ChartMuseumTestTestSuite))
+}
@@ -0,0 +1,66 @@
+package chartmuseumtest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	pathutil "path"
+	"sort"
+
+	"github.com/kubernetes-helm/chartmuseum/pkg/repo"
+)
+
+// ChartPackage returns a chart package (.tgz) of a chart with the given name and version. Its
+// Chart.yaml is generated unless given in files, which are paths relative to the chart directory
+// (e.g. "values.yaml" or "templates/deployment.yaml") and their content.
+func ChartPackage(name string, version string, files map[string]string) []byte {
+	all := map[string]string{
+		"Chart.yaml": fmt.Sprintf("apiVersion: v1\nname: %s\nversion: %s\ndescription: A Helm chart for testing\n", name, version),
+	}
+	for path, content := range files {
+		all[path] = content
+	}
+	paths := []string{}
+	for path := range all {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	buf := bytes.NewBuffer(nil)
+	gzw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gzw)
+	for _, path := range paths {
+		content := all[path]
+		tw.WriteHeader(&tar.Header{Name: pathutil.Join(name, path), Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gzw.Close()
+	return buf.Bytes()
+}
+
+// ProvenanceFile returns a provenance file for a chart package built by ChartPackage, with the
+// digest of the package. Its signature is a placeholder: it is accepted by uploads, but can't be
+// verified (e.g. with `helm verify`).
+func ProvenanceFile(name string, version string, pkg []byte) []byte {
+	digest := sha256.Sum256(pkg)
+	return []byte(fmt.Sprintf(`-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA512
+
+name: %s
+version: %s
+description: A Helm chart for testing
+apiVersion: v1
+
+...
+files:
+  %s: sha256:%s
+-----BEGIN PGP SIGNATURE-----
+
+placeholder
+-----END PGP SIGNATURE-----
+`, name, version, repo.ChartPackageFilenameFromNameVersion(name, version), hex.EncodeToString(digest[:])))
+}
@@ -0,0 +1,4 @@
+// Package chartmuseumtest provides helpers for testing programs embedding ChartMuseum: an in-memory
+// storage backend whose listings and failures can be programmed, and sample chart packages and
+// provenance files built on the fly.
+package chartmuseumtest
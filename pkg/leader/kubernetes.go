@@ -0,0 +1,225 @@
+package leader
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	pathutil "path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrorNotInCluster is raised when in-cluster Kubernetes configuration cannot be found
+	ErrorNotInCluster = errors.New("unable to load in-cluster configuration, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be defined")
+
+	serviceAccountDirectory = "/var/run/secrets/kubernetes.io/serviceaccount"
+	microTimeFormat         = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+type (
+	// KubernetesLeaseElector is a leader elector using a coordination.k8s.io/v1 Lease object
+	KubernetesLeaseElector struct {
+		APIServer     string
+		TokenFile     string
+		Client        *http.Client
+		Namespace     string
+		Name          string
+		Identity      string
+		LeaseDuration time.Duration
+	}
+
+	lease struct {
+		APIVersion string        `json:"apiVersion"`
+		Kind       string        `json:"kind"`
+		Metadata   leaseMetadata `json:"metadata"`
+		Spec       leaseSpec     `json:"spec"`
+	}
+
+	leaseMetadata struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	}
+
+	leaseSpec struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+	}
+)
+
+// NewKubernetesLeaseElector creates a new instance of KubernetesLeaseElector using in-cluster
+// configuration (service account token and CA). If namespace is empty, the namespace of the
+// service account is used. If identity is empty, the hostname (pod name) is used.
+func NewKubernetesLeaseElector(namespace string, name string, identity string, leaseDuration time.Duration) (*KubernetesLeaseElector, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, ErrorNotInCluster
+	}
+
+	ca, err := ioutil.ReadFile(pathutil.Join(serviceAccountDirectory, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	if namespace == "" {
+		content, err := ioutil.ReadFile(pathutil.Join(serviceAccountDirectory, "namespace"))
+		if err != nil {
+			return nil, err
+		}
+		namespace = strings.TrimSpace(string(content))
+	}
+
+	if identity == "" {
+		identity, err = os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	e := &KubernetesLeaseElector{
+		APIServer: fmt.Sprintf("https://%s", net.JoinHostPort(host, port)),
+		TokenFile: pathutil.Join(serviceAccountDirectory, "token"),
+		Client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		Namespace:     namespace,
+		Name:          name,
+		Identity:      identity,
+		LeaseDuration: leaseDuration,
+	}
+	return e, nil
+}
+
+// RetryPeriod is a third of the lease duration, leaving room for a couple of failed renewals
+func (e KubernetesLeaseElector) RetryPeriod() time.Duration {
+	return e.LeaseDuration / 3
+}
+
+// TryAcquireOrRenew creates or updates the Lease object, returning true if this instance holds it
+func (e KubernetesLeaseElector) TryAcquireOrRenew() (bool, error) {
+	now := time.Now()
+
+	current, status, err := e.getLease()
+	if err != nil {
+		return false, err
+	}
+
+	if status == http.StatusNotFound {
+		l := lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   leaseMetadata{Name: e.Name, Namespace: e.Namespace},
+			Spec: leaseSpec{
+				HolderIdentity:       e.Identity,
+				LeaseDurationSeconds: int(e.LeaseDuration.Seconds()),
+				AcquireTime:          now.UTC().Format(microTimeFormat),
+				RenewTime:            now.UTC().Format(microTimeFormat),
+			},
+		}
+		return e.writeLease("POST", e.leasesURL(), l, http.StatusCreated)
+	}
+
+	if current.Spec.HolderIdentity != e.Identity {
+		if current.Spec.HolderIdentity != "" && !leaseExpired(current.Spec, now) {
+			return false, nil
+		}
+		current.Spec.AcquireTime = now.UTC().Format(microTimeFormat)
+		current.Spec.LeaseTransitions++
+	}
+	current.Spec.HolderIdentity = e.Identity
+	current.Spec.LeaseDurationSeconds = int(e.LeaseDuration.Seconds())
+	current.Spec.RenewTime = now.UTC().Format(microTimeFormat)
+
+	// resourceVersion is kept from the GET, so a concurrent update results in a 409
+	return e.writeLease("PUT", e.leaseURL(), current, http.StatusOK)
+}
+
+func leaseExpired(spec leaseSpec, now time.Time) bool {
+	renewTime, err := time.Parse(time.RFC3339Nano, spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	duration := time.Duration(spec.LeaseDurationSeconds) * time.Second
+	return now.After(renewTime.Add(duration))
+}
+
+func (e KubernetesLeaseElector) leasesURL() string {
+	return fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", e.APIServer, e.Namespace)
+}
+
+func (e KubernetesLeaseElector) leaseURL() string {
+	return fmt.Sprintf("%s/%s", e.leasesURL(), e.Name)
+}
+
+func (e KubernetesLeaseElector) getLease() (lease, int, error) {
+	var l lease
+	res, err := e.do("GET", e.leaseURL(), nil)
+	if err != nil {
+		return l, 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return l, res.StatusCode, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return l, res.StatusCode, fmt.Errorf("unexpected status getting lease %s/%s: %d", e.Namespace, e.Name, res.StatusCode)
+	}
+	err = json.NewDecoder(res.Body).Decode(&l)
+	return l, res.StatusCode, err
+}
+
+func (e KubernetesLeaseElector) writeLease(method string, url string, l lease, expectedStatus int) (bool, error) {
+	content, err := json.Marshal(l)
+	if err != nil {
+		return false, err
+	}
+	res, err := e.do(method, url, content)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case expectedStatus:
+		return true, nil
+	case http.StatusConflict:
+		// someone else created or updated the lease first
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected status writing lease %s/%s: %d", e.Namespace, e.Name, res.StatusCode)
+	}
+}
+
+func (e KubernetesLeaseElector) do(method string, url string, content []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(content))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if e.TokenFile != "" {
+		token, err := ioutil.ReadFile(e.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", strings.TrimSpace(string(token))))
+	}
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,127 @@
+package leader
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeLeaseAPI emulates the subset of the Kubernetes API used for a single Lease object
+type fakeLeaseAPI struct {
+	lease   *lease
+	version int
+	lock    sync.Mutex
+}
+
+func (api *fakeLeaseAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	switch r.Method {
+	case "GET":
+		if api.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(api.lease)
+	case "POST":
+		if api.lease != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		api.store(w, r, http.StatusCreated)
+	case "PUT":
+		api.store(w, r, http.StatusOK)
+	}
+}
+
+func (api *fakeLeaseAPI) store(w http.ResponseWriter, r *http.Request, status int) {
+	var l lease
+	json.NewDecoder(r.Body).Decode(&l)
+	if api.lease != nil && l.Metadata.ResourceVersion != api.lease.Metadata.ResourceVersion {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	api.version++
+	l.Metadata.ResourceVersion = strconv.Itoa(api.version)
+	api.lease = &l
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(api.lease)
+}
+
+type KubernetesTestSuite struct {
+	suite.Suite
+	API    *fakeLeaseAPI
+	Server *httptest.Server
+	A      *KubernetesLeaseElector
+	B      *KubernetesLeaseElector
+}
+
+func (suite *KubernetesTestSuite) SetupSuite() {
+	suite.API = &fakeLeaseAPI{}
+	suite.Server = httptest.NewServer(suite.API)
+	newElector := func(identity string) *KubernetesLeaseElector {
+		return &KubernetesLeaseElector{
+			APIServer:     suite.Server.URL,
+			Namespace:     "default",
+			Name:          "chartmuseum",
+			Identity:      identity,
+			LeaseDuration: 15 * time.Second,
+		}
+	}
+	suite.A = newElector("a")
+	suite.B = newElector("b")
+}
+
+func (suite *KubernetesTestSuite) TearDownSuite() {
+	suite.Server.Close()
+}
+
+func (suite *KubernetesTestSuite) TestTryAcquireOrRenew() {
+	leader, err := suite.A.TryAcquireOrRenew()
+	suite.Nil(err, "no error acquiring new lease")
+	suite.True(leader, "a is leader after creating lease")
+
+	leader, err = suite.B.TryAcquireOrRenew()
+	suite.Nil(err, "no error trying to acquire held lease")
+	suite.False(leader, "b is not leader while lease held by a")
+
+	leader, err = suite.A.TryAcquireOrRenew()
+	suite.Nil(err, "no error renewing lease")
+	suite.True(leader, "a is still leader after renewing lease")
+
+	// let the lease held by a expire
+	suite.API.lock.Lock()
+	suite.API.lease.Spec.RenewTime = time.Now().Add(-1 * time.Minute).UTC().Format(microTimeFormat)
+	suite.API.lock.Unlock()
+
+	leader, err = suite.B.TryAcquireOrRenew()
+	suite.Nil(err, "no error acquiring expired lease")
+	suite.True(leader, "b is leader after lease held by a expired")
+	suite.Equal(1, suite.API.lease.Spec.LeaseTransitions, "lease transition recorded")
+
+	leader, err = suite.A.TryAcquireOrRenew()
+	suite.Nil(err, "no error trying to acquire lease held by b")
+	suite.False(leader, "a is no longer leader")
+
+	suite.Equal(5*time.Second, suite.A.RetryPeriod(), "retry period is a third of lease duration")
+}
+
+func (suite *KubernetesTestSuite) TestNewKubernetesLeaseElector() {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return
+	}
+	_, err := NewKubernetesLeaseElector("", "chartmuseum", "", 15*time.Second)
+	suite.Equal(ErrorNotInCluster, err, "error creating elector outside of a cluster")
+}
+
+func TestKubernetesTestSuite(t *testing.T) {
+	suite.Run(t, new(KubernetesTestSuite))
+}
@@ -0,0 +1,16 @@
+package leader
+
+import (
+	"time"
+)
+
+type (
+	// Elector is a generic interface for leader election mechanisms, used to make sure
+	// background jobs only run on a single instance when several are deployed
+	Elector interface {
+		// TryAcquireOrRenew attempts to become leader, or to remain leader if already elected
+		TryAcquireOrRenew() (bool, error)
+		// RetryPeriod is how often TryAcquireOrRenew should be called
+		RetryPeriod() time.Duration
+	}
+)
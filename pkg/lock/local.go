@@ -0,0 +1,39 @@
+package lock
+
+import (
+	"sync"
+)
+
+// LocalLocker is a locker kept in process memory (not shared between instances)
+type LocalLocker struct {
+	held map[string]bool
+	lock *sync.Mutex
+}
+
+// NewLocalLocker creates a new instance of LocalLocker
+func NewLocalLocker() *LocalLocker {
+	l := &LocalLocker{
+		held: map[string]bool{},
+		lock: &sync.Mutex{},
+	}
+	return l
+}
+
+// TryLock acquires the named lock if it is not already held
+func (l LocalLocker) TryLock(key string) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.held[key] {
+		return false, nil
+	}
+	l.held[key] = true
+	return true, nil
+}
+
+// Unlock releases the named lock
+func (l LocalLocker) Unlock(key string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.held, key)
+	return nil
+}
@@ -0,0 +1,13 @@
+package lock
+
+type (
+	// Locker is a generic interface for named locks, which may be shared between
+	// multiple ChartMuseum instances
+	Locker interface {
+		// TryLock attempts to acquire the named lock without blocking,
+		// returning false if it is already held
+		TryLock(key string) (bool, error)
+		// Unlock releases the named lock
+		Unlock(key string) error
+	}
+)
@@ -0,0 +1,62 @@
+package lock
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LockTestSuite struct {
+	suite.Suite
+	Lockers map[string]Locker
+	Prefix  string
+}
+
+func (suite *LockTestSuite) SetupSuite() {
+	suite.Prefix = fmt.Sprintf("unittest/%s", time.Now().Format("20060102150405"))
+	suite.Lockers = make(map[string]Locker)
+	suite.Lockers["Local"] = Locker(NewLocalLocker())
+
+	if addr := os.Getenv("TEST_CACHE_REDIS_ADDR"); addr != "" {
+		suite.Lockers["Redis"] = Locker(NewRedisLocker(addr, "", 0, time.Minute))
+	}
+}
+
+func (suite *LockTestSuite) TestTryLockUnlock() {
+	for key, locker := range suite.Lockers {
+		k := fmt.Sprintf("%s/mychart-0.1.0.tgz", suite.Prefix)
+
+		locked, err := locker.TryLock(k)
+		message := fmt.Sprintf("no error acquiring lock using %s locker", key)
+		suite.Nil(err, message)
+		message = fmt.Sprintf("lock acquired using %s locker", key)
+		suite.True(locked, message)
+
+		locked, err = locker.TryLock(k)
+		message = fmt.Sprintf("no error acquiring held lock using %s locker", key)
+		suite.Nil(err, message)
+		message = fmt.Sprintf("held lock not acquired using %s locker", key)
+		suite.False(locked, message)
+
+		err = locker.Unlock(k)
+		message = fmt.Sprintf("no error releasing lock using %s locker", key)
+		suite.Nil(err, message)
+
+		locked, err = locker.TryLock(k)
+		message = fmt.Sprintf("no error acquiring released lock using %s locker", key)
+		suite.Nil(err, message)
+		message = fmt.Sprintf("released lock acquired using %s locker", key)
+		suite.True(locked, message)
+
+		err = locker.Unlock(k)
+		message = fmt.Sprintf("no error releasing lock again using %s locker", key)
+		suite.Nil(err, message)
+	}
+}
+
+func TestLockTestSuite(t *testing.T) {
+	suite.Run(t, new(LockTestSuite))
+}
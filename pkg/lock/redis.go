@@ -0,0 +1,84 @@
+package lock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	// only delete the key if it still holds our token, so that a lock which
+	// expired and was acquired by another instance is not released by mistake
+	redisUnlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+)
+
+// RedisLocker is a locker backed by Redis, shared between all instances using the same server
+type RedisLocker struct {
+	Client *redis.Client
+	TTL    time.Duration
+	tokens map[string]string
+	lock   *sync.Mutex
+}
+
+// NewRedisLocker creates a new instance of RedisLocker. Locks expire after ttl in case
+// the instance holding them goes away.
+func NewRedisLocker(addr string, password string, db int, ttl time.Duration) *RedisLocker {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+	l := &RedisLocker{
+		Client: client,
+		TTL:    ttl,
+		tokens: map[string]string{},
+		lock:   &sync.Mutex{},
+	}
+	return l
+}
+
+// TryLock acquires the named lock if it is not already held by any instance
+func (l RedisLocker) TryLock(key string) (bool, error) {
+	token, err := randomToken()
+	if err != nil {
+		return false, err
+	}
+	locked, err := l.Client.SetNX(redisLockKey(key), token, l.TTL).Result()
+	if err != nil || !locked {
+		return false, err
+	}
+	l.lock.Lock()
+	l.tokens[key] = token
+	l.lock.Unlock()
+	return true, nil
+}
+
+// Unlock releases the named lock
+func (l RedisLocker) Unlock(key string) error {
+	l.lock.Lock()
+	token, ok := l.tokens[key]
+	delete(l.tokens, key)
+	l.lock.Unlock()
+	if !ok {
+		return nil
+	}
+	err := l.Client.Eval(redisUnlockScript, []string{redisLockKey(key)}, token).Err()
+	return err
+}
+
+func redisLockKey(key string) string {
+	return fmt.Sprintf("chartmuseum/lock/%s", key)
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,198 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// v2Signature starts every version 2 (binary) header
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	// v1MaxLength is the maximum length of a version 1 (text) header, including CRLF
+	v1MaxLength = 107
+
+	// ErrNoProxyHeader is returned when a connection does not start with a PROXY protocol header
+	ErrNoProxyHeader = errors.New("connection does not start with a PROXY protocol header")
+)
+
+type (
+	// Listener wraps a net.Listener, reading a PROXY protocol (version 1 or 2) header from the start
+	// of every accepted connection. The source address from the header is returned as the
+	// connection's RemoteAddr.
+	Listener struct {
+		Listener          net.Listener
+		ReadHeaderTimeout time.Duration
+	}
+
+	// Conn is a connection accepted by Listener. The header is read on the first call to Read or RemoteAddr.
+	Conn struct {
+		net.Conn
+		reader            *bufio.Reader
+		readHeaderTimeout time.Duration
+		once              sync.Once
+		remoteAddr        net.Addr
+		err               error
+	}
+)
+
+// NewListener creates a new instance of Listener
+func NewListener(listener net.Listener, readHeaderTimeout time.Duration) *Listener {
+	l := &Listener{
+		Listener:          listener,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	return l
+}
+
+// Accept waits for and returns the next connection
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{
+		Conn:              conn,
+		reader:            bufio.NewReader(conn),
+		readHeaderTimeout: l.ReadHeaderTimeout,
+	}
+	return c, nil
+}
+
+// Close closes the underlying listener
+func (l *Listener) Close() error {
+	return l.Listener.Close()
+}
+
+// Addr returns the address of the underlying listener
+func (l *Listener) Addr() net.Addr {
+	return l.Listener.Addr()
+}
+
+// Read reads data from the connection, after the PROXY protocol header
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the source address from the PROXY protocol header, or the address of
+// the proxy itself for health checks sent by the proxy (LOCAL/UNKNOWN)
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) readHeader() {
+	if c.readHeaderTimeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.readHeaderTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+	}
+	c.remoteAddr, c.err = readHeader(c.reader)
+	if c.err != nil {
+		c.Conn.Close()
+	}
+}
+
+// readHeader reads a version 1 or 2 header from r, returning the source address it contains
+// (nil for LOCAL/UNKNOWN connections)
+func readHeader(r *bufio.Reader) (net.Addr, error) {
+	signature, err := r.Peek(len(v2Signature))
+	if err == nil && bytes.Equal(signature, v2Signature) {
+		return readV2Header(r)
+	}
+	prefix, err := r.Peek(6)
+	if err == nil && string(prefix) == "PROXY " {
+		return readV1Header(r)
+	}
+	return nil, ErrNoProxyHeader
+}
+
+// readV1Header reads a header such as "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+func readV1Header(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("PROXY protocol header too long")
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY protocol header: %q", strings.TrimSpace(string(line)))
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid PROXY protocol header: %q", strings.TrimSpace(string(line)))
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readV2Header reads a binary header, see https://www.haproxy.org/download/1.8/doc/proxy-protocol.txt
+func readV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+	versionCommand := header[12]
+	family := header[13]
+	length := binary.BigEndian.Uint16(header[14:16])
+	addresses := make([]byte, length)
+	_, err = io.ReadFull(r, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	if versionCommand>>4 != 2 {
+		return nil, errors.New("unsupported PROXY protocol version")
+	}
+	switch versionCommand & 0x0f {
+	case 0x0: // LOCAL
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, errors.New("unsupported PROXY protocol command")
+	}
+
+	switch family >> 4 {
+	case 0x1: // AF_INET
+		if length < 12 {
+			return nil, errors.New("invalid PROXY protocol address length")
+		}
+		return &net.TCPAddr{IP: net.IP(addresses[0:4]), Port: int(binary.BigEndian.Uint16(addresses[8:10]))}, nil
+	case 0x2: // AF_INET6
+		if length < 36 {
+			return nil, errors.New("invalid PROXY protocol address length")
+		}
+		return &net.TCPAddr{IP: net.IP(addresses[0:16]), Port: int(binary.BigEndian.Uint16(addresses[32:34]))}, nil
+	}
+	// AF_UNSPEC or AF_UNIX, keep the address of the proxy
+	return nil, nil
+}
@@ -0,0 +1,84 @@
+package proxyproto
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ProxyProtoTestSuite struct {
+	suite.Suite
+	Listener *Listener
+}
+
+func (suite *ProxyProtoTestSuite) SetupSuite() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Nil(err, "no error listening")
+	suite.Listener = NewListener(listener, time.Second)
+}
+
+func (suite *ProxyProtoTestSuite) TearDownSuite() {
+	suite.Listener.Close()
+}
+
+// roundTrip sends data over a new connection, returning the accepted connection's remote address and
+// everything read from it
+func (suite *ProxyProtoTestSuite) roundTrip(data []byte) (net.Addr, string, error) {
+	client, err := net.Dial("tcp", suite.Listener.Addr().String())
+	suite.Nil(err, "no error dialing")
+	client.Write(data)
+	client.Close()
+
+	conn, err := suite.Listener.Accept()
+	suite.Nil(err, "no error accepting")
+	defer conn.Close()
+	remoteAddr := conn.RemoteAddr()
+	content, err := ioutil.ReadAll(conn)
+	return remoteAddr, string(content), err
+}
+
+func (suite *ProxyProtoTestSuite) TestV1() {
+	addr, content, err := suite.roundTrip([]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nhello"))
+	suite.Nil(err, "no error reading v1 connection")
+	suite.Equal("192.168.0.1:56324", addr.String(), "source address from v1 header")
+	suite.Equal("hello", content, "content after v1 header")
+
+	addr, _, err = suite.roundTrip([]byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"))
+	suite.Nil(err, "no error reading v1 TCP6 connection")
+	suite.Equal("[2001:db8::1]:56324", addr.String(), "source address from v1 TCP6 header")
+
+	addr, _, err = suite.roundTrip([]byte("PROXY UNKNOWN\r\n"))
+	suite.Nil(err, "no error reading v1 UNKNOWN connection")
+	suite.Equal("127.0.0.1", addr.(*net.TCPAddr).IP.String(), "proxy address kept for v1 UNKNOWN")
+
+	_, _, err = suite.roundTrip([]byte("PROXY TCP4 nonsense\r\n"))
+	suite.NotNil(err, "error reading invalid v1 header")
+}
+
+func (suite *ProxyProtoTestSuite) TestV2() {
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x21, 0x11, 0x00, 0x0c) // PROXY, TCP over IPv4, 12 bytes of addresses
+	header = append(header, 10, 1, 2, 3, 10, 1, 2, 4, 0xdc, 0x04, 0x01, 0xbb)
+	addr, content, err := suite.roundTrip(append(header, []byte("hello")...))
+	suite.Nil(err, "no error reading v2 connection")
+	suite.Equal("10.1.2.3:56324", addr.String(), "source address from v2 header")
+	suite.Equal("hello", content, "content after v2 header")
+
+	header = append([]byte{}, v2Signature...)
+	header = append(header, 0x20, 0x00, 0x00, 0x00) // LOCAL
+	addr, _, err = suite.roundTrip(header)
+	suite.Nil(err, "no error reading v2 LOCAL connection")
+	suite.Equal("127.0.0.1", addr.(*net.TCPAddr).IP.String(), "proxy address kept for v2 LOCAL")
+}
+
+func (suite *ProxyProtoTestSuite) TestNoHeader() {
+	_, _, err := suite.roundTrip([]byte("GET / HTTP/1.1\r\n\r\n"))
+	suite.Equal(ErrNoProxyHeader, err, "error reading connection without header")
+}
+
+func TestProxyProtoTestSuite(t *testing.T) {
+	suite.Run(t, new(ProxyProtoTestSuite))
+}
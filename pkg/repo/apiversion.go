@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	helm_chart "k8s.io/helm/pkg/proto/hapi/chart"
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+var (
+	// ChartAPIVersionV1 is the apiVersion of Helm 2 charts (also assumed if apiVersion is not set)
+	ChartAPIVersionV1 = "v1"
+
+	// ChartAPIVersionV2 is the apiVersion of Helm 3 charts, which may list dependencies in Chart.yaml and have a type
+	ChartAPIVersionV2 = "v2"
+
+	// ChartTypeApplication is the type of charts which can be installed (all apiVersion v1 charts)
+	ChartTypeApplication = "application"
+
+	// ChartTypeLibrary is the type of apiVersion v2 charts which only provide templates to other charts
+	ChartTypeLibrary = "library"
+
+	// ChartTypeAnnotation records the type of apiVersion v2 charts in their index entry, since
+	// index entries are made of Helm 2 chart metadata, which has no type
+	ChartTypeAnnotation = "chartmuseum.io/type"
+)
+
+// chartV2Metadata holds the fields of Chart.yaml which are missing from Helm 2 chart metadata
+type chartV2Metadata struct {
+	Type string `json:"type"`
+}
+
+// annotateChartType checks that the apiVersion and type of a chart are known, and records the
+// type of apiVersion v2 charts as the ChartTypeAnnotation of metadata
+func annotateChartType(metadata *helm_chart.Metadata, content []byte) error {
+	switch metadata.ApiVersion {
+	case "", ChartAPIVersionV1:
+		return nil
+	case ChartAPIVersionV2:
+	default:
+		return fmt.Errorf("unsupported chart apiVersion %q", metadata.ApiVersion)
+	}
+	archive, err := readChartArchive(content, ChartMetadataFileName)
+	if err != nil {
+		return ErrorInvalidChartPackage
+	}
+	var parsed chartV2Metadata
+	err = yaml.Unmarshal(archive.files[ChartMetadataFileName], &parsed)
+	if err != nil {
+		return ErrorInvalidChartPackage
+	}
+	switch parsed.Type {
+	case "":
+		parsed.Type = ChartTypeApplication
+	case ChartTypeApplication, ChartTypeLibrary:
+	default:
+		return fmt.Errorf("unsupported chart type %q", parsed.Type)
+	}
+	if metadata.Annotations == nil {
+		metadata.Annotations = map[string]string{}
+	}
+	metadata.Annotations[ChartTypeAnnotation] = parsed.Type
+	return nil
+}
+
+// ChartVersionType returns the type of a chart version, ChartTypeApplication or ChartTypeLibrary
+func ChartVersionType(chartVersion *helm_repo.ChartVersion) string {
+	if chartType, ok := chartVersion.Annotations[ChartTypeAnnotation]; ok {
+		return chartType
+	}
+	return ChartTypeApplication
+}
+
+// FilterChartVersionsByType returns the chart versions of the given type
+func FilterChartVersionsByType(chartVersions helm_repo.ChartVersions, chartType string) helm_repo.ChartVersions {
+	filtered := helm_repo.ChartVersions{}
+	for _, chartVersion := range chartVersions {
+		if ChartVersionType(chartVersion) == chartType {
+			filtered = append(filtered, chartVersion)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,113 @@
+package repo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var (
+	// AttestationContentType is the http content-type header for attestations
+	AttestationContentType = "application/json"
+
+	// ErrorInvalidAttestation is raised when an attestation is not a JSON object
+	ErrorInvalidAttestation = errors.New("invalid attestation, expected a JSON object (such as an in-toto statement or a DSSE envelope)")
+
+	// ErrorAttestationSubjectMismatch is raised when an in-toto statement is not about the chart package it is attached to
+	ErrorAttestationSubjectMismatch = errors.New("attestation subjects don't include the chart package")
+
+	// inTotoStatementTypePrefix prefixes the _type of all versions of in-toto statements
+	inTotoStatementTypePrefix = "https://in-toto.io/Statement/"
+
+	// inTotoPayloadType is the payload type of DSSE envelopes holding an in-toto statement
+	inTotoPayloadType = "application/vnd.in-toto+json"
+)
+
+type (
+	// Attestation describes supply-chain metadata about a chart package, such as build provenance or
+	// scan results. In-toto statements (bare, in a DSSE envelope or in a sigstore bundle) name the
+	// artifacts they are about and the type of their predicate; any other JSON document is kept as is.
+	Attestation struct {
+		PredicateType string
+		Subjects      []AttestationSubject
+	}
+
+	// AttestationSubject is an artifact an in-toto statement is about
+	AttestationSubject struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	}
+
+	inTotoStatement struct {
+		Type          string               `json:"_type"`
+		PredicateType string               `json:"predicateType"`
+		Subject       []AttestationSubject `json:"subject"`
+	}
+
+	dsseEnvelope struct {
+		PayloadType string `json:"payloadType"`
+		Payload     string `json:"payload"`
+	}
+
+	sigstoreBundle struct {
+		DSSEEnvelope *dsseEnvelope `json:"dsseEnvelope"`
+	}
+)
+
+// ParseAttestation parses an attestation, which must be a JSON object
+func ParseAttestation(content []byte) (*Attestation, error) {
+	var document map[string]json.RawMessage
+	err := json.Unmarshal(content, &document)
+	if err != nil || document == nil {
+		return nil, ErrorInvalidAttestation
+	}
+
+	var bundle sigstoreBundle
+	if _, ok := document["dsseEnvelope"]; ok && json.Unmarshal(content, &bundle) == nil && bundle.DSSEEnvelope != nil {
+		return parseDSSEEnvelope(bundle.DSSEEnvelope)
+	}
+	if _, ok := document["payloadType"]; ok {
+		var envelope dsseEnvelope
+		if json.Unmarshal(content, &envelope) == nil {
+			return parseDSSEEnvelope(&envelope)
+		}
+	}
+	var statement inTotoStatement
+	if json.Unmarshal(content, &statement) == nil && strings.HasPrefix(statement.Type, inTotoStatementTypePrefix) {
+		return &Attestation{PredicateType: statement.PredicateType, Subjects: statement.Subject}, nil
+	}
+	return &Attestation{}, nil
+}
+
+// parseDSSEEnvelope parses the in-toto statement in a DSSE envelope. Envelopes of other payloads
+// are kept as is, and signatures are not verified.
+func parseDSSEEnvelope(envelope *dsseEnvelope) (*Attestation, error) {
+	if envelope.PayloadType != inTotoPayloadType {
+		return &Attestation{}, nil
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, ErrorInvalidAttestation
+	}
+	var statement inTotoStatement
+	err = json.Unmarshal(payload, &statement)
+	if err != nil {
+		return nil, ErrorInvalidAttestation
+	}
+	return &Attestation{PredicateType: statement.PredicateType, Subjects: statement.Subject}, nil
+}
+
+// CheckSubject checks that the attestation is about the chart package with a sha256 digest, if it
+// names the artifacts it is about
+func (attestation *Attestation) CheckSubject(digest string) error {
+	if len(attestation.Subjects) == 0 {
+		return nil
+	}
+	for _, subject := range attestation.Subjects {
+		if subject.Digest["sha256"] == digest {
+			return nil
+		}
+	}
+	return ErrorAttestationSubjectMismatch
+}
@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AttestationTestSuite struct {
+	suite.Suite
+}
+
+func (suite *AttestationTestSuite) TestParseAttestation() {
+	statement := `{"_type": "https://in-toto.io/Statement/v1", "predicateType": "https://slsa.dev/provenance/v1", "subject": [{"name": "mychart-0.1.0.tgz", "digest": {"sha256": "abc"}}], "predicate": {}}`
+
+	attestation, err := ParseAttestation([]byte(statement))
+	suite.Nil(err, "no error parsing in-toto statement")
+	suite.Equal("https://slsa.dev/provenance/v1", attestation.PredicateType, "predicate type of statement")
+	suite.Nil(attestation.CheckSubject("abc"), "statement about chart package")
+	suite.Equal(ErrorAttestationSubjectMismatch, attestation.CheckSubject("def"), "statement about other artifact")
+
+	envelope := `{"payloadType": "application/vnd.in-toto+json", "payload": "` + base64.StdEncoding.EncodeToString([]byte(statement)) + `", "signatures": []}`
+	attestation, err = ParseAttestation([]byte(envelope))
+	suite.Nil(err, "no error parsing DSSE envelope")
+	suite.Equal("https://slsa.dev/provenance/v1", attestation.PredicateType, "predicate type of statement in envelope")
+	suite.Len(attestation.Subjects, 1, "subjects of statement in envelope")
+
+	attestation, err = ParseAttestation([]byte(`{"mediaType": "application/vnd.dev.sigstore.bundle+json;version=0.2", "dsseEnvelope": ` + envelope + `}`))
+	suite.Nil(err, "no error parsing sigstore bundle")
+	suite.Equal("https://slsa.dev/provenance/v1", attestation.PredicateType, "predicate type of statement in bundle")
+
+	attestation, err = ParseAttestation([]byte(`{"SchemaVersion": 2, "Results": []}`))
+	suite.Nil(err, "no error parsing other JSON document")
+	suite.Equal("", attestation.PredicateType, "no predicate type for other JSON document")
+	suite.Nil(attestation.CheckSubject("def"), "other JSON document not checked against chart package")
+
+	_, err = ParseAttestation([]byte(`{"payloadType": "application/vnd.in-toto+json", "payload": "not base64!"}`))
+	suite.Equal(ErrorInvalidAttestation, err, "ErrorInvalidAttestation from envelope with bad payload")
+	for _, content := range []string{"not json", "[]", "null", `"string"`} {
+		_, err = ParseAttestation([]byte(content))
+		suite.Equal(ErrorInvalidAttestation, err, "ErrorInvalidAttestation from %s", content)
+	}
+}
+
+func TestAttestationTestSuite(t *testing.T) {
+	suite.Run(t, new(AttestationTestSuite))
+}
@@ -0,0 +1,151 @@
+package repo
+
+import (
+	"sort"
+	"strings"
+
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+// KeywordCount is a keyword of charts in the index, with the number of charts having it
+type KeywordCount struct {
+	Keyword string `json:"keyword"`
+	Charts  int    `json:"charts"`
+}
+
+// MaintainerCount is a maintainer of charts in the index, with the number of charts they maintain
+type MaintainerCount struct {
+	Name   string `json:"name"`
+	Email  string `json:"email,omitempty"`
+	Charts int    `json:"charts"`
+}
+
+// Keywords aggregates the (lowercased) keywords of the latest version of each chart, sorted by
+// number of charts, then keyword
+func (index *Index) Keywords() []KeywordCount {
+	counts := map[string]int{}
+	for _, name := range index.chartNames() {
+		chartVersions := index.Entries[name]
+		if len(chartVersions) == 0 {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, keyword := range chartVersions[0].Keywords {
+			keyword = strings.ToLower(strings.TrimSpace(keyword))
+			if keyword == "" || seen[keyword] {
+				continue
+			}
+			seen[keyword] = true
+			counts[keyword]++
+		}
+	}
+	keywords := []KeywordCount{}
+	for keyword, count := range counts {
+		keywords = append(keywords, KeywordCount{Keyword: keyword, Charts: count})
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		if keywords[i].Charts != keywords[j].Charts {
+			return keywords[i].Charts > keywords[j].Charts
+		}
+		return keywords[i].Keyword < keywords[j].Keyword
+	})
+	return keywords
+}
+
+// Maintainers aggregates the maintainers of the latest version of each chart, identified by email
+// (or name, if they have none) and named as in the first chart listing them, sorted by number of
+// charts, then name
+func (index *Index) Maintainers() []MaintainerCount {
+	maintainers := map[string]*MaintainerCount{}
+	for _, name := range index.chartNames() {
+		chartVersions := index.Entries[name]
+		if len(chartVersions) == 0 {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, maintainer := range chartVersions[0].Maintainers {
+			if maintainer == nil {
+				continue
+			}
+			key := strings.ToLower(maintainer.Email)
+			if key == "" {
+				key = maintainer.Name
+			}
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			if _, ok := maintainers[key]; !ok {
+				maintainers[key] = &MaintainerCount{Name: maintainer.Name, Email: maintainer.Email}
+			}
+			maintainers[key].Charts++
+		}
+	}
+	counts := []MaintainerCount{}
+	for _, maintainer := range maintainers {
+		counts = append(counts, *maintainer)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Charts != counts[j].Charts {
+			return counts[i].Charts > counts[j].Charts
+		}
+		if counts[i].Name != counts[j].Name {
+			return counts[i].Name < counts[j].Name
+		}
+		return counts[i].Email < counts[j].Email
+	})
+	return counts
+}
+
+// Annotations aggregates the Chart.yaml annotations of the latest version of each chart, counting
+// the number of charts having each value of each annotation
+func (index *Index) Annotations() map[string]map[string]int {
+	annotations := map[string]map[string]int{}
+	for _, chartVersions := range index.Entries {
+		if len(chartVersions) == 0 {
+			continue
+		}
+		for key, value := range chartVersions[0].Annotations {
+			if _, ok := annotations[key]; !ok {
+				annotations[key] = map[string]int{}
+			}
+			annotations[key][value]++
+		}
+	}
+	return annotations
+}
+
+// ChartVersionMatchesAnnotations checks whether a chart version has all of the given annotations,
+// each given as "key=value", or just "key" to match any value
+func ChartVersionMatchesAnnotations(chartVersion *helm_repo.ChartVersion, filters []string) bool {
+	for _, filter := range filters {
+		parts := strings.SplitN(filter, "=", 2)
+		value, ok := chartVersion.Annotations[parts[0]]
+		if !ok || (len(parts) == 2 && value != parts[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterChartVersionsByAnnotations returns the chart versions having all of the given annotations
+// (see ChartVersionMatchesAnnotations)
+func FilterChartVersionsByAnnotations(chartVersions helm_repo.ChartVersions, filters []string) helm_repo.ChartVersions {
+	filtered := helm_repo.ChartVersions{}
+	for _, chartVersion := range chartVersions {
+		if ChartVersionMatchesAnnotations(chartVersion, filters) {
+			filtered = append(filtered, chartVersion)
+		}
+	}
+	return filtered
+}
+
+// chartNames returns the names of all charts in the index, sorted
+func (index *Index) chartNames() []string {
+	names := []string{}
+	for name := range index.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
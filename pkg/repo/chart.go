@@ -9,6 +9,7 @@ import (
 
 	"github.com/kubernetes-helm/chartmuseum/pkg/storage"
 
+	"github.com/ghodss/yaml"
 	"k8s.io/helm/pkg/chartutil"
 	helm_chart "k8s.io/helm/pkg/proto/hapi/chart"
 	helm_repo "k8s.io/helm/pkg/repo"
@@ -38,10 +39,26 @@ func ChartPackageFilenameFromContent(content []byte) (string, error) {
 		return "", err
 	}
 	meta := chart.Metadata
+	err = annotateChartType(meta, content)
+	if err != nil {
+		return "", err
+	}
 	filename := fmt.Sprintf("%s-%s.%s", meta.Name, meta.Version, ChartPackageFileExtension)
 	return filename, nil
 }
 
+// ChartNameFromContent returns the name of the chart in a chart package, or signed by a provenance file
+func ChartNameFromContent(content []byte) (string, error) {
+	if name, _, err := provenanceNameVersionFromContent(content); err == nil {
+		return name, nil
+	}
+	chart, err := chartFromContent(content)
+	if err != nil {
+		return "", ErrorInvalidChartPackage
+	}
+	return chart.Metadata.Name, nil
+}
+
 // ChartVersionFromStorageObject returns a chart version from a storage object
 func ChartVersionFromStorageObject(object storage.Object) (*helm_repo.ChartVersion, error) {
 	if len(object.Content) == 0 {
@@ -55,6 +72,9 @@ func ChartVersionFromStorageObject(object storage.Object) (*helm_repo.ChartVersi
 	if err != nil {
 		return nil, ErrorInvalidChartPackage
 	}
+	if annotateChartType(chart.Metadata, object.Content) != nil {
+		return nil, ErrorInvalidChartPackage
+	}
 	digest, err := provenanceDigestFromContent(object.Content)
 	if err != nil {
 		return nil, err
@@ -68,6 +88,66 @@ func ChartVersionFromStorageObject(object storage.Object) (*helm_repo.ChartVersi
 	return chartVersion, nil
 }
 
+// ChartPackageDigest returns the digest of a chart package, as recorded in index.yaml
+func ChartPackageDigest(content []byte) (string, error) {
+	return provenanceDigestFromContent(content)
+}
+
+// ChartPackageDocsFromContent returns the README (empty if there is none) and default values of a chart package
+func ChartPackageDocsFromContent(content []byte) (string, string, error) {
+	chart, err := chartFromContent(content)
+	if err != nil {
+		return "", "", err
+	}
+	var readme, values string
+	for _, file := range chart.Files {
+		if strings.EqualFold(file.TypeUrl, "README.md") || strings.EqualFold(file.TypeUrl, "README") {
+			readme = string(file.Value)
+			break
+		}
+	}
+	if chart.Values != nil {
+		values = chart.Values.Raw
+	}
+	return readme, values, nil
+}
+
+// ChartPackageContents describes what a chart package holds, e.g. to evaluate policies against it
+type ChartPackageContents struct {
+	Metadata  *helm_chart.Metadata   `json:"metadata"`
+	Values    map[string]interface{} `json:"values"`
+	Templates []string               `json:"templates"`
+	Files     []string               `json:"files"`
+}
+
+// ChartPackageContentsFromContent returns the metadata, parsed default values and the names of
+// templates and other files of a chart package
+func ChartPackageContentsFromContent(content []byte) (*ChartPackageContents, error) {
+	chart, err := chartFromContent(content)
+	if err != nil {
+		return nil, ErrorInvalidChartPackage
+	}
+	contents := &ChartPackageContents{
+		Metadata:  chart.Metadata,
+		Values:    map[string]interface{}{},
+		Templates: []string{},
+		Files:     []string{},
+	}
+	if chart.Values != nil {
+		err = yaml.Unmarshal([]byte(chart.Values.Raw), &contents.Values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, template := range chart.Templates {
+		contents.Templates = append(contents.Templates, template.Name)
+	}
+	for _, file := range chart.Files {
+		contents.Files = append(contents.Files, file.TypeUrl)
+	}
+	return contents, nil
+}
+
 func chartFromContent(content []byte) (*helm_chart.Chart, error) {
 	chart, err := chartutil.LoadArchive(bytes.NewBuffer(content))
 	return chart, err
@@ -0,0 +1,225 @@
+package repo
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	// CosignSignatureExtension is the file extension used for cosign signatures of chart packages
+	CosignSignatureExtension = "tgz.sig"
+
+	// CosignSignatureContentType is the http content-type header for cosign signatures
+	CosignSignatureContentType = "text/plain"
+
+	// ErrorInvalidCosignSignature is raised when a cosign signature can't be parsed
+	ErrorInvalidCosignSignature = errors.New("invalid cosign signature, expected the output of cosign sign-blob (a base64 signature, or a bundle)")
+
+	// ErrorCosignSignatureMismatch is raised when a cosign signature doesn't match the chart package it is for
+	ErrorCosignSignatureMismatch = errors.New("cosign signature doesn't match the chart package")
+
+	// fulcioIssuerOID and fulcioIssuerV1OID are the extensions of Fulcio certificates holding the
+	// OIDC issuer of the signer's identity, as a DER UTF8String, or raw (deprecated) respectively
+	fulcioIssuerOID   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+	fulcioIssuerV1OID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+)
+
+type (
+	// CosignSignature is a signature of a chart package made with cosign sign-blob: either just the
+	// base64 signature (of a key pair), or a bundle (with --bundle) which also holds the certificate
+	// of a keyless signature
+	CosignSignature struct {
+		Signature   []byte
+		Certificate *x509.Certificate
+	}
+
+	cosignBundle struct {
+		Base64Signature string `json:"base64Signature"`
+		Cert            string `json:"cert"` // base64 encoded PEM
+	}
+
+	// CosignVerifier verifies cosign signatures of chart packages, either against a public key, or
+	// for keyless signatures, against root certificates (such as Fulcio's) and the identity and OIDC
+	// issuer of the signer. Transparency logs are not checked, so the certificates of keyless
+	// signatures are only checked to have been valid when issued.
+	CosignVerifier struct {
+		PublicKey crypto.PublicKey
+		Roots     *x509.CertPool
+		Identity  string // email or URI the certificate must be issued to, any if empty
+		Issuer    string // OIDC issuer of the identity, any if empty
+	}
+)
+
+// CosignSignatureFilenameFromNameVersion returns a cosign signature filename from a name and version
+func CosignSignatureFilenameFromNameVersion(name string, version string) string {
+	return fmt.Sprintf("%s-%s.%s", name, version, CosignSignatureExtension)
+}
+
+// ParseCosignSignature parses the output of cosign sign-blob: a base64 signature, or a bundle
+func ParseCosignSignature(content []byte) (*CosignSignature, error) {
+	content = bytes.TrimSpace(content)
+	if !bytes.HasPrefix(content, []byte("{")) {
+		signature, err := base64.StdEncoding.DecodeString(string(content))
+		if err != nil || len(signature) == 0 {
+			return nil, ErrorInvalidCosignSignature
+		}
+		return &CosignSignature{Signature: signature}, nil
+	}
+
+	var bundle cosignBundle
+	err := json.Unmarshal(content, &bundle)
+	if err != nil {
+		return nil, ErrorInvalidCosignSignature
+	}
+	signature, err := base64.StdEncoding.DecodeString(bundle.Base64Signature)
+	if err != nil || len(signature) == 0 {
+		return nil, ErrorInvalidCosignSignature
+	}
+	parsed := &CosignSignature{Signature: signature}
+	if bundle.Cert == "" {
+		return parsed, nil
+	}
+	certPEM, err := base64.StdEncoding.DecodeString(bundle.Cert)
+	if err != nil {
+		certPEM = []byte(bundle.Cert)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, ErrorInvalidCosignSignature
+	}
+	parsed.Certificate, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, ErrorInvalidCosignSignature
+	}
+	return parsed, nil
+}
+
+// NewCosignVerifier creates a CosignVerifier from a PEM public key, or PEM root certificates along
+// with the identity and issuer expected (either may be empty to accept any)
+func NewCosignVerifier(publicKeyPEM []byte, rootsPEM []byte, identity string, issuer string) (*CosignVerifier, error) {
+	if len(publicKeyPEM) == 0 && len(rootsPEM) == 0 {
+		return nil, errors.New("a public key or root certificates are needed to verify cosign signatures")
+	}
+	if len(rootsPEM) == 0 && (identity != "" || issuer != "") {
+		return nil, errors.New("an identity or issuer can only be verified with root certificates")
+	}
+	verifier := &CosignVerifier{Identity: identity, Issuer: issuer}
+	if len(publicKeyPEM) > 0 {
+		block, _ := pem.Decode(publicKeyPEM)
+		if block == nil {
+			return nil, errors.New("invalid cosign public key, expected PEM")
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cosign public key: %s", err)
+		}
+		verifier.PublicKey = key
+	}
+	if len(rootsPEM) > 0 {
+		verifier.Roots = x509.NewCertPool()
+		if !verifier.Roots.AppendCertsFromPEM(rootsPEM) {
+			return nil, errors.New("invalid cosign root certificates, expected PEM")
+		}
+	}
+	return verifier, nil
+}
+
+// Verify checks that content was signed by the content of a cosign signature file. Signatures are
+// verified against the public key of the verifier if it has one, otherwise against the certificate
+// of the signature.
+func (verifier *CosignVerifier) Verify(content []byte, signatureContent []byte) error {
+	signature, err := ParseCosignSignature(signatureContent)
+	if err != nil {
+		return err
+	}
+	if verifier.PublicKey != nil {
+		return signature.VerifyKey(verifier.PublicKey, content)
+	}
+
+	cert := signature.Certificate
+	if cert == nil {
+		return errors.New("cosign signature has no certificate, sign with cosign sign-blob --bundle")
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:       verifier.Roots,
+		CurrentTime: cert.NotBefore,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return fmt.Errorf("untrusted cosign certificate: %s", err)
+	}
+	if verifier.Identity != "" && !certificateHasIdentity(cert, verifier.Identity) {
+		return fmt.Errorf("cosign certificate is not issued to %s", verifier.Identity)
+	}
+	if verifier.Issuer != "" && certificateIssuer(cert) != verifier.Issuer {
+		return fmt.Errorf("cosign certificate identity is not issued by %s", verifier.Issuer)
+	}
+	return signature.VerifyKey(cert.PublicKey, content)
+}
+
+// VerifyKey checks that content was signed with the private key of key. For signatures with a
+// certificate, checking against the certificate's key only shows that the package wasn't altered
+// since it was signed, not who signed it.
+func (signature *CosignSignature) VerifyKey(key crypto.PublicKey, content []byte) error {
+	digest := sha256.Sum256(content)
+	var ok bool
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, digest[:], signature.Signature)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature.Signature) == nil
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, content, signature.Signature)
+	default:
+		return fmt.Errorf("unsupported cosign key type %T", key)
+	}
+	if !ok {
+		return ErrorCosignSignatureMismatch
+	}
+	return nil
+}
+
+// certificateHasIdentity checks whether cert was issued to identity, an email address or URI
+func certificateHasIdentity(cert *x509.Certificate, identity string) bool {
+	for _, email := range cert.EmailAddresses {
+		if email == identity {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if uri.String() == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// certificateIssuer returns the OIDC issuer of the identity a Fulcio certificate was issued to
+func certificateIssuer(cert *x509.Certificate) string {
+	for _, extension := range cert.Extensions {
+		if extension.Id.Equal(fulcioIssuerOID) {
+			var issuer string
+			if _, err := asn1.Unmarshal(extension.Value, &issuer); err == nil {
+				return issuer
+			}
+		}
+	}
+	for _, extension := range cert.Extensions {
+		if extension.Id.Equal(fulcioIssuerV1OID) {
+			return string(extension.Value)
+		}
+	}
+	return ""
+}
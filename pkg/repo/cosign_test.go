@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CosignTestSuite struct {
+	suite.Suite
+	Content []byte
+}
+
+func (suite *CosignTestSuite) SetupSuite() {
+	suite.Content = []byte("chart package content")
+}
+
+func (suite *CosignTestSuite) newKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Nil(err, "no error generating key")
+	return key
+}
+
+func (suite *CosignTestSuite) sign(key *ecdsa.PrivateKey) []byte {
+	digest := sha256.Sum256(suite.Content)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	suite.Nil(err, "no error signing content")
+	return signature
+}
+
+func (suite *CosignTestSuite) newCertificate(template *x509.Certificate, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, []byte) {
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	suite.Nil(err, "no error creating certificate")
+	cert, err := x509.ParseCertificate(der)
+	suite.Nil(err, "no error parsing certificate")
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func (suite *CosignTestSuite) TestCosignSignatureFilenameFromNameVersion() {
+	filename := CosignSignatureFilenameFromNameVersion("mychart", "0.1.0")
+	suite.Equal("mychart-0.1.0.tgz.sig", filename, "cosign signature filename as expected")
+}
+
+func (suite *CosignTestSuite) TestParseCosignSignature() {
+	_, err := ParseCosignSignature([]byte("not base64!"))
+	suite.Equal(ErrorInvalidCosignSignature, err, "ErrorInvalidCosignSignature from bad content")
+	_, err = ParseCosignSignature([]byte(`{"base64Signature": ""}`))
+	suite.Equal(ErrorInvalidCosignSignature, err, "ErrorInvalidCosignSignature from bundle without signature")
+
+	signature, err := ParseCosignSignature([]byte(base64.StdEncoding.EncodeToString([]byte("sig")) + "\n"))
+	suite.Nil(err, "no error parsing base64 signature")
+	suite.Equal([]byte("sig"), signature.Signature, "signature decoded")
+	suite.Nil(signature.Certificate, "no certificate")
+}
+
+func (suite *CosignTestSuite) TestVerifyWithKey() {
+	key := suite.newKey()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	suite.Nil(err, "no error marshalling public key")
+	verifier, err := NewCosignVerifier(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil, "", "")
+	suite.Nil(err, "no error creating verifier with public key")
+
+	signature := []byte(base64.StdEncoding.EncodeToString(suite.sign(key)))
+	suite.Nil(verifier.Verify(suite.Content, signature), "signature verifies")
+	suite.Equal(ErrorCosignSignatureMismatch, verifier.Verify([]byte("other content"), signature), "signature of other content")
+	other := []byte(base64.StdEncoding.EncodeToString(suite.sign(suite.newKey())))
+	suite.Equal(ErrorCosignSignatureMismatch, verifier.Verify(suite.Content, other), "signature with other key")
+
+	_, err = NewCosignVerifier(nil, nil, "", "")
+	suite.NotNil(err, "error creating verifier without key or roots")
+	_, err = NewCosignVerifier([]byte("not pem"), nil, "", "")
+	suite.NotNil(err, "error creating verifier with bad key")
+	_, err = NewCosignVerifier(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil, "me@example.com", "")
+	suite.NotNil(err, "error creating verifier with identity but no roots")
+}
+
+func (suite *CosignTestSuite) TestVerifyKeyless() {
+	now := time.Now()
+	rootKey := suite.newKey()
+	root, rootPEM := suite.newCertificate(&x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, rootKey, nil, nil)
+	issuer, err := asn1.Marshal("https://accounts.example.com")
+	suite.Nil(err, "no error marshalling issuer")
+	workflow, _ := url.Parse("https://github.com/example/charts/.github/workflows/release.yaml@refs/heads/main")
+
+	bundle := func(template *x509.Certificate) []byte {
+		key := suite.newKey()
+		template.SerialNumber = big.NewInt(2)
+		template.NotBefore = now.Add(-time.Minute)
+		template.NotAfter = now.Add(-time.Minute / 2) // short lived, expired when verified
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+		_, certPEM := suite.newCertificate(template, key, root, rootKey)
+		content, err := json.Marshal(map[string]string{
+			"base64Signature": base64.StdEncoding.EncodeToString(suite.sign(key)),
+			"cert":            base64.StdEncoding.EncodeToString(certPEM),
+		})
+		suite.Nil(err, "no error marshalling bundle")
+		return content
+	}
+	emailBundle := bundle(&x509.Certificate{
+		EmailAddresses:  []string{"me@example.com"},
+		ExtraExtensions: []pkix.Extension{{Id: fulcioIssuerOID, Value: issuer}},
+	})
+	uriBundle := bundle(&x509.Certificate{
+		URIs:            []*url.URL{workflow},
+		ExtraExtensions: []pkix.Extension{{Id: fulcioIssuerV1OID, Value: []byte("https://token.actions.githubusercontent.com")}},
+	})
+
+	signature, err := ParseCosignSignature(emailBundle)
+	suite.Nil(err, "no error parsing bundle")
+	suite.NotNil(signature.Certificate, "certificate parsed from bundle")
+	suite.Nil(signature.VerifyKey(signature.Certificate.PublicKey, suite.Content), "signature verifies against its certificate")
+
+	verifier, err := NewCosignVerifier(nil, rootPEM, "me@example.com", "https://accounts.example.com")
+	suite.Nil(err, "no error creating verifier with roots")
+	suite.Nil(verifier.Verify(suite.Content, emailBundle), "keyless signature verifies")
+	suite.NotNil(verifier.Verify(suite.Content, uriBundle), "keyless signature of other identity")
+	suite.Equal(ErrorCosignSignatureMismatch, verifier.Verify([]byte("other content"), emailBundle), "keyless signature of other content")
+	suite.NotNil(verifier.Verify(suite.Content, []byte(base64.StdEncoding.EncodeToString([]byte("sig")))), "signature without certificate")
+
+	verifier, err = NewCosignVerifier(nil, rootPEM, workflow.String(), "https://token.actions.githubusercontent.com")
+	suite.Nil(err, "no error creating verifier with roots")
+	suite.Nil(verifier.Verify(suite.Content, uriBundle), "keyless signature with URI identity and v1 issuer verifies")
+	verifier.Issuer = "https://accounts.example.com"
+	suite.NotNil(verifier.Verify(suite.Content, uriBundle), "keyless signature from other issuer")
+
+	_, otherRootPEM := suite.newCertificate(&x509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: "other root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, suite.newKey(), nil, nil)
+	verifier, err = NewCosignVerifier(nil, otherRootPEM, "", "")
+	suite.Nil(err, "no error creating verifier with other roots")
+	suite.NotNil(verifier.Verify(suite.Content, emailBundle), "keyless signature from untrusted root")
+}
+
+func TestCosignTestSuite(t *testing.T) {
+	suite.Run(t, new(CosignTestSuite))
+}
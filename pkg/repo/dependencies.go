@@ -0,0 +1,121 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+var (
+	// ChartRequirementsFileName is the file listing dependencies of apiVersion v1 charts
+	ChartRequirementsFileName = "requirements.yaml"
+
+	// ChartMetadataFileName is the file with the metadata of a chart (and dependencies of apiVersion v2 charts)
+	ChartMetadataFileName = "Chart.yaml"
+)
+
+// ChartDependency is a dependency of a chart, as listed in requirements.yaml or Chart.yaml
+type ChartDependency struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version"`
+	Repository string   `json:"repository"`
+	Condition  string   `json:"condition,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Alias      string   `json:"alias,omitempty"`
+	Bundled    bool     `json:"bundled,omitempty"` // included in the charts/ directory of the package
+}
+
+type chartDependencies struct {
+	Dependencies []ChartDependency `json:"dependencies"`
+}
+
+// ChartDependenciesFromContent returns the dependencies of a chart package, from requirements.yaml
+// followed by those in Chart.yaml, flagging those bundled in its charts/ directory
+func ChartDependenciesFromContent(content []byte) ([]ChartDependency, error) {
+	archive, err := readChartArchive(content, ChartRequirementsFileName, ChartMetadataFileName)
+	if err != nil {
+		return nil, ErrorInvalidChartPackage
+	}
+	if _, ok := archive.files[ChartMetadataFileName]; !ok {
+		return nil, ErrorInvalidChartPackage
+	}
+	dependencies := []ChartDependency{}
+	for _, name := range []string{ChartRequirementsFileName, ChartMetadataFileName} {
+		raw, ok := archive.files[name]
+		if !ok {
+			continue
+		}
+		var parsed chartDependencies
+		err = yaml.Unmarshal(raw, &parsed)
+		if err != nil {
+			return nil, err
+		}
+		for _, dependency := range parsed.Dependencies {
+			dependency.Bundled = archive.subcharts[dependency.Name]
+			dependencies = append(dependencies, dependency)
+		}
+	}
+	return dependencies, nil
+}
+
+// chartArchive holds the parts of a chart package needed to inspect its dependencies
+type chartArchive struct {
+	files     map[string][]byte // requested files from the top-level directory
+	subcharts map[string]bool   // names of charts bundled in the charts/ directory
+}
+
+// readChartArchive reads the given files from the top-level directory of a chart package,
+// along with the names of its bundled subcharts
+func readChartArchive(content []byte, names ...string) (*chartArchive, error) {
+	gz, err := gzip.NewReader(bytes.NewBuffer(content))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	archive := &chartArchive{files: map[string][]byte{}, subcharts: map[string]bool{}}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.SplitN(header.Name, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if subchart := strings.Split(parts[1], "/"); len(subchart) > 1 && subchart[0] == "charts" {
+			switch {
+			case len(subchart) == 2 && strings.HasSuffix(subchart[1], "."+ChartPackageFileExtension):
+				archive.subcharts[emptyChartVersionFromPackageFilename(subchart[1]).Name] = true
+			case len(subchart) == 3 && subchart[2] == ChartMetadataFileName:
+				archive.subcharts[subchart[1]] = true
+			}
+			continue
+		}
+		if !stringInSlice(parts[1], names) {
+			continue
+		}
+		archive.files[parts[1]], err = ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return archive, nil
+}
+
+func stringInSlice(s string, slice []string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,11 @@
 package repo
 
 import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ghodss/yaml"
@@ -10,31 +14,115 @@ import (
 )
 
 var (
+	// IndexFileName is the filename used for the repository index
+	IndexFileName = "index.yaml"
+
 	// IndexFileContentType is the http content-type header for index.yaml
 	IndexFileContentType = "application/x-yaml"
+
+	// IndexGzipFileName is the filename used for the gzip compressed repository index
+	IndexGzipFileName = "index.yaml.gz"
+
+	// IndexGzipFileContentType is the http content-type header for index.yaml.gz
+	IndexGzipFileContentType = "application/gzip"
+
+	// LibraryChartsInclude lists library charts in index.yaml along with all other charts
+	LibraryChartsInclude = "include"
+
+	// LibraryChartsExclude leaves library charts out of index.yaml, into LibraryRaw
+	LibraryChartsExclude = "exclude"
+
+	// LibraryChartsSeparate leaves library charts out of index.yaml, into LibraryRaw, which is served as an index of its own
+	LibraryChartsSeparate = "separate"
 )
 
 // Index represents the repository index (index.yaml)
 type Index struct {
 	*helm_repo.IndexFile
-	Raw      []byte
-	ChartURL string
+	Raw            []byte
+	RawGzip        []byte // Raw compressed with gzip
+	ChartURL       string
+	Shards         *IndexShards  // if set, index.yaml is generated shard by shard
+	LibraryCharts  string        // how library charts are listed, LibraryChartsInclude if empty
+	LibraryRaw     []byte        // index of library charts left out of Raw, if any
+	LibraryRawGzip []byte        // LibraryRaw compressed with gzip
+	Pruning        *IndexPruning // if set, chart versions left out of Raw, into PrunedRaw
+	PrunedRaw      []byte        // index of chart versions pruned from Raw, if any
+	NoMetrics      bool          // if set, metrics are not updated (for indexes other than the one served)
+	prunedCounts   map[string]int
 }
 
 // NewIndex creates a new instance of Index
 func NewIndex(chartURL string) *Index {
 	chartURL = strings.TrimSuffix(chartURL, "/")
-	index := Index{&helm_repo.IndexFile{}, []byte{}, chartURL}
+	index := Index{IndexFile: &helm_repo.IndexFile{}, Raw: []byte{}, ChartURL: chartURL}
 	index.Entries = map[string]helm_repo.ChartVersions{}
 	index.APIVersion = helm_repo.APIVersionV1
 	return &index
 }
 
-// Regenerate sorts entries in index file and sets current time for generated key
+// LoadIndex creates a new instance of Index from existing index.yaml content
+func LoadIndex(raw []byte, chartURL string) (*Index, error) {
+	index := NewIndex(chartURL)
+	err := yaml.Unmarshal(raw, index.IndexFile)
+	if err != nil {
+		return nil, err
+	}
+	if index.Entries == nil {
+		index.Entries = map[string]helm_repo.ChartVersions{}
+	}
+	index.Raw = raw
+	index.RawGzip, err = gzipRaw(raw)
+	if err != nil {
+		return nil, err
+	}
+	index.updateMetrics()
+	return index, nil
+}
+
+// Regenerate sorts entries in index file and sets current time for generated key. Unless
+// LibraryCharts is LibraryChartsInclude, library charts are generated into LibraryRaw instead of Raw.
+// Chart versions pruned by Pruning are generated into PrunedRaw instead of either.
 func (index *Index) Regenerate() error {
 	index.SortEntries()
 	index.Generated = time.Now().Round(time.Second)
-	raw, err := yaml.Marshal(index.IndexFile)
+	indexFile := index.IndexFile
+	index.LibraryRaw, index.LibraryRawGzip = nil, nil
+	index.PrunedRaw = nil
+	if index.Pruning.Enabled() {
+		var prunedIndexFile *helm_repo.IndexFile
+		indexFile, prunedIndexFile = index.Pruning.prune(indexFile, index.Generated)
+		index.invalidatePrunedShards(prunedIndexFile)
+		prunedRaw, err := yaml.Marshal(prunedIndexFile)
+		if err != nil {
+			return err
+		}
+		index.PrunedRaw = prunedRaw
+	}
+	if index.LibraryCharts != "" && index.LibraryCharts != LibraryChartsInclude {
+		var libraryIndexFile *helm_repo.IndexFile
+		indexFile, libraryIndexFile = splitLibraryCharts(indexFile)
+		libraryRaw, err := yaml.Marshal(libraryIndexFile)
+		if err != nil {
+			return err
+		}
+		index.LibraryRawGzip, err = gzipRaw(libraryRaw)
+		if err != nil {
+			return err
+		}
+		index.LibraryRaw = libraryRaw
+	}
+	var raw []byte
+	var err error
+	if index.Shards != nil {
+		raw, err = index.Shards.marshal(indexFile)
+	} else {
+		raw, err = yaml.Marshal(indexFile)
+	}
+	if err != nil {
+		return err
+	}
+	index.RawGzip, err = gzipRaw(raw)
 	if err != nil {
 		return err
 	}
@@ -43,8 +131,95 @@ func (index *Index) Regenerate() error {
 	return nil
 }
 
+// PruningDue returns whether chart versions in Raw have aged beyond Pruning.MaxAge since the index
+// was generated, so that it must be regenerated to prune them even though no entries changed
+func (index *Index) PruningDue() bool {
+	return index.Pruning.due(index.IndexFile, index.Generated, time.Now())
+}
+
+// LoadLibraryIndex adds the entries of an index of library charts (LibraryRaw of an index
+// previously generated) to index, which was loaded from an index.yaml leaving them out
+func (index *Index) LoadLibraryIndex(raw []byte) error {
+	err := index.loadEntries(raw)
+	if err != nil {
+		return err
+	}
+	index.LibraryRawGzip, err = gzipRaw(raw)
+	if err != nil {
+		return err
+	}
+	index.LibraryRaw = raw
+	index.updateMetrics()
+	return nil
+}
+
+// LoadPrunedIndex adds the entries of an index of pruned chart versions (PrunedRaw of an index
+// previously generated) to index, which was loaded from an index.yaml leaving them out
+func (index *Index) LoadPrunedIndex(raw []byte) error {
+	err := index.loadEntries(raw)
+	if err != nil {
+		return err
+	}
+	index.PrunedRaw = raw
+	index.updateMetrics()
+	return nil
+}
+
+func (index *Index) loadEntries(raw []byte) error {
+	indexFile := &helm_repo.IndexFile{}
+	err := yaml.Unmarshal(raw, indexFile)
+	if err != nil {
+		return err
+	}
+	for name, chartVersions := range indexFile.Entries {
+		index.Entries[name] = append(index.Entries[name], chartVersions...)
+	}
+	index.SortEntries()
+	return nil
+}
+
+// Filter returns a copy of index with only the charts for which keep returns true, generated the
+// same way as index (e.g. to serve clients which may only see some charts)
+func (index *Index) Filter(keep func(name string) bool) (*Index, error) {
+	filtered := NewIndex(index.ChartURL)
+	filtered.LibraryCharts = index.LibraryCharts
+	filtered.Pruning = index.Pruning
+	filtered.NoMetrics = true
+	for name, chartVersions := range index.Entries {
+		if keep(name) {
+			filtered.Entries[name] = append(helm_repo.ChartVersions{}, chartVersions...)
+		}
+	}
+	err := filtered.Regenerate()
+	if err != nil {
+		return nil, err
+	}
+	filtered.Generated = index.Generated
+	return filtered, nil
+}
+
+// splitLibraryCharts splits the entries of indexFile into an index file without library charts,
+// and an index file of only library charts
+func splitLibraryCharts(indexFile *helm_repo.IndexFile) (*helm_repo.IndexFile, *helm_repo.IndexFile) {
+	others := *indexFile
+	others.Entries = map[string]helm_repo.ChartVersions{}
+	libraries := *indexFile
+	libraries.Entries = map[string]helm_repo.ChartVersions{}
+	for name, chartVersions := range indexFile.Entries {
+		for _, chartVersion := range chartVersions {
+			if ChartVersionType(chartVersion) == ChartTypeLibrary {
+				libraries.Entries[name] = append(libraries.Entries[name], chartVersion)
+			} else {
+				others.Entries[name] = append(others.Entries[name], chartVersion)
+			}
+		}
+	}
+	return &others, &libraries
+}
+
 // RemoveEntry removes a chart version from index
 func (index *Index) RemoveEntry(chartVersion *helm_repo.ChartVersion) {
+	index.invalidateShard(chartVersion.Name)
 	for k := range index.Entries {
 		if k == chartVersion.Name {
 			for i, cv := range index.Entries[chartVersion.Name] {
@@ -64,6 +239,7 @@ func (index *Index) RemoveEntry(chartVersion *helm_repo.ChartVersion) {
 
 // AddEntry adds a chart version to index
 func (index *Index) AddEntry(chartVersion *helm_repo.ChartVersion) {
+	index.invalidateShard(chartVersion.Name)
 	if _, ok := index.Entries[chartVersion.Name]; !ok {
 		index.Entries[chartVersion.Name] = helm_repo.ChartVersions{}
 	}
@@ -73,6 +249,7 @@ func (index *Index) AddEntry(chartVersion *helm_repo.ChartVersion) {
 
 // UpdateEntry updates a chart version in index
 func (index *Index) UpdateEntry(chartVersion *helm_repo.ChartVersion) {
+	index.invalidateShard(chartVersion.Name)
 	for k := range index.Entries {
 		if k == chartVersion.Name {
 			for i, cv := range index.Entries[chartVersion.Name] {
@@ -87,6 +264,64 @@ func (index *Index) UpdateEntry(chartVersion *helm_repo.ChartVersion) {
 	}
 }
 
+// RenameEntry points the chart version stored at the package path from to the package path to,
+// returning false if no chart version in index is stored at from
+func (index *Index) RenameEntry(from string, to string) bool {
+	fromURL := index.packageURL(from)
+	for _, chartVersions := range index.Entries {
+		for _, cv := range chartVersions {
+			if len(cv.URLs) > 0 && cv.URLs[0] == fromURL {
+				index.invalidateShard(cv.Name)
+				cv.URLs[0] = index.packageURL(to)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetByPackage returns the chart version stored at the package path, or nil if there is none in index
+func (index *Index) GetByPackage(path string) *helm_repo.ChartVersion {
+	url := index.packageURL(path)
+	for _, chartVersions := range index.Entries {
+		for _, cv := range chartVersions {
+			if len(cv.URLs) > 0 && cv.URLs[0] == url {
+				return cv
+			}
+		}
+	}
+	return nil
+}
+
+// invalidatePrunedShards marks the shards of charts with versions pruned since the last
+// regeneration as changed, since versions get pruned as they age without their entries changing
+func (index *Index) invalidatePrunedShards(prunedIndexFile *helm_repo.IndexFile) {
+	prunedCounts := map[string]int{}
+	for name, chartVersions := range prunedIndexFile.Entries {
+		prunedCounts[name] = len(chartVersions)
+	}
+	for name := range index.Entries {
+		if prunedCounts[name] != index.prunedCounts[name] {
+			index.invalidateShard(name)
+		}
+	}
+	index.prunedCounts = prunedCounts
+}
+
+func (index *Index) packageURL(path string) string {
+	url := fmt.Sprintf("charts/%s", path)
+	if index.ChartURL != "" {
+		url = strings.Join([]string{index.ChartURL, url}, "/")
+	}
+	return url
+}
+
+func (index *Index) invalidateShard(name string) {
+	if index.Shards != nil {
+		index.Shards.invalidate(name)
+	}
+}
+
 func (index *Index) setChartURL(chartVersion *helm_repo.ChartVersion) {
 	if index.ChartURL != "" {
 		chartVersion.URLs[0] = strings.Join([]string{index.ChartURL, chartVersion.URLs[0]}, "/")
@@ -95,10 +330,39 @@ func (index *Index) setChartURL(chartVersion *helm_repo.ChartVersion) {
 
 // UpdateMetrics updates chart index-related Prometheus metrics
 func (index *Index) updateMetrics() {
+	if index.NoMetrics {
+		return
+	}
 	nChartVersions := 0
 	for _, chartVersions := range index.Entries {
 		nChartVersions += len(chartVersions)
 	}
 	chartTotalGauge.Set(float64(len(index.Entries)))
 	chartVersionTotalGauge.Set(float64(nChartVersions))
+	indexSizeGauge.WithLabelValues(IndexFileName).Set(float64(len(index.Raw)))
+	indexSizeGauge.WithLabelValues(IndexGzipFileName).Set(float64(len(index.RawGzip)))
+}
+
+// gzipWriters are reused between regenerations, since each holds about a megabyte of compressor state
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+func gzipRaw(raw []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(raw) / 8) // indexes typically compress about tenfold
+	w := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(w)
+	w.Reset(&buf)
+	_, err := w.Write(raw)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
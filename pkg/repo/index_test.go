@@ -1,10 +1,16 @@
 package repo
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io/ioutil"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ghodss/yaml"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/suite"
 	"k8s.io/helm/pkg/proto/hapi/chart"
 	helm_repo "k8s.io/helm/pkg/repo"
@@ -85,6 +91,288 @@ func (suite *IndexTestSuite) TestChartURLs() {
 		index.Entries["a"][0].URLs[0], "absolute chart url")
 }
 
+func (suite *IndexTestSuite) TestRenameEntry() {
+	index := NewIndex("http://mysite.com:8080/")
+	index.AddEntry(getChartVersion("a", 0, time.Now()))
+	suite.True(index.RenameEntry("a-1.0.0.tgz", "archive/a-1.0.0.tgz"), "entry renamed")
+	suite.Equal("http://mysite.com:8080/charts/archive/a-1.0.0.tgz",
+		index.Entries["a"][0].URLs[0], "chart url points to new path")
+	suite.False(index.RenameEntry("a-1.0.0.tgz", "other/a-1.0.0.tgz"), "no entry at old path")
+}
+
+func (suite *IndexTestSuite) TestShardedRegenerate() {
+	index := NewIndex("")
+	index.Shards = NewIndexShards()
+	err := index.Regenerate()
+	suite.Nil(err, "no error regenerating empty sharded index")
+	raw, _ := yaml.Marshal(index.IndexFile)
+	suite.Equal(string(raw), string(index.Raw), "empty sharded index same as unsharded")
+
+	now := time.Now()
+	for _, name := range []string{"beta", "alpha", "Zeta", "9chart", "10chart", "apple", "_private"} {
+		for i := 0; i < 3; i++ {
+			chartVersion := getChartVersion(name, i, now)
+			chartVersion.Description = "multi-line\n\ndescription"
+			index.AddEntry(chartVersion)
+		}
+	}
+	err = index.Regenerate()
+	suite.Nil(err, "no error regenerating sharded index")
+	raw, _ = yaml.Marshal(index.IndexFile)
+	suite.Equal(string(raw), string(index.Raw), "sharded index same as unsharded")
+	suite.Equal(len(index.Raw), cap(index.Raw), "sharded index allocated at its exact size")
+	suite.Equal(5, len(index.Shards.raw), "one shard per first character")
+
+	cachedShard := index.Shards.raw["b"]
+	index.AddEntry(getChartVersion("apple", 3, now))
+	index.RemoveEntry(getChartVersion("Zeta", 0, now))
+	err = index.Regenerate()
+	suite.Nil(err, "no error regenerating changed sharded index")
+	raw, _ = yaml.Marshal(index.IndexFile)
+	suite.Equal(string(raw), string(index.Raw), "changed sharded index same as unsharded")
+	suite.Equal(cachedShard, index.Shards.raw["b"], "unchanged shard reused")
+
+	for i := 1; i < 3; i++ {
+		index.RemoveEntry(getChartVersion("Zeta", i, now))
+	}
+	err = index.Regenerate()
+	suite.Nil(err, "no error regenerating sharded index with shard removed")
+	suite.NotContains(index.Shards.raw, "Z", "empty shard removed")
+}
+
+func (suite *IndexTestSuite) TestGzipRaw() {
+	for _, raw := range [][]byte{[]byte("apiVersion: v1\nentries: {}\n"), bytes.Repeat([]byte("entries: {}\n"), 1000)} {
+		// gzip writers are reused, make sure nothing leaks from one index to the next
+		compressed, err := gzipRaw(raw)
+		suite.Nil(err, "no error compressing index")
+		r, err := gzip.NewReader(bytes.NewReader(compressed))
+		suite.Nil(err, "no error reading compressed index")
+		decompressed, err := ioutil.ReadAll(r)
+		suite.Nil(err, "no error decompressing index")
+		suite.Equal(raw, decompressed, "index compressed and decompressed")
+	}
+}
+
+func (suite *IndexTestSuite) TestKeywordsAndMaintainers() {
+	index := NewIndex("")
+	now := time.Now()
+	for _, cv := range []struct {
+		name        string
+		patch       int
+		keywords    []string
+		maintainers []*chart.Maintainer
+	}{
+		{"a", 0, []string{"old"}, []*chart.Maintainer{{Name: "Old", Email: "old@example.com"}}},
+		{"a", 1, []string{"Database", "sql", "database"}, []*chart.Maintainer{{Name: "Jo", Email: "jo@example.com"}}},
+		{"b", 0, []string{"database"}, []*chart.Maintainer{{Name: "Jo", Email: "JO@example.com"}, {Name: "Sam"}}},
+		{"c", 0, nil, nil},
+	} {
+		chartVersion := getChartVersion(cv.name, cv.patch, now)
+		chartVersion.Keywords = cv.keywords
+		chartVersion.Maintainers = cv.maintainers
+		index.AddEntry(chartVersion)
+	}
+	err := index.Regenerate()
+	suite.Nil(err)
+
+	suite.Equal([]KeywordCount{
+		{Keyword: "database", Charts: 2},
+		{Keyword: "sql", Charts: 1},
+	}, index.Keywords(), "keywords of latest chart versions, counted once per chart")
+	suite.Equal([]MaintainerCount{
+		{Name: "Jo", Email: "jo@example.com", Charts: 2},
+		{Name: "Sam", Charts: 1},
+	}, index.Maintainers(), "maintainers of latest chart versions, identified by email")
+}
+
+func (suite *IndexTestSuite) TestChartVersionMatchesAnnotations() {
+	chartVersion := getChartVersion("a", 0, time.Now())
+	suite.True(ChartVersionMatchesAnnotations(chartVersion, nil), "no filters match")
+	suite.False(ChartVersionMatchesAnnotations(chartVersion, []string{"category"}), "no annotations")
+
+	chartVersion.Annotations = map[string]string{"category": "database", "empty": ""}
+	suite.True(ChartVersionMatchesAnnotations(chartVersion, []string{"category"}), "key matches any value")
+	suite.True(ChartVersionMatchesAnnotations(chartVersion, []string{"category=database", "empty="}), "all key=value match")
+	suite.False(ChartVersionMatchesAnnotations(chartVersion, []string{"category=database", "team"}), "one filter doesn't match")
+	suite.False(ChartVersionMatchesAnnotations(chartVersion, []string{"category=data"}), "value doesn't match")
+}
+
+func (suite *IndexTestSuite) TestSuggestions() {
+	index := NewIndex("")
+	now := time.Now()
+	for _, name := range []string{"postgresql", "mysql", "redis", "redis-ha"} {
+		for patch := 0; patch < 4; patch++ {
+			index.AddEntry(getChartVersion(name, patch, now))
+		}
+	}
+	chartVersion := getChartVersion("redis", 0, now)
+	chartVersion.Version = "2.0.0"
+	index.AddEntry(chartVersion)
+
+	suite.Equal([]string{"postgresql"}, index.SuggestChartNames("postgressql", 3), "typo suggests chart")
+	suite.Equal([]string{"redis", "redis-ha"}, index.SuggestChartNames("rediss", 3), "similar charts suggested, closest first")
+	suite.Equal([]string{"mysql"}, index.SuggestChartNames("MySQL", 3), "names compared case-insensitively")
+	suite.Empty(index.SuggestChartNames("nginx", 3), "no suggestions for unrelated name")
+
+	suite.Equal([]string{"1.0.3", "1.0.2"}, index.SuggestChartVersions("redis", "1.0.4", 2), "nearest patch versions suggested")
+	suite.Equal([]string{"2.0.0"}, index.SuggestChartVersions("redis", "2.1.0", 1), "nearest major version suggested")
+	suite.Empty(index.SuggestChartVersions("nginx", "1.0.0", 2), "no suggestions for unknown chart")
+}
+
+func (suite *IndexTestSuite) TestLoadIndex() {
+	index := NewIndex("")
+	index.AddEntry(getChartVersion("a", 0, time.Now()))
+	err := index.Regenerate()
+	suite.Nil(err, "no error regenerating index")
+
+	loaded, err := LoadIndex(index.Raw, "")
+	suite.Nil(err, "no error loading index from raw content")
+	suite.Equal(index.Raw, loaded.Raw, "raw content preserved")
+	suite.Equal(index.RawGzip, loaded.RawGzip, "gzipped raw content regenerated")
+	suite.Equal("1.0.0", loaded.Entries["a"][0].Version, "entries loaded")
+
+	_, err = LoadIndex([]byte("entries: [this is not valid"), "")
+	suite.NotNil(err, "error loading index from bad content")
+}
+
+func (suite *IndexTestSuite) TestLibraryCharts() {
+	index := NewIndex("")
+	index.LibraryCharts = LibraryChartsExclude
+	index.AddEntry(getChartVersion("app", 0, time.Now()))
+	library := getChartVersion("common", 0, time.Now())
+	library.Annotations = map[string]string{ChartTypeAnnotation: ChartTypeLibrary}
+	index.AddEntry(library)
+	err := index.Regenerate()
+	suite.Nil(err, "no error regenerating index without library charts")
+	suite.Len(index.Entries, 2, "library charts still in entries")
+
+	var indexFile helm_repo.IndexFile
+	yaml.Unmarshal(index.Raw, &indexFile)
+	suite.Contains(indexFile.Entries, "app", "application chart in index.yaml")
+	suite.NotContains(indexFile.Entries, "common", "library chart not in index.yaml")
+	indexFile = helm_repo.IndexFile{}
+	yaml.Unmarshal(index.LibraryRaw, &indexFile)
+	suite.Contains(indexFile.Entries, "common", "library chart in library index")
+	suite.NotContains(indexFile.Entries, "app", "application chart not in library index")
+
+	loaded, err := LoadIndex(index.Raw, "")
+	suite.Nil(err, "no error loading index")
+	err = loaded.LoadLibraryIndex(index.LibraryRaw)
+	suite.Nil(err, "no error loading library index")
+	suite.Len(loaded.Entries, 2, "library charts loaded back into entries")
+	suite.Equal(index.LibraryRaw, loaded.LibraryRaw, "library index preserved")
+
+	index.LibraryCharts = LibraryChartsInclude
+	err = index.Regenerate()
+	suite.Nil(err, "no error regenerating index with library charts")
+	indexFile = helm_repo.IndexFile{}
+	yaml.Unmarshal(index.Raw, &indexFile)
+	suite.Contains(indexFile.Entries, "common", "library chart in index.yaml")
+	suite.Nil(index.LibraryRaw, "no library index")
+}
+
+func (suite *IndexTestSuite) TestFilter() {
+	index := NewIndex("")
+	index.LibraryCharts = LibraryChartsExclude
+	index.AddEntry(getChartVersion("team-a-app", 0, time.Now()))
+	index.AddEntry(getChartVersion("team-b-app", 0, time.Now()))
+	library := getChartVersion("team-a-common", 0, time.Now())
+	library.Annotations = map[string]string{ChartTypeAnnotation: ChartTypeLibrary}
+	index.AddEntry(library)
+	err := index.Regenerate()
+	suite.Nil(err, "no error regenerating index")
+
+	filtered, err := index.Filter(func(name string) bool {
+		return strings.HasPrefix(name, "team-a-")
+	})
+	suite.Nil(err, "no error filtering index")
+	suite.Len(filtered.Entries, 2, "charts of team a left")
+	suite.Len(index.Entries, 3, "index itself unchanged")
+	suite.Equal(index.Generated, filtered.Generated, "generated time of index kept")
+
+	var indexFile helm_repo.IndexFile
+	yaml.Unmarshal(filtered.Raw, &indexFile)
+	suite.Contains(indexFile.Entries, "team-a-app", "kept chart in index.yaml")
+	suite.NotContains(indexFile.Entries, "team-b-app", "filtered out chart not in index.yaml")
+	indexFile = helm_repo.IndexFile{}
+	yaml.Unmarshal(filtered.LibraryRaw, &indexFile)
+	suite.Contains(indexFile.Entries, "team-a-common", "kept library chart in library index")
+	suite.NotEmpty(filtered.RawGzip, "filtered index compressed")
+}
+
+func (suite *IndexTestSuite) TestPruning() {
+	index := NewIndex("")
+	index.Shards = NewIndexShards()
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		index.AddEntry(getChartVersion("old", i, now.Add(-48*time.Hour)))
+	}
+	index.AddEntry(getChartVersion("new", 0, now.Add(-48*time.Hour)))
+	index.AddEntry(getChartVersion("new", 1, now))
+	prerelease := getChartVersion("new", 2, now)
+	prerelease.Version = "1.0.2-rc.1"
+	index.AddEntry(prerelease)
+	index.Pruning = &IndexPruning{MaxAge: 24 * time.Hour, HidePrereleases: true}
+	err := index.Regenerate()
+	suite.Nil(err, "no error regenerating pruned index")
+	suite.Len(index.Entries["old"], 3, "pruned versions still in entries")
+
+	var indexFile helm_repo.IndexFile
+	yaml.Unmarshal(index.Raw, &indexFile)
+	suite.Len(indexFile.Entries["old"], 1, "newest version of a chart never pruned")
+	suite.Equal("1.0.2", indexFile.Entries["old"][0].Version, "newest version kept")
+	suite.Len(indexFile.Entries["new"], 1, "old and prerelease versions pruned")
+	suite.Equal("1.0.1", indexFile.Entries["new"][0].Version, "recent release kept")
+	suite.False(index.PruningDue(), "no pruning due right after regenerating")
+	generated := index.Generated
+	index.Generated = now.Add(-47 * time.Hour)
+	suite.True(index.PruningDue(), "pruning due once kept versions aged beyond max age")
+	index.Generated = generated
+
+	loaded, err := LoadIndex(index.Raw, "")
+	suite.Nil(err, "no error loading index")
+	err = loaded.LoadPrunedIndex(index.PrunedRaw)
+	suite.Nil(err, "no error loading pruned index")
+	suite.Len(loaded.Entries["old"], 3, "pruned versions loaded back into entries")
+	suite.Len(loaded.Entries["new"], 3, "pruned versions loaded back into entries")
+
+	// shards are marshaled again when pruned versions change without any change to entries
+	index.Pruning.MaxAge = 0
+	err = index.Regenerate()
+	suite.Nil(err, "no error regenerating index")
+	indexFile = helm_repo.IndexFile{}
+	yaml.Unmarshal(index.Raw, &indexFile)
+	suite.Len(indexFile.Entries["old"], 3, "old versions no longer pruned")
+	suite.Len(indexFile.Entries["new"], 2, "prerelease still pruned")
+
+	index.Pruning = nil
+	err = index.Regenerate()
+	suite.Nil(err, "no error regenerating index without pruning")
+	suite.Nil(index.PrunedRaw, "no pruned index")
+}
+
+func (suite *IndexTestSuite) TestMetrics() {
+	index := NewIndex("")
+	index.AddEntry(getChartVersion("metrics", 0, time.Now()))
+	err := index.Regenerate()
+	suite.Nil(err)
+
+	var metric dto.Metric
+	indexSizeGauge.WithLabelValues(IndexFileName).Write(&metric)
+	suite.Equal(float64(len(index.Raw)), metric.GetGauge().GetValue(), "index.yaml size")
+	indexSizeGauge.WithLabelValues(IndexGzipFileName).Write(&metric)
+	suite.Equal(float64(len(index.RawGzip)), metric.GetGauge().GetValue(), "index.yaml.gz size")
+	chartVersionTotalGauge.Write(&metric)
+	suite.Equal(float64(1), metric.GetGauge().GetValue(), "index entries")
+
+	other := NewIndex("")
+	other.NoMetrics = true
+	err = other.Regenerate()
+	suite.Nil(err)
+	indexSizeGauge.WithLabelValues(IndexFileName).Write(&metric)
+	suite.Equal(float64(len(index.Raw)), metric.GetGauge().GetValue(), "index without metrics ignored")
+}
+
 func TestIndexTestSuite(t *testing.T) {
 	suite.Run(t, new(IndexTestSuite))
 }
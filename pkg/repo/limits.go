@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	pathutil "path"
+	"strings"
+)
+
+// ChartPackageLimits restricts what a chart package may unpack to, as a defense against
+// archives which are small but unpack to huge amounts of data (zip bombs)
+type ChartPackageLimits struct {
+	MaxUnpackedSize int64 // total size of all files in bytes (0 for no limit)
+	MaxFiles        int   // number of files, not counting directories (0 for no limit)
+}
+
+// CheckChartPackageLimits unpacks a chart package without keeping its contents, returning an error
+// if it exceeds limits or has entries pointing outside of the chart directory (e.g. "../x")
+func CheckChartPackageLimits(content []byte, limits ChartPackageLimits) error {
+	return CheckChartPackageLimitsReader(bytes.NewBuffer(content), limits)
+}
+
+// CheckChartPackageLimitsReader is CheckChartPackageLimits for a chart package read from r. A
+// package which is cut short is invalid, but whatever of it could be read is checked first.
+func CheckChartPackageLimitsReader(r io.Reader, limits ChartPackageLimits) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return ErrorInvalidChartPackage
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	var files int
+	var size int64
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return ErrorInvalidChartPackage
+		}
+		if isUnsafeArchivePath(header.Name) {
+			return fmt.Errorf("chart package entry %q is outside of the chart directory", header.Name)
+		}
+		if (header.Typeflag == tar.TypeSymlink || header.Typeflag == tar.TypeLink) &&
+			isUnsafeArchivePath(pathutil.Join(pathutil.Dir(header.Name), header.Linkname)) {
+			return fmt.Errorf("chart package entry %q links outside of the chart directory", header.Name)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		files++
+		if limits.MaxFiles > 0 && files > limits.MaxFiles {
+			return fmt.Errorf("chart package has more than %d files", limits.MaxFiles)
+		}
+		// count the bytes actually unpacked rather than trusting the size in the header
+		reader := io.Reader(tr)
+		if limits.MaxUnpackedSize > 0 {
+			reader = io.LimitReader(tr, limits.MaxUnpackedSize-size+1)
+		}
+		n, err := io.Copy(ioutil.Discard, reader)
+		if err != nil {
+			return ErrorInvalidChartPackage
+		}
+		size += n
+		if limits.MaxUnpackedSize > 0 && size > limits.MaxUnpackedSize {
+			return fmt.Errorf("chart package unpacks to more than %d bytes", limits.MaxUnpackedSize)
+		}
+	}
+}
+
+// isUnsafeArchivePath checks whether an archive entry would be unpacked outside of the current directory
+func isUnsafeArchivePath(name string) bool {
+	name = strings.Replace(name, "\\", "/", -1)
+	if strings.HasPrefix(name, "/") {
+		return true
+	}
+	cleaned := pathutil.Clean(name)
+	return cleaned == ".." || strings.HasPrefix(cleaned, "../")
+}
@@ -21,8 +21,17 @@ var (
 			Help:      "Current number of chart versions served",
 		},
 	)
+	// Size of the generated index, by file (index.yaml or index.yaml.gz)
+	indexSizeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "chartmuseum",
+			Name:      "index_size_bytes",
+			Help:      "Current size of the generated index, by file",
+		},
+		[]string{"file"},
+	)
 )
 
 func init() {
-	prometheus.MustRegister(chartTotalGauge, chartVersionTotalGauge)
+	prometheus.MustRegister(chartTotalGauge, chartVersionTotalGauge, indexSizeGauge)
 }
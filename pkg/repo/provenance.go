@@ -29,6 +29,16 @@ func ProvenanceFilenameFromNameVersion(name string, version string) string {
 
 // ProvenanceFilenameFromContent returns a provenance filename from binary content
 func ProvenanceFilenameFromContent(content []byte) (string, error) {
+	name, version, err := provenanceNameVersionFromContent(content)
+	if err != nil {
+		return "", err
+	}
+	filename := ProvenanceFilenameFromNameVersion(name, version)
+	return filename, nil
+}
+
+// provenanceNameVersionFromContent returns the name and version of the chart signed by a provenance file
+func provenanceNameVersionFromContent(content []byte) (string, string, error) {
 	contentStr := string(content[:])
 
 	hasPGPBegin := strings.HasPrefix(contentStr, "-----BEGIN PGP SIGNED MESSAGE-----")
@@ -36,11 +46,9 @@ func ProvenanceFilenameFromContent(content []byte) (string, error) {
 	versionMatch := regexp.MustCompile("version:[ *](.+)").FindStringSubmatch(contentStr)
 
 	if !hasPGPBegin || len(nameMatch) != 2 || len(versionMatch) != 2 {
-		return "", ErrorInvalidProvenanceFile
+		return "", "", ErrorInvalidProvenanceFile
 	}
-
-	filename := ProvenanceFilenameFromNameVersion(nameMatch[1], versionMatch[1])
-	return filename, nil
+	return nameMatch[1], versionMatch[1], nil
 }
 
 func provenanceDigestFromContent(content []byte) (string, error) {
@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/Masterminds/semver"
+
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+// IndexPruning describes chart versions left out of index.yaml to keep it small, so that
+// helm search stays fast. Pruned chart versions are still indexed (listed by the API and
+// downloadable by exact URL), they are only generated into PrunedRaw instead of Raw.
+type IndexPruning struct {
+	MaxAge          time.Duration // if set, versions created longer ago are pruned, except the newest version of each chart
+	HidePrereleases bool          // if set, semver prerelease versions are pruned
+}
+
+// Enabled returns whether pruning leaves any chart version out of index.yaml
+func (pruning *IndexPruning) Enabled() bool {
+	return pruning != nil && (pruning.MaxAge > 0 || pruning.HidePrereleases)
+}
+
+// prune splits the entries of indexFile, sorted newest version first, into an index file of
+// chart versions kept in index.yaml, and an index file of chart versions pruned from it
+func (pruning *IndexPruning) prune(indexFile *helm_repo.IndexFile, now time.Time) (*helm_repo.IndexFile, *helm_repo.IndexFile) {
+	kept := *indexFile
+	kept.Entries = map[string]helm_repo.ChartVersions{}
+	pruned := *indexFile
+	pruned.Entries = map[string]helm_repo.ChartVersions{}
+	for name, chartVersions := range indexFile.Entries {
+		for _, chartVersion := range chartVersions {
+			if pruning.HidePrereleases && isPrerelease(chartVersion.Version) {
+				pruned.Entries[name] = append(pruned.Entries[name], chartVersion)
+				continue
+			}
+			newest := len(kept.Entries[name]) == 0
+			if pruning.MaxAge > 0 && !newest && now.Sub(chartVersion.Created) > pruning.MaxAge {
+				pruned.Entries[name] = append(pruned.Entries[name], chartVersion)
+				continue
+			}
+			kept.Entries[name] = append(kept.Entries[name], chartVersion)
+		}
+	}
+	return &kept, &pruned
+}
+
+// due returns whether a chart version of indexFile (sorted newest version first), which was kept in
+// index.yaml when generated, has aged beyond MaxAge by now
+func (pruning *IndexPruning) due(indexFile *helm_repo.IndexFile, generated time.Time, now time.Time) bool {
+	if pruning == nil || pruning.MaxAge <= 0 {
+		return false
+	}
+	for _, chartVersions := range indexFile.Entries {
+		newest := true
+		for _, chartVersion := range chartVersions {
+			if pruning.HidePrereleases && isPrerelease(chartVersion.Version) {
+				continue
+			}
+			if !newest && generated.Sub(chartVersion.Created) <= pruning.MaxAge && now.Sub(chartVersion.Created) > pruning.MaxAge {
+				return true
+			}
+			newest = false
+		}
+	}
+	return false
+}
+
+func isPrerelease(version string) bool {
+	v, err := semver.NewVersion(version)
+	return err == nil && v.Prerelease() != ""
+}
@@ -0,0 +1,79 @@
+package repo
+
+import (
+	pathutil "path"
+	"strings"
+
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/engine"
+	helm_chart "k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+var (
+	// DefaultRenderReleaseName is the release name used for rendering if none is given, as in "helm template"
+	DefaultRenderReleaseName = "RELEASE-NAME"
+
+	// DefaultRenderNamespace is the namespace used for rendering if none is given
+	DefaultRenderNamespace = "default"
+)
+
+// RenderedChart holds the manifests rendered from the templates of a chart package, by template path
+type RenderedChart struct {
+	Manifests map[string]string `json:"manifests"`
+	Notes     string            `json:"notes,omitempty"`
+}
+
+// RenderChartPackage renders the templates of a chart package with the given values (yaml or json)
+// merged over its defaults, like "helm template" does, without access to a cluster. Partials and
+// templates rendering to nothing are left out. Returns ErrorInvalidChartPackage if the package cannot
+// be loaded, any other error is caused by the values or a template failing with them.
+func RenderChartPackage(content []byte, values []byte, releaseName string, namespace string) (*RenderedChart, error) {
+	chart, err := chartFromContent(content)
+	if err != nil {
+		return nil, ErrorInvalidChartPackage
+	}
+	_, err = chartutil.ReadValues(values)
+	if err != nil {
+		return nil, err
+	}
+	if releaseName == "" {
+		releaseName = DefaultRenderReleaseName
+	}
+	if namespace == "" {
+		namespace = DefaultRenderNamespace
+	}
+
+	config := &helm_chart.Config{Raw: string(values)}
+	err = chartutil.ProcessRequirementsEnabled(chart, config)
+	if err != nil {
+		return nil, err
+	}
+	err = chartutil.ProcessRequirementsImportValues(chart)
+	if err != nil {
+		return nil, err
+	}
+	options := chartutil.ReleaseOptions{Name: releaseName, Namespace: namespace, IsInstall: true, Revision: 1}
+	renderValues, err := chartutil.ToRenderValues(chart, config, options)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := engine.New().Render(chart, renderValues)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RenderedChart{Manifests: map[string]string{}}
+	notesPath := pathutil.Join(chart.Metadata.Name, "templates", "NOTES.txt")
+	for path, manifest := range rendered {
+		base := pathutil.Base(path)
+		switch {
+		case path == notesPath:
+			result.Notes = manifest
+		case base == "NOTES.txt", strings.HasPrefix(base, "_"), strings.TrimSpace(manifest) == "":
+			continue
+		default:
+			result.Manifests[path] = manifest
+		}
+	}
+	return result, nil
+}
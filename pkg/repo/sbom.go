@@ -0,0 +1,288 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"time"
+
+	"k8s.io/helm/pkg/chartutil"
+)
+
+var (
+	// SBOMFormatSPDX is the SPDX (2.3, JSON) format of SBOMs
+	SBOMFormatSPDX = "spdx"
+
+	// SBOMFormatCycloneDX is the CycloneDX (1.4, JSON) format of SBOMs
+	SBOMFormatCycloneDX = "cyclonedx"
+
+	// ErrorUnknownSBOMFormat is raised when an SBOM is requested in a format other than SBOMFormatSPDX or SBOMFormatCycloneDX
+	ErrorUnknownSBOMFormat = errors.New("unknown SBOM format, must be \"spdx\" or \"cyclonedx\"")
+
+	// manifestImagePattern matches the image of a container in a rendered manifest
+	manifestImagePattern = regexp.MustCompile(`(?m)^\s*(?:-\s+)?image:\s*["']?([^"'\s]+)["']?\s*$`)
+)
+
+type (
+	// SBOM is the software bill of materials of a chart package: the container images it deploys,
+	// the charts it depends on and an inventory of its files. It is rendered as SPDX or CycloneDX.
+	SBOM struct {
+		Name         string            `json:"name"`
+		Version      string            `json:"version"`
+		Digest       string            `json:"digest"`
+		Created      time.Time         `json:"created"`
+		Images       []string          `json:"images"`
+		Dependencies []ChartDependency `json:"dependencies"`
+		Files        []SBOMFile        `json:"files"`
+	}
+
+	// SBOMFile is a file of a chart package
+	SBOMFile struct {
+		Path   string `json:"path"`
+		Size   int64  `json:"size"`
+		SHA256 string `json:"sha256"`
+	}
+)
+
+// ChartPackageSBOM generates the SBOM of a chart package. Images are those of containers in the
+// manifests rendered with default values, or, if the chart can't be rendered without more values,
+// those set in its default values.
+func ChartPackageSBOM(content []byte, created time.Time) (*SBOM, error) {
+	chart, err := chartFromContent(content)
+	if err != nil {
+		return nil, ErrorInvalidChartPackage
+	}
+	digest, err := ChartPackageDigest(content)
+	if err != nil {
+		return nil, err
+	}
+	dependencies, err := ChartDependenciesFromContent(content)
+	if err != nil {
+		return nil, err
+	}
+	files, err := chartPackageFiles(content)
+	if err != nil {
+		return nil, err
+	}
+	sbom := &SBOM{
+		Name:         chart.Metadata.Name,
+		Version:      chart.Metadata.Version,
+		Digest:       digest,
+		Created:      created.UTC(),
+		Dependencies: dependencies,
+		Files:        files,
+	}
+
+	images := map[string]bool{}
+	rendered, err := RenderChartPackage(content, nil, "", "")
+	if err == nil {
+		for _, manifest := range rendered.Manifests {
+			for _, match := range manifestImagePattern.FindAllStringSubmatch(manifest, -1) {
+				images[match[1]] = true
+			}
+		}
+	} else if chart.Values != nil {
+		values, err := chartutil.ReadValues([]byte(chart.Values.Raw))
+		if err == nil {
+			collectValuesImages(values, images)
+		}
+	}
+	sbom.Images = []string{}
+	for image := range images {
+		sbom.Images = append(sbom.Images, image)
+	}
+	sort.Strings(sbom.Images)
+	return sbom, nil
+}
+
+// collectValuesImages adds the images set in values, either as image: <image>, or as
+// image: {registry: <registry>, repository: <repository>, tag: <tag>}
+func collectValuesImages(values map[string]interface{}, images map[string]bool) {
+	for key, value := range values {
+		switch value := value.(type) {
+		case string:
+			if key == "image" && value != "" {
+				images[value] = true
+			}
+		case map[string]interface{}:
+			repository, _ := value["repository"].(string)
+			if key != "image" || repository == "" {
+				collectValuesImages(value, images)
+				continue
+			}
+			if registry, ok := value["registry"].(string); ok && registry != "" {
+				repository = registry + "/" + repository
+			}
+			if tag := fmt.Sprint(value["tag"]); value["tag"] != nil && tag != "" {
+				repository = repository + ":" + tag
+			}
+			images[repository] = true
+		}
+	}
+}
+
+// chartPackageFiles lists the regular files of a chart package, in archive order
+func chartPackageFiles(content []byte) ([]SBOMFile, error) {
+	gz, err := gzip.NewReader(bytes.NewBuffer(content))
+	if err != nil {
+		return nil, ErrorInvalidChartPackage
+	}
+	defer gz.Close()
+	files := []SBOMFile{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, ErrorInvalidChartPackage
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+		hash := sha256.New()
+		size, err := io.Copy(hash, tr)
+		if err != nil {
+			return nil, ErrorInvalidChartPackage
+		}
+		files = append(files, SBOMFile{Path: header.Name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))})
+	}
+}
+
+// Render returns the SBOM in format, SBOMFormatSPDX or SBOMFormatCycloneDX, as JSON
+func (sbom *SBOM) Render(format string) ([]byte, error) {
+	switch format {
+	case SBOMFormatSPDX:
+		return json.Marshal(sbom.spdx())
+	case SBOMFormatCycloneDX:
+		return json.Marshal(sbom.cycloneDX())
+	}
+	return nil, ErrorUnknownSBOMFormat
+}
+
+type jsonObject map[string]interface{}
+
+// spdx returns the SBOM as an SPDX document describing the chart, which contains its files and
+// depends on its images and dependencies
+func (sbom *SBOM) spdx() jsonObject {
+	chartPackage := jsonObject{
+		"SPDXID":           "SPDXRef-Chart",
+		"name":             sbom.Name,
+		"versionInfo":      sbom.Version,
+		"downloadLocation": "NOASSERTION",
+		"filesAnalyzed":    false,
+		"checksums":        []jsonObject{{"algorithm": "SHA256", "checksumValue": sbom.Digest}},
+	}
+	packages := []jsonObject{chartPackage}
+	files := []jsonObject{}
+	relationships := []jsonObject{spdxRelationship("SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Chart")}
+	for i, image := range sbom.Images {
+		id := fmt.Sprintf("SPDXRef-Image-%d", i+1)
+		packages = append(packages, jsonObject{
+			"SPDXID":                id,
+			"name":                  image,
+			"downloadLocation":      "NOASSERTION",
+			"filesAnalyzed":         false,
+			"primaryPackagePurpose": "CONTAINER",
+		})
+		relationships = append(relationships, spdxRelationship("SPDXRef-Chart", "DEPENDS_ON", id))
+	}
+	for i, dependency := range sbom.Dependencies {
+		id := fmt.Sprintf("SPDXRef-Dependency-%d", i+1)
+		downloadLocation := dependency.Repository
+		if downloadLocation == "" {
+			downloadLocation = "NOASSERTION"
+		}
+		packages = append(packages, jsonObject{
+			"SPDXID":           id,
+			"name":             dependency.Name,
+			"versionInfo":      dependency.Version,
+			"downloadLocation": downloadLocation,
+			"filesAnalyzed":    false,
+		})
+		relationships = append(relationships, spdxRelationship("SPDXRef-Chart", "DEPENDS_ON", id))
+	}
+	for i, file := range sbom.Files {
+		id := fmt.Sprintf("SPDXRef-File-%d", i+1)
+		files = append(files, jsonObject{
+			"SPDXID":    id,
+			"fileName":  "./" + file.Path,
+			"checksums": []jsonObject{{"algorithm": "SHA256", "checksumValue": file.SHA256}},
+		})
+		relationships = append(relationships, spdxRelationship("SPDXRef-Chart", "CONTAINS", id))
+	}
+	return jsonObject{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              fmt.Sprintf("%s-%s", sbom.Name, sbom.Version),
+		"documentNamespace": fmt.Sprintf("urn:chartmuseum:sbom:%s-%s:%s", sbom.Name, sbom.Version, sbom.Digest),
+		"creationInfo": jsonObject{
+			"created":  sbom.Created.Format(time.RFC3339),
+			"creators": []string{"Tool: chartmuseum"},
+		},
+		"packages":      packages,
+		"files":         files,
+		"relationships": relationships,
+	}
+}
+
+func spdxRelationship(from string, relationship string, to string) jsonObject {
+	return jsonObject{"spdxElementId": from, "relationshipType": relationship, "relatedSpdxElement": to}
+}
+
+// cycloneDX returns the SBOM as a CycloneDX BOM of the chart, with its images, dependencies and
+// files as components
+func (sbom *SBOM) cycloneDX() jsonObject {
+	components := []jsonObject{}
+	dependsOn := []string{}
+	for _, image := range sbom.Images {
+		ref := "image:" + image
+		components = append(components, jsonObject{"type": "container", "bom-ref": ref, "name": image})
+		dependsOn = append(dependsOn, ref)
+	}
+	for _, dependency := range sbom.Dependencies {
+		ref := fmt.Sprintf("chart:%s@%s", dependency.Name, dependency.Version)
+		component := jsonObject{"type": "application", "bom-ref": ref, "name": dependency.Name, "version": dependency.Version}
+		if dependency.Repository != "" {
+			component["externalReferences"] = []jsonObject{{"type": "distribution", "url": dependency.Repository}}
+		}
+		components = append(components, component)
+		dependsOn = append(dependsOn, ref)
+	}
+	for _, file := range sbom.Files {
+		components = append(components, jsonObject{
+			"type":    "file",
+			"bom-ref": "file:" + file.Path,
+			"name":    file.Path,
+			"hashes":  []jsonObject{{"alg": "SHA-256", "content": file.SHA256}},
+		})
+	}
+	return jsonObject{
+		"bomFormat":   "CycloneDX",
+		"specVersion": "1.4",
+		"version":     1,
+		"metadata": jsonObject{
+			"timestamp": sbom.Created.Format(time.RFC3339),
+			"tools":     []jsonObject{{"name": "chartmuseum"}},
+			"component": jsonObject{
+				"type":    "application",
+				"bom-ref": "chart",
+				"name":    sbom.Name,
+				"version": sbom.Version,
+				"hashes":  []jsonObject{{"alg": "SHA-256", "content": sbom.Digest}},
+			},
+		},
+		"components":   components,
+		"dependencies": []jsonObject{{"ref": "chart", "dependsOn": dependsOn}},
+	}
+}
@@ -0,0 +1,85 @@
+package repo
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	pathutil "path"
+	"regexp"
+	"strings"
+)
+
+// SecretFinding is a line of a chart package which likely holds a secret
+type SecretFinding struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Rule string `json:"rule"`
+}
+
+// secretRules are patterns of well-known credentials, named after what they detect
+var secretRules = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"aws-access-key-id", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-access-key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}\b`)},
+	{"private-key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY( BLOCK)?-----`)},
+	{"github-token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}`)},
+	{"google-api-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+}
+
+// FindChartPackageSecrets scans the values.yaml files and templates of a chart package (including
+// bundled subcharts) for likely secrets. The secrets themselves are not returned, so findings can
+// be logged safely.
+func FindChartPackageSecrets(content []byte) ([]SecretFinding, error) {
+	gz, err := gzip.NewReader(bytes.NewBuffer(content))
+	if err != nil {
+		return nil, ErrorInvalidChartPackage
+	}
+	defer gz.Close()
+	findings := []SecretFinding{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return findings, nil
+		}
+		if err != nil {
+			return nil, ErrorInvalidChartPackage
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if !isSecretScannedFile(header.Name) {
+			continue
+		}
+		scanner := bufio.NewScanner(tr)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			for _, rule := range secretRules {
+				if rule.pattern.Match(scanner.Bytes()) {
+					findings = append(findings, SecretFinding{File: header.Name, Line: line, Rule: rule.name})
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// isSecretScannedFile checks whether a file of a chart package is a values.yaml file or a template
+func isSecretScannedFile(name string) bool {
+	if pathutil.Base(name) == "values.yaml" {
+		return true
+	}
+	for _, part := range strings.Split(pathutil.Dir(name), "/") {
+		if part == "templates" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ghodss/yaml"
+
+	helm_repo "k8s.io/helm/pkg/repo"
+)
+
+var errShardPlaceholderMissing = errors.New("unable to find entries in marshaled index")
+
+// IndexShards splits the entries of an index by the first character of chart names, and caches
+// the marshaled entries of each shard. On Regenerate, only shards with changed entries are
+// marshaled again (in parallel) before being merged into the final index.yaml.
+type IndexShards struct {
+	raw   map[string][]byte
+	dirty map[string]bool
+}
+
+// NewIndexShards creates a new instance of IndexShards
+func NewIndexShards() *IndexShards {
+	return &IndexShards{
+		raw:   map[string][]byte{},
+		dirty: map[string]bool{},
+	}
+}
+
+// invalidate marks the shard containing chart name as changed
+func (shards *IndexShards) invalidate(name string) {
+	shards.dirty[indexShardKey(name)] = true
+}
+
+// marshal returns the yaml for indexFile, the same as yaml.Marshal would, reusing the cached
+// yaml of unchanged shards
+func (shards *IndexShards) marshal(indexFile *helm_repo.IndexFile) ([]byte, error) {
+	entries := map[string]map[string]helm_repo.ChartVersions{}
+	for name, chartVersions := range indexFile.Entries {
+		key := indexShardKey(name)
+		if _, ok := entries[key]; !ok {
+			entries[key] = map[string]helm_repo.ChartVersions{}
+		}
+		entries[key][name] = chartVersions
+	}
+	for key := range shards.raw {
+		if _, ok := entries[key]; !ok {
+			delete(shards.raw, key)
+		}
+	}
+
+	type shardResult struct {
+		key string
+		raw []byte
+		err error
+	}
+	var wg sync.WaitGroup
+	results := make(chan shardResult, len(entries))
+	for key, shardEntries := range entries {
+		if _, cached := shards.raw[key]; cached && !shards.dirty[key] {
+			continue
+		}
+		wg.Add(1)
+		go func(key string, shardEntries map[string]helm_repo.ChartVersions) {
+			defer wg.Done()
+			raw, err := yaml.Marshal(shardEntries)
+			results <- shardResult{key, indentYAML(raw), err}
+		}(key, shardEntries)
+	}
+	wg.Wait()
+	close(results)
+	for result := range results {
+		if result.err != nil {
+			return nil, result.err
+		}
+		shards.raw[result.key] = result.raw
+	}
+	shards.dirty = map[string]bool{}
+
+	// marshal everything but the entries, then put the shards in place of the empty entries
+	header := *indexFile
+	header.Entries = map[string]helm_repo.ChartVersions{}
+	raw, err := yaml.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return raw, nil
+	}
+	keys := []string{}
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return indexShardKeyLess(keys[i], keys[j])
+	})
+
+	// the index is written once into a buffer of its exact size: for large indexes, building it
+	// up (or replacing into a copy) would hold several copies at once
+	placeholder := []byte("entries: {}\n")
+	i := bytes.Index(raw, placeholder)
+	if i < 0 {
+		return nil, errShardPlaceholderMissing
+	}
+	size := len(raw) - len(placeholder) + len("entries:\n")
+	for _, key := range keys {
+		size += len(shards.raw[key])
+	}
+	merged := make([]byte, 0, size)
+	merged = append(merged, raw[:i]...)
+	merged = append(merged, "entries:\n"...)
+	for _, key := range keys {
+		merged = append(merged, shards.raw[key]...)
+	}
+	return append(merged, raw[i+len(placeholder):]...), nil
+}
+
+// indexShardKey returns the key of the shard containing chart name. Names starting with a digit
+// share a shard, since yaml orders them by the value of their leading number.
+func indexShardKey(name string) string {
+	r, _ := utf8.DecodeRuneInString(name)
+	if unicode.IsDigit(r) {
+		return "0"
+	}
+	return string(r)
+}
+
+// indexShardKeyLess orders shards the way yaml orders map keys: other characters, then digits, then letters
+func indexShardKeyLess(a string, b string) bool {
+	ar, _ := utf8.DecodeRuneInString(a)
+	br, _ := utf8.DecodeRuneInString(b)
+	if ac, bc := indexShardKeyClass(ar), indexShardKeyClass(br); ac != bc {
+		return ac < bc
+	}
+	return ar < br
+}
+
+func indexShardKeyClass(r rune) int {
+	switch {
+	case unicode.IsLetter(r):
+		return 2
+	case unicode.IsDigit(r):
+		return 1
+	}
+	return 0
+}
+
+// indentYAML indents every non-empty line of raw by two spaces, to nest it under "entries:"
+func indentYAML(raw []byte) []byte {
+	var indented bytes.Buffer
+	for _, line := range bytes.SplitAfter(raw, []byte("\n")) {
+		if len(line) > 0 && line[0] != '\n' {
+			indented.WriteString("  ")
+		}
+		indented.Write(line)
+	}
+	return indented.Bytes()
+}
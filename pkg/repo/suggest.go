@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// SuggestChartNames returns up to n names of charts in the index which are close to name, e.g.
+// for a typo, closest first
+func (index *Index) SuggestChartNames(name string, n int) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	name = strings.ToLower(name)
+	maxDistance := len(name)/3 + 1
+	var candidates []candidate
+	for _, chartName := range index.chartNames() {
+		lower := strings.ToLower(chartName)
+		distance := editDistance(name, lower)
+		if distance > maxDistance && !(len(name) > 2 && strings.Contains(lower, name)) {
+			continue
+		}
+		candidates = append(candidates, candidate{chartName, distance})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+	suggestions := []string{}
+	for i := 0; i < len(candidates) && i < n; i++ {
+		suggestions = append(suggestions, candidates[i].name)
+	}
+	return suggestions
+}
+
+// SuggestChartVersions returns up to n versions of chart name which are nearest to version,
+// nearest first. Versions which are not semver are only suggested if version is not either.
+func (index *Index) SuggestChartVersions(name string, version string, n int) []string {
+	type candidate struct {
+		version  string
+		distance [3]int64
+	}
+	target, targetErr := semver.NewVersion(version)
+	var candidates []candidate
+	for _, chartVersion := range index.Entries[name] {
+		c := candidate{version: chartVersion.Version}
+		if v, err := semver.NewVersion(chartVersion.Version); err == nil && targetErr == nil {
+			c.distance = [3]int64{abs(v.Major() - target.Major()), abs(v.Minor() - target.Minor()), abs(v.Patch() - target.Patch())}
+		} else if err == nil || targetErr == nil {
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].distance, candidates[j].distance
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	suggestions := []string{}
+	for i := 0; i < len(candidates) && i < n; i++ {
+		suggestions = append(suggestions, candidates[i].version)
+	}
+	return suggestions
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a string, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(br)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func abs(i int64) int64 {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
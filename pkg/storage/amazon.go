@@ -2,64 +2,144 @@ package storage
 
 import (
 	"bytes"
-	"io/ioutil"
+	"context"
+	"encoding/json"
+	"net/url"
 	pathutil "path"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/sqs"
 )
 
 // AmazonS3Backend is a storage backend for Amazon S3
 type AmazonS3Backend struct {
-	Bucket     string
-	Client     *s3.S3
-	Downloader *s3manager.Downloader
-	Prefix     string
-	Uploader   *s3manager.Uploader
+	Bucket         string
+	Client         *s3.S3
+	Downloader     *s3manager.Downloader
+	Prefix         string
+	Uploader       *s3manager.Uploader
+	ChangeQueue    *sqs.SQS
+	ChangeQueueURL string // SQS queue the event notifications of the bucket are sent to, for listing changes
 }
 
+// amazonS3EventNotification is the body of an S3 event notification message
+type amazonS3EventNotification struct {
+	Records []struct {
+		EventName string    `json:"eventName"`
+		EventTime time.Time `json:"eventTime"`
+		S3        struct {
+			Object struct {
+				Key  string `json:"key"`
+				ETag string `json:"eTag"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// AmazonS3AssumeRole configures an IAM role to assume for accessing the bucket, instead of
+// using the credentials found in the environment directly
+type AmazonS3AssumeRole struct {
+	RoleARN              string
+	ExternalID           string
+	SessionName          string
+	WebIdentityTokenFile string // if set, assume the role with this web identity token (e.g. IRSA)
+}
+
+// amazonS3DefaultSessionName is used for assumed role sessions if none is configured
+const amazonS3DefaultSessionName = "chartmuseum"
+
 // NewAmazonS3Backend creates a new instance of AmazonS3Backend
 func NewAmazonS3Backend(bucket string, prefix string, region string, endpoint string) *AmazonS3Backend {
-	service := s3.New(session.New(), &aws.Config{
+	return newAmazonS3Backend(bucket, prefix, region, endpoint, nil)
+}
+
+// NewAmazonS3BackendWithAssumeRole creates a new instance of AmazonS3Backend, accessing the bucket
+// using temporary credentials for the given role
+func NewAmazonS3BackendWithAssumeRole(bucket string, prefix string, region string, endpoint string, role AmazonS3AssumeRole) *AmazonS3Backend {
+	return newAmazonS3Backend(bucket, prefix, region, endpoint, &role)
+}
+
+func newAmazonS3Backend(bucket string, prefix string, region string, endpoint string, role *AmazonS3AssumeRole) *AmazonS3Backend {
+	sess := session.New(&aws.Config{
+		Region: aws.String(region),
+	})
+	config := &aws.Config{
 		Region:           aws.String(region),
 		Endpoint:         aws.String(endpoint),
 		DisableSSL:       aws.Bool(strings.HasPrefix(endpoint, "http://")),
 		S3ForcePathStyle: aws.Bool(endpoint != ""),
-	})
+	}
+	if role != nil {
+		sessionName := role.SessionName
+		if sessionName == "" {
+			sessionName = amazonS3DefaultSessionName
+		}
+		if role.WebIdentityTokenFile != "" {
+			config.Credentials = stscreds.NewWebIdentityCredentials(sess, role.RoleARN, sessionName, role.WebIdentityTokenFile)
+		} else {
+			config.Credentials = stscreds.NewCredentials(sess, role.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+				p.RoleSessionName = sessionName
+				if role.ExternalID != "" {
+					p.ExternalID = aws.String(role.ExternalID)
+				}
+			})
+		}
+	}
+	service := s3.New(sess, config)
 	b := &AmazonS3Backend{
-		Bucket:     bucket,
-		Client:     service,
-		Downloader: s3manager.NewDownloaderWithClient(service),
-		Prefix:     cleanPrefix(prefix),
-		Uploader:   s3manager.NewUploaderWithClient(service),
+		Bucket:      bucket,
+		Client:      service,
+		Downloader:  s3manager.NewDownloaderWithClient(service),
+		Prefix:      cleanPrefix(prefix),
+		Uploader:    s3manager.NewUploaderWithClient(service),
+		ChangeQueue: sqs.New(sess, &aws.Config{Region: aws.String(region), Credentials: config.Credentials}),
 	}
 	return b
 }
 
 // ListObjects lists all objects in Amazon S3 bucket, at prefix
 func (b AmazonS3Backend) ListObjects() ([]Object, error) {
+	return b.listObjects(context.Background(), false)
+}
+
+// ListObjectsWithContext lists all objects in Amazon S3 bucket, at prefix, giving up when ctx is done
+func (b AmazonS3Backend) ListObjectsWithContext(ctx context.Context) ([]Object, error) {
+	return b.listObjects(ctx, false)
+}
+
+// ListNestedObjects lists all objects in Amazon S3 bucket, at prefix, including those below subdirectories
+func (b AmazonS3Backend) ListNestedObjects() ([]Object, error) {
+	return b.listObjects(context.Background(), true)
+}
+
+func (b AmazonS3Backend) listObjects(ctx context.Context, nested bool) ([]Object, error) {
 	var objects []Object
 	s3Input := &s3.ListObjectsInput{
 		Bucket: aws.String(b.Bucket),
 		Prefix: aws.String(b.Prefix),
 	}
 	for {
-		s3Result, err := b.Client.ListObjects(s3Input)
+		s3Result, err := b.Client.ListObjectsWithContext(ctx, s3Input)
 		if err != nil {
 			return objects, err
 		}
 		for _, obj := range s3Result.Contents {
 			path := removePrefixFromObjectPath(b.Prefix, *obj.Key)
-			if objectPathIsInvalid(path) {
+			if objectPathIsInvalid(path, nested) {
 				continue
 			}
 			object := Object{
 				Path:         path,
 				Content:      []byte{},
 				LastModified: *obj.LastModified,
+				Digest:       strings.Trim(aws.StringValue(obj.ETag), `"`),
 			}
 			objects = append(objects, object)
 		}
@@ -71,8 +151,219 @@ func (b AmazonS3Backend) ListObjects() ([]Object, error) {
 	return objects, nil
 }
 
+// ListObjectsWithChangeToken lists all objects in Amazon S3 bucket, at prefix, along with a change token
+// if ChangeQueueURL is set (an empty one otherwise)
+func (b AmazonS3Backend) ListObjectsWithChangeToken() ([]Object, string, error) {
+	return b.listObjectsWithChangeToken(false)
+}
+
+// ListNestedObjectsWithChangeToken lists all objects in Amazon S3 bucket, at prefix, including those below
+// subdirectories, along with a change token if ChangeQueueURL is set
+func (b AmazonS3Backend) ListNestedObjectsWithChangeToken() ([]Object, string, error) {
+	return b.listObjectsWithChangeToken(true)
+}
+
+// ListChanges returns the objects in Amazon S3 bucket, at prefix, added, updated and removed since token,
+// from the event notifications received on ChangeQueueURL since
+func (b AmazonS3Backend) ListChanges(token string) (ObjectChanges, error) {
+	return b.listChanges(token, false)
+}
+
+// ListNestedChanges returns the changes to objects in Amazon S3 bucket, at prefix, since token, including
+// those below subdirectories
+func (b AmazonS3Backend) ListNestedChanges(token string) (ObjectChanges, error) {
+	return b.listChanges(token, true)
+}
+
+func (b AmazonS3Backend) listObjectsWithChangeToken(nested bool) ([]Object, string, error) {
+	if b.ChangeQueueURL == "" {
+		objects, err := b.listObjects(context.Background(), nested)
+		return objects, "", err
+	}
+	// notifications received until now are made obsolete by the listing
+	token := time.Now().Format(time.RFC3339Nano)
+	_, err := b.receiveChanges(nested)
+	if err != nil {
+		return nil, "", err
+	}
+	objects, err := b.listObjects(context.Background(), nested)
+	if err != nil {
+		return nil, "", err
+	}
+	return objects, token, nil
+}
+
+func (b AmazonS3Backend) listChanges(token string, nested bool) (ObjectChanges, error) {
+	issued, err := time.Parse(time.RFC3339Nano, token)
+	if b.ChangeQueueURL == "" || err != nil {
+		return ObjectChanges{}, ErrChangeTokenExpired
+	}
+	retention, err := b.changeQueueRetention()
+	if err != nil {
+		return ObjectChanges{}, err
+	}
+	if time.Since(issued) >= retention {
+		// notifications sent right after the token was issued may have been dropped from the queue
+		return ObjectChanges{}, ErrChangeTokenExpired
+	}
+	next := time.Now().Format(time.RFC3339Nano)
+	changes, err := b.receiveChanges(nested)
+	if err != nil {
+		return ObjectChanges{}, err
+	}
+	changes.Token = next
+	return changes, nil
+}
+
+// changeQueueRetention returns how long messages are kept in the change queue
+func (b AmazonS3Backend) changeQueueRetention() (time.Duration, error) {
+	output, err := b.ChangeQueue.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(b.ChangeQueueURL),
+		AttributeNames: []*string{aws.String(sqs.QueueAttributeNameMessageRetentionPeriod)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	seconds, err := strconv.Atoi(aws.StringValue(output.Attributes[sqs.QueueAttributeNameMessageRetentionPeriod]))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// receiveChanges receives all messages in the change queue, then deletes them. If they can't all be
+// deleted, ErrChangeTokenExpired is returned since the changes of those which were are lost.
+func (b AmazonS3Backend) receiveChanges(nested bool) (ObjectChanges, error) {
+	var messages []*sqs.Message
+	for {
+		output, err := b.ChangeQueue.ReceiveMessage(&sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(b.ChangeQueueURL),
+			MaxNumberOfMessages: aws.Int64(10),
+		})
+		if err != nil {
+			return ObjectChanges{}, err
+		}
+		if len(output.Messages) == 0 {
+			break
+		}
+		messages = append(messages, output.Messages...)
+	}
+
+	var bodies []string
+	for _, message := range messages {
+		bodies = append(bodies, aws.StringValue(message.Body))
+		_, err := b.ChangeQueue.DeleteMessage(&sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(b.ChangeQueueURL),
+			ReceiptHandle: message.ReceiptHandle,
+		})
+		if err != nil {
+			return ObjectChanges{}, ErrChangeTokenExpired
+		}
+	}
+	return amazonS3ChangesFromNotifications(b.Prefix, bodies, nested), nil
+}
+
+// amazonS3ChangesFromNotifications returns the changes to objects at prefix described by the bodies of
+// S3 event notification messages, keeping the latest event of each object. Other messages are skipped.
+func amazonS3ChangesFromNotifications(prefix string, bodies []string, nested bool) ObjectChanges {
+	var paths []string
+	latest := map[string]Object{}
+	removed := map[string]bool{}
+	for _, body := range bodies {
+		var notification amazonS3EventNotification
+		if json.Unmarshal([]byte(body), &notification) != nil {
+			continue
+		}
+		for _, record := range notification.Records {
+			isRemoved := strings.HasPrefix(record.EventName, "ObjectRemoved:")
+			if !isRemoved && !strings.HasPrefix(record.EventName, "ObjectCreated:") {
+				continue
+			}
+			// keys are URL-encoded in notifications
+			key, err := url.QueryUnescape(record.S3.Object.Key)
+			if err != nil || (prefix != "" && !strings.HasPrefix(key, prefix+"/")) {
+				continue
+			}
+			path := removePrefixFromObjectPath(prefix, key)
+			if objectPathIsInvalid(path, nested) {
+				continue
+			}
+			object, seen := latest[path]
+			if seen && record.EventTime.Before(object.LastModified) {
+				continue
+			}
+			if !seen {
+				paths = append(paths, path)
+			}
+			latest[path] = Object{Path: path, Content: []byte{}, LastModified: record.EventTime, Digest: record.S3.Object.ETag}
+			removed[path] = isRemoved
+		}
+	}
+
+	changes := ObjectChanges{}
+	for _, path := range paths {
+		if removed[path] {
+			changes.Removed = append(changes.Removed, path)
+		} else {
+			changes.Updated = append(changes.Updated, latest[path])
+		}
+	}
+	return changes
+}
+
+// ListObjectsPage lists a page of the objects in Amazon S3 bucket, at prefix, whose path starts with
+// prefix (below the one of the backend), including those below subdirectories
+func (b AmazonS3Backend) ListObjectsPage(prefix string, token string, max int) (ObjectPage, error) {
+	var page ObjectPage
+	if max <= 0 {
+		max = defaultPageSize
+	}
+	s3Input := &s3.ListObjectsInput{
+		Bucket:  aws.String(b.Bucket),
+		Prefix:  aws.String(b.objectKeyPrefix(prefix)),
+		MaxKeys: aws.Int64(int64(max)),
+	}
+	if token != "" {
+		s3Input.Marker = aws.String(b.objectKeyPrefix(token))
+	}
+	s3Result, err := b.Client.ListObjects(s3Input)
+	if err != nil {
+		return page, err
+	}
+	for _, obj := range s3Result.Contents {
+		path := removePrefixFromObjectPath(b.Prefix, *obj.Key)
+		if objectPathIsInvalid(path, true) {
+			continue
+		}
+		page.Objects = append(page.Objects, Object{
+			Path:         path,
+			Content:      []byte{},
+			LastModified: *obj.LastModified,
+			Digest:       strings.Trim(aws.StringValue(obj.ETag), `"`),
+		})
+	}
+	if aws.BoolValue(s3Result.IsTruncated) && len(s3Result.Contents) > 0 {
+		page.NextToken = removePrefixFromObjectPath(b.Prefix, *s3Result.Contents[len(s3Result.Contents)-1].Key)
+	}
+	return page, nil
+}
+
+// objectKeyPrefix returns the start of the keys of objects whose path starts with prefix. Unlike
+// joining paths, a trailing slash is kept.
+func (b AmazonS3Backend) objectKeyPrefix(prefix string) string {
+	if b.Prefix == "" {
+		return prefix
+	}
+	return b.Prefix + "/" + prefix
+}
+
 // GetObject retrieves an object from Amazon S3 bucket, at prefix
 func (b AmazonS3Backend) GetObject(path string) (Object, error) {
+	return b.GetObjectWithContext(context.Background(), path)
+}
+
+// GetObjectWithContext retrieves an object from Amazon S3 bucket, at prefix, giving up when ctx is done
+func (b AmazonS3Backend) GetObjectWithContext(ctx context.Context, path string) (Object, error) {
 	var object Object
 	object.Path = path
 	var content []byte
@@ -80,11 +371,12 @@ func (b AmazonS3Backend) GetObject(path string) (Object, error) {
 		Bucket: aws.String(b.Bucket),
 		Key:    aws.String(pathutil.Join(b.Prefix, path)),
 	}
-	s3Result, err := b.Client.GetObject(s3Input)
+	s3Result, err := b.Client.GetObjectWithContext(ctx, s3Input)
 	if err != nil {
 		return object, err
 	}
-	content, err = ioutil.ReadAll(s3Result.Body)
+	defer s3Result.Body.Close()
+	content, err = readAllWithContext(ctx, s3Result.Body)
 	if err != nil {
 		return object, err
 	}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"fmt"
 	"os"
 	"testing"
 
@@ -51,6 +52,46 @@ func (suite *AmazonTestSuite) TestPutObject() {
 	suite.NotNil(err, "cannot put objects with bad bucket")
 }
 
+type AmazonChangesTestSuite struct {
+	suite.Suite
+}
+
+func (suite *AmazonChangesTestSuite) TestChangesFromNotifications() {
+	notification := func(eventName string, key string, eventTime string) string {
+		return fmt.Sprintf(`{"Records": [{"eventName": %q, "eventTime": %q, "s3": {"object": {"key": %q, "eTag": "abc"}}}]}`,
+			eventName, eventTime, key)
+	}
+	bodies := []string{
+		`{"Service": "Amazon S3", "Event": "s3:TestEvent"}`,
+		"not json",
+		notification("ObjectCreated:Put", "charts/mychart-0.1.0.tgz", "2026-10-16T10:00:00.000Z"),
+		notification("ObjectCreated:Put", "charts/my+chart-0.2.0.tgz", "2026-10-16T10:00:01.000Z"),
+		notification("ObjectRemoved:Delete", "charts/oldchart-0.1.0.tgz", "2026-10-16T10:00:02.000Z"),
+		notification("ObjectCreated:Put", "charts/tmpchart-0.1.0.tgz", "2026-10-16T10:00:03.000Z"),
+		notification("ObjectRemoved:Delete", "charts/tmpchart-0.1.0.tgz", "2026-10-16T10:00:04.000Z"),
+		notification("ObjectRemoved:Delete", "charts/mychart-0.1.0.tgz", "2026-10-16T09:59:00.000Z"),
+		notification("ObjectRestore:Completed", "charts/restored-0.1.0.tgz", "2026-10-16T10:00:05.000Z"),
+		notification("ObjectCreated:Put", "elsewhere/mychart-0.1.0.tgz", "2026-10-16T10:00:06.000Z"),
+		notification("ObjectCreated:Put", "charts/mychart/0.1.0/mychart-0.1.0.tgz", "2026-10-16T10:00:07.000Z"),
+	}
+
+	changes := amazonS3ChangesFromNotifications("charts", bodies, false)
+	var updated []string
+	for _, object := range changes.Updated {
+		updated = append(updated, object.Path)
+	}
+	suite.Equal([]string{"mychart-0.1.0.tgz", "my chart-0.2.0.tgz"}, updated, "objects created at prefix updated, latest event wins")
+	suite.Equal([]string{"oldchart-0.1.0.tgz", "tmpchart-0.1.0.tgz"}, changes.Removed, "objects removed at prefix removed")
+	suite.Equal("abc", changes.Updated[0].Digest, "digest of updated object from its etag")
+
+	changes = amazonS3ChangesFromNotifications("charts", bodies, true)
+	suite.Equal(3, len(changes.Updated), "objects below subdirectories updated when nested")
+}
+
+func TestAmazonChangesTestSuite(t *testing.T) {
+	suite.Run(t, new(AmazonChangesTestSuite))
+}
+
 func TestAmazonStorageTestSuite(t *testing.T) {
 	if os.Getenv("TEST_CLOUD_STORAGE") == "1" {
 		suite.Run(t, new(AmazonTestSuite))
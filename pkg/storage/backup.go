@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackupManifestFileName is the name of the file describing a backup snapshot. It is written
+// last, so snapshots without a manifest are incomplete and ignored.
+const BackupManifestFileName = "manifest.json"
+
+// BackupSnapshotIDFormat is the time format used for backup snapshot ids, which sort chronologically
+const BackupSnapshotIDFormat = "20060102150405"
+
+// BackupManifest describes the contents of a backup snapshot
+type BackupManifest struct {
+	ID      string            `json:"id"`
+	Created time.Time         `json:"created"`
+	Objects map[string]string `json:"objects"` // path -> sha256 digest
+}
+
+var errBackupNotNested = errors.New("backup backend does not support listing snapshots")
+
+// CreateBackupSnapshot copies all objects from source, along with any extra files (e.g. the index),
+// below a new snapshot directory in target
+func CreateBackupSnapshot(source Backend, target Backend, extra map[string][]byte) (BackupManifest, error) {
+	now := time.Now().UTC()
+	manifest := BackupManifest{
+		ID:      now.Format(BackupSnapshotIDFormat),
+		Created: now,
+		Objects: map[string]string{},
+	}
+
+	put := func(path string, content []byte) error {
+		err := target.PutObject(backupObjectPath(manifest.ID, path), content)
+		if err != nil {
+			return err
+		}
+		manifest.Objects[path] = backupDigest(content)
+		return nil
+	}
+
+	objects, err := source.ListObjects()
+	if err != nil {
+		return manifest, err
+	}
+	for _, object := range objects {
+		object, err = source.GetObject(object.Path)
+		if err != nil {
+			return manifest, err
+		}
+		err = put(object.Path, object.Content)
+		if err != nil {
+			return manifest, err
+		}
+	}
+	for path, content := range extra {
+		err = put(path, content)
+		if err != nil {
+			return manifest, err
+		}
+	}
+
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return manifest, err
+	}
+	err = target.PutObject(backupObjectPath(manifest.ID, BackupManifestFileName), content)
+	return manifest, err
+}
+
+// ListBackupSnapshots returns the ids of all complete snapshots in backend, oldest first
+func ListBackupSnapshots(backend Backend) ([]string, error) {
+	lister, ok := backend.(NestedLister)
+	if !ok {
+		return nil, errBackupNotNested
+	}
+	objects, err := lister.ListNestedObjects()
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, object := range objects {
+		parts := strings.Split(object.Path, "/")
+		if len(parts) == 2 && parts[1] == BackupManifestFileName {
+			ids = append(ids, parts[0])
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// GetBackupManifest retrieves the manifest of the snapshot with the given id
+func GetBackupManifest(backend Backend, id string) (BackupManifest, error) {
+	var manifest BackupManifest
+	object, err := backend.GetObject(backupObjectPath(id, BackupManifestFileName))
+	if err != nil {
+		return manifest, fmt.Errorf("backup snapshot %s not found: %s", id, err)
+	}
+	err = json.Unmarshal(object.Content, &manifest)
+	return manifest, err
+}
+
+// PruneBackupSnapshots deletes all but the newest keep snapshots from backend
+func PruneBackupSnapshots(backend Backend, keep int) error {
+	ids, err := ListBackupSnapshots(backend)
+	if err != nil {
+		return err
+	}
+	if len(ids) <= keep {
+		return nil
+	}
+	for _, id := range ids[:len(ids)-keep] {
+		manifest, err := GetBackupManifest(backend, id)
+		if err != nil {
+			return err
+		}
+		// Delete the manifest first, so a partially deleted snapshot is no longer listed
+		err = backend.DeleteObject(backupObjectPath(id, BackupManifestFileName))
+		if err != nil {
+			return err
+		}
+		for path := range manifest.Objects {
+			backend.DeleteObject(backupObjectPath(id, path))
+		}
+	}
+	return nil
+}
+
+func backupDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func backupObjectPath(id string, path string) string {
+	return fmt.Sprintf("%s/%s", id, path)
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type BackupTestSuite struct {
+	suite.Suite
+	TempDirectory string
+	SourceBackend *LocalFilesystemBackend
+	BackupBackend *LocalFilesystemBackend
+}
+
+func (suite *BackupTestSuite) SetupTest() {
+	timestamp := time.Now().Format("20060102150405.000000")
+	suite.TempDirectory = fmt.Sprintf("../../.test/storage-backup/%s", timestamp)
+	suite.SourceBackend = NewLocalFilesystemBackend(fmt.Sprintf("%s/source", suite.TempDirectory))
+	suite.BackupBackend = NewLocalFilesystemBackend(fmt.Sprintf("%s/backup", suite.TempDirectory))
+
+	suite.Nil(suite.SourceBackend.PutObject("mychart-0.1.0.tgz", []byte("chart")), "no error putting object")
+	suite.Nil(suite.SourceBackend.PutObject("mychart-0.1.0.tgz.prov", []byte("prov")), "no error putting object")
+}
+
+func (suite *BackupTestSuite) TearDownTest() {
+	os.RemoveAll(suite.TempDirectory)
+}
+
+func (suite *BackupTestSuite) TestCreateBackupSnapshot() {
+	manifest, err := CreateBackupSnapshot(suite.SourceBackend, suite.BackupBackend, map[string][]byte{"index.yaml": []byte("index")})
+	suite.Nil(err, "no error creating backup snapshot")
+	suite.Equal(3, len(manifest.Objects), "all objects in manifest")
+	suite.Equal(backupDigest([]byte("chart")), manifest.Objects["mychart-0.1.0.tgz"], "digest in manifest")
+
+	object, err := suite.BackupBackend.GetObject(fmt.Sprintf("%s/index.yaml", manifest.ID))
+	suite.Nil(err, "no error getting backed up index")
+	suite.Equal([]byte("index"), object.Content, "index backed up")
+
+	ids, err := ListBackupSnapshots(suite.BackupBackend)
+	suite.Nil(err, "no error listing backup snapshots")
+	suite.Equal([]string{manifest.ID}, ids, "snapshot listed")
+
+	stored, err := GetBackupManifest(suite.BackupBackend, manifest.ID)
+	suite.Nil(err, "no error getting backup manifest")
+	suite.Equal(manifest.Objects, stored.Objects, "manifest stored")
+
+	_, err = GetBackupManifest(suite.BackupBackend, "19700101000000")
+	suite.NotNil(err, "error getting missing backup manifest")
+
+	_, err = ListBackupSnapshots(NewFederatedBackend(suite.BackupBackend))
+	suite.NotNil(err, "error listing snapshots in backend without nested listing")
+}
+
+func (suite *BackupTestSuite) TestPruneBackupSnapshots() {
+	for _, id := range []string{"20170101000000", "20170102000000", "20170103000000"} {
+		suite.Nil(suite.BackupBackend.PutObject(fmt.Sprintf("%s/mychart-0.1.0.tgz", id), []byte("chart")), "no error putting object")
+		manifest := fmt.Sprintf(`{"id":"%s","objects":{"mychart-0.1.0.tgz":"x"}}`, id)
+		suite.Nil(suite.BackupBackend.PutObject(fmt.Sprintf("%s/%s", id, BackupManifestFileName), []byte(manifest)), "no error putting manifest")
+	}
+	// incomplete snapshot, without manifest
+	suite.Nil(suite.BackupBackend.PutObject("20170104000000/mychart-0.1.0.tgz", []byte("chart")), "no error putting object")
+
+	err := PruneBackupSnapshots(suite.BackupBackend, 2)
+	suite.Nil(err, "no error pruning backup snapshots")
+
+	ids, err := ListBackupSnapshots(suite.BackupBackend)
+	suite.Nil(err, "no error listing backup snapshots")
+	suite.Equal([]string{"20170102000000", "20170103000000"}, ids, "oldest snapshot pruned")
+
+	_, err = suite.BackupBackend.GetObject("20170101000000/mychart-0.1.0.tgz")
+	suite.NotNil(err, "pruned snapshot objects deleted")
+}
+
+func TestBackupTestSuite(t *testing.T) {
+	suite.Run(t, new(BackupTestSuite))
+}
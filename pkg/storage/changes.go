@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+)
+
+// ErrChangeTokenExpired is returned by ChangeLister.ListChanges when changes since the given token
+// are no longer known, in which case all objects must be listed again
+var ErrChangeTokenExpired = errors.New("change token expired")
+
+type (
+	// ChangeLister is implemented by backends which can tell what changed since a previous listing
+	// (e.g. from an inventory or a change feed), so that syncs don't need to list all objects
+	ChangeLister interface {
+		// ListObjectsWithChangeToken lists all objects, like ListObjects, along with a token
+		// identifying this listing
+		ListObjectsWithChangeToken() ([]Object, string, error)
+		// ListChanges returns the objects added, updated and removed since the listing identified
+		// by token, along with a token identifying the new state
+		ListChanges(token string) (ObjectChanges, error)
+	}
+
+	// NestedChangeLister is implemented by ChangeListers which can also list objects below subdirectories,
+	// and changes to them, like a NestedLister
+	NestedChangeLister interface {
+		ListNestedObjectsWithChangeToken() ([]Object, string, error)
+		ListNestedChanges(token string) (ObjectChanges, error)
+	}
+
+	// ObjectChanges are the changes to the objects in a backend since a change token was issued
+	ObjectChanges struct {
+		Updated []Object // objects added or modified
+		Removed []string // paths of objects removed
+		Token   string
+	}
+)
+
+// ApplyObjectChanges returns objects with changes applied: removed objects are left out, updated
+// ones are replaced and added ones are appended. Objects both removed and updated (e.g. deleted,
+// then uploaded again) are kept.
+func ApplyObjectChanges(objects []Object, changes ObjectChanges) []Object {
+	updated := map[string]Object{}
+	for _, object := range changes.Updated {
+		updated[object.Path] = object
+	}
+	removed := map[string]bool{}
+	for _, path := range changes.Removed {
+		if _, ok := updated[path]; !ok {
+			removed[path] = true
+		}
+	}
+
+	result := []Object{}
+	for _, object := range objects {
+		if removed[object.Path] {
+			continue
+		}
+		if o, ok := updated[object.Path]; ok {
+			object = o
+			delete(updated, object.Path)
+		}
+		result = append(result, object)
+	}
+	for _, object := range changes.Updated {
+		if o, ok := updated[object.Path]; ok {
+			result = append(result, o)
+			delete(updated, object.Path)
+		}
+	}
+	return result
+}
+
+// listObjectsWithChangeToken lists all objects in backend, along with a change token if it is a
+// ChangeLister or an empty one otherwise
+func listObjectsWithChangeToken(backend Backend) ([]Object, string, error) {
+	if lister, ok := backend.(ChangeLister); ok {
+		return lister.ListObjectsWithChangeToken()
+	}
+	objects, err := backend.ListObjects()
+	return objects, "", err
+}
+
+// listChanges returns the changes to backend since token, or ErrChangeTokenExpired if it is not a ChangeLister
+func listChanges(backend Backend, token string) (ObjectChanges, error) {
+	if lister, ok := backend.(ChangeLister); ok && token != "" {
+		return lister.ListChanges(token)
+	}
+	return ObjectChanges{}, ErrChangeTokenExpired
+}
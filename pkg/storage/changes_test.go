@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ChangesTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ChangesTestSuite) TestApplyObjectChanges() {
+	now := time.Now()
+	objects := []Object{
+		{Path: "a-0.1.0.tgz", LastModified: now},
+		{Path: "b-0.1.0.tgz", LastModified: now},
+		{Path: "c-0.1.0.tgz", LastModified: now},
+	}
+	later := now.Add(time.Minute)
+	changes := ObjectChanges{
+		Updated: []Object{
+			{Path: "b-0.1.0.tgz", LastModified: later},
+			{Path: "d-0.1.0.tgz", LastModified: later},
+			{Path: "c-0.1.0.tgz", LastModified: later},
+		},
+		Removed: []string{"a-0.1.0.tgz", "c-0.1.0.tgz", "e-0.1.0.tgz"},
+		Token:   "2",
+	}
+	result := ApplyObjectChanges(objects, changes)
+	suite.Equal([]Object{
+		{Path: "b-0.1.0.tgz", LastModified: later},
+		{Path: "c-0.1.0.tgz", LastModified: later},
+		{Path: "d-0.1.0.tgz", LastModified: later},
+	}, result, "changes applied")
+	suite.Len(objects, 3, "objects left untouched")
+
+	suite.Equal(objects, ApplyObjectChanges(objects, ObjectChanges{}), "no changes")
+}
+
+func TestChangesTestSuite(t *testing.T) {
+	suite.Run(t, new(ChangesTestSuite))
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// contextReadChunkSize is how much of an object is read at once, checking in between whether reading
+// should be given up
+const contextReadChunkSize = 32 * 1024
+
+// ContextBackend is implemented by backends whose reads can be given up when a context is done, e.g.
+// when the client which requested an object disconnected. Use ListObjectsWithContext and
+// GetObjectWithContext to read from any backend with a context.
+type ContextBackend interface {
+	ListObjectsWithContext(ctx context.Context) ([]Object, error)
+	GetObjectWithContext(ctx context.Context, path string) (Object, error)
+}
+
+// ListObjectsWithContext lists all objects in backend, like ListObjects. It gives up as soon as ctx
+// is done if backend is a ContextBackend, and otherwise only checks ctx before listing.
+func ListObjectsWithContext(ctx context.Context, backend Backend) ([]Object, error) {
+	if b, ok := backend.(ContextBackend); ok {
+		return b.ListObjectsWithContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return backend.ListObjects()
+}
+
+// GetObjectWithContext retrieves an object from backend, like GetObject. It gives up as soon as ctx
+// is done if backend is a ContextBackend, and otherwise only checks ctx before retrieving the object.
+func GetObjectWithContext(ctx context.Context, backend Backend, path string) (Object, error) {
+	if b, ok := backend.(ContextBackend); ok {
+		return b.GetObjectWithContext(ctx, path)
+	}
+	if err := ctx.Err(); err != nil {
+		return Object{Path: path}, err
+	}
+	return backend.GetObject(path)
+}
+
+// readAllWithContext reads r until EOF, like ioutil.ReadAll, giving up when ctx is done
+func readAllWithContext(ctx context.Context, r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		_, err := io.CopyN(&buf, r, contextReadChunkSize)
+		if err == io.EOF {
+			return buf.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
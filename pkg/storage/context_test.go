@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ContextTestSuite struct {
+	suite.Suite
+	TempDirectory string
+	LocalBackend  *LocalFilesystemBackend
+}
+
+// plainBackend only has the methods of Backend, hiding those of ContextBackend
+type plainBackend struct {
+	Backend
+}
+
+func (suite *ContextTestSuite) SetupTest() {
+	timestamp := time.Now().Format("20060102150405.000000")
+	suite.TempDirectory = fmt.Sprintf("../../.test/storage-context/%s", timestamp)
+	suite.LocalBackend = NewLocalFilesystemBackend(suite.TempDirectory)
+	suite.Nil(suite.LocalBackend.PutObject("mychart-0.1.0.tgz", []byte("content")), "no error putting object")
+}
+
+func (suite *ContextTestSuite) TearDownTest() {
+	os.RemoveAll(suite.TempDirectory)
+}
+
+func (suite *ContextTestSuite) TestContextBackends() {
+	layout, err := NewLayoutBackend(suite.LocalBackend, LayoutHashed)
+	suite.Nil(err, "no error creating layout backend")
+	backends := map[string]Backend{
+		"local":     suite.LocalBackend,
+		"layout":    layout,
+		"federated": NewFederatedBackend(layout, NewLocalFilesystemBackend(suite.TempDirectory)),
+		"dualwrite": NewDualWriteBackend(layout, NewLocalFilesystemBackend(suite.TempDirectory)),
+		"faults":    NewFaultInjectionBackend(layout, map[string]Fault{}),
+		"plain":     plainBackend{suite.LocalBackend},
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for name, backend := range backends {
+		objects, err := ListObjectsWithContext(context.Background(), backend)
+		suite.Nil(err, "no error listing objects with %s backend", name)
+		suite.Len(objects, 1, "objects listed with %s backend", name)
+		object, err := GetObjectWithContext(context.Background(), backend, "mychart-0.1.0.tgz")
+		suite.Nil(err, "no error getting object with %s backend", name)
+		suite.Equal([]byte("content"), object.Content, "object content with %s backend", name)
+
+		_, err = ListObjectsWithContext(canceled, backend)
+		suite.Equal(context.Canceled, err, "listing given up with %s backend", name)
+		_, err = GetObjectWithContext(canceled, backend, "mychart-0.1.0.tgz")
+		suite.Equal(context.Canceled, err, "getting object given up with %s backend", name)
+	}
+}
+
+func (suite *ContextTestSuite) TestFaultLatencyGivenUp() {
+	backend := NewFaultInjectionBackend(suite.LocalBackend, map[string]Fault{OperationGet: {Latency: time.Minute}})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := GetObjectWithContext(ctx, backend, "mychart-0.1.0.tgz")
+	suite.Equal(context.DeadlineExceeded, err, "injected latency given up")
+	suite.True(time.Since(start) < time.Minute, "did not wait for injected latency")
+}
+
+func TestContextTestSuite(t *testing.T) {
+	suite.Run(t, new(ContextTestSuite))
+}
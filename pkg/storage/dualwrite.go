@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+type (
+	// DualWriteBackend is a storage backend which reads from Primary, but writes to both
+	// Primary and Secondary, for switching storage providers without downtime
+	DualWriteBackend struct {
+		Primary   Backend
+		Secondary Backend
+	}
+
+	// ConsistencyReport lists objects which are only present in one of two backends
+	ConsistencyReport struct {
+		Consistent         bool     `json:"consistent"`
+		MissingInPrimary   []string `json:"missingInPrimary"`
+		MissingInSecondary []string `json:"missingInSecondary"`
+	}
+
+	// ConsistencyChecker is implemented by backends which keep several copies of objects
+	ConsistencyChecker interface {
+		CheckConsistency() (ConsistencyReport, error)
+	}
+)
+
+// NewDualWriteBackend creates a new instance of DualWriteBackend
+func NewDualWriteBackend(primary Backend, secondary Backend) *DualWriteBackend {
+	b := &DualWriteBackend{
+		Primary:   primary,
+		Secondary: secondary,
+	}
+	return b
+}
+
+// ListObjects lists all objects in the primary backend
+func (b DualWriteBackend) ListObjects() ([]Object, error) {
+	return b.Primary.ListObjects()
+}
+
+// ListObjectsWithContext lists all objects in the primary backend, giving up when ctx is done
+func (b DualWriteBackend) ListObjectsWithContext(ctx context.Context) ([]Object, error) {
+	return ListObjectsWithContext(ctx, b.Primary)
+}
+
+// ListObjectsWithChangeToken lists all objects in the primary backend, along with a change token if it
+// is a ChangeLister (an empty one otherwise)
+func (b DualWriteBackend) ListObjectsWithChangeToken() ([]Object, string, error) {
+	return listObjectsWithChangeToken(b.Primary)
+}
+
+// ListChanges returns the changes to the primary backend since token
+func (b DualWriteBackend) ListChanges(token string) (ObjectChanges, error) {
+	return listChanges(b.Primary, token)
+}
+
+// GetObject retrieves an object from the primary backend
+func (b DualWriteBackend) GetObject(path string) (Object, error) {
+	return b.Primary.GetObject(path)
+}
+
+// GetObjectWithContext retrieves an object from the primary backend, giving up when ctx is done
+func (b DualWriteBackend) GetObjectWithContext(ctx context.Context, path string) (Object, error) {
+	return GetObjectWithContext(ctx, b.Primary, path)
+}
+
+// PutObject uploads an object to both backends. If it cannot be written to the secondary
+// backend, the primary backend is rolled back so both stay consistent: an object which was
+// overwritten gets its previous content back, a new object is removed again.
+func (b DualWriteBackend) PutObject(path string, content []byte) error {
+	previous, getErr := b.Primary.GetObject(path)
+	err := b.Primary.PutObject(path, content)
+	if err != nil {
+		return err
+	}
+	err = b.Secondary.PutObject(path, content)
+	if err != nil {
+		if getErr == nil {
+			b.Primary.PutObject(path, previous.Content)
+		} else {
+			b.Primary.DeleteObject(path)
+		}
+		return fmt.Errorf("unable to write %s to secondary backend: %s", path, err)
+	}
+	return nil
+}
+
+// DeleteObject removes an object from both backends. Errors from the secondary backend are
+// ignored, as objects stored before dual writes were enabled may not have been copied over.
+func (b DualWriteBackend) DeleteObject(path string) error {
+	err := b.Primary.DeleteObject(path)
+	if err != nil {
+		return err
+	}
+	b.Secondary.DeleteObject(path)
+	return nil
+}
+
+// CheckConsistency compares the objects listed in both backends
+func (b DualWriteBackend) CheckConsistency() (ConsistencyReport, error) {
+	report := ConsistencyReport{MissingInPrimary: []string{}, MissingInSecondary: []string{}}
+	primaryObjects, err := b.Primary.ListObjects()
+	if err != nil {
+		return report, err
+	}
+	secondaryObjects, err := b.Secondary.ListObjects()
+	if err != nil {
+		return report, err
+	}
+	// compare paths only, objects with the same content at different paths are still missing
+	report.MissingInSecondary = missingObjectPaths(primaryObjects, secondaryObjects)
+	report.MissingInPrimary = missingObjectPaths(secondaryObjects, primaryObjects)
+	sort.Strings(report.MissingInPrimary)
+	sort.Strings(report.MissingInSecondary)
+	report.Consistent = len(report.MissingInPrimary)+len(report.MissingInSecondary) == 0
+	return report, nil
+}
+
+// MigrateObjects copies all objects of source which are missing in target (by path) to target, for
+// moving to a new backend offline or catching up on objects stored before dual writes were enabled.
+// It returns the number of objects copied.
+func MigrateObjects(source Backend, target Backend) (int, error) {
+	sourceObjects, err := source.ListObjects()
+	if err != nil {
+		return 0, err
+	}
+	targetObjects, err := target.ListObjects()
+	if err != nil {
+		return 0, err
+	}
+	missing := missingObjectPaths(sourceObjects, targetObjects)
+	sort.Strings(missing)
+	for i, path := range missing {
+		object, err := source.GetObject(path)
+		if err != nil {
+			return i, err
+		}
+		err = target.PutObject(path, object.Content)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(missing), nil
+}
+
+// missingObjectPaths returns the paths of objects in os1 which are not in os2
+func missingObjectPaths(os1 []Object, os2 []Object) []string {
+	paths := map[string]bool{}
+	for _, object := range os2 {
+		paths[object.Path] = true
+	}
+	missing := []string{}
+	for _, object := range os1 {
+		if !paths[object.Path] {
+			missing = append(missing, object.Path)
+		}
+	}
+	return missing
+}
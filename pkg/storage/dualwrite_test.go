@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DualWriteTestSuite struct {
+	suite.Suite
+	TempDirectory    string
+	PrimaryBackend   *LocalFilesystemBackend
+	SecondaryBackend *LocalFilesystemBackend
+	DualWriteBackend *DualWriteBackend
+}
+
+func (suite *DualWriteTestSuite) SetupTest() {
+	timestamp := time.Now().Format("20060102150405.000000")
+	suite.TempDirectory = fmt.Sprintf("../../.test/storage-dualwrite/%s", timestamp)
+	suite.PrimaryBackend = NewLocalFilesystemBackend(fmt.Sprintf("%s/primary", suite.TempDirectory))
+	suite.SecondaryBackend = NewLocalFilesystemBackend(fmt.Sprintf("%s/secondary", suite.TempDirectory))
+	suite.DualWriteBackend = NewDualWriteBackend(suite.PrimaryBackend, suite.SecondaryBackend)
+}
+
+func (suite *DualWriteTestSuite) TearDownTest() {
+	os.RemoveAll(suite.TempDirectory)
+}
+
+func (suite *DualWriteTestSuite) TestPutDeleteObject() {
+	err := suite.DualWriteBackend.PutObject("test.txt", []byte("test"))
+	suite.Nil(err, "no error putting object")
+	_, err = suite.PrimaryBackend.GetObject("test.txt")
+	suite.Nil(err, "object written to primary")
+	_, err = suite.SecondaryBackend.GetObject("test.txt")
+	suite.Nil(err, "object written to secondary")
+
+	objects, err := suite.DualWriteBackend.ListObjects()
+	suite.Nil(err, "no error listing objects")
+	suite.Equal(1, len(objects), "object listed")
+
+	err = suite.DualWriteBackend.DeleteObject("test.txt")
+	suite.Nil(err, "no error deleting object")
+	_, err = suite.PrimaryBackend.GetObject("test.txt")
+	suite.NotNil(err, "object deleted from primary")
+	_, err = suite.SecondaryBackend.GetObject("test.txt")
+	suite.NotNil(err, "object deleted from secondary")
+
+	err = suite.PrimaryBackend.PutObject("primaryonly.txt", []byte("test"))
+	suite.Nil(err, "no error putting object in primary only")
+	err = suite.DualWriteBackend.DeleteObject("primaryonly.txt")
+	suite.Nil(err, "no error deleting object missing from secondary")
+}
+
+func (suite *DualWriteTestSuite) TestPutObjectSecondaryFailure() {
+	brokenSecondary := NewLocalFilesystemBackend(fmt.Sprintf("%s/broken", suite.TempDirectory))
+	os.RemoveAll(brokenSecondary.RootDirectory)
+	err := os.MkdirAll(suite.TempDirectory, 0777)
+	suite.Nil(err, "no error creating temp directory")
+	err = ioutil.WriteFile(brokenSecondary.RootDirectory, []byte("not a directory"), 0644)
+	suite.Nil(err, "no error breaking secondary")
+
+	backend := NewDualWriteBackend(suite.PrimaryBackend, brokenSecondary)
+	err = backend.PutObject("test.txt", []byte("test"))
+	suite.NotNil(err, "error putting object when secondary fails")
+	_, err = suite.PrimaryBackend.GetObject("test.txt")
+	suite.NotNil(err, "object removed from primary when secondary fails")
+
+	err = suite.PrimaryBackend.PutObject("existing.txt", []byte("old"))
+	suite.Nil(err, "no error putting object in primary")
+	err = backend.PutObject("existing.txt", []byte("new"))
+	suite.NotNil(err, "error overwriting object when secondary fails")
+	object, err := suite.PrimaryBackend.GetObject("existing.txt")
+	suite.Nil(err, "overwritten object kept in primary when secondary fails")
+	suite.Equal([]byte("old"), object.Content, "previous content restored in primary")
+}
+
+func (suite *DualWriteTestSuite) TestCheckConsistency() {
+	report, err := suite.DualWriteBackend.CheckConsistency()
+	suite.Nil(err, "no error checking consistency")
+	suite.True(report.Consistent, "empty backends consistent")
+
+	suite.Nil(suite.DualWriteBackend.PutObject("both.txt", []byte("test")), "no error putting object")
+	suite.Nil(suite.PrimaryBackend.PutObject("primary.txt", []byte("test")), "no error putting object in primary")
+	suite.Nil(suite.SecondaryBackend.PutObject("secondary.txt", []byte("test")), "no error putting object in secondary")
+
+	report, err = suite.DualWriteBackend.CheckConsistency()
+	suite.Nil(err, "no error checking consistency")
+	suite.False(report.Consistent, "backends inconsistent")
+	suite.Equal([]string{"secondary.txt"}, report.MissingInPrimary, "missing in primary")
+	suite.Equal([]string{"primary.txt"}, report.MissingInSecondary, "missing in secondary")
+}
+
+func (suite *DualWriteTestSuite) TestMigrateObjects() {
+	suite.Nil(suite.PrimaryBackend.PutObject("a.txt", []byte("a")), "no error putting object in primary")
+	suite.Nil(suite.PrimaryBackend.PutObject("b.txt", []byte("b")), "no error putting object in primary")
+	suite.Nil(suite.SecondaryBackend.PutObject("b.txt", []byte("other")), "no error putting object in secondary")
+
+	copied, err := MigrateObjects(suite.PrimaryBackend, suite.SecondaryBackend)
+	suite.Nil(err, "no error migrating objects")
+	suite.Equal(1, copied, "missing object copied")
+	object, err := suite.SecondaryBackend.GetObject("a.txt")
+	suite.Nil(err, "copied object in target")
+	suite.Equal([]byte("a"), object.Content, "content of copied object")
+	object, _ = suite.SecondaryBackend.GetObject("b.txt")
+	suite.Equal([]byte("other"), object.Content, "existing object in target left alone")
+
+	copied, err = MigrateObjects(suite.PrimaryBackend, suite.SecondaryBackend)
+	suite.Nil(err, "no error migrating objects again")
+	suite.Equal(0, copied, "nothing left to copy")
+}
+
+func TestDualWriteTestSuite(t *testing.T) {
+	suite.Run(t, new(DualWriteTestSuite))
+}
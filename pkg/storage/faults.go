@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// OperationList is ListObjects
+	OperationList = "list"
+
+	// OperationGet is GetObject
+	OperationGet = "get"
+
+	// OperationPut is PutObject
+	OperationPut = "put"
+
+	// OperationDelete is DeleteObject
+	OperationDelete = "delete"
+)
+
+var (
+	// Operations are the operations of a backend faults can be injected into
+	Operations = []string{OperationList, OperationGet, OperationPut, OperationDelete}
+
+	// ErrInjectedFault is returned by FaultInjectionBackend for operations it made fail
+	ErrInjectedFault = errors.New("injected storage fault")
+)
+
+type (
+	// Fault is injected into an operation: it is delayed by Latency, then fails with probability
+	// ErrorRate (between 0 and 1) without reaching the backend
+	Fault struct {
+		Latency   time.Duration
+		ErrorRate float64
+	}
+
+	// FaultInjectionBackend is a storage backend injecting faults into the operations of Backend, by
+	// operation, to check how clients and the index cope with slow or failing storage
+	FaultInjectionBackend struct {
+		Backend Backend
+		Faults  map[string]Fault
+		rand    *rand.Rand
+		lock    *sync.Mutex
+	}
+)
+
+// NewFaultInjectionBackend creates a new instance of FaultInjectionBackend
+func NewFaultInjectionBackend(backend Backend, faults map[string]Fault) *FaultInjectionBackend {
+	return &FaultInjectionBackend{
+		Backend: backend,
+		Faults:  faults,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		lock:    &sync.Mutex{},
+	}
+}
+
+// ParseFaults parses faults by operation from a comma-separated list of <operation>=<latency>[:<error rate>],
+// e.g. "get=200ms,put=100ms:0.1,list=:0.5"
+func ParseFaults(spec string) (map[string]Fault, error) {
+	faults := map[string]Fault{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || !isOperation(kv[0]) {
+			return nil, fmt.Errorf("invalid storage fault %q, expected <%s>=<latency>[:<error rate>]", part, strings.Join(Operations, "|"))
+		}
+		var fault Fault
+		values := strings.SplitN(kv[1], ":", 2)
+		if values[0] != "" {
+			latency, err := time.ParseDuration(values[0])
+			if err != nil || latency < 0 {
+				return nil, fmt.Errorf("invalid latency in storage fault %q", part)
+			}
+			fault.Latency = latency
+		}
+		if len(values) == 2 {
+			rate, err := strconv.ParseFloat(values[1], 64)
+			if err != nil || rate < 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid error rate in storage fault %q, expected a number between 0 and 1", part)
+			}
+			fault.ErrorRate = rate
+		}
+		faults[kv[0]] = fault
+	}
+	return faults, nil
+}
+
+func isOperation(operation string) bool {
+	for _, o := range Operations {
+		if o == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// inject delays operation and returns ErrInjectedFault if it should fail
+func (b FaultInjectionBackend) inject(operation string) error {
+	return b.injectWithContext(context.Background(), operation)
+}
+
+// injectWithContext delays operation like inject, unless ctx is done first
+func (b FaultInjectionBackend) injectWithContext(ctx context.Context, operation string) error {
+	fault, ok := b.Faults[operation]
+	if !ok {
+		return nil
+	}
+	timer := time.NewTimer(fault.Latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	b.lock.Lock()
+	failed := b.rand.Float64() < fault.ErrorRate
+	b.lock.Unlock()
+	if failed {
+		return ErrInjectedFault
+	}
+	return nil
+}
+
+// ListObjects lists all objects in Backend, unless a fault is injected
+func (b FaultInjectionBackend) ListObjects() ([]Object, error) {
+	if err := b.inject(OperationList); err != nil {
+		return nil, err
+	}
+	return b.Backend.ListObjects()
+}
+
+// ListObjectsWithContext lists all objects in Backend, unless a fault is injected, giving up when ctx is done
+func (b FaultInjectionBackend) ListObjectsWithContext(ctx context.Context) ([]Object, error) {
+	if err := b.injectWithContext(ctx, OperationList); err != nil {
+		return nil, err
+	}
+	return ListObjectsWithContext(ctx, b.Backend)
+}
+
+// ListObjectsWithChangeToken lists all objects in Backend along with a change token if it is a
+// ChangeLister, unless a fault is injected
+func (b FaultInjectionBackend) ListObjectsWithChangeToken() ([]Object, string, error) {
+	if err := b.inject(OperationList); err != nil {
+		return nil, "", err
+	}
+	return listObjectsWithChangeToken(b.Backend)
+}
+
+// ListChanges returns the changes to Backend since token, unless a fault is injected
+func (b FaultInjectionBackend) ListChanges(token string) (ObjectChanges, error) {
+	if err := b.inject(OperationList); err != nil {
+		return ObjectChanges{}, err
+	}
+	return listChanges(b.Backend, token)
+}
+
+// GetObjectWithContext retrieves an object from Backend, unless a fault is injected, giving up when ctx is done
+func (b FaultInjectionBackend) GetObjectWithContext(ctx context.Context, path string) (Object, error) {
+	if err := b.injectWithContext(ctx, OperationGet); err != nil {
+		return Object{Path: path}, err
+	}
+	return GetObjectWithContext(ctx, b.Backend, path)
+}
+
+// GetObject retrieves an object from Backend, unless a fault is injected
+func (b FaultInjectionBackend) GetObject(path string) (Object, error) {
+	if err := b.inject(OperationGet); err != nil {
+		return Object{Path: path}, err
+	}
+	return b.Backend.GetObject(path)
+}
+
+// PutObject stores an object in Backend, unless a fault is injected
+func (b FaultInjectionBackend) PutObject(path string, content []byte) error {
+	if err := b.inject(OperationPut); err != nil {
+		return err
+	}
+	return b.Backend.PutObject(path, content)
+}
+
+// DeleteObject removes an object from Backend, unless a fault is injected
+func (b FaultInjectionBackend) DeleteObject(path string) error {
+	if err := b.inject(OperationDelete); err != nil {
+		return err
+	}
+	return b.Backend.DeleteObject(path)
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type FaultsTestSuite struct {
+	suite.Suite
+	TempDirectory string
+	LocalBackend  *LocalFilesystemBackend
+}
+
+func (suite *FaultsTestSuite) SetupTest() {
+	timestamp := time.Now().Format("20060102150405.000000")
+	suite.TempDirectory = fmt.Sprintf("../../.test/storage-faults/%s", timestamp)
+	suite.LocalBackend = NewLocalFilesystemBackend(suite.TempDirectory)
+}
+
+func (suite *FaultsTestSuite) TearDownTest() {
+	os.RemoveAll(suite.TempDirectory)
+}
+
+func (suite *FaultsTestSuite) TestParseFaults() {
+	faults, err := ParseFaults("get=200ms, put=100ms:0.1,list=:0.5")
+	suite.Nil(err, "no error parsing faults")
+	suite.Equal(map[string]Fault{
+		OperationGet:  {Latency: 200 * time.Millisecond},
+		OperationPut:  {Latency: 100 * time.Millisecond, ErrorRate: 0.1},
+		OperationList: {ErrorRate: 0.5},
+	}, faults, "faults by operation")
+
+	faults, err = ParseFaults("")
+	suite.Nil(err, "no error parsing no faults")
+	suite.Empty(faults, "no faults")
+
+	for _, spec := range []string{"head=1s", "get", "get=soon", "get=-1s", "put=:2", "put=1s:often"} {
+		_, err = ParseFaults(spec)
+		suite.NotNil(err, fmt.Sprintf("error parsing %q", spec))
+	}
+}
+
+func (suite *FaultsTestSuite) TestFaultInjectionBackend() {
+	backend := NewFaultInjectionBackend(suite.LocalBackend, map[string]Fault{
+		OperationPut:    {ErrorRate: 1},
+		OperationGet:    {Latency: 20 * time.Millisecond},
+		OperationDelete: {ErrorRate: 0},
+	})
+
+	err := backend.PutObject("test.txt", []byte("test"))
+	suite.Equal(ErrInjectedFault, err, "put always fails")
+	_, err = suite.LocalBackend.GetObject("test.txt")
+	suite.NotNil(err, "failed put doesn't reach the backend")
+
+	err = suite.LocalBackend.PutObject("test.txt", []byte("test"))
+	suite.Nil(err, "no error putting object in backend")
+	start := time.Now()
+	object, err := backend.GetObject("test.txt")
+	suite.Nil(err, "no error getting object")
+	suite.Equal([]byte("test"), object.Content, "object content")
+	suite.True(time.Since(start) >= 20*time.Millisecond, "get delayed")
+
+	objects, err := backend.ListObjects()
+	suite.Nil(err, "no error listing objects without faults")
+	suite.Len(objects, 1, "object listed")
+	suite.Nil(backend.DeleteObject("test.txt"), "delete never fails")
+}
+
+func TestFaultsTestSuite(t *testing.T) {
+	suite.Run(t, new(FaultsTestSuite))
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+)
+
+// FederatedBackend is a storage backend which serves objects from several backends as if they
+// were one. All writes go to Primary, the other backends are only ever read from.
+type FederatedBackend struct {
+	Primary     Backend
+	Secondaries []Backend
+}
+
+// NewFederatedBackend creates a new instance of FederatedBackend
+func NewFederatedBackend(primary Backend, secondaries ...Backend) *FederatedBackend {
+	b := &FederatedBackend{
+		Primary:     primary,
+		Secondaries: secondaries,
+	}
+	return b
+}
+
+// ListObjects lists objects from all backends. If an object with the same path exists in
+// several backends, the one from the backend listed first (primary first) is used.
+func (b FederatedBackend) ListObjects() ([]Object, error) {
+	return b.ListObjectsWithContext(context.Background())
+}
+
+// ListObjectsWithContext lists objects from all backends like ListObjects, giving up when ctx is done
+func (b FederatedBackend) ListObjectsWithContext(ctx context.Context) ([]Object, error) {
+	var objects []Object
+	seen := map[string]bool{}
+	for _, backend := range b.backends() {
+		backendObjects, err := ListObjectsWithContext(ctx, backend)
+		if err != nil {
+			return objects, err
+		}
+		for _, object := range backendObjects {
+			if seen[object.Path] {
+				continue
+			}
+			seen[object.Path] = true
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+// GetObject retrieves an object from the first backend containing it (primary first)
+func (b FederatedBackend) GetObject(path string) (Object, error) {
+	return b.GetObjectWithContext(context.Background(), path)
+}
+
+// GetObjectWithContext retrieves an object like GetObject, giving up when ctx is done
+func (b FederatedBackend) GetObjectWithContext(ctx context.Context, path string) (Object, error) {
+	var object Object
+	var err error
+	for _, backend := range b.backends() {
+		object, err = GetObjectWithContext(ctx, backend, path)
+		if ctx.Err() != nil {
+			return object, ctx.Err()
+		}
+		if err == nil {
+			return object, nil
+		}
+	}
+	return object, err
+}
+
+// PutObject uploads an object to the primary backend
+func (b FederatedBackend) PutObject(path string, content []byte) error {
+	return b.Primary.PutObject(path, content)
+}
+
+// DeleteObject removes an object from the primary backend
+func (b FederatedBackend) DeleteObject(path string) error {
+	return b.Primary.DeleteObject(path)
+}
+
+func (b FederatedBackend) backends() []Backend {
+	return append([]Backend{b.Primary}, b.Secondaries...)
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type FederatedTestSuite struct {
+	suite.Suite
+	TempDirectory    string
+	PrimaryBackend   *LocalFilesystemBackend
+	SecondaryBackend *LocalFilesystemBackend
+	FederatedBackend *FederatedBackend
+}
+
+func (suite *FederatedTestSuite) SetupSuite() {
+	timestamp := time.Now().Format("20060102150405")
+	suite.TempDirectory = fmt.Sprintf("../../.test/storage-federated/%s", timestamp)
+	suite.PrimaryBackend = NewLocalFilesystemBackend(fmt.Sprintf("%s/primary", suite.TempDirectory))
+	suite.SecondaryBackend = NewLocalFilesystemBackend(fmt.Sprintf("%s/secondary", suite.TempDirectory))
+	suite.FederatedBackend = NewFederatedBackend(suite.PrimaryBackend, suite.SecondaryBackend)
+
+	suite.Nil(suite.PrimaryBackend.PutObject("primary.txt", []byte("primary")), "no error putting object in primary")
+	suite.Nil(suite.PrimaryBackend.PutObject("both.txt", []byte("primary")), "no error putting object in primary")
+	suite.Nil(suite.SecondaryBackend.PutObject("secondary.txt", []byte("secondary")), "no error putting object in secondary")
+	suite.Nil(suite.SecondaryBackend.PutObject("both.txt", []byte("secondary")), "no error putting object in secondary")
+}
+
+func (suite *FederatedTestSuite) TearDownSuite() {
+	os.RemoveAll(suite.TempDirectory)
+}
+
+func (suite *FederatedTestSuite) TestListObjects() {
+	objects, err := suite.FederatedBackend.ListObjects()
+	suite.Nil(err, "no error listing objects")
+	var paths []string
+	for _, object := range objects {
+		paths = append(paths, object.Path)
+	}
+	sort.Strings(paths)
+	suite.Equal([]string{"both.txt", "primary.txt", "secondary.txt"}, paths, "objects from all backends listed once")
+}
+
+func (suite *FederatedTestSuite) TestGetObject() {
+	object, err := suite.FederatedBackend.GetObject("both.txt")
+	suite.Nil(err, "no error getting object in both backends")
+	suite.Equal([]byte("primary"), object.Content, "object from primary preferred")
+
+	object, err = suite.FederatedBackend.GetObject("secondary.txt")
+	suite.Nil(err, "no error getting object in secondary backend")
+	suite.Equal([]byte("secondary"), object.Content, "object from secondary")
+
+	_, err = suite.FederatedBackend.GetObject("fake.txt")
+	suite.NotNil(err, "error getting object in no backend")
+}
+
+func (suite *FederatedTestSuite) TestPutDeleteObject() {
+	err := suite.FederatedBackend.PutObject("new.txt", []byte("new"))
+	suite.Nil(err, "no error putting object")
+	_, err = suite.PrimaryBackend.GetObject("new.txt")
+	suite.Nil(err, "object written to primary")
+	_, err = suite.SecondaryBackend.GetObject("new.txt")
+	suite.NotNil(err, "object not written to secondary")
+
+	err = suite.FederatedBackend.DeleteObject("new.txt")
+	suite.Nil(err, "no error deleting object")
+
+	err = suite.FederatedBackend.DeleteObject("secondary.txt")
+	suite.NotNil(err, "error deleting object only in secondary")
+	_, err = suite.SecondaryBackend.GetObject("secondary.txt")
+	suite.Nil(err, "secondary left untouched")
+}
+
+func TestFederatedTestSuite(t *testing.T) {
+	suite.Run(t, new(FederatedTestSuite))
+}
@@ -1,7 +1,7 @@
 package storage
 
 import (
-	"io/ioutil"
+	"encoding/hex"
 	pathutil "path"
 
 	"cloud.google.com/go/storage"
@@ -38,8 +38,22 @@ func NewGoogleCSBackend(bucket string, prefix string) *GoogleCSBackend {
 
 // ListObjects lists all objects in Google Cloud Storage bucket, at prefix
 func (b GoogleCSBackend) ListObjects() ([]Object, error) {
+	return b.listObjects(b.Context, false)
+}
+
+// ListObjectsWithContext lists all objects in Google Cloud Storage bucket, at prefix, giving up when ctx is done
+func (b GoogleCSBackend) ListObjectsWithContext(ctx context.Context) ([]Object, error) {
+	return b.listObjects(ctx, false)
+}
+
+// ListNestedObjects lists all objects in Google Cloud Storage bucket, at prefix, including those below subdirectories
+func (b GoogleCSBackend) ListNestedObjects() ([]Object, error) {
+	return b.listObjects(b.Context, true)
+}
+
+func (b GoogleCSBackend) listObjects(ctx context.Context, nested bool) ([]Object, error) {
 	var objects []Object
-	it := b.Client.Objects(b.Context, b.Query)
+	it := b.Client.Objects(ctx, b.Query)
 	for {
 		attrs, err := it.Next()
 		if err == iterator.Done {
@@ -49,34 +63,72 @@ func (b GoogleCSBackend) ListObjects() ([]Object, error) {
 			return objects, err
 		}
 		path := removePrefixFromObjectPath(b.Prefix, attrs.Name)
-		if objectPathIsInvalid(path) {
+		if objectPathIsInvalid(path, nested) {
 			continue
 		}
 		object := Object{
 			Path:         path,
 			Content:      []byte{},
 			LastModified: attrs.Updated,
+			Digest:       hex.EncodeToString(attrs.MD5),
 		}
 		objects = append(objects, object)
 	}
 	return objects, nil
 }
 
+// ListObjectsPage lists a page of the objects in Google Cloud Storage bucket, at prefix, whose path
+// starts with prefix (below the one of the backend), including those below subdirectories
+func (b GoogleCSBackend) ListObjectsPage(prefix string, token string, max int) (ObjectPage, error) {
+	var page ObjectPage
+	if max <= 0 {
+		max = defaultPageSize
+	}
+	query := storage.Query{Prefix: prefix}
+	if b.Prefix != "" {
+		query.Prefix = b.Prefix + "/" + prefix
+	}
+	var attrsList []*storage.ObjectAttrs
+	nextToken, err := iterator.NewPager(b.Client.Objects(b.Context, &query), max, token).NextPage(&attrsList)
+	if err != nil {
+		return page, err
+	}
+	for _, attrs := range attrsList {
+		path := removePrefixFromObjectPath(b.Prefix, attrs.Name)
+		if objectPathIsInvalid(path, true) {
+			continue
+		}
+		page.Objects = append(page.Objects, Object{
+			Path:         path,
+			Content:      []byte{},
+			LastModified: attrs.Updated,
+			Digest:       hex.EncodeToString(attrs.MD5),
+		})
+	}
+	page.NextToken = nextToken
+	return page, nil
+}
+
 // GetObject retrieves an object from Google Cloud Storage bucket, at prefix
 func (b GoogleCSBackend) GetObject(path string) (Object, error) {
+	return b.GetObjectWithContext(b.Context, path)
+}
+
+// GetObjectWithContext retrieves an object from Google Cloud Storage bucket, at prefix, giving up when ctx is done
+func (b GoogleCSBackend) GetObjectWithContext(ctx context.Context, path string) (Object, error) {
 	var object Object
 	object.Path = path
 	objectHandle := b.Client.Object(pathutil.Join(b.Prefix, path))
-	attrs, err := objectHandle.Attrs(b.Context)
+	attrs, err := objectHandle.Attrs(ctx)
 	if err != nil {
 		return object, err
 	}
 	object.LastModified = attrs.Updated
-	rc, err := objectHandle.NewReader(b.Context)
+	rc, err := objectHandle.NewReader(ctx)
 	if err != nil {
 		return object, err
 	}
-	content, err := ioutil.ReadAll(rc)
+	content, err := readAllWithContext(ctx, rc)
 	rc.Close()
 	if err != nil {
 		return object, err
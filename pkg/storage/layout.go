@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	pathutil "path"
+	"regexp"
+)
+
+const (
+	// LayoutFlat stores all objects at the root of the backend (e.g. "mychart-0.1.0.tgz")
+	LayoutFlat = "flat"
+
+	// LayoutNameVersion stores objects in name/version subdirectories (e.g. "mychart/0.1.0/mychart-0.1.0.tgz")
+	LayoutNameVersion = "name-version"
+
+	// LayoutHashed stores objects below two levels of hashed prefixes (e.g. "3f/a2/mychart-0.1.0.tgz")
+	LayoutHashed = "hashed"
+)
+
+var (
+	// Layouts are all supported object key layouts
+	Layouts = []string{LayoutFlat, LayoutNameVersion, LayoutHashed}
+
+	nameVersionFromFilenameRegex = regexp.MustCompile(`^(.+?)-(v?[0-9]+\.[0-9]+\.[0-9]+.*)\.tgz(\.prov)?$`)
+)
+
+// LayoutBackend is a storage backend which stores new objects under keys following Layout,
+// while still finding objects stored using any of the other layouts. Object paths it deals
+// with are always plain filenames, regardless of the key they are stored under.
+type LayoutBackend struct {
+	Backend         Backend
+	Layout          string
+	ParallelListing bool // with the hashed layout, list backends which are PageListers in 16 concurrent ranges
+}
+
+// NewLayoutBackend creates a new instance of LayoutBackend
+func NewLayoutBackend(backend Backend, layout string) (*LayoutBackend, error) {
+	if layout == "" {
+		layout = LayoutFlat
+	}
+	for _, l := range Layouts {
+		if l == layout {
+			return &LayoutBackend{Backend: backend, Layout: layout}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported storage layout: %s", layout)
+}
+
+// ObjectKey returns the key under which an object with the given filename is stored using layout.
+// Files which are not chart packages or provenance files are always stored at the root. A filename
+// below a directory (e.g. "staging/mychart-0.1.0.tgz") is stored using layout within that directory.
+func ObjectKey(layout string, filename string) string {
+	dir, filename := pathutil.Split(filename)
+	match := nameVersionFromFilenameRegex.FindStringSubmatch(filename)
+	if match == nil {
+		return dir + filename
+	}
+	switch layout {
+	case LayoutNameVersion:
+		return pathutil.Join(dir, match[1], match[2], filename)
+	case LayoutHashed:
+		// hash name and version only, so a package and its provenance file end up side by side
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s-%s", match[1], match[2])))
+		hash := hex.EncodeToString(sum[:])
+		return pathutil.Join(dir, hash[0:2], hash[2:4], filename)
+	}
+	return dir + filename
+}
+
+// ListObjects lists objects stored using any layout, preferring the configured layout
+// if the same file is stored under several keys
+func (b LayoutBackend) ListObjects() ([]Object, error) {
+	return b.ListObjectsWithContext(context.Background())
+}
+
+// ListObjectsWithContext lists objects stored using any layout, like ListObjects. Listing backends
+// which are NestedListers or PageListers is only given up if ctx is done before it starts.
+func (b LayoutBackend) ListObjectsWithContext(ctx context.Context) ([]Object, error) {
+	var objects []Object
+	var err error
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	if lister, ok := b.Backend.(PageLister); ok && b.ParallelListing && b.Layout == LayoutHashed {
+		objects, err = ListObjectsInParallel(lister, hexBoundaries)
+	} else if lister, ok := b.Backend.(NestedLister); ok {
+		objects, err = lister.ListNestedObjects()
+	} else {
+		objects, err = ListObjectsWithContext(ctx, b.Backend)
+	}
+	if err != nil {
+		return objects, err
+	}
+	return b.objectsByFilename(objects), nil
+}
+
+// ListObjectsWithChangeToken lists objects stored using any layout, like ListObjects, along with a
+// change token if Backend is a NestedChangeLister (an empty one otherwise)
+func (b LayoutBackend) ListObjectsWithChangeToken() ([]Object, string, error) {
+	lister, ok := b.Backend.(NestedChangeLister)
+	if !ok {
+		objects, err := b.ListObjects()
+		return objects, "", err
+	}
+	objects, token, err := lister.ListNestedObjectsWithChangeToken()
+	if err != nil {
+		return nil, "", err
+	}
+	return b.objectsByFilename(objects), token, nil
+}
+
+// ListChanges returns the changes to objects stored using any layout since token. An object removed
+// from under one key is not reported as removed if it is still stored under the key of another layout.
+func (b LayoutBackend) ListChanges(token string) (ObjectChanges, error) {
+	lister, ok := b.Backend.(NestedChangeLister)
+	if !ok || token == "" {
+		return ObjectChanges{}, ErrChangeTokenExpired
+	}
+	changes, err := lister.ListNestedChanges(token)
+	if err != nil {
+		return ObjectChanges{}, err
+	}
+	result := ObjectChanges{Updated: b.objectsByFilename(changes.Updated), Token: changes.Token}
+	for _, key := range changes.Removed {
+		if _, ok := b.layoutOfKey(key); !ok {
+			continue
+		}
+		filename := pathutil.Base(key)
+		if object, err := b.GetObject(filename); err == nil {
+			object.Content = []byte{}
+			result.Updated = append(result.Updated, object)
+			continue
+		}
+		result.Removed = append(result.Removed, filename)
+	}
+	return result, nil
+}
+
+// objectsByFilename returns the objects listed from Backend which are stored using a known layout, by
+// filename, preferring the configured layout if the same file is stored under several keys
+func (b LayoutBackend) objectsByFilename(objects []Object) []Object {
+	var result []Object
+	seen := map[string]int{}
+	for _, object := range objects {
+		filename := pathutil.Base(object.Path)
+		layout, ok := b.layoutOfKey(object.Path)
+		if !ok {
+			continue // not stored using a known layout
+		}
+		object.Path = filename
+		if i, ok := seen[filename]; ok {
+			if layout == b.Layout {
+				result[i] = object
+			}
+			continue
+		}
+		seen[filename] = len(result)
+		result = append(result, object)
+	}
+	return result
+}
+
+// ListNestedObjects lists all objects of Backend under their keys, including those below
+// subdirectories which are not stored using any layout (e.g. a clone of the repository)
+func (b LayoutBackend) ListNestedObjects() ([]Object, error) {
+	lister, ok := b.Backend.(NestedLister)
+	if !ok {
+		return nil, ErrPrefixListingUnsupported
+	}
+	return lister.ListNestedObjects()
+}
+
+// ListObjectsPage lists a page of the objects of Backend under their keys, like ListNestedObjects
+func (b LayoutBackend) ListObjectsPage(prefix string, token string, max int) (ObjectPage, error) {
+	if lister, ok := b.Backend.(PageLister); ok {
+		return lister.ListObjectsPage(prefix, token, max)
+	}
+	objects, err := ListObjectsWithPrefix(b.Backend, prefix)
+	if err != nil {
+		return ObjectPage{}, err
+	}
+	return pageOfObjects(objects, token, max), nil
+}
+
+// GetObject retrieves an object, looking under the key for the configured layout first
+func (b LayoutBackend) GetObject(path string) (Object, error) {
+	return b.GetObjectWithContext(context.Background(), path)
+}
+
+// GetObjectWithContext retrieves an object like GetObject, giving up when ctx is done
+func (b LayoutBackend) GetObjectWithContext(ctx context.Context, path string) (Object, error) {
+	var object Object
+	var err error
+	for _, key := range b.keys(path) {
+		object, err = GetObjectWithContext(ctx, b.Backend, key)
+		if ctx.Err() != nil {
+			return object, ctx.Err()
+		}
+		if err == nil {
+			object.Path = path
+			return object, nil
+		}
+	}
+	return object, err
+}
+
+// PutObject stores an object under the key for the configured layout
+func (b LayoutBackend) PutObject(path string, content []byte) error {
+	return b.Backend.PutObject(ObjectKey(b.Layout, path), content)
+}
+
+// DeleteObject removes an object from all layouts it is stored under
+func (b LayoutBackend) DeleteObject(path string) error {
+	var err error
+	deleted := false
+	for _, key := range b.keys(path) {
+		e := b.Backend.DeleteObject(key)
+		if e == nil {
+			deleted = true
+		} else if err == nil {
+			err = e
+		}
+	}
+	if deleted {
+		return nil
+	}
+	return err
+}
+
+// keys returns the distinct keys an object may be stored under, configured layout first
+func (b LayoutBackend) keys(path string) []string {
+	keys := []string{ObjectKey(b.Layout, path)}
+	for _, layout := range Layouts {
+		key := ObjectKey(layout, path)
+		found := false
+		for _, k := range keys {
+			if k == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (b LayoutBackend) layoutOfKey(key string) (string, bool) {
+	filename := pathutil.Base(key)
+	if ObjectKey(b.Layout, filename) == key {
+		return b.Layout, true
+	}
+	for _, layout := range Layouts {
+		if ObjectKey(layout, filename) == key {
+			return layout, true
+		}
+	}
+	return "", false
+}
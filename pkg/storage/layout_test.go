@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LayoutTestSuite struct {
+	suite.Suite
+	TempDirectory string
+	LocalBackend  *LocalFilesystemBackend
+	LayoutBackend *LayoutBackend
+}
+
+func (suite *LayoutTestSuite) SetupSuite() {
+	timestamp := time.Now().Format("20060102150405")
+	suite.TempDirectory = fmt.Sprintf("../../.test/storage-layout/%s", timestamp)
+	suite.LocalBackend = NewLocalFilesystemBackend(suite.TempDirectory)
+	layoutBackend, err := NewLayoutBackend(suite.LocalBackend, LayoutNameVersion)
+	suite.Nil(err, "no error creating layout backend")
+	suite.LayoutBackend = layoutBackend
+
+	// existing objects stored using other layouts
+	for _, key := range []string{
+		"flatchart-0.1.0.tgz",
+		ObjectKey(LayoutHashed, "hashedchart-0.1.0.tgz"),
+		"index.yaml",
+		"some/unknown/nested/object.tgz",
+	} {
+		err := suite.LocalBackend.PutObject(key, []byte(key))
+		suite.Nil(err, fmt.Sprintf("no error putting %s in local storage", key))
+	}
+}
+
+func (suite *LayoutTestSuite) TearDownSuite() {
+	os.RemoveAll(suite.TempDirectory)
+}
+
+func (suite *LayoutTestSuite) TestObjectKey() {
+	suite.Equal("mychart-0.1.0.tgz", ObjectKey(LayoutFlat, "mychart-0.1.0.tgz"), "flat key")
+	suite.Equal("my-chart/0.1.0-rc.1/my-chart-0.1.0-rc.1.tgz", ObjectKey(LayoutNameVersion, "my-chart-0.1.0-rc.1.tgz"), "name-version key")
+	suite.Equal("mychart/0.1.0/mychart-0.1.0.tgz.prov", ObjectKey(LayoutNameVersion, "mychart-0.1.0.tgz.prov"), "name-version key for provenance file")
+	suite.Regexp("^[0-9a-f]{2}/[0-9a-f]{2}/mychart-0.1.0.tgz$", ObjectKey(LayoutHashed, "mychart-0.1.0.tgz"), "hashed key")
+	suite.Equal(ObjectKey(LayoutHashed, "mychart-0.1.0.tgz")+".prov", ObjectKey(LayoutHashed, "mychart-0.1.0.tgz.prov"), "hashed key for provenance file next to package")
+	suite.Equal("index.yaml", ObjectKey(LayoutNameVersion, "index.yaml"), "other files at root")
+	suite.Equal("staging/mychart/0.1.0/mychart-0.1.0.tgz", ObjectKey(LayoutNameVersion, "staging/mychart-0.1.0.tgz"), "name-version key within directory")
+	suite.Equal("staging/"+ObjectKey(LayoutHashed, "mychart-0.1.0.tgz"), ObjectKey(LayoutHashed, "staging/mychart-0.1.0.tgz"), "hashed key within directory")
+	suite.Equal("staging/index.yaml", ObjectKey(LayoutHashed, "staging/index.yaml"), "other files at root of directory")
+
+	_, err := NewLayoutBackend(suite.LocalBackend, "garage")
+	suite.NotNil(err, "error creating layout backend with bad layout")
+}
+
+func (suite *LayoutTestSuite) TestLayoutBackend() {
+	err := suite.LayoutBackend.PutObject("newchart-0.1.0.tgz", []byte("new"))
+	suite.Nil(err, "no error putting object")
+	_, err = suite.LocalBackend.GetObject("newchart/0.1.0/newchart-0.1.0.tgz")
+	suite.Nil(err, "object stored using configured layout")
+
+	objects, err := suite.LayoutBackend.ListObjects()
+	suite.Nil(err, "no error listing objects")
+	var paths []string
+	for _, object := range objects {
+		paths = append(paths, object.Path)
+	}
+	sort.Strings(paths)
+	suite.Equal([]string{"flatchart-0.1.0.tgz", "hashedchart-0.1.0.tgz", "index.yaml", "newchart-0.1.0.tgz"}, paths,
+		"objects from all layouts listed by filename, unknown keys skipped")
+
+	for _, filename := range []string{"flatchart-0.1.0.tgz", "hashedchart-0.1.0.tgz", "newchart-0.1.0.tgz"} {
+		object, err := suite.LayoutBackend.GetObject(filename)
+		suite.Nil(err, fmt.Sprintf("no error getting %s", filename))
+		suite.Equal(filename, object.Path, "object path is filename")
+	}
+
+	err = suite.LayoutBackend.DeleteObject("hashedchart-0.1.0.tgz")
+	suite.Nil(err, "no error deleting object stored using other layout")
+	_, err = suite.LayoutBackend.GetObject("hashedchart-0.1.0.tgz")
+	suite.NotNil(err, "deleted object is gone")
+
+	err = suite.LayoutBackend.DeleteObject("fakechart-0.1.0.tgz")
+	suite.NotNil(err, "error deleting object which does not exist")
+
+	objects, err = ListObjectsWithPrefix(suite.LayoutBackend, "some/")
+	suite.Nil(err, "no error listing objects below prefix")
+	suite.Equal(1, len(objects), "objects below prefix listed")
+	suite.Equal("some/unknown/nested/object.tgz", objects[0].Path, "objects below prefix listed by key")
+}
+
+// nestedChangeListerBackend reports the changes set by the test, like a backend with a change feed
+type nestedChangeListerBackend struct {
+	*LocalFilesystemBackend
+	changes ObjectChanges
+}
+
+func (b *nestedChangeListerBackend) ListNestedObjectsWithChangeToken() ([]Object, string, error) {
+	objects, err := b.ListNestedObjects()
+	return objects, "token", err
+}
+
+func (b *nestedChangeListerBackend) ListNestedChanges(token string) (ObjectChanges, error) {
+	return b.changes, nil
+}
+
+func (suite *LayoutTestSuite) TestLayoutBackendChanges() {
+	tempDirectory := suite.TempDirectory + "-changes"
+	defer os.RemoveAll(tempDirectory)
+	backend := &nestedChangeListerBackend{LocalFilesystemBackend: NewLocalFilesystemBackend(tempDirectory)}
+	for _, key := range []string{"mychart-0.1.0.tgz", "mychart/0.1.0/mychart-0.1.0.tgz", "other-0.1.0.tgz"} {
+		suite.Nil(backend.PutObject(key, []byte(key)), fmt.Sprintf("no error putting %s in local storage", key))
+	}
+	layoutBackend, err := NewLayoutBackend(backend, LayoutNameVersion)
+	suite.Nil(err, "no error creating layout backend")
+
+	objects, token, err := layoutBackend.ListObjectsWithChangeToken()
+	suite.Nil(err, "no error listing objects with change token")
+	suite.Equal("token", token, "change token of backend")
+	suite.Equal(2, len(objects), "objects listed by filename")
+
+	backend.DeleteObject("mychart/0.1.0/mychart-0.1.0.tgz")
+	backend.DeleteObject("other-0.1.0.tgz")
+	backend.changes = ObjectChanges{
+		Updated: []Object{{Path: "newchart/0.1.0/newchart-0.1.0.tgz"}, {Path: "some/unknown/key.tgz"}},
+		Removed: []string{"mychart/0.1.0/mychart-0.1.0.tgz", "other-0.1.0.tgz"},
+		Token:   "next",
+	}
+	changes, err := layoutBackend.ListChanges(token)
+	suite.Nil(err, "no error listing changes")
+	var updated []string
+	for _, object := range changes.Updated {
+		updated = append(updated, object.Path)
+	}
+	suite.Equal([]string{"newchart-0.1.0.tgz", "mychart-0.1.0.tgz"}, updated, "changes by filename, objects still stored using another layout updated")
+	suite.Equal([]string{"other-0.1.0.tgz"}, changes.Removed, "objects removed by filename")
+	suite.Equal("next", changes.Token, "next change token of backend")
+
+	_, token, err = suite.LayoutBackend.ListObjectsWithChangeToken()
+	suite.Nil(err, "no error listing objects of backend without changes")
+	suite.Empty(token, "no change token for backend without changes")
+	_, err = suite.LayoutBackend.ListChanges("token")
+	suite.Equal(ErrChangeTokenExpired, err, "no changes of backend without changes")
+}
+
+func TestLayoutTestSuite(t *testing.T) {
+	suite.Run(t, new(LayoutTestSuite))
+}
@@ -1,10 +1,13 @@
 package storage
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	pathutil "path"
+	"path/filepath"
 )
 
 // LocalFilesystemBackend is a storage backend for local filesystem storage
@@ -41,28 +44,101 @@ func (b LocalFilesystemBackend) ListObjects() ([]Object, error) {
 	return objects, nil
 }
 
+// ListObjectsWithContext lists all objects in root directory (depth 1), unless ctx is done
+func (b LocalFilesystemBackend) ListObjectsWithContext(ctx context.Context) ([]Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.ListObjects()
+}
+
+// ListNestedObjects lists all objects in root directory, including those below subdirectories
+func (b LocalFilesystemBackend) ListNestedObjects() ([]Object, error) {
+	return b.listObjectsBelow("")
+}
+
+// ListObjectsPage lists a page of the objects in root directory whose path starts with prefix,
+// including those below subdirectories
+func (b LocalFilesystemBackend) ListObjectsPage(prefix string, token string, max int) (ObjectPage, error) {
+	// only walk the deepest directory containing all objects with prefix
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i]
+	}
+	allObjects, err := b.listObjectsBelow(dir)
+	if os.IsNotExist(err) && dir != "" {
+		return ObjectPage{}, nil
+	}
+	if err != nil {
+		return ObjectPage{}, err
+	}
+	objects := []Object{}
+	for _, object := range allObjects {
+		if strings.HasPrefix(object.Path, prefix) {
+			objects = append(objects, object)
+		}
+	}
+	sortObjectsByPath(objects)
+	return pageOfObjects(objects, token, max), nil
+}
+
+// listObjectsBelow lists all objects below dir (relative to root directory), with paths relative to root directory
+func (b LocalFilesystemBackend) listObjectsBelow(dir string) ([]Object, error) {
+	var objects []Object
+	err := filepath.Walk(filepath.Join(b.RootDirectory, filepath.FromSlash(dir)), func(fullpath string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			return nil
+		}
+		path, err := filepath.Rel(b.RootDirectory, fullpath)
+		if err != nil {
+			return err
+		}
+		object := Object{Path: filepath.ToSlash(path), Content: []byte{}, LastModified: f.ModTime()}
+		objects = append(objects, object)
+		return nil
+	})
+	return objects, err
+}
+
 // GetObject retrieves an object from root directory
 func (b LocalFilesystemBackend) GetObject(path string) (Object, error) {
+	return b.GetObjectWithContext(context.Background(), path)
+}
+
+// GetObjectWithContext retrieves an object from root directory, giving up when ctx is done
+func (b LocalFilesystemBackend) GetObjectWithContext(ctx context.Context, path string) (Object, error) {
 	var object Object
 	object.Path = path
 	fullpath := pathutil.Join(b.RootDirectory, path)
-	content, err := ioutil.ReadFile(fullpath)
+	f, err := os.Open(fullpath)
 	if err != nil {
 		return object, err
 	}
-	object.Content = content
-	info, err := os.Stat(fullpath)
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return object, err
+	}
+	content, err := readAllWithContext(ctx, f)
 	if err != nil {
 		return object, err
 	}
+	object.Content = content
 	object.LastModified = info.ModTime()
-	return object, err
+	return object, nil
 }
 
 // PutObject puts an object in root directory
 func (b LocalFilesystemBackend) PutObject(path string, content []byte) error {
 	fullpath := pathutil.Join(b.RootDirectory, path)
-	err := ioutil.WriteFile(fullpath, content, 0644)
+	err := os.MkdirAll(pathutil.Dir(fullpath), 0777)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(fullpath, content, 0644)
 	return err
 }
 
@@ -33,6 +33,44 @@ func (suite *LocalTestSuite) TestGetObject() {
 	suite.NotNil(err, "cannot get objects with bad path")
 }
 
+func (suite *LocalTestSuite) TestListObjectsPage() {
+	timestamp := time.Now().Format("20060102150405")
+	tempDirectory := fmt.Sprintf("../../.test/storage-local/%s-pages", timestamp)
+	defer os.RemoveAll(tempDirectory)
+	backend := NewLocalFilesystemBackend(tempDirectory)
+	for _, path := range []string{"a.tgz", "staging/b.tgz", "staging/a.tgz", "staging/sub/c.tgz", "staging2/d.tgz"} {
+		suite.Nil(backend.PutObject(path, []byte(path)), fmt.Sprintf("no error putting %s", path))
+	}
+
+	paths := func(objects []Object) []string {
+		result := []string{}
+		for _, object := range objects {
+			result = append(result, object.Path)
+		}
+		return result
+	}
+
+	page, err := backend.ListObjectsPage("staging/", "", 2)
+	suite.Nil(err, "no error listing first page")
+	suite.Equal([]string{"staging/a.tgz", "staging/b.tgz"}, paths(page.Objects), "first page")
+	suite.Equal("staging/b.tgz", page.NextToken, "token for the next page")
+	page, err = backend.ListObjectsPage("staging/", page.NextToken, 2)
+	suite.Nil(err, "no error listing last page")
+	suite.Equal([]string{"staging/sub/c.tgz"}, paths(page.Objects), "last page")
+	suite.Empty(page.NextToken, "no token after the last page")
+
+	page, err = backend.ListObjectsPage("missing/", "", 0)
+	suite.Nil(err, "no error listing missing prefix")
+	suite.Empty(page.Objects, "no objects below missing prefix")
+
+	objects, err := ListObjectsWithPrefix(backend, "staging")
+	suite.Nil(err, "no error listing objects with prefix")
+	suite.Equal([]string{"staging/a.tgz", "staging/b.tgz", "staging/sub/c.tgz", "staging2/d.tgz"}, paths(objects), "all pages listed")
+
+	_, err = ListObjectsWithPrefix(struct{ Backend }{backend}, "staging/")
+	suite.Equal(ErrPrefixListingUnsupported, err, "backend without nested listing")
+}
+
 func TestLocalStorageTestSuite(t *testing.T) {
 	suite.Run(t, new(LocalTestSuite))
 }
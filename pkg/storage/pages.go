@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// defaultPageSize is how many objects are listed per page by PageListers when not told
+const defaultPageSize = 1000
+
+// ErrPrefixListingUnsupported is returned by ListObjectsWithPrefix for backends which can't list
+// objects below subdirectories
+var ErrPrefixListingUnsupported = errors.New("storage backend does not support listing objects below a prefix")
+
+// ListObjectsWithPrefix lists the objects in backend whose path starts with prefix, including
+// those below subdirectories, in path order. PageListers are only asked for the objects below
+// prefix, page by page, while other backends are listed in full and filtered.
+func ListObjectsWithPrefix(backend Backend, prefix string) ([]Object, error) {
+	if lister, ok := backend.(PageLister); ok {
+		objects := []Object{}
+		token := ""
+		for {
+			page, err := lister.ListObjectsPage(prefix, token, 0)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, page.Objects...)
+			if page.NextToken == "" {
+				return objects, nil
+			}
+			token = page.NextToken
+		}
+	}
+	lister, ok := backend.(NestedLister)
+	if !ok {
+		return nil, ErrPrefixListingUnsupported
+	}
+	allObjects, err := lister.ListNestedObjects()
+	if err != nil {
+		return nil, err
+	}
+	objects := []Object{}
+	for _, object := range allObjects {
+		if strings.HasPrefix(object.Path, prefix) {
+			objects = append(objects, object)
+		}
+	}
+	sortObjectsByPath(objects)
+	return objects, nil
+}
+
+// pageOfObjects returns the page of objects (sorted by path) starting after the path in token
+func pageOfObjects(objects []Object, token string, max int) ObjectPage {
+	if max <= 0 {
+		max = defaultPageSize
+	}
+	start := 0
+	if token != "" {
+		start = sort.Search(len(objects), func(i int) bool {
+			return objects[i].Path > token
+		})
+	}
+	page := ObjectPage{Objects: objects[start:]}
+	if len(page.Objects) > max {
+		page.Objects = page.Objects[:max]
+		page.NextToken = page.Objects[max-1].Path
+	}
+	return page
+}
+
+func sortObjectsByPath(objects []Object) {
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Path < objects[j].Path
+	})
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"sync"
+)
+
+// hexBoundaries split keys starting with a hex digit (like those of the hashed layout) into 16
+// ranges of roughly the same size
+var hexBoundaries = []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "a", "b", "c", "d", "e", "f"}
+
+// ListObjectsInParallel lists all objects of a PageLister, including those below subdirectories, in
+// path order. The key space is split into ranges at boundaries (sorted), each listed concurrently, so
+// that scanning a very large bucket takes about as long as listing its largest range.
+func ListObjectsInParallel(lister PageLister, boundaries []string) ([]Object, error) {
+	shards := make([][]Object, len(boundaries)+1)
+	errs := make([]error, len(boundaries)+1)
+	var wg sync.WaitGroup
+	for i := range shards {
+		start, end := "", ""
+		if i > 0 {
+			start = boundaries[i-1]
+		}
+		if i < len(boundaries) {
+			end = boundaries[i]
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			shards[i], errs[i] = listObjectsRange(lister, start, end)
+		}(i)
+	}
+	wg.Wait()
+
+	var objects []Object
+	for i, shard := range shards {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		objects = append(objects, shard...)
+	}
+	return objects, nil
+}
+
+// listObjectsRange lists the objects whose path is at least start and before end (if not empty)
+func listObjectsRange(lister PageLister, start string, end string) ([]Object, error) {
+	var objects []Object
+	token := tokenBefore(start)
+	for {
+		page, err := lister.ListObjectsPage("", token, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Objects {
+			if object.Path < start {
+				continue
+			}
+			if end != "" && object.Path >= end {
+				return objects, nil
+			}
+			objects = append(objects, object)
+		}
+		if page.NextToken == "" {
+			return objects, nil
+		}
+		token = page.NextToken
+	}
+}
+
+// tokenBefore returns a page token from which listing starts at path (tokens are the path listing
+// starts after): path with its last byte decremented, followed by the greatest rune, which sorts
+// after any path sharing that beginning
+func tokenBefore(path string) string {
+	if path == "" {
+		return ""
+	}
+	last := path[len(path)-1]
+	if last == 0 {
+		return path[:len(path)-1]
+	}
+	return path[:len(path)-1] + string([]byte{last - 1}) + string(rune(0x10FFFF))
+}
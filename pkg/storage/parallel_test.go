@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ParallelTestSuite struct {
+	suite.Suite
+	TempDirectory string
+	LocalBackend  *LocalFilesystemBackend
+}
+
+func (suite *ParallelTestSuite) SetupSuite() {
+	timestamp := time.Now().Format("20060102150405")
+	suite.TempDirectory = fmt.Sprintf("../../.test/storage-parallel/%s", timestamp)
+	suite.LocalBackend = NewLocalFilesystemBackend(suite.TempDirectory)
+	for i := 0; i < 50; i++ {
+		filename := fmt.Sprintf("chart%d-0.1.0.tgz", i)
+		err := suite.LocalBackend.PutObject(ObjectKey(LayoutHashed, filename), []byte(filename))
+		suite.Nil(err, fmt.Sprintf("no error putting %s", filename))
+	}
+	for _, key := range []string{"flatchart-0.1.0.tgz", ObjectKey(LayoutNameVersion, "nvchart-0.1.0.tgz"), "index.yaml", "0"} {
+		err := suite.LocalBackend.PutObject(key, []byte(key))
+		suite.Nil(err, fmt.Sprintf("no error putting %s", key))
+	}
+}
+
+func (suite *ParallelTestSuite) TearDownSuite() {
+	os.RemoveAll(suite.TempDirectory)
+}
+
+func (suite *ParallelTestSuite) TestListObjectsInParallel() {
+	expected, err := suite.LocalBackend.ListNestedObjects()
+	suite.Nil(err, "no error listing nested objects")
+	sortObjectsByPath(expected)
+
+	objects, err := ListObjectsInParallel(suite.LocalBackend, hexBoundaries)
+	suite.Nil(err, "no error listing objects in parallel")
+	suite.Equal(expected, objects, "all objects listed once, in path order")
+}
+
+func (suite *ParallelTestSuite) TestLayoutBackendParallelListing() {
+	names := func(backend *LayoutBackend) []string {
+		objects, err := backend.ListObjects()
+		suite.Nil(err, "no error listing objects")
+		result := []string{}
+		for _, object := range objects {
+			result = append(result, object.Path)
+		}
+		sort.Strings(result)
+		return result
+	}
+	backend, err := NewLayoutBackend(suite.LocalBackend, LayoutHashed)
+	suite.Nil(err, "no error creating layout backend")
+	expected := names(backend)
+	backend.ParallelListing = true
+	suite.Equal(expected, names(backend), "same objects listed in parallel")
+	suite.Contains(expected, "flatchart-0.1.0.tgz", "objects stored using other layouts listed")
+}
+
+func (suite *ParallelTestSuite) TestTokenBefore() {
+	suite.Equal("", tokenBefore(""), "no token to start from the beginning")
+	suite.True(tokenBefore("1") < "1", "token before boundary")
+	suite.True(tokenBefore("1") > "0ff/ff/chart.tgz", "token after keys before boundary")
+}
+
+func TestParallelTestSuite(t *testing.T) {
+	suite.Run(t, new(ParallelTestSuite))
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"errors"
+	pathutil "path"
+	"strings"
+)
+
+// PublishResult summarizes what PublishObjects changed in the target backend
+type PublishResult struct {
+	Copied    int `json:"copied"`
+	Deleted   int `json:"deleted"`
+	Unchanged int `json:"unchanged"`
+}
+
+var errPublishNotNested = errors.New("publish backend does not support listing subdirectories")
+
+// PublishObjects mirrors the objects in source with one of the given extensions to the directory
+// prefix of target, e.g. for serving them from a static site. Objects already in target are only
+// copied again if they changed since, and objects no longer in source are deleted from target.
+func PublishObjects(source Backend, target Backend, prefix string, extensions []string) (PublishResult, error) {
+	var result PublishResult
+	targetObjects, err := ListObjectsWithPrefix(target, prefix+"/")
+	if err == ErrPrefixListingUnsupported {
+		return result, errPublishNotNested
+	}
+	if err != nil {
+		return result, err
+	}
+	published := map[string]Object{}
+	for _, object := range targetObjects {
+		published[strings.TrimPrefix(object.Path, prefix+"/")] = object
+	}
+
+	sourceObjects, err := source.ListObjects()
+	if err != nil {
+		return result, err
+	}
+	for _, object := range sourceObjects {
+		if !hasOneOfExtensions(object, extensions) {
+			continue
+		}
+		if p, ok := published[object.Path]; ok {
+			delete(published, object.Path)
+			if sameDigest(object, p) || (!publishDigestsComparable(object, p) && !p.LastModified.Before(object.LastModified)) {
+				result.Unchanged++
+				continue
+			}
+		}
+		object, err = source.GetObject(object.Path)
+		if err != nil {
+			return result, err
+		}
+		err = target.PutObject(pathutil.Join(prefix, object.Path), object.Content)
+		if err != nil {
+			return result, err
+		}
+		result.Copied++
+	}
+
+	for path, object := range published {
+		if !hasOneOfExtensions(object, extensions) {
+			continue
+		}
+		err = target.DeleteObject(pathutil.Join(prefix, path))
+		if err != nil {
+			return result, err
+		}
+		result.Deleted++
+	}
+	return result, nil
+}
+
+func hasOneOfExtensions(object Object, extensions []string) bool {
+	for _, extension := range extensions {
+		if strings.HasSuffix(object.Path, "."+extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// publishDigestsComparable is true if both objects have a digest, which can be used instead of
+// modification times (only meaningful within the same kind of backend, e.g. S3 ETags)
+func publishDigestsComparable(o1 Object, o2 Object) bool {
+	return o1.Digest != "" && o2.Digest != ""
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PublishTestSuite struct {
+	suite.Suite
+	TempDirectory  string
+	SourceBackend  *LocalFilesystemBackend
+	PublishBackend *LocalFilesystemBackend
+}
+
+func (suite *PublishTestSuite) SetupTest() {
+	timestamp := time.Now().Format("20060102150405.000000")
+	suite.TempDirectory = fmt.Sprintf("../../.test/storage-publish/%s", timestamp)
+	suite.SourceBackend = NewLocalFilesystemBackend(fmt.Sprintf("%s/source", suite.TempDirectory))
+	suite.PublishBackend = NewLocalFilesystemBackend(fmt.Sprintf("%s/publish", suite.TempDirectory))
+
+	suite.Nil(suite.SourceBackend.PutObject("mychart-0.1.0.tgz", []byte("chart")), "no error putting object")
+	suite.Nil(suite.SourceBackend.PutObject("mychart-0.1.0.tgz.prov", []byte("prov")), "no error putting object")
+	suite.Nil(suite.SourceBackend.PutObject("index.yaml", []byte("index")), "no error putting object")
+}
+
+func (suite *PublishTestSuite) TearDownTest() {
+	os.RemoveAll(suite.TempDirectory)
+}
+
+func (suite *PublishTestSuite) TestPublishObjects() {
+	extensions := []string{"tgz", "tgz.prov"}
+	result, err := PublishObjects(suite.SourceBackend, suite.PublishBackend, "charts", extensions)
+	suite.Nil(err, "no error publishing objects")
+	suite.Equal(PublishResult{Copied: 2}, result, "chart and provenance file copied")
+
+	object, err := suite.PublishBackend.GetObject("charts/mychart-0.1.0.tgz")
+	suite.Nil(err, "no error getting published chart")
+	suite.Equal([]byte("chart"), object.Content, "chart published")
+	_, err = suite.PublishBackend.GetObject("charts/index.yaml")
+	suite.NotNil(err, "objects with other extensions not published")
+
+	result, err = PublishObjects(suite.SourceBackend, suite.PublishBackend, "charts", extensions)
+	suite.Nil(err, "no error publishing objects again")
+	suite.Equal(PublishResult{Unchanged: 2}, result, "unchanged objects not copied again")
+
+	suite.Nil(suite.SourceBackend.PutObject("mychart-0.2.0.tgz", []byte("chart")), "no error putting object")
+	suite.Nil(suite.SourceBackend.DeleteObject("mychart-0.1.0.tgz.prov"), "no error deleting object")
+	suite.Nil(suite.PublishBackend.PutObject("charts/README.md", []byte("readme")), "no error putting object")
+	result, err = PublishObjects(suite.SourceBackend, suite.PublishBackend, "charts", extensions)
+	suite.Nil(err, "no error publishing changed objects")
+	suite.Equal(PublishResult{Copied: 1, Deleted: 1, Unchanged: 1}, result, "new object copied and removed object deleted")
+	_, err = suite.PublishBackend.GetObject("charts/mychart-0.1.0.tgz.prov")
+	suite.NotNil(err, "removed object deleted from publish backend")
+	_, err = suite.PublishBackend.GetObject("charts/README.md")
+	suite.Nil(err, "objects with other extensions left alone")
+
+	_, err = PublishObjects(suite.SourceBackend, NewFederatedBackend(suite.PublishBackend), "charts", extensions)
+	suite.NotNil(err, "error publishing to backend without nested listing")
+}
+
+func TestPublishTestSuite(t *testing.T) {
+	suite.Run(t, new(PublishTestSuite))
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	pathutil "path"
+	"strings"
+)
+
+// RestoreBackupSnapshot copies all objects of the snapshot with the given id from backup to target,
+// verifying each against the digest in the snapshot's manifest before writing it
+func RestoreBackupSnapshot(backup Backend, id string, target Backend) (BackupManifest, error) {
+	manifest, err := GetBackupManifest(backup, id)
+	if err != nil {
+		return manifest, err
+	}
+	for path := range manifest.Objects {
+		if isUnsafeObjectPath(path) {
+			return manifest, fmt.Errorf("unsafe path %q in backup snapshot %s", path, id)
+		}
+	}
+	for path, digest := range manifest.Objects {
+		object, err := backup.GetObject(backupObjectPath(id, path))
+		if err != nil {
+			return manifest, err
+		}
+		if backupDigest(object.Content) != digest {
+			return manifest, fmt.Errorf("digest mismatch for %s in backup snapshot %s", path, id)
+		}
+		err = target.PutObject(path, object.Content)
+		if err != nil {
+			return manifest, err
+		}
+	}
+	return manifest, nil
+}
+
+// RestoreBackupArchive copies all files in a gzipped tarball to target. If the archive contains
+// a manifest (e.g. a tarball of a backup snapshot directory), all files are verified against it
+// before anything is written.
+func RestoreBackupArchive(r io.Reader, target Backend) (BackupManifest, error) {
+	manifest := BackupManifest{Objects: map[string]string{}}
+	files, err := readBackupArchive(r)
+	if err != nil {
+		return manifest, err
+	}
+
+	// files may be below the directory containing the manifest
+	prefix := ""
+	hasManifest := false
+	for path, content := range files {
+		if pathutil.Base(path) == BackupManifestFileName {
+			err = json.Unmarshal(content, &manifest)
+			if err != nil {
+				return manifest, err
+			}
+			prefix = strings.TrimSuffix(path, BackupManifestFileName)
+			hasManifest = true
+			break
+		}
+	}
+
+	if hasManifest {
+		for path, digest := range manifest.Objects {
+			content, ok := files[prefix+path]
+			if !ok {
+				return manifest, fmt.Errorf("%s listed in manifest but missing from archive", path)
+			}
+			if backupDigest(content) != digest {
+				return manifest, fmt.Errorf("digest mismatch for %s in archive", path)
+			}
+		}
+	} else {
+		for path, content := range files {
+			manifest.Objects[path] = backupDigest(content)
+		}
+	}
+	for path := range manifest.Objects {
+		if isUnsafeObjectPath(path) {
+			return manifest, fmt.Errorf("unsafe path %q in archive", path)
+		}
+	}
+
+	for path := range manifest.Objects {
+		err = target.PutObject(path, files[prefix+path])
+		if err != nil {
+			return manifest, err
+		}
+	}
+	return manifest, nil
+}
+
+func readBackupArchive(r io.Reader) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return files, err
+	}
+	defer gzr.Close()
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return files, err
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return files, err
+		}
+		files[strings.TrimPrefix(header.Name, "./")] = content
+	}
+	return files, nil
+}
+
+// isUnsafeObjectPath checks whether a path from a backup would be written outside of the target
+// backend, e.g. "/etc/passwd" or "../x"
+func isUnsafeObjectPath(path string) bool {
+	path = strings.Replace(path, "\\", "/", -1)
+	if path == "" || strings.HasPrefix(path, "/") {
+		return true
+	}
+	cleaned := pathutil.Clean(path)
+	return cleaned == ".." || strings.HasPrefix(cleaned, "../")
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RestoreTestSuite struct {
+	suite.Suite
+	TempDirectory string
+	SourceBackend *LocalFilesystemBackend
+	BackupBackend *LocalFilesystemBackend
+	TargetBackend *LocalFilesystemBackend
+}
+
+func (suite *RestoreTestSuite) SetupTest() {
+	timestamp := time.Now().Format("20060102150405.000000")
+	suite.TempDirectory = fmt.Sprintf("../../.test/storage-restore/%s", timestamp)
+	suite.SourceBackend = NewLocalFilesystemBackend(fmt.Sprintf("%s/source", suite.TempDirectory))
+	suite.BackupBackend = NewLocalFilesystemBackend(fmt.Sprintf("%s/backup", suite.TempDirectory))
+	suite.TargetBackend = NewLocalFilesystemBackend(fmt.Sprintf("%s/target", suite.TempDirectory))
+
+	suite.Nil(suite.SourceBackend.PutObject("mychart-0.1.0.tgz", []byte("chart")), "no error putting object")
+}
+
+func (suite *RestoreTestSuite) TearDownTest() {
+	os.RemoveAll(suite.TempDirectory)
+}
+
+func (suite *RestoreTestSuite) TestRestoreBackupSnapshot() {
+	manifest, err := CreateBackupSnapshot(suite.SourceBackend, suite.BackupBackend, nil)
+	suite.Nil(err, "no error creating backup snapshot")
+
+	_, err = RestoreBackupSnapshot(suite.BackupBackend, manifest.ID, suite.TargetBackend)
+	suite.Nil(err, "no error restoring backup snapshot")
+	object, err := suite.TargetBackend.GetObject("mychart-0.1.0.tgz")
+	suite.Nil(err, "no error getting restored object")
+	suite.Equal([]byte("chart"), object.Content, "object restored")
+
+	_, err = RestoreBackupSnapshot(suite.BackupBackend, "19700101000000", suite.TargetBackend)
+	suite.NotNil(err, "error restoring missing snapshot")
+
+	err = suite.BackupBackend.PutObject(fmt.Sprintf("%s/mychart-0.1.0.tgz", manifest.ID), []byte("tampered"))
+	suite.Nil(err, "no error tampering with backup")
+	_, err = RestoreBackupSnapshot(suite.BackupBackend, manifest.ID, suite.TargetBackend)
+	suite.NotNil(err, "error restoring tampered snapshot")
+}
+
+func (suite *RestoreTestSuite) TestRestoreBackupArchive() {
+	archive := testBackupArchive(map[string]string{"./mychart-0.1.0.tgz": "chart"})
+	manifest, err := RestoreBackupArchive(archive, suite.TargetBackend)
+	suite.Nil(err, "no error restoring archive without manifest")
+	suite.Equal(1, len(manifest.Objects), "object restored")
+	_, err = suite.TargetBackend.GetObject("mychart-0.1.0.tgz")
+	suite.Nil(err, "no error getting restored object")
+
+	manifestContent := fmt.Sprintf(`{"id":"20170101000000","objects":{"other-0.1.0.tgz":"%s"}}`, backupDigest([]byte("other")))
+	archive = testBackupArchive(map[string]string{
+		"20170101000000/other-0.1.0.tgz": "other",
+		"20170101000000/manifest.json":   manifestContent,
+	})
+	_, err = RestoreBackupArchive(archive, suite.TargetBackend)
+	suite.Nil(err, "no error restoring archive of snapshot directory")
+	_, err = suite.TargetBackend.GetObject("other-0.1.0.tgz")
+	suite.Nil(err, "no error getting object restored from snapshot directory")
+
+	archive = testBackupArchive(map[string]string{
+		"another-0.1.0.tgz": "tampered",
+		"manifest.json":     fmt.Sprintf(`{"objects":{"another-0.1.0.tgz":"%s"}}`, backupDigest([]byte("another"))),
+	})
+	_, err = RestoreBackupArchive(archive, suite.TargetBackend)
+	suite.NotNil(err, "error restoring tampered archive")
+	_, err = suite.TargetBackend.GetObject("another-0.1.0.tgz")
+	suite.NotNil(err, "nothing restored from tampered archive")
+
+	_, err = RestoreBackupArchive(bytes.NewBufferString("not a tarball"), suite.TargetBackend)
+	suite.NotNil(err, "error restoring invalid archive")
+}
+
+func (suite *RestoreTestSuite) TestRestorePathTraversal() {
+	for _, name := range []string{"../escaped.tgz", "charts/../../escaped.tgz", "/escaped.tgz"} {
+		_, err := RestoreBackupArchive(testBackupArchive(map[string]string{name: "evil"}), suite.TargetBackend)
+		suite.NotNil(err, "error restoring archive with entry "+name)
+		manifest := fmt.Sprintf(`{"objects":{%q:"%s"}}`, name, backupDigest([]byte("evil")))
+		_, err = RestoreBackupArchive(testBackupArchive(map[string]string{name: "evil", "manifest.json": manifest}), suite.TargetBackend)
+		suite.NotNil(err, "error restoring archive with manifest listing "+name)
+	}
+
+	suite.Nil(suite.BackupBackend.PutObject("20170101000000/manifest.json",
+		[]byte(fmt.Sprintf(`{"id":"20170101000000","objects":{"../../escaped.tgz":"%s"}}`, backupDigest([]byte("evil"))))), "no error putting manifest")
+	suite.Nil(suite.BackupBackend.PutObject("escaped.tgz", []byte("evil")), "no error putting object")
+	_, err := RestoreBackupSnapshot(suite.BackupBackend, "20170101000000", suite.TargetBackend)
+	suite.NotNil(err, "error restoring snapshot with path outside of the target")
+
+	_, err = os.Stat(fmt.Sprintf("%s/escaped.tgz", suite.TempDirectory))
+	suite.True(os.IsNotExist(err), "nothing written outside of the target")
+}
+
+func testBackupArchive(files map[string]string) *bytes.Buffer {
+	buf := bytes.NewBuffer(nil)
+	gzw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gzw)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gzw.Close()
+	return buf
+}
+
+func TestRestoreTestSuite(t *testing.T) {
+	suite.Run(t, new(RestoreTestSuite))
+}
@@ -13,6 +13,7 @@ type (
 		Path         string
 		Content      []byte
 		LastModified time.Time
+		Digest       string // fingerprint of the content provided by the backend when listing (e.g. ETag), if any
 	}
 
 	// ObjectSliceDiff provides information on what has changed since last calling ListObjects
@@ -21,6 +22,14 @@ type (
 		Removed []Object
 		Added   []Object
 		Updated []Object
+		Renamed []ObjectRename // objects moved to a new path, with unchanged content
+		Copied  []Object       // new objects with the same content as an existing object
+	}
+
+	// ObjectRename is an object which was moved from one path to another
+	ObjectRename struct {
+		From Object
+		To   Object
 	}
 
 	// Backend is a generic interface for storage backends
@@ -30,6 +39,27 @@ type (
 		PutObject(path string, content []byte) error
 		DeleteObject(path string) error
 	}
+
+	// NestedLister is implemented by backends which can also list objects below subdirectories,
+	// with paths relative to the root of the backend (e.g. "mychart/0.1.0/mychart-0.1.0.tgz")
+	NestedLister interface {
+		ListNestedObjects() ([]Object, error)
+	}
+
+	// PageLister is implemented by backends which can list the objects below a prefix one page at a
+	// time, so that listing part of a large backend doesn't require listing all of it
+	PageLister interface {
+		// ListObjectsPage lists up to max objects (or a default number, if max is 0) whose path starts
+		// with prefix, including those below subdirectories, in path order. The first page is listed
+		// with an empty token, the next ones with the token returned along with the previous page.
+		ListObjectsPage(prefix string, token string, max int) (ObjectPage, error)
+	}
+
+	// ObjectPage is a page of objects listed by a PageLister
+	ObjectPage struct {
+		Objects   []Object
+		NextToken string // empty on the last page
+	}
 )
 
 // HasExtension determines whether or not an object contains a file extension
@@ -37,40 +67,79 @@ func (object Object) HasExtension(extension string) bool {
 	return filepath.Ext(object.Path) == fmt.Sprintf(".%s", extension)
 }
 
-// GetObjectSliceDiff takes two objects slices and returns an ObjectSliceDiff
+// GetObjectSliceDiff takes two objects slices and returns an ObjectSliceDiff. When both objects
+// have a digest, it is used to tell whether content actually changed: objects with a new modification
+// time but the same digest are not updated, and removed or added objects with the same digest as another
+// object are reported as renamed or copied instead.
 func GetObjectSliceDiff(os1 []Object, os2 []Object) ObjectSliceDiff {
 	var diff ObjectSliceDiff
+	paths1 := map[string]Object{}
 	for _, o1 := range os1 {
-		found := false
-		for _, o2 := range os2 {
-			if o1.Path == o2.Path {
-				found = true
-				if o1.LastModified != o2.LastModified {
-					diff.Updated = append(diff.Updated, o2)
-				}
-				break
-			}
-		}
+		paths1[o1.Path] = o1
+	}
+	paths2 := map[string]Object{}
+	for _, o2 := range os2 {
+		paths2[o2.Path] = o2
+	}
+
+	var removed []Object
+	for _, o1 := range os1 {
+		o2, found := paths2[o1.Path]
 		if !found {
-			diff.Removed = append(diff.Removed, o1)
+			removed = append(removed, o1)
+			continue
+		}
+		if !o1.LastModified.Equal(o2.LastModified) && !sameDigest(o1, o2) {
+			diff.Updated = append(diff.Updated, o2)
 		}
 	}
+
+	// removed objects by digest, which are candidates for having been renamed
+	removedDigests := map[string][]Object{}
+	for _, o1 := range removed {
+		if o1.Digest != "" {
+			removedDigests[o1.Digest] = append(removedDigests[o1.Digest], o1)
+		}
+	}
+	// digests of all known content, which new objects may be copies of
+	knownDigests := map[string]bool{}
+	for _, o1 := range os1 {
+		if o1.Digest != "" {
+			knownDigests[o1.Digest] = true
+		}
+	}
+
+	renamed := map[string]bool{}
 	for _, o2 := range os2 {
-		found := false
-		for _, o1 := range os1 {
-			if o2.Path == o1.Path {
-				found = true
-				break
-			}
+		if _, found := paths1[o2.Path]; found {
+			continue
 		}
-		if !found {
-			diff.Added = append(diff.Added, o2)
+		if candidates := removedDigests[o2.Digest]; o2.Digest != "" && len(candidates) > 0 {
+			diff.Renamed = append(diff.Renamed, ObjectRename{From: candidates[0], To: o2})
+			renamed[candidates[0].Path] = true
+			removedDigests[o2.Digest] = candidates[1:]
+			continue
+		}
+		if o2.Digest != "" && knownDigests[o2.Digest] {
+			diff.Copied = append(diff.Copied, o2)
+			continue
+		}
+		diff.Added = append(diff.Added, o2)
+	}
+	for _, o1 := range removed {
+		if !renamed[o1.Path] {
+			diff.Removed = append(diff.Removed, o1)
 		}
 	}
-	diff.Change = len(diff.Removed)+len(diff.Added)+len(diff.Updated) > 0
+
+	diff.Change = len(diff.Removed)+len(diff.Added)+len(diff.Updated)+len(diff.Renamed)+len(diff.Copied) > 0
 	return diff
 }
 
+func sameDigest(o1 Object, o2 Object) bool {
+	return o1.Digest != "" && o1.Digest == o2.Digest
+}
+
 func cleanPrefix(prefix string) string {
 	return strings.Trim(prefix, "/")
 }
@@ -83,6 +152,9 @@ func removePrefixFromObjectPath(prefix string, path string) string {
 	return path
 }
 
-func objectPathIsInvalid(path string) bool {
+func objectPathIsInvalid(path string, nested bool) bool {
+	if nested {
+		return path == "" || strings.HasSuffix(path, "/")
+	}
 	return strings.Contains(path, "/") || path == ""
 }
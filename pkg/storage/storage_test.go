@@ -171,6 +171,35 @@ func (suite *StorageTestSuite) TestGetObjectSliceDiff() {
 	suite.Empty(diff.Updated, "updated slice empty")
 }
 
+func (suite *StorageTestSuite) TestGetObjectSliceDiffDigests() {
+	now := time.Now()
+	os1 := []Object{
+		{Path: "a.tgz", LastModified: now, Digest: "aaa"},
+		{Path: "b.tgz", LastModified: now, Digest: "bbb"},
+	}
+
+	os2 := []Object{
+		{Path: "a.tgz", LastModified: now.Add(1), Digest: "aaa"},
+		{Path: "b.tgz", LastModified: now.Add(1), Digest: "ccc"},
+	}
+	diff := GetObjectSliceDiff(os1, os2)
+	suite.Equal([]Object{os2[1]}, diff.Updated, "only object with new digest updated")
+
+	os2 = []Object{
+		{Path: "a.tgz", LastModified: now, Digest: "aaa"},
+		{Path: "moved/b.tgz", LastModified: now.Add(1), Digest: "bbb"},
+		{Path: "copy/a.tgz", LastModified: now.Add(1), Digest: "aaa"},
+		{Path: "c.tgz", LastModified: now.Add(1), Digest: "ccc"},
+	}
+	diff = GetObjectSliceDiff(os1, os2)
+	suite.True(diff.Change, "change detected")
+	suite.Empty(diff.Removed, "renamed object not removed")
+	suite.Equal([]ObjectRename{{From: os1[1], To: os2[1]}}, diff.Renamed, "renamed slice populated")
+	suite.Equal([]Object{os2[2]}, diff.Copied, "copied slice populated")
+	suite.Equal([]Object{os2[3]}, diff.Added, "added slice populated")
+	suite.Empty(diff.Updated, "updated slice empty")
+}
+
 func TestStorageTestSuite(t *testing.T) {
 	suite.Run(t, new(StorageTestSuite))
 }
@@ -0,0 +1,83 @@
+package systemd
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// listenFdsStart is the first file descriptor passed by socket activation (after stdin, stdout and stderr)
+	listenFdsStart = 3
+
+	// NotifyReady tells systemd that startup is finished (for units with Type=notify)
+	NotifyReady = "READY=1"
+
+	// NotifyStopping tells systemd that the service is shutting down
+	NotifyStopping = "STOPPING=1"
+)
+
+// ErrNoNotifySocket is returned by Notify when the process was not started by systemd with NotifyAccess
+var ErrNoNotifySocket = errors.New("NOTIFY_SOCKET is not set")
+
+// Listeners returns the listening sockets passed by systemd socket activation, by name as set with
+// FileDescriptorName= in the socket unit (systemd names sockets without one "unknown"). It returns
+// no listeners if the process was not socket activated. The environment variables describing the
+// sockets are unset, so they are not inherited by child processes.
+func Listeners() (map[string][]net.Listener, error) {
+	defer unsetListenEnv()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := map[string][]net.Listener{}
+	for i := 0; i < count; i++ {
+		fd := listenFdsStart + i
+		closeOnExec(fd)
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		file.Close() // FileListener duplicates the descriptor
+		if err != nil {
+			return nil, err
+		}
+		listeners[name] = append(listeners[name], listener)
+	}
+	return listeners, nil
+}
+
+func unsetListenEnv() {
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+}
+
+// Notify sends a state (e.g. NotifyReady) to the socket in NOTIFY_SOCKET, returning
+// ErrNoNotifySocket if it is not set
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return ErrNoNotifySocket
+	}
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:] // abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
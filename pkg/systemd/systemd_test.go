@@ -0,0 +1,64 @@
+package systemd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SystemdTestSuite struct {
+	suite.Suite
+	TempDirectory string
+}
+
+func (suite *SystemdTestSuite) SetupSuite() {
+	tempDirectory, err := ioutil.TempDir("", "systemd-test")
+	suite.Nil(err, "no error creating temp directory")
+	suite.TempDirectory = tempDirectory
+}
+
+func (suite *SystemdTestSuite) TearDownSuite() {
+	os.RemoveAll(suite.TempDirectory)
+}
+
+func (suite *SystemdTestSuite) TestListeners() {
+	os.Unsetenv("LISTEN_PID")
+	listeners, err := Listeners()
+	suite.Nil(err, "no error without socket activation")
+	suite.Empty(listeners, "no listeners without socket activation")
+
+	// sockets passed to another process
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	listeners, err = Listeners()
+	suite.Nil(err, "no error with sockets for another process")
+	suite.Empty(listeners, "no listeners with sockets for another process")
+	suite.Empty(os.Getenv("LISTEN_FDS"), "LISTEN_FDS unset")
+}
+
+func (suite *SystemdTestSuite) TestNotify() {
+	os.Unsetenv("NOTIFY_SOCKET")
+	suite.Equal(ErrNoNotifySocket, Notify(NotifyReady), "error without NOTIFY_SOCKET")
+
+	path := filepath.Join(suite.TempDirectory, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	suite.Nil(err, "no error listening on notify socket")
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	suite.Nil(Notify(NotifyReady), "no error notifying")
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	suite.Nil(err, "no error reading notification")
+	suite.Equal("READY=1", string(buf[:n]), "readiness sent")
+}
+
+func TestSystemdTestSuite(t *testing.T) {
+	suite.Run(t, new(SystemdTestSuite))
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package systemd
+
+import (
+	"syscall"
+)
+
+// closeOnExec keeps a passed socket from being inherited by child processes
+func closeOnExec(fd int) {
+	syscall.CloseOnExec(fd)
+}
@@ -0,0 +1,7 @@
+//go:build windows
+// +build windows
+
+package systemd
+
+// closeOnExec does nothing, as there is no socket activation on windows
+func closeOnExec(fd int) {}
@@ -0,0 +1,14 @@
+// Package winsvc runs ChartMuseum as a Windows service: it installs and removes the service, handles
+// requests from the service control manager, and writes logs to the Windows event log. On other
+// platforms, only IsWindowsService is usable (and always returns false).
+package winsvc
+
+import (
+	"errors"
+)
+
+// DefaultName is the name the service is installed under, and the event log source of its logs
+const DefaultName = "chartmuseum"
+
+// ErrNotSupported is returned on platforms other than Windows
+var ErrNotSupported = errors.New("windows services are only supported on windows")
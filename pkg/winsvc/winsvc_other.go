@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package winsvc
+
+import (
+	"go.uber.org/zap/zapcore"
+)
+
+// IsWindowsService reports whether the process was started by the Windows service control manager
+func IsWindowsService() (bool, error) {
+	return false, nil
+}
+
+// Run serves the service name until the service control manager stops it
+func Run(name string, serve func()) error {
+	return ErrNotSupported
+}
+
+// Install registers the running executable as the service name, started with args
+func Install(name string, args []string) error {
+	return ErrNotSupported
+}
+
+// Uninstall removes the service name
+func Uninstall(name string) error {
+	return ErrNotSupported
+}
+
+// NewEventLogCore returns a zap core writing log entries to the event log as source name
+func NewEventLogCore(name string, encoder zapcore.Encoder, enabler zapcore.LevelEnabler) (zapcore.Core, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package winsvc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap/zapcore"
+)
+
+type WinsvcTestSuite struct {
+	suite.Suite
+}
+
+func (suite *WinsvcTestSuite) TestNotSupported() {
+	isService, err := IsWindowsService()
+	suite.Nil(err, "no error checking for windows service")
+	suite.False(isService, "never a windows service")
+
+	suite.Equal(ErrNotSupported, Run(DefaultName, func() {}), "cannot run as a service")
+	suite.Equal(ErrNotSupported, Install(DefaultName, nil), "cannot install a service")
+	suite.Equal(ErrNotSupported, Uninstall(DefaultName), "cannot uninstall a service")
+	_, err = NewEventLogCore(DefaultName, zapcore.NewJSONEncoder(zapcore.EncoderConfig{}), zapcore.InfoLevel)
+	suite.Equal(ErrNotSupported, err, "no event log")
+}
+
+func TestWinsvcTestSuite(t *testing.T) {
+	suite.Run(t, new(WinsvcTestSuite))
+}
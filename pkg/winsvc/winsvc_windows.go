@@ -0,0 +1,163 @@
+//go:build windows
+// +build windows
+
+package winsvc
+
+import (
+	"fmt"
+	"os"
+
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	displayName = "ChartMuseum"
+	description = "Helm Chart Repository"
+
+	// eventID is the id of all events logged, as messages are not registered in a message file
+	eventID = 1
+)
+
+type (
+	// handler serves the service until it is asked to stop
+	handler struct {
+		serve func()
+	}
+
+	// eventLogCore writes log entries to the event log, with the event type matching their level
+	eventLogCore struct {
+		zapcore.LevelEnabler
+		encoder zapcore.Encoder
+		log     *eventlog.Log
+	}
+)
+
+// IsWindowsService reports whether the process was started by the Windows service control manager
+func IsWindowsService() (bool, error) {
+	return svc.IsWindowsService()
+}
+
+// Run serves the service name until the service control manager stops it
+func Run(name string, serve func()) error {
+	return svc.Run(name, &handler{serve: serve})
+}
+
+// Execute starts serving, then answers requests from the service control manager until asked to stop
+func (h *handler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.StartPending}
+	go h.serve()
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			status <- request.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// Install registers the running executable as the service name, started with args, along with
+// an event log source of the same name
+func Install(name string, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", name)
+	}
+	config := mgr.Config{
+		DisplayName: displayName,
+		Description: description,
+		StartType:   mgr.StartAutomatic,
+	}
+	s, err = m.CreateService(name, exe, config, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	err = eventlog.InstallAsEventCreate(name, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil {
+		s.Delete()
+		return err
+	}
+	return nil
+}
+
+// Uninstall removes the service name and its event log source
+func Uninstall(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+	err = s.Delete()
+	if err != nil {
+		return err
+	}
+	return eventlog.Remove(name)
+}
+
+// NewEventLogCore returns a zap core writing log entries to the event log as source name
+func NewEventLogCore(name string, encoder zapcore.Encoder, enabler zapcore.LevelEnabler) (zapcore.Core, error) {
+	log, err := eventlog.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLogCore{LevelEnabler: enabler, encoder: encoder, log: log}, nil
+}
+
+func (c *eventLogCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.encoder = c.encoder.Clone()
+	for _, field := range fields {
+		field.AddTo(clone.encoder)
+	}
+	return &clone
+}
+
+func (c *eventLogCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *eventLogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.encoder.EncodeEntry(entry, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+	switch {
+	case entry.Level >= zapcore.ErrorLevel:
+		return c.log.Error(eventID, buf.String())
+	case entry.Level == zapcore.WarnLevel:
+		return c.log.Warning(eventID, buf.String())
+	default:
+		return c.log.Info(eventID, buf.String())
+	}
+}
+
+func (c *eventLogCore) Sync() error {
+	return nil
+}